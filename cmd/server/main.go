@@ -1,24 +1,147 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"remote-iptv/internal/api"
 	"remote-iptv/internal/db"
+	"remote-iptv/internal/imagecache"
 	"remote-iptv/internal/player"
-
-
+	"remote-iptv/internal/redact"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "rotate-key":
+			if err := rotateKey(databasePath()); err != nil {
+				log.Fatalf("Key rotation failed: %v", err)
+			}
+			return
+		case "schema-version":
+			if err := printSchemaStatus(databasePath(), false); err != nil {
+				log.Fatalf("Reading schema version failed: %v", err)
+			}
+			return
+		case "migrate":
+			if err := printSchemaStatus(databasePath(), true); err != nil {
+				log.Fatalf("Migration failed: %v", err)
+			}
+			return
+		default:
+			log.Fatalf("Unknown command %q (available: rotate-key, schema-version, migrate)", os.Args[1])
+		}
+	}
 	runServer()
 }
 
+// databasePath veritabanı dosyasının yolunu döndürür
+func databasePath() string {
+	dbPath := "iptv.db"
+	if os.Getenv("PWD") != "" {
+		dbPath = filepath.Join(os.Getenv("PWD"), "data", "iptv.db")
+	}
+	return dbPath
+}
+
+// rotateKey kayıtlı kimlik bilgilerini yeni bir anahtarla yeniden şifreler.
+// Yeni anahtar IPTV_NEW_SECRET_KEY ile verilebilir, verilmezse rastgele
+// üretilir. Anahtar bir dosyadan okunuyorsa dosya yeni anahtarla güncellenir.
+func rotateKey(dbPath string) error {
+	current, err := db.LoadSecretKey(dbPath)
+	if err != nil {
+		return err
+	}
+
+	var newKey []byte
+	if value := os.Getenv("IPTV_NEW_SECRET_KEY"); value != "" {
+		if newKey, err = db.ParseSecretKey(dbPath, value); err != nil {
+			return fmt.Errorf("IPTV_NEW_SECRET_KEY: %w", err)
+		}
+	} else if current.File == "" {
+		return fmt.Errorf("the key comes from %s; set IPTV_NEW_SECRET_KEY to the new key", current.Origin)
+	} else if newKey, err = db.GenerateSecretKey(); err != nil {
+		return err
+	}
+
+	database, err := db.NewDatabase(dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	// Yeni anahtar önce yan dosyaya yazılır; veritabanı güncellenemezse eski
+	// anahtar geçerli kalır
+	pending := current.File + ".new"
+	if current.File != "" {
+		if err := db.WriteSecretKeyFile(pending, newKey); err != nil {
+			return err
+		}
+	}
+
+	n, err := database.RotateKey(newKey)
+	if err != nil {
+		if current.File != "" {
+			os.Remove(pending)
+		}
+		return err
+	}
+
+	if current.File != "" {
+		if err := os.Rename(pending, current.File); err != nil {
+			return fmt.Errorf("credentials were re-encrypted but the key file could not be replaced, move %s to %s: %w",
+				pending, current.File, err)
+		}
+		log.Printf("Re-encrypted %d credentials, new key saved to %s", n, current.File)
+	} else {
+		log.Printf("Re-encrypted %d credentials, update %s to the new key", n, current.Origin)
+	}
+	return nil
+}
+
+// printSchemaStatus veritabanının şema sürümünü ve migration listesini
+// yazdırır. apply doğruysa bekleyen migration'lar önce uygulanır.
+func printSchemaStatus(dbPath string, apply bool) error {
+	var status *db.SchemaStatus
+	if apply {
+		database, err := db.NewDatabase(dbPath)
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+		if status, err = database.SchemaStatus(); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if status, err = db.ReadSchemaStatus(dbPath); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("schema version %d (latest %d, %d pending)\n", status.Version, status.Latest, status.Pending())
+	for _, m := range status.Migrations {
+		applied := "pending"
+		if m.AppliedAt != nil {
+			applied = m.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%4d  %-28s %s\n", m.Version, m.Name, applied)
+	}
+	return nil
+}
+
 func runServer() {
+	// Loglara sağlayıcı kimlik bilgileri yazılmasın
+	log.SetOutput(redact.NewWriter(os.Stderr))
+
 	// MPV player setup
 	player, err := player.NewMPVPlayer()
 	if err != nil {
@@ -27,10 +150,7 @@ func runServer() {
 	defer player.Cleanup()
 
 	// Database setup
-	dbPath := "iptv.db"
-	if os.Getenv("PWD") != "" {
-		dbPath = filepath.Join(os.Getenv("PWD"), "data", "iptv.db")
-	}
+	dbPath := databasePath()
 	log.Printf("Database path: %s\n", dbPath)
 	database, err := db.NewDatabase(dbPath)
 	if err != nil {
@@ -38,8 +158,22 @@ func runServer() {
 	}
 	defer database.Close()
 
+	// Kayıtlı şifreler loglarda hangi biçimde geçerse geçsin gizlensin
+	if sources, err := database.GetSources(); err != nil {
+		log.Printf("Error loading sources: %v", err)
+	} else {
+		for _, source := range sources {
+			api.RegisterSourceSecrets(source)
+		}
+	}
+
 	// API handlers setup
-	handler := api.NewHandler(player, database, nil)
+	handler := api.NewHandler(player, database)
+	setupImageCache(handler, dbPath)
+	setupAuth(handler, database)
+
+	// Zamanlanmış kanal senkronizasyonu ve rehber yenilemesi
+	go handler.RunScheduler(context.Background())
 
 	// Router setup
 	r := mux.NewRouter()
@@ -69,6 +203,87 @@ func runServer() {
 	}
 }
 
+// setupImageCache logo önbelleğini ortam değişkenlerine göre kurar:
+// IMAGE_CACHE_DIR (varsayılan veritabanının yanındaki images dizini),
+// IMAGE_CACHE_MAX_MB (varsayılan 256) ve IMAGE_PREFETCH (live, all, off).
+// Önbellek açılamazsa logolar sağlayıcıdan gelmeye devam eder.
+func setupImageCache(handler *api.Handler, dbPath string) {
+	dir := os.Getenv("IMAGE_CACHE_DIR")
+	if dir == "" {
+		dir = filepath.Join(filepath.Dir(dbPath), "images")
+	}
+	maxMB := int64(256)
+	if value := os.Getenv("IMAGE_CACHE_MAX_MB"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid IMAGE_CACHE_MAX_MB %q, using %d", value, maxMB)
+		} else {
+			maxMB = parsed
+		}
+	}
+	prefetch := os.Getenv("IMAGE_PREFETCH")
+	switch prefetch {
+	case "":
+		prefetch = api.ImagePrefetchLive
+	case api.ImagePrefetchLive, api.ImagePrefetchAll, api.ImagePrefetchOff:
+	default:
+		log.Printf("Invalid IMAGE_PREFETCH %q, using %s", prefetch, api.ImagePrefetchLive)
+		prefetch = api.ImagePrefetchLive
+	}
+
+	cache, err := imagecache.New(dir, maxMB<<20)
+	if err != nil {
+		log.Printf("Image cache disabled: %v", err)
+		return
+	}
+	log.Printf("Image cache: %s (%d MB)\n", dir, maxMB)
+	handler.SetImageCache(cache, prefetch)
+}
+
+// setupAuth kimlik doğrulamayı ortam değişkenlerine göre kurar:
+// ADMIN_PASSWORD yönetici parolasını belirler (boşsa kayıtlı parola
+// korunur), AUTH_TRUSTED_NETWORKS parola istenmeyen ağlardır ("lan" ya da
+// CIDR listesi), CORS_ORIGINS CORS ile erişebilecek kaynaklardır ("*" hepsi).
+func setupAuth(handler *api.Handler, database *db.Database) {
+	if password := os.Getenv("ADMIN_PASSWORD"); password != "" {
+		// Parola aynıysa açık oturumlar kapanmasın
+		if ok, err := database.CheckAdminPassword(password); err != nil {
+			log.Fatalf("Failed to read admin password: %v", err)
+		} else if !ok {
+			if err := database.SetAdminPassword(password); err != nil {
+				log.Fatalf("Failed to set admin password: %v", err)
+			}
+			log.Printf("Admin password set from environment")
+		}
+	}
+
+	var config api.AuthConfig
+	networks, err := api.ParseNetworks(os.Getenv("AUTH_TRUSTED_NETWORKS"))
+	if err != nil {
+		log.Fatalf("Invalid AUTH_TRUSTED_NETWORKS: %v", err)
+	}
+	config.TrustedNetworks = networks
+	for _, origin := range strings.Split(os.Getenv("CORS_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			config.AllowedOrigins = append(config.AllowedOrigins, origin)
+		}
+	}
+	handler.SetAuthConfig(config)
+
+	enabled, err := database.AuthEnabled()
+	if err != nil {
+		log.Fatalf("Failed to read authentication settings: %v", err)
+	}
+	switch {
+	case enabled:
+		log.Printf("API authentication enabled (%d trusted networks)", len(networks))
+	case len(networks) > 0:
+		log.Printf("API access limited to %d trusted networks", len(networks))
+	default:
+		log.Printf("Warning: API authentication is disabled; set ADMIN_PASSWORD or AUTH_TRUSTED_NETWORKS")
+	}
+}
+
 // SPA handler for serving React frontend
 type spaHandler struct {
 	staticPath string
@@ -0,0 +1,497 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"remote-iptv/internal/db"
+)
+
+// Kimlik doğrulama: yönetici parolası belirlendiğinde /api, /stream ve
+// /export istekleri parolayla açılan oturum (çerez ya da Bearer) veya
+// otomasyonlar için verilen API anahtarı ister. Güvenilen ağlardan
+// (AUTH_TRUSTED_NETWORKS) gelen istekler parola istemez; parola yokken
+// güvenilen ağ tanımlıysa diğer ağlardan gelen istekler reddedilir. Parola
+// ve güvenilen ağ tanımlanmamışsa API eskisi gibi herkese açıktır.
+const (
+	authSessionCookie = "auth_session"
+	// authTokenParam başlık gönderemeyen oynatıcıların (VLC, TiviMate)
+	// /export ve /stream adreslerinde kullandığı parametredir
+	authTokenParam = "token"
+	// maxGlobalLoginFailures tüm adreslerden pinLockout süresi içinde gelen
+	// hatalı deneme sınırıdır; aşılırsa giriş herkese kapanır
+	maxGlobalLoginFailures = 50
+	// minPasswordLength yönetici parolasının en kısa uzunluğudur
+	minPasswordLength = 8
+)
+
+// lanNetworks AUTH_TRUSTED_NETWORKS'teki "lan" değerinin karşılığı olan
+// yerel ve özel ağlardır
+var lanNetworks = []string{
+	"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16",
+	"::1/128", "fc00::/7", "fe80::/10",
+}
+
+// AuthConfig sunucu başlatılırken verilen kimlik doğrulama kurallarıdır
+type AuthConfig struct {
+	// AllowedOrigins CORS ile erişebilecek kaynaklardır. "*" tüm kaynaklara
+	// çerezsiz erişim verir; boşsa yalnızca aynı kaynaktan erişilebilir.
+	AllowedOrigins []string
+	// TrustedNetworks parola istenmeyen istemci ağlarıdır
+	TrustedNetworks []*net.IPNet
+}
+
+// ParseNetworks virgülle ayrılmış ağ listesini okur. Değerler CIDR, tek
+// bir IP adresi ya da yerel ve özel ağların tümü için "lan" olabilir.
+func ParseNetworks(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		items := []string{item}
+		switch {
+		case item == "":
+			continue
+		case strings.EqualFold(item, "lan"):
+			items = lanNetworks
+		case !strings.Contains(item, "/"):
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid network %q", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			items = []string{fmt.Sprintf("%s/%d", item, bits)}
+		}
+		for _, cidr := range items {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q", item)
+			}
+			networks = append(networks, network)
+		}
+	}
+	return networks, nil
+}
+
+// SetAuthConfig kimlik doğrulama kurallarını belirler; RegisterRoutes'tan
+// önce çağrılmalıdır
+func (h *Handler) SetAuthConfig(config AuthConfig) {
+	h.auth = config
+}
+
+// access isteğin API'ye hangi yolla eriştiğidir
+type access string
+
+const (
+	accessNone    access = "none"
+	accessOpen    access = "open"
+	accessNetwork access = "network"
+	accessSession access = "session"
+	accessToken   access = "token"
+)
+
+type accessKey struct{}
+
+// requestAccess middleware'in isteğe verdiği erişimi döndürür
+func requestAccess(r *http.Request) access {
+	if a, ok := r.Context().Value(accessKey{}).(access); ok {
+		return a
+	}
+	return accessNone
+}
+
+// clientIP isteğin geldiği adresi döndürür. Bağlantının adresi kullanılır;
+// X-Forwarded-For istemci tarafından yazılabildiği için dikkate alınmaz.
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// loginAttempts yönetici parolası denemelerini istemci adresine göre sayar.
+// Üst üste maxPINAttempts hatalı deneme yapan adres pinLockout süresince
+// kilitlenir. Çok sayıda adresten yapılan denemelere karşı tüm adreslerin
+// hataları da sayılır ve sınır aşılınca giriş herkese kapanır.
+type loginAttempts struct {
+	mu           sync.Mutex
+	failures     map[string]int
+	locked       map[string]time.Time
+	global       int
+	globalSince  time.Time
+	globalLocked time.Time
+}
+
+// allow adres ve giriş kilitli değilse doğru döner
+func (a *loginAttempts) allow(addr string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	return now.After(a.globalLocked) && now.After(a.locked[addr])
+}
+
+// record denemenin sonucunu kaydeder
+func (a *loginAttempts) record(addr string, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failures == nil {
+		a.failures = map[string]int{}
+		a.locked = map[string]time.Time{}
+	}
+	if ok {
+		delete(a.failures, addr)
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(a.globalSince) > pinLockout {
+		a.global = 0
+		a.globalSince = now
+	}
+	a.global++
+	if a.global >= maxGlobalLoginFailures {
+		log.Printf("Too many wrong admin passwords, login is locked for %v", pinLockout)
+		a.globalLocked = now.Add(pinLockout)
+		a.global = 0
+	}
+
+	a.failures[addr]++
+	if a.failures[addr] >= maxPINAttempts {
+		a.locked[addr] = now.Add(pinLockout)
+		delete(a.failures, addr)
+		// Süresi dolan kilitler atılır, harita adres sayısıyla büyümez
+		for other, until := range a.locked {
+			if now.After(until) {
+				delete(a.locked, other)
+			}
+		}
+	}
+}
+
+// trustedClient isteğin güvenilen bir ağdan gelip gelmediğini döndürür
+func (h *Handler) trustedClient(r *http.Request) bool {
+	ip := clientIP(r)
+	if ip == nil {
+		return false
+	}
+	for _, network := range h.auth.TrustedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// authToken istekteki oturum ya da API anahtarını okur. Sorgu
+// parametresi yalnızca oynatıcıların açtığı adreslerde geçerlidir.
+func authToken(r *http.Request) string {
+	if value := r.Header.Get("Authorization"); value != "" {
+		if scheme, token, ok := strings.Cut(value, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	if cookie, err := r.Cookie(authSessionCookie); err == nil {
+		return cookie.Value
+	}
+	if strings.HasPrefix(r.URL.Path, "/stream/") || strings.HasPrefix(r.URL.Path, "/export/") ||
+		strings.HasPrefix(r.URL.Path, "/api/images/") {
+		return r.URL.Query().Get(authTokenParam)
+	}
+	return ""
+}
+
+// checkAccess isteğin erişimini belirler; enabled yönetici parolasının
+// belirlenmiş olup olmadığıdır
+func (h *Handler) checkAccess(r *http.Request) (a access, enabled bool, err error) {
+	if enabled, err = h.db.AuthEnabled(); err != nil {
+		return accessNone, false, err
+	}
+	if h.trustedClient(r) {
+		return accessNetwork, enabled, nil
+	}
+	if !enabled {
+		if len(h.auth.TrustedNetworks) > 0 {
+			return accessNone, false, nil
+		}
+		return accessOpen, false, nil
+	}
+
+	token := authToken(r)
+	if token == "" {
+		return accessNone, true, nil
+	}
+	if ok, err := h.db.AdminSessionActive(token); err != nil || ok {
+		return accessSession, true, err
+	}
+	if ok, err := h.db.CheckAPIToken(token); err != nil || ok {
+		return accessToken, true, err
+	}
+	return accessNone, true, nil
+}
+
+// publicPath kimlik doğrulama istemeyen adresleri belirler: arayüz
+// dosyaları, giriş ve çıkış, ve açık aktarma oturumlarının liste girişleri.
+// Liste girişlerinin adları oturuma özel rastgele anahtarlardır ve yalnızca
+// doğrulanmış bir istekle açılan oturumlarda geçerlidir.
+func publicPath(r *http.Request) bool {
+	path := r.URL.Path
+	switch {
+	case path == "/api/auth/login", path == "/api/auth/logout", path == "/api/auth/status":
+		return true
+	case strings.HasPrefix(path, "/stream/"):
+		return strings.Count(strings.Trim(path, "/"), "/") >= 3
+	case strings.HasPrefix(path, "/api/"), strings.HasPrefix(path, "/export/"):
+		return false
+	}
+	return true
+}
+
+// authenticate kimlik doğrulama kurallarını uygulayan middleware'dir
+func (h *Handler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "OPTIONS" || publicPath(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		a, enabled, err := h.checkAccess(r)
+		if err != nil {
+			log.Printf("Error checking authentication: %v", err)
+			http.Error(w, "Failed to check authentication", http.StatusInternalServerError)
+			return
+		}
+		if a == accessNone {
+			if enabled {
+				writeAuthError(w, http.StatusUnauthorized, "auth_required", "authentication required")
+			} else {
+				writeAuthError(w, http.StatusForbidden, "network_not_allowed", "access is only allowed from trusted networks")
+			}
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), accessKey{}, a)))
+	})
+}
+
+// writeAuthError kimlik doğrulama hatasını istemcinin ayırt edebileceği
+// bir kodla yazar
+func writeAuthError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   code,
+		"message": message,
+	})
+}
+
+// requireAdmin parola ve API anahtarı yönetimi için yönetici erişimi
+// ister. API anahtarları yeni anahtar oluşturamaz ve parolayı değiştiremez.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if requestAccess(r) == accessToken {
+		writeAuthError(w, http.StatusForbidden, "admin_required", "API tokens cannot manage authentication")
+		return false
+	}
+	return true
+}
+
+// GetAuthStatus kimlik doğrulamanın açık olup olmadığını ve isteğin nasıl
+// eriştiğini döndürür; arayüz giriş ekranını göstermek için kullanır
+func (h *Handler) GetAuthStatus(w http.ResponseWriter, r *http.Request) {
+	a, enabled, err := h.checkAccess(r)
+	if err != nil {
+		log.Printf("Error checking authentication: %v", err)
+		http.Error(w, "Failed to check authentication", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":       enabled,
+		"authenticated": a != accessNone,
+		"access":        a,
+	})
+}
+
+// Login yönetici parolasını doğrulayıp oturum açar: {"password": "..."}.
+// Oturum anahtarı çerez olarak da yazılır.
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	enabled, err := h.db.AuthEnabled()
+	if err != nil {
+		http.Error(w, "Failed to check password", http.StatusInternalServerError)
+		return
+	}
+	if !enabled {
+		http.Error(w, "No admin password is set", http.StatusBadRequest)
+		return
+	}
+	addr := clientIP(r).String()
+	if !h.loginAttempts.allow(addr) {
+		http.Error(w, "Too many wrong password attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+	ok, err := h.db.CheckAdminPassword(req.Password)
+	if err != nil {
+		http.Error(w, "Failed to check password", http.StatusInternalServerError)
+		return
+	}
+	h.loginAttempts.record(addr, ok)
+	if !ok {
+		log.Printf("Wrong admin password from %s", addr)
+		http.Error(w, "Wrong password", http.StatusUnauthorized)
+		return
+	}
+
+	token, expires, err := h.db.CreateAdminSession()
+	if err != nil {
+		log.Printf("Error creating admin session: %v", err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     authSessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(requestBaseURL(r), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":      token,
+		"expires_at": expires,
+	})
+}
+
+// Logout isteğin yönetici oturumunu kapatır
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	if token := authToken(r); token != "" {
+		if err := h.db.DeleteAdminSession(token); err != nil {
+			http.Error(w, "Failed to delete session", http.StatusInternalServerError)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: authSessionCookie, Value: "", Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetAdminPassword yönetici parolasını belirler ya da boş parolayla
+// kimlik doğrulamayı kapatır: {"password": "..."}. Açık oturumlar kapanır;
+// istemci yeniden giriş yapmalıdır.
+func (h *Handler) SetAdminPassword(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Password != "" && len(req.Password) < minPasswordLength {
+		http.Error(w, fmt.Sprintf("Password must be at least %d characters", minPasswordLength), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.SetAdminPassword(req.Password); err != nil {
+		log.Printf("Error setting admin password: %v", err)
+		http.Error(w, "Failed to set password", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Admin password updated (enabled: %v)", req.Password != "")
+	http.SetCookie(w, &http.Cookie{Name: authSessionCookie, Value: "", Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAPITokens API anahtarlarını döndürür; anahtarların kendisi dönmez
+func (h *Handler) GetAPITokens(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	tokens, err := h.db.GetAPITokens()
+	if err != nil {
+		log.Printf("Error getting API tokens: %v", err)
+		http.Error(w, "Failed to get API tokens", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// CreateAPIToken otomasyonlar için yeni bir API anahtarı oluşturur:
+// {"name": "Home Assistant"}. Anahtar yalnızca bu yanıtta döner.
+func (h *Handler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	token, secret, err := h.db.CreateAPIToken(req.Name)
+	if err != nil {
+		log.Printf("Error creating API token: %v", err)
+		http.Error(w, "Failed to create API token", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Created API token %d (%s)", token.ID, token.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		*db.APIToken
+		Token string `json:"token"`
+	}{token, secret})
+}
+
+// DeleteAPIToken API anahtarını iptal eder
+func (h *Handler) DeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+	err = h.db.DeleteAPIToken(id)
+	if errors.Is(err, db.ErrAPITokenNotFound) {
+		http.Error(w, "API token not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting API token %d: %v", id, err)
+		http.Error(w, "Failed to delete API token", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Deleted API token %d", id)
+	w.WriteHeader(http.StatusNoContent)
+}
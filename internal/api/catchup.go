@@ -0,0 +1,222 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"remote-iptv/internal/db"
+	"remote-iptv/internal/m3u"
+	"remote-iptv/internal/player"
+	"remote-iptv/internal/xtream"
+)
+
+// CatchupInfo arşivden oynatılan programı tanımlar
+type CatchupInfo struct {
+	ProgrammeID int       `json:"programme_id,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	Start       time.Time `json:"start"`
+	Stop        time.Time `json:"stop"`
+}
+
+// catchupStartTimeout arşiv adresinin oynatılmaya başlaması için beklenen
+// süredir; başlamazsa sıradaki adres denenir
+const catchupStartTimeout = 10 * time.Second
+
+// PlayCatchup arşivli bir canlı kanalın geçmiş bir programını oynatır.
+// Program EPG'den programme_id ile ya da start (RFC3339) ve duration
+// (dakika) ile seçilir.
+func (h *Handler) PlayCatchup(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChannelID   int    `json:"channel_id"`
+		ProgrammeID int    `json:"programme_id"`
+		Start       string `json:"start"`
+		Duration    int    `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+
+	ch, err := h.db.GetChannel(req.ChannelID)
+	if err != nil {
+		log.Printf("Error getting channel %d: %v", req.ChannelID, err)
+		http.Error(w, "Failed to get channel", http.StatusInternalServerError)
+		return
+	}
+	if ch == nil {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	if !h.checkChannelAllowed(w, r, ch.ID) {
+		return
+	}
+	if ch.Catchup == "" {
+		http.Error(w, "Channel has no catch-up archive", http.StatusBadRequest)
+		return
+	}
+
+	info, err := h.catchupProgramme(ch.ID, req.ProgrammeID, req.Start, req.Duration)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	if !info.Start.Before(now) {
+		http.Error(w, "Programme has not started yet", http.StatusBadRequest)
+		return
+	}
+	if ch.CatchupDays > 0 && info.Start.Before(now.AddDate(0, 0, -ch.CatchupDays)) {
+		http.Error(w, fmt.Sprintf("Programme is older than the %d day archive", ch.CatchupDays), http.StatusBadRequest)
+		return
+	}
+
+	source, err := h.db.GetSource(ch.SourceID)
+	if err != nil {
+		http.Error(w, "Failed to get source", http.StatusInternalServerError)
+		return
+	}
+	if source == nil {
+		http.Error(w, "Channel source not found", http.StatusNotFound)
+		return
+	}
+
+	urls, err := h.catchupURLs(source, ch, info)
+	if err != nil {
+		log.Printf("Error building catch-up URL for channel %d: %v", ch.ID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.player == nil {
+		h.player, err = player.NewMPVPlayer()
+		if err != nil {
+			log.Printf("Error creating MPV player: %v", err)
+			http.Error(w, "Failed to create player", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	opts := player.PlayOptions{
+		UserAgent:        ch.HTTPUserAgent,
+		Referrer:         ch.HTTPReferrer,
+		AudioLanguage:    profile.AudioLanguage,
+		SubtitleLanguage: profile.SubtitleLanguage,
+	}
+	h.saveResumePoint()
+	played := false
+	for i, catchupURL := range urls {
+		log.Printf("Playing catch-up URL #%d for channel %d (%s)", i+1, ch.ID, info.Start.Format(time.RFC3339))
+		if err := h.player.PlayWithOptions(catchupURL, opts); err != nil {
+			log.Printf("Error playing catch-up URL #%d: %v", i+1, err)
+			continue
+		}
+		// mpv adresi hemen kabul eder; sağlayıcının desteklemediği biçim
+		// ancak oynatmanın başlaması beklenerek anlaşılır
+		if err := h.player.WaitForPlayback(catchupURL, catchupStartTimeout); err != nil {
+			log.Printf("Catch-up URL #%d did not start: %v", i+1, err)
+			continue
+		}
+		played = true
+		break
+	}
+	if !played {
+		http.Error(w, "Failed to play catch-up", http.StatusInternalServerError)
+		return
+	}
+
+	h.setPlayback(ch, info, &PlaybackProfile{ID: profile.ID, Name: profile.Name})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// catchupProgramme istekteki program kimliğini ya da zaman aralığını çözer
+func (h *Handler) catchupProgramme(channelID, programmeID int, start string, duration int) (*CatchupInfo, error) {
+	if programmeID > 0 {
+		programme, err := h.db.GetProgramme(programmeID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get programme")
+		}
+		if programme == nil {
+			return nil, fmt.Errorf("programme not found")
+		}
+
+		// Programın gerçekten bu kanalın rehberine ait olduğunu doğrula
+		programmes, err := h.db.GetProgrammes(channelID, programme.Start, programme.Stop)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get programmes")
+		}
+		for _, p := range programmes {
+			if p.ID == programme.ID {
+				return &CatchupInfo{
+					ProgrammeID: p.ID,
+					Title:       p.Title,
+					Start:       p.Start,
+					Stop:        p.Stop,
+				}, nil
+			}
+		}
+		return nil, fmt.Errorf("programme does not belong to channel")
+	}
+
+	if start == "" {
+		return nil, fmt.Errorf("programme_id or start is required")
+	}
+	startTime, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start parameter")
+	}
+	if duration <= 0 {
+		duration = 60
+	}
+	return &CatchupInfo{
+		Start: startTime,
+		Stop:  startTime.Add(time.Duration(duration) * time.Minute),
+	}, nil
+}
+
+// catchupURLs kaynağın türüne göre denenecek arşiv URL'lerini döndürür
+func (h *Handler) catchupURLs(source *db.Source, ch *db.Channel, info *CatchupInfo) ([]string, error) {
+	duration := info.Stop.Sub(info.Start)
+
+	switch source.Type {
+	case db.SourceXtream:
+		client := h.xtreamClient(source)
+		h.ensureHealthyServer(source, client)
+		timezone := source.Timezone
+		if timezone == "" {
+			// Saat dilimi henüz bilinmiyorsa sağlayıcıdan öğren ve sakla
+			account, err := client.GetAccountInfo()
+			if err != nil {
+				log.Printf("Error fetching account info for source %d: %v", source.ID, err)
+			} else if account.ServerInfo.Timezone != "" {
+				timezone = account.ServerInfo.Timezone
+				if err := h.db.SetSourceTimezone(source.ID, timezone); err != nil {
+					log.Printf("Error saving timezone for source %d: %v", source.ID, err)
+				}
+			}
+		}
+		server := xtream.ServerInfo{Timezone: timezone}
+		loc := server.Location()
+		return []string{
+			client.TimeshiftURL(ch.RemoteID, info.Start, duration, loc),
+			client.TimeshiftPHPURL(ch.RemoteID, info.Start, duration, loc),
+		}, nil
+	case db.SourceM3U:
+		catchupURL, err := m3u.CatchupURL(ch.URL, ch.Catchup, ch.CatchupSource, info.Start, duration)
+		if err != nil {
+			return nil, err
+		}
+		return []string{catchupURL}, nil
+	default:
+		return nil, fmt.Errorf("unknown source type %q", source.Type)
+	}
+}
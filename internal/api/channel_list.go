@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"remote-iptv/internal/db"
+)
+
+// maxChannelPageSize tek sayfada dönebilecek en fazla kanal sayısıdır
+const maxChannelPageSize = 5000
+
+// Kanal listesi görünümleri
+const (
+	ViewFull    = "full"
+	ViewCompact = "compact"
+)
+
+// ChannelSummary kanal listesinin hafif görünümüdür (?view=compact). Liste
+// ekranında gereken alanlar dışındaki bilgiler (URL, açıklama, catch-up
+// ayarları) gönderilmez.
+type ChannelSummary struct {
+	ID         int    `json:"id"`
+	SourceID   int    `json:"source_id"`
+	Name       string `json:"name"`
+	StreamType string `json:"stream_type"`
+	CategoryID int    `json:"category_id"`
+	StreamIcon string `json:"stream_icon,omitempty"`
+	Rating     string `json:"rating,omitempty"`
+	Number     int    `json:"number,omitempty"`
+}
+
+// parseChannelQuery sayfalama, sıralama ve kaynak parametrelerini okur:
+// ?source=ID, ?sort=name|rating|added|number|health, ?order=asc|desc,
+// ?offset=N, ?limit=N. ?group_variants=true aynı kanalın sürümlerinden
+// yalnızca tercih edileni, ?hide_dead=true yalnızca ölü olmayan kanalları
+// listeler.
+func parseChannelQuery(r *http.Request, q *db.ChannelQuery) error {
+	var err error
+	if q.SourceID, err = sourceFilter(r); err != nil {
+		return fmt.Errorf("invalid source ID")
+	}
+
+	query := r.URL.Query()
+	q.Sort = query.Get("sort")
+	if !db.ValidChannelSort(q.Sort) {
+		return fmt.Errorf("invalid sort")
+	}
+	q.IncludeHidden = query.Get("include_hidden") == "true"
+	q.GroupVariants = query.Get("group_variants") == "true"
+	q.HideDead = query.Get("hide_dead") == "true"
+	q.Order = query.Get("order")
+	if q.Order != "" && q.Order != "asc" && q.Order != "desc" {
+		return fmt.Errorf("invalid order")
+	}
+
+	if value := query.Get("offset"); value != "" {
+		if q.Offset, err = strconv.Atoi(value); err != nil || q.Offset < 0 {
+			return fmt.Errorf("invalid offset")
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if q.Limit, err = strconv.Atoi(value); err != nil || q.Limit <= 0 {
+			return fmt.Errorf("invalid limit")
+		}
+		if q.Limit > maxChannelPageSize {
+			q.Limit = maxChannelPageSize
+		}
+	}
+	return nil
+}
+
+// writeChannelList sorguya uyan kanalları yazar. Toplam kanal sayısı
+// X-Total-Count başlığında döner; ?view=compact ile yalnızca liste
+// alanları gönderilir. Profilin gizlediği kategorilerdeki ve ebeveyn
+// denetimiyle kilitli kanallar listelenmez.
+func (h *Handler) writeChannelList(w http.ResponseWriter, r *http.Request, q db.ChannelQuery) {
+	view := r.URL.Query().Get("view")
+	if view != "" && view != ViewFull && view != ViewCompact {
+		http.Error(w, "Invalid view", http.StatusBadRequest)
+		return
+	}
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	q.ProfileID = profile.ID
+	q.PreferredQuality = profile.PreferredQuality
+	if q.Parental, ok = h.requireParentalFilter(w, r); !ok {
+		return
+	}
+
+	channels, total, err := h.db.ListChannels(q)
+	if err != nil {
+		log.Printf("Error getting channels: %v", err)
+		http.Error(w, "Failed to get channels", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if view != ViewCompact {
+		writeCachedJSON(w, r, channels)
+		return
+	}
+
+	summaries := make([]ChannelSummary, len(channels))
+	for i, ch := range channels {
+		summaries[i] = ChannelSummary{
+			ID:         ch.ID,
+			SourceID:   ch.SourceID,
+			Name:       ch.Name,
+			StreamType: ch.StreamType,
+			CategoryID: ch.CategoryID,
+			StreamIcon: ch.StreamIcon,
+			Rating:     ch.Rating,
+			Number:     ch.Number,
+		}
+	}
+	writeCachedJSON(w, r, summaries)
+}
+
+// writeCachedJSON yanıtı içeriğinin özetinden üretilen ETag ile yazar.
+// İstemcinin If-None-Match başlığındaki etiket aynıysa gövde gönderilmez,
+// 304 döner.
+func writeCachedJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(v); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(body.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	// Tarayıcı her seferinde etiketi doğrulasın
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body.Bytes())
+}
+
+// etagMatches If-None-Match başlığındaki etiketlerden biri etag ile
+// eşleşiyorsa doğru döner. Zayıf (W/) etiketler de kabul edilir.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"remote-iptv/internal/db"
+	"remote-iptv/internal/epg"
+	"remote-iptv/internal/redact"
+)
+
+// ImportEPG XMLTV rehberini içe aktarır. Rehber sırasıyla yüklenen dosya
+// (multipart "file" alanı), JSON gövdedeki http(s) "url" ya da Xtream
+// kaynağının xmltv.php adresi olabilir. ?source=ID verilirse rehber yalnızca
+// o kaynağın kanallarıyla eşlenir.
+func (h *Handler) ImportEPG(w http.ResponseWriter, r *http.Request) {
+	sourceID, err := sourceFilter(r)
+	if err != nil {
+		http.Error(w, "Invalid source ID", http.StatusBadRequest)
+		return
+	}
+
+	guide, sourceID, err := h.openEPGSource(r, sourceID)
+	if err != nil {
+		log.Printf("Error opening EPG source: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to open EPG source: %v", err), http.StatusBadRequest)
+		return
+	}
+	defer guide.Close()
+
+	importer := &epg.Importer{DB: h.db, SourceID: sourceID}
+	result, err := importer.Import(guide)
+	if err != nil {
+		log.Printf("Error importing EPG: %v", err)
+		http.Error(w, "Failed to import EPG", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// openEPGSource istekten rehber kaynağını belirleyip akış olarak açar ve
+// rehberin eşleneceği kaynak ID'sini döndürür
+func (h *Handler) openEPGSource(r *http.Request, sourceID int) (io.ReadCloser, int, error) {
+	upload, location, err := sourceRequest(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	if upload != nil {
+		guide, err := epg.Decompress(upload)
+		return guide, sourceID, err
+	}
+	if location != "" {
+		log.Printf("Importing EPG from: %s", redact.URL(location))
+		guide, err := epg.Open(location)
+		return guide, sourceID, err
+	}
+
+	var source *db.Source
+	if sourceID != 0 {
+		source, err = h.db.GetSource(sourceID)
+	} else {
+		source, err = h.db.GetDefaultXtreamSource()
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if source == nil {
+		return nil, 0, fmt.Errorf("no EPG source given and no Xtream source found")
+	}
+	if source.Type != db.SourceXtream {
+		return nil, 0, fmt.Errorf("source %d has no provider guide", source.ID)
+	}
+	client := h.xtreamClient(source)
+	h.ensureHealthyServer(source, client)
+	log.Printf("Importing EPG from provider xmltv.php at %s", client.ActiveServer())
+	guide, err := epg.Open(client.XMLTVURL())
+	return guide, source.ID, err
+}
+
+// sourceRequest içe aktarma isteklerinden kaynağı okur: multipart "file"
+// alanı varsa yüklenen dosyayı, yoksa JSON gövdedeki "url" değerini
+// döndürür. İkisi de yoksa upload nil ve location boş olur. Sunucudaki
+// dosyalar API'den okunamaz, adres http(s) olmalıdır.
+func sourceRequest(r *http.Request) (upload io.ReadCloser, location string, err error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			return nil, "", err
+		}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil, "", fmt.Errorf("no file field in upload")
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			if part.FormName() == "file" {
+				log.Printf("Reading uploaded file %s", part.FileName())
+				return part, "", nil
+			}
+			part.Close()
+		}
+	}
+
+	var req struct {
+		URL string `json:"url"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			return nil, "", fmt.Errorf("invalid request body")
+		}
+	}
+	if req.URL == "" {
+		return nil, "", nil
+	}
+	if err := checkRemoteURL(req.URL); err != nil {
+		return nil, "", err
+	}
+	return nil, req.URL, nil
+}
+
+// checkRemoteURL adresin bir http(s) adresi olduğunu doğrular
+func checkRemoteURL(location string) error {
+	parsed, err := url.Parse(location)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid url %q, only http and https urls are accepted", redact.URL(location))
+	}
+	return nil
+}
+
+// GetChannelEPG bir kanalın yayın akışını döndürür. Varsayılan aralık
+// son iki saat ile önümüzdeki 24 saattir.
+func (h *Handler) GetChannelEPG(w http.ResponseWriter, r *http.Request) {
+	channelID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid channel ID", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	from := now.Add(-2 * time.Hour)
+	to := now.Add(24 * time.Hour)
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "Invalid from parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			http.Error(w, "Invalid to parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	programmes, err := h.db.GetProgrammes(channelID, from, to)
+	if err != nil {
+		log.Printf("Error getting EPG for channel %d: %v", channelID, err)
+		http.Error(w, "Failed to get EPG", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(programmes)
+}
@@ -0,0 +1,319 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"remote-iptv/internal/db"
+	"remote-iptv/internal/epg"
+	"remote-iptv/internal/m3u"
+	"remote-iptv/internal/xtream"
+)
+
+// Dışa aktarma: yerel kütüphane (yerel adlar, logolar, sıra, gizlemeler,
+// favoriler) diğer oynatıcıların (Kodi, VLC, TiviMate) okuyabileceği M3U
+// listesi ve XMLTV rehberi olarak sunulur. Bu oynatıcılar başlık
+// gönderemediğinden profil ?profile=ID ile de seçilebilir.
+
+// Dışa aktarılan rehberin varsayılan ve en uzun süresi (gün). Arşivden
+// izleme için geçmiş bir gün de eklenir.
+const (
+	defaultExportDays = 3
+	maxExportDays     = 14
+	exportPastWindow  = 24 * time.Hour
+)
+
+// exportItem dışa aktarılacak bir kanal ve listedeki grubudur
+type exportItem struct {
+	channel db.Channel
+	group   string
+}
+
+// exportChannelID kanalın dışa aktarılan liste ve rehberdeki kimliğidir.
+// Kanal kimliğinden (kaynak, tür, sağlayıcıdaki ID) üretildiği için
+// senkronizasyonlar arasında değişmez.
+func exportChannelID(ch db.Channel) string {
+	return fmt.Sprintf("%d.%s.%d", ch.SourceID, ch.StreamType, ch.RemoteID)
+}
+
+// exportChannels isteğin süzgeçlerine uyan kanalları döndürür; hata
+// durumunda yanıtı yazar ve false döner. Parametreler:
+//   - ?profile=ID profil (X-Profile-ID başlığı yerine)
+//   - ?type=live|movie|series|all, varsayılan live
+//   - ?list=ID yalnızca favori listesi, ?favorites=true tüm favori listeleri;
+//     bu durumda kanallar liste sırasıyla gelir ve liste adıyla gruplanır
+//   - diğer durumda kanal listesi parametreleri (?source, ?sort,
+//     ?group_variants, ?hide_dead ...) geçerlidir ve gruplar kategorilerdir
+func (h *Handler) exportChannels(w http.ResponseWriter, r *http.Request) ([]exportItem, bool) {
+	query := r.URL.Query()
+	if value := query.Get("profile"); value != "" && r.Header.Get(profileHeader) == "" {
+		r.Header.Set(profileHeader, value)
+	}
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return nil, false
+	}
+	filter, ok := h.requireParentalFilter(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	streamType := query.Get("type")
+	switch streamType {
+	case "":
+		streamType = "live"
+	case "all":
+		streamType = ""
+	case "live", "movie", "series":
+	default:
+		http.Error(w, "Invalid type", http.StatusBadRequest)
+		return nil, false
+	}
+
+	listID, err := intParam(r, "list")
+	if err != nil {
+		http.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return nil, false
+	}
+	if listID != 0 || query.Get("favorites") == "true" {
+		return h.exportFavorites(w, profile.ID, listID, streamType, filter)
+	}
+
+	q := db.ChannelQuery{StreamType: streamType}
+	if err := parseChannelQuery(r, &q); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	q.ProfileID = profile.ID
+	q.PreferredQuality = profile.PreferredQuality
+	q.Parental = filter
+	channels, _, err := h.db.ListChannels(q)
+	if err != nil {
+		log.Printf("Error getting channels for export: %v", err)
+		http.Error(w, "Failed to get channels", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	groups := make(map[int]string)
+	for _, categoryType := range []string{"live", "movie", "series"} {
+		if streamType != "" && streamType != categoryType {
+			continue
+		}
+		categories, err := h.db.GetCategories(categoryType, q.SourceID)
+		if err != nil {
+			log.Printf("Error getting categories for export: %v", err)
+			http.Error(w, "Failed to get categories", http.StatusInternalServerError)
+			return nil, false
+		}
+		for _, category := range categories {
+			groups[category.ID] = category.Name
+		}
+	}
+
+	items := make([]exportItem, len(channels))
+	for i, ch := range channels {
+		items[i] = exportItem{channel: ch, group: groups[ch.CategoryID]}
+	}
+	return items, true
+}
+
+// exportFavorites profilin favorilerini (listID sıfır değilse yalnızca o
+// listeyi) liste sırasıyla döndürür. Listeden çıkmış ve ebeveyn denetimine
+// takılan kanallar atlanır.
+func (h *Handler) exportFavorites(w http.ResponseWriter, profileID, listID int, streamType string, filter db.ParentalFilter) ([]exportItem, bool) {
+	lists, err := h.db.GetFavoriteLists(profileID)
+	if err != nil {
+		log.Printf("Error getting favorite lists for export: %v", err)
+		http.Error(w, "Failed to get favorite lists", http.StatusInternalServerError)
+		return nil, false
+	}
+	names := make(map[int]string)
+	for _, list := range lists {
+		names[list.ID] = list.Name
+	}
+	if _, ok := names[listID]; listID != 0 && !ok {
+		http.Error(w, "Favorite list not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	favorites, err := h.db.GetFavorites(db.FavoriteQuery{ProfileID: profileID, ListID: listID, Parental: filter})
+	if err != nil {
+		log.Printf("Error getting favorites for export: %v", err)
+		http.Error(w, "Failed to get favorites", http.StatusInternalServerError)
+		return nil, false
+	}
+	items := []exportItem{}
+	for _, f := range favorites {
+		if !f.Available || (streamType != "" && f.StreamType != streamType) {
+			continue
+		}
+		ch, err := h.db.GetChannel(f.ChannelID)
+		if err != nil || ch == nil {
+			continue
+		}
+		// Favoriler yerel ad ve logoyla döner
+		ch.Name, ch.StreamIcon = f.Name, f.StreamIcon
+		items = append(items, exportItem{channel: *ch, group: names[f.ListID]})
+	}
+	return items, true
+}
+
+// ExportPlaylist seçilen kanalları M3U listesi olarak döndürür.
+// ?proxy=true adresleri sunucunun /stream aktarmasına yönlendirir;
+// sağlayıcı kimlik bilgileri listeye yazılmaz; liste ?token= ile
+// alındıysa anahtar bu adreslere de eklenir. ?renumber=true kanalları
+// liste sırasıyla 1'den numaralandırır. Diğer parametreler için
+// exportChannels'a bakınız.
+func (h *Handler) ExportPlaylist(w http.ResponseWriter, r *http.Request) {
+	items, ok := h.exportChannels(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	proxy := query.Get("proxy") == "true"
+	renumber := query.Get("renumber") == "true"
+	streamBase := requestBaseURL(r) + "/stream/"
+	streamQuery := ""
+	if token := query.Get(authTokenParam); token != "" {
+		streamQuery = "?" + authTokenParam + "=" + url.QueryEscape(token)
+	}
+
+	sources := make(map[int]*db.Source)
+	clients := make(map[int]*xtream.Client)
+	w.Header().Set("Content-Type", "audio/x-mpegurl; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="playlist.m3u"`)
+	playlist := m3u.NewWriter(w)
+	for i, item := range items {
+		ch := item.channel
+		entry := m3u.Entry{
+			Name:          ch.Name,
+			Duration:      -1,
+			TvgID:         exportChannelID(ch),
+			TvgName:       ch.Name,
+			TvgLogo:       ch.StreamIcon,
+			GroupTitle:    item.group,
+			ChannelNumber: ch.Number,
+		}
+		if renumber {
+			entry.ChannelNumber = i + 1
+		}
+
+		if proxy {
+			entry.URL = streamBase + ch.StreamType + "/" + strconv.Itoa(ch.ID) + streamQuery
+		} else {
+			entry.URL = h.exportStreamURL(sources, clients, ch)
+			entry.UserAgent = ch.HTTPUserAgent
+			entry.Referrer = ch.HTTPReferrer
+			entry.Catchup = ch.Catchup
+			entry.CatchupDays = ch.CatchupDays
+			entry.CatchupSource = ch.CatchupSource
+		}
+		if entry.URL == "" {
+			continue
+		}
+		if err := playlist.Write(entry); err != nil {
+			return
+		}
+	}
+	playlist.Flush()
+}
+
+// exportStreamURL kanalın sağlayıcıdaki adresini döndürür. Kaynaklar ve
+// Xtream istemcileri liste boyunca bir kez oluşturulur.
+func (h *Handler) exportStreamURL(sources map[int]*db.Source, clients map[int]*xtream.Client, ch db.Channel) string {
+	source, ok := sources[ch.SourceID]
+	if !ok {
+		var err error
+		if source, err = h.db.GetSource(ch.SourceID); err != nil {
+			log.Printf("Error getting source %d: %v", ch.SourceID, err)
+		}
+		sources[ch.SourceID] = source
+		if source != nil && source.Type == db.SourceXtream {
+			client := h.xtreamClient(source)
+			h.ensureHealthyServer(source, client)
+			clients[source.ID] = client
+		}
+	}
+	if source == nil {
+		return ""
+	}
+	if client := clients[source.ID]; client != nil {
+		return xtreamStreamURL(client, source, ch)
+	}
+	return ch.URL
+}
+
+// requestBaseURL isteğin geldiği adresi (şema ve sunucu) döndürür
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// ExportEPG seçilen canlı kanalların rehberini XMLTV olarak döndürür.
+// Kanal kimlikleri /export/playlist.m3u'daki tvg-id'lerle aynıdır.
+// ?days=N gelecekteki gün sayısıdır (varsayılan 3, en fazla 14).
+func (h *Handler) ExportEPG(w http.ResponseWriter, r *http.Request) {
+	days := defaultExportDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		var err error
+		if days, err = strconv.Atoi(value); err != nil || days <= 0 {
+			http.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+		if days > maxExportDays {
+			days = maxExportDays
+		}
+	}
+	items, ok := h.exportChannels(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="epg.xml"`)
+	guide := epg.NewWriter(w)
+	ids := make(map[int]string)
+	for _, item := range items {
+		ch := item.channel
+		if ch.StreamType != "live" {
+			continue
+		}
+		if _, ok := ids[ch.ID]; ok {
+			continue
+		}
+		ids[ch.ID] = exportChannelID(ch)
+		if err := guide.WriteChannel(epg.Channel{ID: ids[ch.ID], DisplayNames: []string{ch.Name}, Icon: ch.StreamIcon}); err != nil {
+			return
+		}
+	}
+
+	now := time.Now()
+	err := h.db.EachProgramme(now.Add(-exportPastWindow), now.AddDate(0, 0, days), func(channelID int, p db.Programme) error {
+		id, ok := ids[channelID]
+		if !ok {
+			return nil
+		}
+		return guide.WriteProgramme(epg.Programme{
+			Channel:     id,
+			Start:       p.Start,
+			Stop:        p.Stop,
+			Title:       p.Title,
+			Description: p.Description,
+			Category:    p.Category,
+		})
+	})
+	if err != nil {
+		// Başlık gönderildiği için yalnızca loglanabilir
+		log.Printf("Error exporting EPG: %v", err)
+		return
+	}
+	guide.Close()
+}
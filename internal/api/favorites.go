@@ -0,0 +1,422 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"remote-iptv/internal/db"
+)
+
+// favoriteIDParam URL'deki favori ya da liste ID'sini okur
+func favoriteIDParam(r *http.Request) (int, error) {
+	return strconv.Atoi(mux.Vars(r)["id"])
+}
+
+// intParam isteğe bağlı sayısal sorgu parametresini okur, yoksa 0 döner
+func intParam(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// writeFavorite favoriyi verilen durum koduyla yazar
+func (h *Handler) writeFavorite(w http.ResponseWriter, profileID, id int, status int) {
+	favorite, err := h.db.GetFavorite(profileID, id)
+	if err != nil || favorite == nil {
+		log.Printf("Error getting favorite %d: %v", id, err)
+		http.Error(w, "Failed to get favorite", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(favorite)
+}
+
+// writeFavoriteExists kanal hedef listede zaten varsa mevcut favoriyi 409
+// ile döndürür
+func (h *Handler) writeFavoriteExists(w http.ResponseWriter, profileID, id int) {
+	favorite, err := h.db.GetFavorite(profileID, id)
+	if err != nil {
+		log.Printf("Error getting favorite %d: %v", id, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":    "favorite_exists",
+		"favorite": favorite,
+	})
+}
+
+// GetFavorites favorileri liste ve kullanıcı sırasıyla döndürür.
+// ?list=ID tek bir listeyi, ?channel_id=ID bir kanalın bulunduğu listeleri
+// getirir.
+func (h *Handler) GetFavorites(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	filter, ok := h.requireParentalFilter(w, r)
+	if !ok {
+		return
+	}
+	q := db.FavoriteQuery{ProfileID: profile.ID, Parental: filter}
+	var err error
+	if q.ListID, err = intParam(r, "list"); err != nil {
+		http.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+	if q.ChannelID, err = intParam(r, "channel_id"); err != nil {
+		http.Error(w, "Invalid channel ID", http.StatusBadRequest)
+		return
+	}
+
+	favorites, err := h.db.GetFavorites(q)
+	if err != nil {
+		log.Printf("Error getting favorites: %v", err)
+		http.Error(w, "Failed to fetch favorites", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(favorites)
+}
+
+// AddFavorite kanalı bir favori listesinin sonuna ekler. Kanal channel_id
+// ile belirtilir; eski istemcilerin gönderdiği kanal nesnesindeki id ya da
+// url de kabul edilir. list_id verilmezse profilin varsayılan listesi
+// kullanılır.
+func (h *Handler) AddFavorite(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		ChannelID int    `json:"channel_id"`
+		ID        int    `json:"id"`
+		URL       string `json:"url"`
+		ListID    int    `json:"list_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error decoding favorite request: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ChannelID == 0 {
+		req.ChannelID = req.ID
+	}
+
+	var ch *db.Channel
+	var err error
+	if req.ChannelID > 0 {
+		ch, err = h.db.GetChannel(req.ChannelID)
+	} else if req.URL != "" {
+		ch, err = h.db.GetChannelByURL(req.URL)
+	}
+	if err != nil {
+		log.Printf("Error getting favorite channel: %v", err)
+		http.Error(w, "Failed to get channel", http.StatusInternalServerError)
+		return
+	}
+	if ch == nil {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+
+	id, err := h.db.AddFavorite(profile.ID, req.ListID, *ch)
+	switch {
+	case errors.Is(err, db.ErrFavoriteExists):
+		h.writeFavoriteExists(w, profile.ID, id)
+		return
+	case errors.Is(err, db.ErrFavoriteListNotFound):
+		http.Error(w, "Favorite list not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("Error adding favorite: %v", err)
+		http.Error(w, "Failed to add favorite", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Added favorite %d: %s (profile %d)", id, ch.Name, profile.ID)
+	h.writeFavorite(w, profile.ID, id, http.StatusCreated)
+}
+
+// UpdateFavorite favoriyi başka bir listeye ya da listede başka bir sıraya
+// taşır. list_id verilmezse favori kendi listesinde kalır, position
+// verilmezse listenin sonuna eklenir.
+func (h *Handler) UpdateFavorite(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	id, err := favoriteIDParam(r)
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		ListID   int  `json:"list_id"`
+		Position *int `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	position := -1
+	if req.Position != nil {
+		position = *req.Position
+	}
+
+	existing, err := h.db.MoveFavorite(profile.ID, id, req.ListID, position)
+	switch {
+	case errors.Is(err, db.ErrFavoriteExists):
+		h.writeFavoriteExists(w, profile.ID, existing)
+		return
+	case errors.Is(err, db.ErrFavoriteListNotFound):
+		http.Error(w, "Favorite list not found", http.StatusNotFound)
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Favorite not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("Error moving favorite %d: %v", id, err)
+		http.Error(w, "Failed to move favorite", http.StatusInternalServerError)
+		return
+	}
+	h.writeFavorite(w, profile.ID, id, http.StatusOK)
+}
+
+func (h *Handler) RemoveFavorite(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	id, err := favoriteIDParam(r)
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.RemoveFavorite(profile.ID, id); err != nil {
+		http.Error(w, "Failed to remove favorite", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ReorderFavorites listedeki favorileri gövdedeki ID sırasına dizer:
+// {"list_id": 1, "ids": [5, 2, 9]}. Verilmeyen favoriler sona kalır.
+func (h *Handler) ReorderFavorites(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		ListID int   `json:"list_id"`
+		IDs    []int `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	err := h.db.ReorderFavorites(profile.ID, req.ListID, req.IDs)
+	switch {
+	case errors.Is(err, db.ErrFavoriteListNotFound):
+		http.Error(w, "Favorite list not found", http.StatusNotFound)
+		return
+	case errors.Is(err, db.ErrInvalidOrder):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("Error reordering favorites: %v", err)
+		http.Error(w, "Failed to reorder favorites", http.StatusInternalServerError)
+		return
+	}
+
+	filter, ok := h.requireParentalFilter(w, r)
+	if !ok {
+		return
+	}
+	favorites, err := h.db.GetFavorites(db.FavoriteQuery{ProfileID: profile.ID, ListID: req.ListID, Parental: filter})
+	if err != nil {
+		http.Error(w, "Failed to fetch favorites", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(favorites)
+}
+
+// GetFavoriteDuplicates birden fazla listeye eklenmiş kanalları ve bir
+// listede farklı kaynaklardan eklenmiş aynı adlı içerikleri döndürür
+func (h *Handler) GetFavoriteDuplicates(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	filter, ok := h.requireParentalFilter(w, r)
+	if !ok {
+		return
+	}
+	duplicates, err := h.db.FindFavoriteDuplicates(profile.ID, filter)
+	if err != nil {
+		log.Printf("Error finding duplicate favorites: %v", err)
+		http.Error(w, "Failed to find duplicates", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(duplicates)
+}
+
+// GetFavoriteLists favori listelerini sırasıyla döndürür
+func (h *Handler) GetFavoriteLists(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	lists, err := h.db.GetFavoriteLists(profile.ID)
+	if err != nil {
+		log.Printf("Error getting favorite lists: %v", err)
+		http.Error(w, "Failed to get favorite lists", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lists)
+}
+
+// decodeFavoriteListName gövdedeki liste adını okur
+func decodeFavoriteListName(r *http.Request) (string, error) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return "", errors.New("invalid request body")
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return "", errors.New("name is required")
+	}
+	return name, nil
+}
+
+// CreateFavoriteList yeni bir favori listesi oluşturur
+func (h *Handler) CreateFavoriteList(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	name, err := decodeFavoriteListName(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id, err := h.db.CreateFavoriteList(profile.ID, name)
+	if err != nil {
+		log.Printf("Error creating favorite list: %v", err)
+		http.Error(w, "Failed to create favorite list", http.StatusInternalServerError)
+		return
+	}
+	list, err := h.db.GetFavoriteList(profile.ID, id)
+	if err != nil || list == nil {
+		http.Error(w, "Failed to get favorite list", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(list)
+}
+
+// RenameFavoriteList listenin adını değiştirir
+func (h *Handler) RenameFavoriteList(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	id, err := favoriteIDParam(r)
+	if err != nil {
+		http.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+	name, err := decodeFavoriteListName(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.db.RenameFavoriteList(profile.ID, id, name)
+	if errors.Is(err, db.ErrFavoriteListNotFound) {
+		http.Error(w, "Favorite list not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error renaming favorite list %d: %v", id, err)
+		http.Error(w, "Failed to rename favorite list", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteFavoriteList listeyi içindeki favorilerle birlikte siler.
+// Varsayılan liste silinemez.
+func (h *Handler) DeleteFavoriteList(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	id, err := favoriteIDParam(r)
+	if err != nil {
+		http.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.db.DeleteFavoriteList(profile.ID, id)
+	switch {
+	case errors.Is(err, db.ErrDefaultFavoriteList):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, db.ErrFavoriteListNotFound):
+		http.Error(w, "Favorite list not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("Error deleting favorite list %d: %v", id, err)
+		http.Error(w, "Failed to delete favorite list", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReorderFavoriteLists listeleri gövdedeki ID sırasına dizer: {"ids": [3, 1]}
+func (h *Handler) ReorderFavoriteLists(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		IDs []int `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.db.ReorderFavoriteLists(profile.ID, req.IDs)
+	if errors.Is(err, db.ErrInvalidOrder) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error reordering favorite lists: %v", err)
+		http.Error(w, "Failed to reorder favorite lists", http.StatusInternalServerError)
+		return
+	}
+	h.GetFavoriteLists(w, r)
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"hash/crc32"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,96 +14,142 @@ import (
 
 	"remote-iptv/internal/db"
 	"remote-iptv/internal/player"
+	"remote-iptv/internal/redact"
+	"remote-iptv/internal/restream"
 	"remote-iptv/internal/xtream"
 	"github.com/gorilla/mux"
 )
 
-// convertXtreamChannels xtream.Channel türünü db.Channel türüne dönüştürür
-func (h *Handler) convertXtreamChannels(channels []xtream.Channel, streamType string) []db.Channel {
-	result := make([]db.Channel, 0, len(channels))
-	usedIDs := make(map[int]bool)
-	autoID := 1000000
+// xtreamChannelConverter xtream.Channel türünü db.Channel türüne dönüştürür.
+// Kanallar akış halinde tek tek geldiği için kullanılan ID'leri tür başına takip eder.
+// Kategori ID'si sağlayıcınınkidir; yerel ID'ye ChannelImport.Commit çevirir.
+type xtreamChannelConverter struct {
+	client  *xtream.Client
+	usedIDs map[int]bool
+}
 
-	for _, ch := range channels {
-		// Kanal ID'sini kontrol et
-		channelID := ch.ID
-		
-		// ID 0 ise veya zaten kullanılmışsa yeni bir ID ata
-		if channelID == 0 || usedIDs[channelID] {
-			if streamType == "movie" {
-				log.Printf("Assigning new ID %d to channel '%s' (original ID: %d)", channelID, ch.Name, ch.ID)
-			}
-			channelID = autoID
-			autoID++
+func newXtreamChannelConverter(client *xtream.Client) *xtreamChannelConverter {
+	return &xtreamChannelConverter{
+		client:  client,
+		usedIDs: make(map[int]bool),
+	}
+}
+
+// syntheticChannelID ID'si olmayan ya da tekrar eden kanallar için ad ve
+// kategoriden türetilmiş negatif bir ID döndürür. ID senkronizasyonlar
+// arasında aynı kalır ve sağlayıcının pozitif ID'leriyle çakışmaz.
+func syntheticChannelID(ch xtream.Channel) int {
+	id := int(crc32.ChecksumIEEE([]byte(ch.StreamType+":"+ch.CategoryID.String()+":"+ch.Name.String())) & 0x7fffffff)
+	if id == 0 {
+		id = 1
+	}
+	return -id
+}
+
+func (c *xtreamChannelConverter) convert(ch xtream.Channel) db.Channel {
+	// Kanal ID'sini kontrol et
+	channelID := ch.ID.Int()
+
+	// ID 0 ise veya zaten kullanılmışsa kalıcı bir ID türet
+	if channelID <= 0 || c.usedIDs[channelID] {
+		original := channelID
+		channelID = syntheticChannelID(ch)
+		for c.usedIDs[channelID] {
+			channelID--
 		}
-		
-		// ID'yi kullanılmış olarak işaretle
-		usedIDs[channelID] = true
-
-		// Category ID'yi integer'a çevir
-		categoryID := 0
-		if ch.CategoryID != "" {
-			categoryIDInt, err := strconv.Atoi(ch.CategoryID)
-			if err == nil {
-				categoryID = categoryIDInt
-			}
+		if ch.StreamType == "movie" {
+			log.Printf("Assigning new ID %d to channel '%s' (original ID: %d)", channelID, ch.Name, original)
 		}
+	}
 
-		// URL'yi seç (URL dolu değilse StreamURL'yi kullan)
-		ch.URL = h.xtream.GetStreamURL(ch)
-		
-		dbChannel := db.Channel{
-			ID:         channelID,
-			Name:       ch.Name,
-			URL:        ch.URL,
-			StreamType: ch.StreamType,
-			CategoryID: categoryID,
-			StreamIcon: ch.StreamIcon,
-			Rating:     ch.Rating,
-			Extension:  ch.Extension,
-		}
-		result = append(result, dbChannel)
+	// ID'yi kullanılmış olarak işaretle
+	c.usedIDs[channelID] = true
+
+	// Category ID'yi integer'a çevir
+	categoryID := 0
+	if remoteCategoryID, err := ch.GetCategoryID(); err == nil {
+		categoryID = remoteCategoryID
 	}
 
-	return result
+	dbChannel := db.Channel{
+		RemoteID:     channelID,
+		Name:         ch.Name.String(),
+		URL:          xtream.StreamPath(ch),
+		StreamType:   ch.StreamType,
+		CategoryID:   categoryID,
+		StreamIcon:   ch.StreamIcon,
+		Rating:       ch.Rating.String(),
+		Extension:    ch.Extension,
+		EPGChannelID: ch.EPGChannelID,
+		Plot:         strings.TrimSpace(ch.Plot.String()),
+		Genre:        strings.TrimSpace(ch.Genre.String()),
+		Cast:         strings.TrimSpace(ch.Cast.String()),
+		Number:       ch.Num.Int(),
+	}
+	// Arşivi olan canlı kanallar Xtream timeshift URL'leriyle izlenebilir
+	if ch.HasArchive() {
+		dbChannel.Catchup = "xc"
+		dbChannel.CatchupDays = ch.ArchiveDays()
+	}
+	return dbChannel
 }
 
 type Handler struct {
 	player         *player.MPVPlayer
 	db            *db.Database
-	xtream        *xtream.Client
+	// mu oynatma bilgisini (currentChannel, currentCatchup, currentProfile) korur
 	mu            sync.Mutex
 	currentChannel *db.Channel
+	currentCatchup *CatchupInfo
+	currentProfile *PlaybackProfile
+	pinAttempts   pinAttempts
+
+	// syncMu kaynak verisini toplu yazan işlemleri (senkronizasyon, M3U
+	// yükleme, kaynak silme) sıraya koyar; oynatıcı kilidini (mu) tutmaz
+	syncMu sync.Mutex
+	jobs   syncJobs
+	health healthRuns
+
+	// streams /stream altındaki yerel yeniden yayın oturumlarıdır
+	streams *restream.Hub
+	// images /api/images altındaki logo önbelleğidir
+	images imageState
+	// auth sunucu başlatılırken verilen kimlik doğrulama kurallarıdır
+	auth AuthConfig
+	// loginAttempts yönetici parolası denemelerini adrese göre sayar
+	loginAttempts loginAttempts
 }
 
 type ChannelRequest struct {
 	URL string `json:"url"`
 }
 
-func NewHandler(player *player.MPVPlayer, db *db.Database, xtream *xtream.Client) *Handler {
+func NewHandler(player *player.MPVPlayer, db *db.Database) *Handler {
 	return &Handler{
-		player: player,
-		db:     db,
-		xtream: xtream,
+		player:  player,
+		db:      db,
+		streams: restream.NewHub(),
 	}
 }
 
-func (h *Handler) GetChannels(w http.ResponseWriter, r *http.Request) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+// sourceFilter isteğin "source" sorgu parametresini okur, yoksa 0 (tüm kaynaklar) döner
+func sourceFilter(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("source")
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
 
-	// Veritabanından kanalları al
-	channels, err := h.db.GetChannels()
-	if err != nil {
-		log.Printf("Error getting channels from database: %v", err)
-		http.Error(w, "Failed to get channels from database", http.StatusInternalServerError)
+// GetChannels tüm kanalları listeler. Sayfalama, sıralama ve görünüm
+// parametreleri için parseChannelQuery ve writeChannelList'e bakın.
+func (h *Handler) GetChannels(w http.ResponseWriter, r *http.Request) {
+	var q db.ChannelQuery
+	if err := parseChannelQuery(r, &q); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Kanallar boş olsa bile Xtream'den otomatik çekme işlemi yapma
-	// Doğrudan mevcut kanalları JSON olarak döndür
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(channels)
+	h.writeChannelList(w, r, q)
 }
 
 func (h *Handler) GetXtreamSettings(w http.ResponseWriter, r *http.Request) {
@@ -121,6 +168,10 @@ func (h *Handler) GetXtreamSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Şifre yerel ağdaki tarayıcılara gönderilmez
+	if settings.Password != "" {
+		settings.Password = redact.Mask
+	}
 	json.NewEncoder(w).Encode(settings)
 }
 
@@ -131,20 +182,31 @@ func (h *Handler) SaveXtreamSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Maskeli şifre geri gönderildiyse kayıtlı şifre korunur
+	if settings.Password == redact.Mask {
+		current, err := h.db.GetXtreamSettings()
+		if err != nil {
+			http.Error(w, "Failed to get Xtream settings", http.StatusInternalServerError)
+			return
+		}
+		if current == nil {
+			http.Error(w, "Password is required", http.StatusBadRequest)
+			return
+		}
+		settings.Password = current.Password
+	}
+
 	if err := h.db.SaveXtreamSettings(settings); err != nil {
 		http.Error(w, "Failed to save Xtream settings", http.StatusInternalServerError)
 		return
 	}
 
-	// Xtream client'ı güncelle
-	h.xtream = xtream.NewClient(settings.URL, settings.Username, settings.Password)
-
 	w.WriteHeader(http.StatusOK)
 }
 
 // getRedirectURL HTTP isteği yaparak nihai URL'yi döndürür
 func getRedirectURL(initialURL string) (string, error) {
-	log.Printf("Getting redirect URL for: %s", initialURL)
+	log.Printf("Getting redirect URL for: %s", redact.URL(initialURL))
 	
 	// HTTP GET isteği hazırla
 	client := &http.Client{
@@ -189,13 +251,13 @@ func getRedirectURL(initialURL string) (string, error) {
 				location = absoluteURL.String()
 			}
 			
-			log.Printf("Redirect detected: %s -> %s", initialURL, location)
+			log.Printf("Redirect detected: %s -> %s", redact.URL(initialURL), redact.URL(location))
 			return location, nil
 		}
 	}
 	
 	// Redirect yoksa veya location header'ı boşsa orijinal URL'yi döndür
-	log.Printf("No redirect for URL: %s (Status: %d)", initialURL, resp.StatusCode)
+	log.Printf("No redirect for URL: %s (Status: %d)", redact.URL(initialURL), resp.StatusCode)
 	return initialURL, nil
 }
 
@@ -205,6 +267,11 @@ func (h *Handler) PlayChannel(w http.ResponseWriter, r *http.Request) {
 		Name       string `json:"name"`
 		ID         int    `json:"id"`
 		StreamType string `json:"stream_type"`
+		// Resume true ise film ve diziler profilin kaldığı yerden başlar
+		Resume bool `json:"resume"`
+		// PreferredVariant true ise canlı kanalın yerine grubundaki profilin
+		// kalite tercihine uyan sürüm oynatılır
+		PreferredVariant bool `json:"preferred_variant"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -213,6 +280,17 @@ func (h *Handler) PlayChannel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	if req.PreferredVariant && req.ID > 0 {
+		if variant := h.preferredVariant(r, profile, req.ID); variant != nil && variant.ID != req.ID {
+			log.Printf("Playing preferred variant %d (quality %q) of channel %d", variant.ID, variant.Quality, req.ID)
+			req.URL, req.Name, req.ID, req.StreamType = variant.URL, variant.Name, variant.ID, variant.StreamType
+		}
+	}
+
 	// URL kontrolü
 	if req.URL == "" {
 		log.Printf("Error: Empty URL received in PlayChannel")
@@ -221,7 +299,85 @@ func (h *Handler) PlayChannel(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	log.Printf("PlayChannel called with URL: %s, Name: %s, ID: %d, Type: %s", 
-		req.URL, req.Name, req.ID, req.StreamType)
+		redact.URL(req.URL), req.Name, req.ID, req.StreamType)
+
+	// Kanalı, kaynağını ve kanala özel HTTP ayarlarını (M3U #EXTVLCOPT) al.
+	// URL'ler kaynağın kendi ID'si (remote_id) ile oluşturulur.
+	var playOpts player.PlayOptions
+	var source *db.Source
+	var played *db.Channel
+	streamID := req.ID
+	if req.ID > 0 {
+		if ch, err := h.db.GetChannel(req.ID); err != nil {
+			log.Printf("Error getting channel %d: %v", req.ID, err)
+		} else if ch != nil {
+			playOpts = player.PlayOptions{UserAgent: ch.HTTPUserAgent, Referrer: ch.HTTPReferrer}
+			played = ch
+			streamID = ch.RemoteID
+			if source, err = h.db.GetSource(ch.SourceID); err != nil {
+				log.Printf("Error getting source %d: %v", ch.SourceID, err)
+			}
+		}
+	}
+	// Favoriler gibi kanal ID'si olmayan isteklerde URL kayıtlı kanal
+	// URL'sinden kaynağa bağlanır. Tam URL'ler de eşlenir; ID ile gelen
+	// istekte URL başka bir kanala aitse o kanal da ebeveyn denetiminden geçer.
+	var byURL *db.Channel
+	if played == nil || played.URL != req.URL {
+		var err error
+		if byURL, err = h.db.GetChannelByURL(req.URL); err != nil {
+			log.Printf("Error getting channel by url: %v", err)
+			http.Error(w, "Failed to check parental controls", http.StatusInternalServerError)
+			return
+		}
+	}
+	if played == nil && byURL != nil {
+		playOpts = player.PlayOptions{UserAgent: byURL.HTTPUserAgent, Referrer: byURL.HTTPReferrer}
+		played = byURL
+		streamID = byURL.RemoteID
+		var err error
+		if source, err = h.db.GetSource(byURL.SourceID); err != nil {
+			log.Printf("Error getting source %d: %v", byURL.SourceID, err)
+		}
+	}
+	isXtream := source != nil && source.Type == db.SourceXtream
+
+	if played != nil && !h.checkChannelAllowed(w, r, played.ID) {
+		return
+	}
+	if byURL != nil && byURL.ID != played.ID && !h.checkChannelAllowed(w, r, byURL.ID) {
+		return
+	}
+	// Hiçbir kanala ait olmayan URL denetlenemez; kilit açık değilse oynatılmaz
+	if played == nil {
+		filter, ok := h.requireParentalFilter(w, r)
+		if !ok {
+			return
+		}
+		if filter.HideLocked {
+			log.Printf("Refused to play unknown URL while parental controls are locked")
+			writeParentalLocked(w)
+			return
+		}
+	}
+
+	// Ses ve altyazı dili profilin tercihinden gelir
+	playOpts.AudioLanguage = profile.AudioLanguage
+	playOpts.SubtitleLanguage = profile.SubtitleLanguage
+	if req.Resume && played != nil {
+		if start, err := h.db.GetResumePoint(profile.ID, *played); err != nil {
+			log.Printf("Error getting resume point: %v", err)
+		} else {
+			playOpts.Start = start
+		}
+	}
+
+	// Xtream kaynaklarında URL'ler o an sağlıklı olan sunucuya göre oluşturulur
+	var client *xtream.Client
+	if isXtream {
+		client = h.xtreamClient(source)
+		h.ensureHealthyServer(source, client)
+	}
 
 	if h.player == nil {
 		var err error
@@ -246,117 +402,128 @@ func (h *Handler) PlayChannel(w http.ResponseWriter, r *http.Request) {
 	log.Printf("URL has protocol: %v", hasProtocol)
 	
 	// 2. Xtream client ayarları var mı?
-	if !hasProtocol && h.xtream != nil && req.ID > 0 {
-		// Eğer URL'de protokol yoksa ve geçerli bir ID varsa, 
-		// xtream ile tam URL oluştur
-		settings, err := h.db.GetXtreamSettings()
-		if err != nil {
-			log.Printf("Error getting xtream settings: %v", err)
-		}
+	if !hasProtocol && isXtream {
+		// Eğer URL'de protokol yoksa ve kanal bir Xtream kaynağına aitse,
+		// kaynağın bilgileriyle tam URL oluştur
+		log.Printf("Generating URL from source %d. BaseURL: %s", source.ID, client.ActiveServer())
 		
-		if err == nil && settings != nil {
-			log.Printf("Generating URL from Xtream settings. BaseURL: %s", settings.URL)
-			
-			// Film ve dizi için özel endpoint kullan
-			baseURL := settings.URL
-			userName := settings.Username
-			password := settings.Password
+		// Film ve dizi için özel endpoint kullan
+		baseURL := client.ActiveServer()
+		userName := source.Username
+		password := source.Password
+		
+		// URL'nin sonunda / var mı kontrol et ve temizle
+		baseURL = strings.TrimSuffix(baseURL, "/")
+		
+		if req.StreamType == "movie" {
+			originalURL := playURL
+			// Movie ID kullanarak Xtream formatında URL oluştur
+			// VOD içerik için alternatif API endpoint formatları:
+			// 1. standart movie endpoint: http://example.com:80/movie/username/password/12345.mp4
+			if resolved, ok := client.ResolveStreamPath(playURL); ok {
+				playURL = resolved
+			} else {
+				playURL = fmt.Sprintf("%s/movie/%s/%s/%d.mp4", baseURL, userName, password, streamID)
+			}
+			log.Printf("Generated standard movie URL: %s (original: %s)", redact.URL(playURL), redact.URL(originalURL))
 			
-			// URL'nin sonunda / var mı kontrol et ve temizle
-			baseURL = strings.TrimSuffix(baseURL, "/")
+			// Filmler için oluşturulan URL'yi doğrudan oynamak yerine
+			// redirect URL'yi tespit et ve o adresi oyna
+			redirectURL, err := getRedirectURL(playURL)
+			if err != nil {
+				log.Printf("Error getting redirect URL: %v", redact.Error(err))
+			} else if redirectURL != playURL {
+				log.Printf("Found redirect URL: %s", redact.URL(redirectURL))
+				playURL = redirectURL
+			}
 			
-			if req.StreamType == "movie" {
-				originalURL := playURL
-				// Movie ID kullanarak Xtream formatında URL oluştur
-				// VOD içerik için alternatif API endpoint formatları:
-				// 1. standart movie endpoint: http://example.com:80/movie/username/password/12345.mp4
-				playURL = fmt.Sprintf("%s/movie/%s/%s/%d.mp4", baseURL, userName, password, req.ID)
-				log.Printf("Generated standard movie URL: %s (original: %s)", playURL, originalURL)
-				
-				// Filmler için oluşturulan URL'yi doğrudan oynamak yerine
-				// redirect URL'yi tespit et ve o adresi oyna
-				redirectURL, err := getRedirectURL(playURL)
-				if err != nil {
-					log.Printf("Error getting redirect URL: %v", err)
-				} else if redirectURL != playURL {
-					log.Printf("Found redirect URL: %s", redirectURL)
-					playURL = redirectURL
-				}
-				
-				// Film URL'lerini backendde oluşturarak hazırda tut
-				alternativeURLs := []string{
-					// 2. vod endpoint: http://example.com:80/vod/username/password/12345.mp4
-					fmt.Sprintf("%s/vod/%s/%s/%d.mp4", baseURL, userName, password, req.ID),
-					
-					// 3. XC get.php API: http://example.com:80/get.php?username=user&password=pass&type=movie&id=12345
-					fmt.Sprintf("%s/get.php?username=%s&password=%s&type=movie&id=%d", 
-						baseURL, userName, password, req.ID),
-					
-					// 4. Uzantısız formata
-					fmt.Sprintf("%s/movie/%s/%s/%d", baseURL, userName, password, req.ID),
-					
-					// 5. m3u8 formatı
-					fmt.Sprintf("%s/movie/%s/%s/%d.m3u8", baseURL, userName, password, req.ID),
-				}
+			// Film URL'lerini backendde oluşturarak hazırda tut
+			alternativeURLs := []string{
+				// 2. vod endpoint: http://example.com:80/vod/username/password/12345.mp4
+				fmt.Sprintf("%s/vod/%s/%s/%d.mp4", baseURL, userName, password, streamID),
 				
-				// Alternatif URL'leri log dosyasına yaz
-				for i, altURL := range alternativeURLs {
-					log.Printf("Alternative movie URL #%d: %s", i+1, altURL)
-				}
-			} else if req.StreamType == "series" {
-				originalURL := playURL
-				// Series ID kullanarak Xtream formatında URL oluştur
-				// Series içerik için API endpoint formatı:
-				// http://example.com:80/series/username/password/12345.mp4
-				playURL = fmt.Sprintf("%s/series/%s/%s/%d.mp4", baseURL, userName, password, req.ID)
-				log.Printf("Generated series URL: %s (original: %s)", playURL, originalURL)
+				// 3. XC get.php API: http://example.com:80/get.php?username=user&password=pass&type=movie&id=12345
+				fmt.Sprintf("%s/get.php?username=%s&password=%s&type=movie&id=%d", 
+					baseURL, userName, password, streamID),
 				
-				// Diziler için oluşturulan URL'yi doğrudan oynamak yerine
-				// redirect URL'yi tespit et ve o adresi oyna
-				redirectURL, err := getRedirectURL(playURL)
-				if err != nil {
-					log.Printf("Error getting redirect URL: %v", err)
-				} else if redirectURL != playURL {
-					log.Printf("Found redirect URL: %s", redirectURL)
-					playURL = redirectURL
-				}
+				// 4. Uzantısız formata
+				fmt.Sprintf("%s/movie/%s/%s/%d", baseURL, userName, password, streamID),
 				
-				// Alternatif series URL'leri
-				alternativeURLs := []string{
-					// Uzantısız
-					fmt.Sprintf("%s/series/%s/%s/%d", baseURL, userName, password, req.ID),
-					
-					// m3u8 formatı
-					fmt.Sprintf("%s/series/%s/%s/%d.m3u8", baseURL, userName, password, req.ID),
-				}
+				// 5. m3u8 formatı
+				fmt.Sprintf("%s/movie/%s/%s/%d.m3u8", baseURL, userName, password, streamID),
+			}
+			
+			// Alternatif URL'leri log dosyasına yaz
+			for i, altURL := range alternativeURLs {
+				log.Printf("Alternative movie URL #%d: %s", i+1, redact.URL(altURL))
+			}
+		} else if req.StreamType == "series" {
+			originalURL := playURL
+			// Series ID kullanarak Xtream formatında URL oluştur
+			// Series içerik için API endpoint formatı:
+			// http://example.com:80/series/username/password/12345.mp4
+			if resolved, ok := client.ResolveStreamPath(playURL); ok {
+				playURL = resolved
+			} else {
+				playURL = fmt.Sprintf("%s/series/%s/%s/%d.mp4", baseURL, userName, password, streamID)
+			}
+			log.Printf("Generated series URL: %s (original: %s)", redact.URL(playURL), redact.URL(originalURL))
+			
+			// Diziler için oluşturulan URL'yi doğrudan oynamak yerine
+			// redirect URL'yi tespit et ve o adresi oyna
+			redirectURL, err := getRedirectURL(playURL)
+			if err != nil {
+				log.Printf("Error getting redirect URL: %v", redact.Error(err))
+			} else if redirectURL != playURL {
+				log.Printf("Found redirect URL: %s", redact.URL(redirectURL))
+				playURL = redirectURL
+			}
+			
+			// Alternatif series URL'leri
+			alternativeURLs := []string{
+				// Uzantısız
+				fmt.Sprintf("%s/series/%s/%s/%d", baseURL, userName, password, streamID),
 				
-				// Alternatif URL'leri log dosyasına yaz
-				for i, altURL := range alternativeURLs {
-					log.Printf("Alternative series URL #%d: %s", i+1, altURL)
-				}
-			} else if req.StreamType == "live" {
-				originalURL := playURL
-				// Live stream için URL oluştur
-				// format: http://example.com:80/live/username/password/12345.ts
-				playURL = fmt.Sprintf("%s/live/%s/%s/%d", baseURL, userName, password, req.ID)
-				log.Printf("Generated live URL: %s (original: %s)", playURL, originalURL)
+				// m3u8 formatı
+				fmt.Sprintf("%s/series/%s/%s/%d.m3u8", baseURL, userName, password, streamID),
 			}
-		} else {
-			log.Printf("No Xtream settings found or error: %v", err)
+			
+			// Alternatif URL'leri log dosyasına yaz
+			for i, altURL := range alternativeURLs {
+				log.Printf("Alternative series URL #%d: %s", i+1, redact.URL(altURL))
+			}
+		} else if req.StreamType == "live" {
+			originalURL := playURL
+			// Live stream için URL oluştur
+			// format: http://example.com:80/live/username/password/12345.ts
+			if resolved, ok := client.ResolveStreamPath(playURL); ok {
+				playURL = resolved
+			} else {
+				playURL = fmt.Sprintf("%s/live/%s/%s/%d", baseURL, userName, password, streamID)
+			}
+			log.Printf("Generated live URL: %s (original: %s)", redact.URL(playURL), redact.URL(originalURL))
 		}
 	} else if !hasProtocol {
 		log.Printf("Cannot generate URL: hasProtocol=%v, xtream=%v, ID=%d", 
-			hasProtocol, h.xtream != nil, req.ID)
+			hasProtocol, isXtream, req.ID)
 	}
 	
+	// Senkronizasyonda oluşturulan URL başka bir sunucuya aitse aktif sunucuya taşı
+	if hasProtocol && isXtream {
+		if rebased := client.RebaseURL(playURL); rebased != playURL {
+			log.Printf("Moved stream URL to active server %s", client.ActiveServer())
+			playURL = rebased
+		}
+	}
+
 	// Eğer film veya dizi ise ve protokol ile başlıyorsa redirect URL kontrolü yap
 	if hasProtocol && (req.StreamType == "movie" || req.StreamType == "series") {
 		// Redirect URL'yi kontrol et
 		redirectURL, err := getRedirectURL(playURL)
 		if err != nil {
-			log.Printf("Error getting redirect URL: %v", err)
+			log.Printf("Error getting redirect URL: %v", redact.Error(err))
 		} else if redirectURL != playURL {
-			log.Printf("Found redirect URL for direct URL: %s", redirectURL)
+			log.Printf("Found redirect URL for direct URL: %s", redact.URL(redirectURL))
 			playURL = redirectURL
 		}
 	}
@@ -369,9 +536,20 @@ func (h *Handler) PlayChannel(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Debug: URL'yi logla
-	log.Printf("Final URL that will be played: %s", playURL)
+	log.Printf("Final URL that will be played: %s", redact.URL(playURL))
+
+	// Oynatılan film ya da dizide kalınan yer kanal değişmeden kaydedilir
+	h.saveResumePoint()
 
-	if err := h.player.Play(playURL); err != nil {
+	err := h.player.PlayWithOptions(playURL, playOpts)
+	// mpv akışı kabul eder etmez döndüğünden, yedek sürümü olan canlı
+	// kanallarda açılamayan akış ancak oynatmanın başlaması beklenerek anlaşılır
+	if err == nil && h.hasVariants(profile, played) {
+		if err = h.player.WaitForPlayback(playURL, variantStartTimeout); err != nil {
+			log.Printf("Channel %d did not start: %v", played.ID, err)
+		}
+	}
+	if err != nil {
 		log.Printf("Error playing URL: %v, trying different format", err)
 		
 		// Film ya da dizi için farklı uzantılar ve formatlar deneyelim
@@ -379,70 +557,63 @@ func (h *Handler) PlayChannel(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Trying alternative movie URLs")
 			
 			// Alternatif URL'leri dene
-			if h.xtream != nil && req.ID > 0 {
-				settings, err := h.db.GetXtreamSettings()
-				if err == nil && settings != nil {
-					baseURL := settings.URL
-					userName := settings.Username
-					password := settings.Password
+			if isXtream {
+				baseURL := client.ActiveServer()
+				userName := source.Username
+				password := source.Password
+				
+				// URL'nin sonunda / var mı kontrol et ve temizle
+				baseURL = strings.TrimSuffix(baseURL, "/")
+				
+				// Önceden hazırladığımız alternatif URL'leri dene
+				alternativeURLs := []string{
+					// 2. vod endpoint
+					fmt.Sprintf("%s/vod/%s/%s/%d.mp4", baseURL, userName, password, streamID),
+					
+					// 3. XC get.php API
+					fmt.Sprintf("%s/get.php?username=%s&password=%s&type=movie&id=%d", 
+						baseURL, userName, password, streamID),
+					
+					// 4. Uzantısız format
+					fmt.Sprintf("%s/movie/%s/%s/%d", baseURL, userName, password, streamID),
 					
-					// URL'nin sonunda / var mı kontrol et ve temizle
-					baseURL = strings.TrimSuffix(baseURL, "/")
+					// 5. m3u8 formatı
+					fmt.Sprintf("%s/movie/%s/%s/%d.m3u8", baseURL, userName, password, streamID),
+					
+					// 6. mkv formatı
+					fmt.Sprintf("%s/movie/%s/%s/%d.mkv", baseURL, userName, password, streamID),
 					
-					// Önceden hazırladığımız alternatif URL'leri dene
-					alternativeURLs := []string{
-						// 2. vod endpoint
-						fmt.Sprintf("%s/vod/%s/%s/%d.mp4", baseURL, userName, password, req.ID),
-						
-						// 3. XC get.php API
-						fmt.Sprintf("%s/get.php?username=%s&password=%s&type=movie&id=%d", 
-							baseURL, userName, password, req.ID),
-						
-						// 4. Uzantısız format
-						fmt.Sprintf("%s/movie/%s/%s/%d", baseURL, userName, password, req.ID),
-						
-						// 5. m3u8 formatı
-						fmt.Sprintf("%s/movie/%s/%s/%d.m3u8", baseURL, userName, password, req.ID),
-						
-						// 6. mkv formatı
-						fmt.Sprintf("%s/movie/%s/%s/%d.mkv", baseURL, userName, password, req.ID),
-						
-						// 7. ts formatı
-						fmt.Sprintf("%s/movie/%s/%s/%d.ts", baseURL, userName, password, req.ID),
+					// 7. ts formatı
+					fmt.Sprintf("%s/movie/%s/%s/%d.ts", baseURL, userName, password, streamID),
+				}
+				
+				// Her bir alternatif URL'yi dene
+				for i, altURL := range alternativeURLs {
+					log.Printf("Trying alternative movie URL #%d: %s", i+1, redact.URL(altURL))
+					
+					// Önce redirect URL'yi kontrol et
+					redirectURL, err := getRedirectURL(altURL)
+					if err != nil {
+						log.Printf("Error getting redirect URL for alt #%d: %v", i+1, redact.Error(err))
+					} else if redirectURL != altURL {
+						log.Printf("Found redirect URL for alt #%d: %s", i+1, redact.URL(redirectURL))
+						altURL = redirectURL
+					}
+					
+					if err := h.player.Play(altURL); err != nil {
+						log.Printf("Error playing alternative URL #%d: %v", i+1, err)
+					} else {
+						log.Printf("Successfully playing alternative URL #%d", i+1)
+						// Başarılı olduysa döngüden çık
+						break
 					}
 					
-					// Her bir alternatif URL'yi dene
-					for i, altURL := range alternativeURLs {
-						log.Printf("Trying alternative movie URL #%d: %s", i+1, altURL)
-						
-						// Önce redirect URL'yi kontrol et
-						redirectURL, err := getRedirectURL(altURL)
-						if err != nil {
-							log.Printf("Error getting redirect URL for alt #%d: %v", i+1, err)
-						} else if redirectURL != altURL {
-							log.Printf("Found redirect URL for alt #%d: %s", i+1, redirectURL)
-							altURL = redirectURL
-						}
-						
-						if err := h.player.Play(altURL); err != nil {
-							log.Printf("Error playing alternative URL #%d: %v", i+1, err)
-						} else {
-							log.Printf("Successfully playing alternative URL #%d", i+1)
-							// Başarılı olduysa döngüden çık
-							break
-						}
-						
-						// Son alternatif de denendiyse ve hala başarısızsa hata döndür
-						if i == len(alternativeURLs)-1 {
-							log.Printf("All alternative URLs failed")
-							http.Error(w, "Failed to play movie with any format", http.StatusInternalServerError)
-							return
-						}
+					// Son alternatif de denendiyse ve hala başarısızsa hata döndür
+					if i == len(alternativeURLs)-1 {
+						log.Printf("All alternative URLs failed")
+						http.Error(w, "Failed to play movie with any format", http.StatusInternalServerError)
+						return
 					}
-				} else {
-					log.Printf("No Xtream settings available for generating alternative URLs")
-					http.Error(w, "Failed to play movie", http.StatusInternalServerError)
-					return
 				}
 			} else {
 				log.Printf("No Xtream client or invalid ID for generating alternative URLs")
@@ -451,63 +622,56 @@ func (h *Handler) PlayChannel(w http.ResponseWriter, r *http.Request) {
 			}
 		} else if req.StreamType == "series" {
 			// Farklı uzantıları dene
-			if h.xtream != nil && req.ID > 0 {
-				settings, err := h.db.GetXtreamSettings()
-				if err == nil && settings != nil {
-					baseURL := settings.URL
-					userName := settings.Username
-					password := settings.Password
+			if isXtream {
+				baseURL := client.ActiveServer()
+				userName := source.Username
+				password := source.Password
+				
+				// URL'nin sonunda / var mı kontrol et ve temizle
+				baseURL = strings.TrimSuffix(baseURL, "/")
+				
+				// Alternatif series URL'leri
+				alternativeURLs := []string{
+					// Uzantısız
+					fmt.Sprintf("%s/series/%s/%s/%d", baseURL, userName, password, streamID),
+					
+					// m3u8 formatı
+					fmt.Sprintf("%s/series/%s/%s/%d.m3u8", baseURL, userName, password, streamID),
+					
+					// mkv formatı
+					fmt.Sprintf("%s/series/%s/%s/%d.mkv", baseURL, userName, password, streamID),
+					
+					// ts formatı
+					fmt.Sprintf("%s/series/%s/%s/%d.ts", baseURL, userName, password, streamID),
+				}
+				
+				// Her bir alternatif URL'yi dene
+				for i, altURL := range alternativeURLs {
+					log.Printf("Trying alternative series URL #%d: %s", i+1, redact.URL(altURL))
 					
-					// URL'nin sonunda / var mı kontrol et ve temizle
-					baseURL = strings.TrimSuffix(baseURL, "/")
+					// Önce redirect URL'yi kontrol et
+					redirectURL, err := getRedirectURL(altURL)
+					if err != nil {
+						log.Printf("Error getting redirect URL for alt series #%d: %v", i+1, redact.Error(err))
+					} else if redirectURL != altURL {
+						log.Printf("Found redirect URL for alt series #%d: %s", i+1, redact.URL(redirectURL))
+						altURL = redirectURL
+					}
 					
-					// Alternatif series URL'leri
-					alternativeURLs := []string{
-						// Uzantısız
-						fmt.Sprintf("%s/series/%s/%s/%d", baseURL, userName, password, req.ID),
-						
-						// m3u8 formatı
-						fmt.Sprintf("%s/series/%s/%s/%d.m3u8", baseURL, userName, password, req.ID),
-						
-						// mkv formatı
-						fmt.Sprintf("%s/series/%s/%s/%d.mkv", baseURL, userName, password, req.ID),
-						
-						// ts formatı
-						fmt.Sprintf("%s/series/%s/%s/%d.ts", baseURL, userName, password, req.ID),
+					if err := h.player.Play(altURL); err != nil {
+						log.Printf("Error playing alternative URL #%d: %v", i+1, err)
+					} else {
+						log.Printf("Successfully playing alternative URL #%d", i+1)
+						// Başarılı olduysa döngüden çık
+						break
 					}
 					
-					// Her bir alternatif URL'yi dene
-					for i, altURL := range alternativeURLs {
-						log.Printf("Trying alternative series URL #%d: %s", i+1, altURL)
-						
-						// Önce redirect URL'yi kontrol et
-						redirectURL, err := getRedirectURL(altURL)
-						if err != nil {
-							log.Printf("Error getting redirect URL for alt series #%d: %v", i+1, err)
-						} else if redirectURL != altURL {
-							log.Printf("Found redirect URL for alt series #%d: %s", i+1, redirectURL)
-							altURL = redirectURL
-						}
-						
-						if err := h.player.Play(altURL); err != nil {
-							log.Printf("Error playing alternative URL #%d: %v", i+1, err)
-						} else {
-							log.Printf("Successfully playing alternative URL #%d", i+1)
-							// Başarılı olduysa döngüden çık
-							break
-						}
-						
-						// Son alternatif de denendiyse ve hala başarısızsa hata döndür
-						if i == len(alternativeURLs)-1 {
-							log.Printf("All alternative URLs failed")
-							http.Error(w, "Failed to play series with any format", http.StatusInternalServerError)
-							return
-						}
+					// Son alternatif de denendiyse ve hala başarısızsa hata döndür
+					if i == len(alternativeURLs)-1 {
+						log.Printf("All alternative URLs failed")
+						http.Error(w, "Failed to play series with any format", http.StatusInternalServerError)
+						return
 					}
-				} else {
-					log.Printf("No Xtream settings available for generating alternative series URLs")
-					http.Error(w, "Failed to play series", http.StatusInternalServerError)
-					return
 				}
 			} else {
 				log.Printf("No Xtream client or invalid ID for generating alternative series URLs")
@@ -515,19 +679,36 @@ func (h *Handler) PlayChannel(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		} else {
-			// Film veya dizi değilse, orijinal hata döndür
-			http.Error(w, "Failed to play URL", http.StatusInternalServerError)
-			return
+			// Canlı kanal açılamazsa grubundaki diğer kalite ve yedek
+			// sürümleri denenir; hiçbiri açılmazsa orijinal hata döner
+			variant, variantSource := h.playVariantFallback(r, profile, played)
+			if variant == nil {
+				http.Error(w, "Failed to play URL", http.StatusInternalServerError)
+				return
+			}
+			played, source = variant, variantSource
+			req.URL, req.Name, req.ID = variant.URL, variant.Name, variant.ID
+			streamID = variant.RemoteID
 		}
 	}
 
 	// Kanal bilgisini sakla
-	h.currentChannel = &db.Channel{
+	current := &db.Channel{
 		URL:        req.URL,
 		Name:       req.Name,
 		ID:         req.ID,
 		StreamType: req.StreamType,
 	}
+	if source != nil {
+		current.SourceID = source.ID
+		current.RemoteID = streamID
+	}
+	h.setPlayback(current, nil, &PlaybackProfile{ID: profile.ID, Name: profile.Name})
+	if played != nil {
+		if err := h.db.AddWatchHistory(profile.ID, *played); err != nil {
+			log.Printf("Error adding watch history: %v", err)
+		}
+	}
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -538,75 +719,74 @@ func (h *Handler) StopChannel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.saveResumePoint()
 	if err := h.player.Stop(); err != nil {
 		log.Printf("Error stopping player: %v", err)
 		http.Error(w, "Failed to stop player", http.StatusInternalServerError)
 		return
 	}
 
-	h.currentChannel = nil
+	h.setPlayback(nil, nil, nil)
 	w.WriteHeader(http.StatusOK)
 }
 
-func (h *Handler) GetFavorites(w http.ResponseWriter, r *http.Request) {
-	log.Println("Getting favorites...")
-	favorites, err := h.db.GetFavorites()
-	if err != nil {
-		log.Printf("Error getting favorites: %v", err)
-		http.Error(w, "Failed to fetch favorites", http.StatusInternalServerError)
+// writeCategories türün kategorilerini yazar. Yerel olarak ya da profilde
+// gizlenen kategoriler atlanır; ?include_hidden=true ile "hidden" işaretiyle döner.
+// Kilitli kategoriler yalnızca ebeveyn kilidi açıkken "locked" işaretiyle
+// listelenir.
+func (h *Handler) writeCategories(w http.ResponseWriter, r *http.Request, categoryType string) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
 		return
 	}
-
-	log.Printf("Found %d favorites", len(favorites))
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(favorites)
-}
-
-func (h *Handler) AddFavorite(w http.ResponseWriter, r *http.Request) {
-	var channel db.Channel
-	if err := json.NewDecoder(r.Body).Decode(&channel); err != nil {
-		log.Printf("Error decoding favorite request: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	sourceID, err := sourceFilter(r)
+	if err != nil {
+		http.Error(w, "Invalid source ID", http.StatusBadRequest)
 		return
 	}
-
-	log.Printf("Adding favorite - Name: %s, URL: %s", channel.Name, channel.URL)
-
-	if err := h.db.AddFavorite(channel.Name, channel.URL); err != nil {
-		log.Printf("Error adding favorite: %v", err)
-		http.Error(w, "Failed to add favorite", http.StatusInternalServerError)
+	categories, err := h.db.GetCategories(categoryType, sourceID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	log.Printf("Successfully added favorite: %s", channel.Name)
-	w.WriteHeader(http.StatusOK)
-}
-
-func (h *Handler) GetLiveCategories(w http.ResponseWriter, r *http.Request) {
-	categories, err := h.db.GetCategories("live")
+	hidden, err := h.db.HiddenCategories(profile.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	json.NewEncoder(w).Encode(categories)
-}
-
-func (h *Handler) GetMovieCategories(w http.ResponseWriter, r *http.Request) {
-	categories, err := h.db.GetCategories("movie")
+	filter, ok := h.requireParentalFilter(w, r)
+	if !ok {
+		return
+	}
+	locked, err := h.db.LockedCategories()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	json.NewEncoder(w).Encode(categories)
+
+	includeHidden := r.URL.Query().Get("include_hidden") == "true"
+	visible := categories[:0]
+	for _, cat := range categories {
+		cat.Hidden = cat.Hidden || hidden[cat.ID]
+		cat.Locked = locked[cat.ID]
+		if (cat.Hidden && !includeHidden) || (cat.Locked && filter.HideLocked) {
+			continue
+		}
+		visible = append(visible, cat)
+	}
+	json.NewEncoder(w).Encode(visible)
+}
+
+func (h *Handler) GetLiveCategories(w http.ResponseWriter, r *http.Request) {
+	h.writeCategories(w, r, "live")
+}
+
+func (h *Handler) GetMovieCategories(w http.ResponseWriter, r *http.Request) {
+	h.writeCategories(w, r, "movie")
 }
 
 func (h *Handler) GetSeriesCategories(w http.ResponseWriter, r *http.Request) {
-	categories, err := h.db.GetCategories("series")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	json.NewEncoder(w).Encode(categories)
+	h.writeCategories(w, r, "series")
 }
 
 // convertXtreamCategories converts xtream categories to database categories
@@ -619,211 +799,21 @@ func convertXtreamCategories(categories []xtream.Category, streamType string) []
 			continue
 		}
 		result = append(result, db.Category{
-			ID:   id,
-			Name: cat.Name,
-			Type: streamType,
+			RemoteID: id,
+			Name:     cat.Name.String(),
+			Type:     streamType,
 		})
 	}
 	return result
 }
 
-func (h *Handler) UpdateChannels(w http.ResponseWriter, r *http.Request) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	log.Println("Starting channel update process...")
-
-	// Xtream ayarlarını kontrol et
-	settings, err := h.db.GetXtreamSettings()
-	if err != nil {
-		log.Printf("Error getting Xtream settings: %v", err)
-		http.Error(w, "Failed to get Xtream settings", http.StatusInternalServerError)
-		return
-	}
-
-	if settings == nil {
-		log.Println("No Xtream settings found")
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "xtream_settings_required",
-		})
-		return
-	}
-
-	// Xtream client'ı güncelle
-	h.xtream = xtream.NewClient(settings.URL, settings.Username, settings.Password)
-
-	// Kategori ve kanal verileri için bir grup oluştur
-	var wg sync.WaitGroup
-	var categoryErr, channelErr error
-	var liveCategories, movieCategories, seriesCategories []xtream.Category
-	var liveStreams, movies, series []xtream.Channel
-
-	// Kategorileri paralel olarak çek
-	wg.Add(3)
-	go func() {
-		defer wg.Done()
-		log.Println("Fetching live categories...")
-		categories, err := h.xtream.GetLiveCategories()
-		if err != nil {
-			log.Printf("Error fetching live categories: %v", err)
-			categoryErr = err
-			return
-		}
-		liveCategories = categories
-		log.Printf("Found %d live categories", len(liveCategories))
-	}()
-
-	go func() {
-		defer wg.Done()
-		log.Println("Fetching movie categories...")
-		categories, err := h.xtream.GetMovieCategories()
-		if err != nil {
-			log.Printf("Error fetching movie categories: %v", err)
-			categoryErr = err
-			return
-		}
-		movieCategories = categories
-		log.Printf("Found %d movie categories", len(movieCategories))
-	}()
-
-	go func() {
-		defer wg.Done()
-		log.Println("Fetching series categories...")
-		categories, err := h.xtream.GetSeriesCategories()
-		if err != nil {
-			log.Printf("Error fetching series categories: %v", err)
-			categoryErr = err
-			return
-		}
-		seriesCategories = categories
-		log.Printf("Found %d series categories", len(seriesCategories))
-	}()
-
-	wg.Wait()
-
-	if categoryErr != nil {
-		http.Error(w, "Failed to fetch categories", http.StatusInternalServerError)
-		return
-	}
-
-	// Kategorileri veritabanına kaydet
-	log.Println("Saving categories to database...")
-	if err := h.db.SaveCategories(convertXtreamCategories(liveCategories, "live")); err != nil {
-		log.Printf("Error saving live categories: %v", err)
-		http.Error(w, "Failed to save categories", http.StatusInternalServerError)
-		return
-	}
-
-	if err := h.db.SaveCategories(convertXtreamCategories(movieCategories, "movie")); err != nil {
-		log.Printf("Error saving movie categories: %v", err)
-		http.Error(w, "Failed to save categories", http.StatusInternalServerError)
-		return
-	}
-
-	if err := h.db.SaveCategories(convertXtreamCategories(seriesCategories, "series")); err != nil {
-		log.Printf("Error saving series categories: %v", err)
-		http.Error(w, "Failed to save categories", http.StatusInternalServerError)
-		return
-	}
-	
-	// Kanal verilerini paralel olarak çek
-	wg.Add(3)
-	go func() {
-		defer wg.Done()
-		log.Println("Fetching live streams...")
-		streams, err := h.xtream.GetLiveStreams()
-		if err != nil {
-			log.Printf("Error fetching live streams: %v", err)
-			channelErr = err
-			return
-		}
-		liveStreams = streams
-		log.Printf("Found %d live streams", len(liveStreams))
-	}()
-
-	go func() {
-		defer wg.Done()
-		log.Println("Fetching movies...")
-		videoStreams, err := h.xtream.GetMovieStreams()
-		if err != nil {
-			log.Printf("Error fetching movies: %v", err)
-			channelErr = err
-			return
-		}
-		movies = videoStreams
-		log.Printf("Found %d movies", len(movies))
-	}()
-
-	go func() {
-		defer wg.Done()
-		log.Println("Fetching series...")
-		seriesStreams, err := h.xtream.GetSeriesStreams()
-		if err != nil {
-			log.Printf("Error fetching series: %v", err)
-			channelErr = err
-			return
-		}
-		series = seriesStreams
-		log.Printf("Found %d series", len(series))
-	}()
-
-	wg.Wait()
-
-	if channelErr != nil {
-		http.Error(w, "Failed to fetch channel data", http.StatusInternalServerError)
-		return
-	}
-
-	// Tüm kanalları veritabanına kaydet
-	log.Println("Saving channels to database...")
-	allChannels := append(append(
-		h.convertXtreamChannels(liveStreams, "live"),
-		h.convertXtreamChannels(movies, "movie")...),
-		h.convertXtreamChannels(series, "series")...)
-
-	if err := h.db.SaveChannels(allChannels); err != nil {
-		log.Printf("Error saving channels: %v", err)
-		http.Error(w, "Failed to save channels", http.StatusInternalServerError)
-		return
-	}
-
-	log.Println("Channel update process completed successfully")
-	w.WriteHeader(http.StatusOK)
-}
-
-func (h *Handler) RemoveFavorite(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	// String id'yi integer'a dönüştür
-	idInt, err := strconv.Atoi(id)
-	if err != nil {
-		http.Error(w, "Invalid ID format", http.StatusBadRequest)
-		return
-	}
-
-	if err := h.db.RemoveFavorite(idInt); err != nil {
-		http.Error(w, "Failed to remove favorite", http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-}
-
 func (h *Handler) GetChannelsByType(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	streamType := vars["type"]
-
-	channels, err := h.db.GetChannelsByType(streamType)
-	if err != nil {
-		http.Error(w, "Failed to get channels", http.StatusInternalServerError)
+	q := db.ChannelQuery{StreamType: mux.Vars(r)["type"]}
+	if err := parseChannelQuery(r, &q); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(channels)
+	h.writeChannelList(w, r, q)
 }
 
 func (h *Handler) GetChannelsByCategory(w http.ResponseWriter, r *http.Request) {
@@ -831,8 +821,6 @@ func (h *Handler) GetChannelsByCategory(w http.ResponseWriter, r *http.Request)
 	streamType := vars["type"]
 	categoryID := vars["categoryId"]
 
-	log.Printf("GetChannelsByCategory - Type: %s, CategoryID: %s", streamType, categoryID)
-
 	// String categoryID'yi integer'a dönüştür
 	categoryIDInt, err := strconv.Atoi(categoryID)
 	if err != nil {
@@ -841,39 +829,44 @@ func (h *Handler) GetChannelsByCategory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Stream type'ı kontrol et ve düzelt
-	var dbStreamType string
+	// Stream type'ı kontrol et
 	switch streamType {
-	case "live":
-		dbStreamType = "live"
-	case "movie":
-		dbStreamType = "movie"
-	case "series":
-		dbStreamType = "series"
+	case "live", "movie", "series":
 	default:
 		log.Printf("Invalid stream type: %s", streamType)
 		http.Error(w, "Invalid stream type", http.StatusBadRequest)
 		return
 	}
 
-	channels, err := h.db.GetChannelsByCategory(dbStreamType, categoryIDInt)
-	if err != nil {
-		log.Printf("Error getting channels by category: %v", err)
-		http.Error(w, "Failed to get channels", http.StatusInternalServerError)
+	q := db.ChannelQuery{StreamType: streamType, CategoryID: categoryIDInt, HasCategory: true}
+	if err := parseChannelQuery(r, &q); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	log.Printf("Found %d channels for type %s and category %d", len(channels), dbStreamType, categoryIDInt)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(channels)
+	h.writeChannelList(w, r, q)
 }
 
-func EnableCORS(next http.Handler) http.Handler {
+// enableCORS izin verilen kaynaklara CORS başlıklarını yazar ve ön
+// kontrol isteklerini yanıtlar
+func (h *Handler) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		if origin := r.Header.Get("Origin"); origin != "" {
+			w.Header().Add("Vary", "Origin")
+			for _, allowed := range h.auth.AllowedOrigins {
+				if allowed == "*" {
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+					break
+				}
+				if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+					break
+				}
+			}
+		}
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-None-Match, Range, X-Profile-ID, X-Profile-Session, X-Parental-Session")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Total-Count, Location, Content-Range, Content-Length")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -885,30 +878,119 @@ func EnableCORS(next http.Handler) http.Handler {
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
-	router.Use(EnableCORS)
-
+	router.Use(h.enableCORS, h.authenticate)
+
+	router.HandleFunc("/api/auth/status", h.GetAuthStatus).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/auth/login", h.Login).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/auth/logout", h.Logout).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/auth/password", h.SetAdminPassword).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/auth/tokens", h.GetAPITokens).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/auth/tokens", h.CreateAPIToken).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/auth/tokens/{id:[0-9]+}", h.DeleteAPIToken).Methods("DELETE", "OPTIONS")
 	router.HandleFunc("/api/channels", h.GetChannels).Methods("GET", "OPTIONS")
-	router.HandleFunc("/api/channels/live", h.GetChannelsByType).Methods("GET", "OPTIONS")
-	router.HandleFunc("/api/channels/movie", h.GetChannelsByType).Methods("GET", "OPTIONS")
-	router.HandleFunc("/api/channels/series", h.GetChannelsByType).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/channels/{type:live|movie|series}", h.GetChannelsByType).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/channels/{id:[0-9]+}/variants", h.GetChannelVariants).Methods("GET", "OPTIONS")
 	router.HandleFunc("/api/channels/{type}/{categoryId}", h.GetChannelsByCategory).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/search", h.Search).Methods("GET", "OPTIONS")
 	router.HandleFunc("/api/categories/live", h.GetLiveCategories).Methods("GET", "OPTIONS")
 	router.HandleFunc("/api/categories/movie", h.GetMovieCategories).Methods("GET", "OPTIONS")
 	router.HandleFunc("/api/categories/series", h.GetSeriesCategories).Methods("GET", "OPTIONS")
 	router.HandleFunc("/api/player/play", h.PlayChannel).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/player/catchup", h.PlayCatchup).Methods("POST", "OPTIONS")
 	router.HandleFunc("/api/player/stop", h.StopChannel).Methods("POST", "OPTIONS")
 	router.HandleFunc("/api/player/status", h.GetPlayerStatus).Methods("GET", "OPTIONS")
 	router.HandleFunc("/api/favorites", h.GetFavorites).Methods("GET", "OPTIONS")
 	router.HandleFunc("/api/favorites", h.AddFavorite).Methods("POST", "OPTIONS")
-	router.HandleFunc("/api/favorites/{id}", h.RemoveFavorite).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/favorites/{id:[0-9]+}", h.UpdateFavorite).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/favorites/{id:[0-9]+}", h.RemoveFavorite).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/favorites/reorder", h.ReorderFavorites).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/favorites/duplicates", h.GetFavoriteDuplicates).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/favorites/lists", h.GetFavoriteLists).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/favorites/lists", h.CreateFavoriteList).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/favorites/lists/reorder", h.ReorderFavoriteLists).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/favorites/lists/{id:[0-9]+}", h.RenameFavoriteList).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/favorites/lists/{id:[0-9]+}", h.DeleteFavoriteList).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/profiles", h.GetProfiles).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/profiles", h.CreateProfile).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/profiles/session", h.DeleteProfileSession).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/profiles/{id:[0-9]+}", h.UpdateProfile).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/profiles/{id:[0-9]+}", h.DeleteProfile).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/profiles/{id:[0-9]+}/pin", h.SetProfilePIN).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/profiles/{id:[0-9]+}/session", h.CreateProfileSession).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/profile", h.GetCurrentProfile).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/profile/history", h.GetWatchHistory).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/profile/history", h.ClearWatchHistory).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/profile/resume/{id:[0-9]+}", h.DeleteResumePoint).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/profile/hidden-categories/{id:[0-9]+}", h.SetCategoryHidden).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/parental", h.GetParentalSettings).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/parental", h.UpdateParentalSettings).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/parental/pin", h.SetParentalPIN).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/parental/unlock", h.UnlockParental).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/parental/unlock", h.LockParental).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/parental/categories/{id:[0-9]+}", h.SetCategoryLocked).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/parental/channels/{id:[0-9]+}", h.SetChannelLocked).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/overrides", h.GetOverrides).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/overrides/categories/reorder", h.ReorderCategories).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/overrides/categories/{id:[0-9]+}", h.UpdateCategoryOverride).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/overrides/categories/{id:[0-9]+}", h.ResetCategoryOverride).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/overrides/channels/reorder", h.ReorderChannels).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/overrides/channels/{id:[0-9]+}", h.UpdateChannelOverride).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/overrides/channels/{id:[0-9]+}", h.ResetChannelOverride).Methods("DELETE", "OPTIONS")
 	router.HandleFunc("/api/xtream/settings", h.GetXtreamSettings).Methods("GET", "OPTIONS")
 	router.HandleFunc("/api/xtream/settings", h.SaveXtreamSettings).Methods("POST", "OPTIONS")
 	router.HandleFunc("/api/xtream/update", h.UpdateChannels).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/sync/jobs", h.GetSyncJobs).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/sync/jobs/{id}", h.GetSyncJob).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/sync/jobs/{id}/cancel", h.CancelSyncJob).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/sync/history", h.GetSyncHistory).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/health", h.GetHealth).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/health/channels", h.GetChannelHealth).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/health/check", h.StartHealthCheck).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/health/check", h.CancelHealthCheck).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/export/playlist.m3u", h.ExportPlaylist).Methods("GET", "OPTIONS")
+	router.HandleFunc("/export/epg.xml", h.ExportEPG).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/images/channels/{id:[0-9]+}", h.GetChannelImage).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/images/categories/{id:[0-9]+}", h.GetCategoryImage).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/streams", h.GetStreams).Methods("GET", "OPTIONS")
+	router.HandleFunc("/stream/{type:live|movie|series}/{id:[0-9]+}", h.StreamChannel).Methods("GET", "OPTIONS")
+	router.HandleFunc("/stream/{type:live|movie|series}/{id:[0-9]+}/{resource}", h.StreamChannel).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/system/schema", h.GetSchemaStatus).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/sources", h.GetSources).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/sources", h.CreateSource).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/sources/{id}", h.GetSource).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/sources/{id}", h.UpdateSource).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/sources/{id}", h.DeleteSource).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/sources/{id}/sync", h.SyncSource).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/sources/{id}/servers", h.GetSourceServers).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/sources/{id}/probe", h.ProbeSourceServers).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/m3u/import", h.ImportM3U).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/epg/import", h.ImportEPG).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/epg/channel/{id}", h.GetChannelEPG).Methods("GET", "OPTIONS")
 }
 
 type PlayerStatus struct {
-	IsRunning      bool       `json:"isRunning"`
-	CurrentChannel *db.Channel `json:"currentChannel"`
+	IsRunning      bool         `json:"isRunning"`
+	CurrentChannel *db.Channel  `json:"currentChannel"`
+	Catchup        *CatchupInfo `json:"catchup,omitempty"`
+	// Profile oynatmayı başlatan profildir
+	Profile *PlaybackProfile `json:"profile,omitempty"`
+}
+
+// setPlayback oynatılan kanalı, catch-up bilgisini ve profili birlikte
+// değiştirir. Bu alanlar yalnızca mu tutularak okunur ve yazılır.
+func (h *Handler) setPlayback(ch *db.Channel, catchup *CatchupInfo, profile *PlaybackProfile) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.currentChannel = ch
+	h.currentCatchup = catchup
+	h.currentProfile = profile
+}
+
+// playback oynatılan kanalı, catch-up bilgisini ve profili döndürür
+func (h *Handler) playback() (*db.Channel, *CatchupInfo, *PlaybackProfile) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.currentChannel, h.currentCatchup, h.currentProfile
 }
 
 func (h *Handler) GetPlayerStatus(w http.ResponseWriter, r *http.Request) {
@@ -926,6 +1008,8 @@ func (h *Handler) GetPlayerStatus(w http.ResponseWriter, r *http.Request) {
 			// Process kontrol edilemiyorsa varsayılan olarak kapalı kabul et
 			isActive = false
 			h.currentChannel = nil
+			h.currentCatchup = nil
+			h.currentProfile = nil
 		} else {
 			// Process durumunu logla
 			if isAlive {
@@ -935,13 +1019,24 @@ func (h *Handler) GetPlayerStatus(w http.ResponseWriter, r *http.Request) {
 				log.Printf("MPV process is not alive")
 				// Player aktif değilse kanal bilgisini sıfırla
 				h.currentChannel = nil
+				h.currentCatchup = nil
+				h.currentProfile = nil
 			}
 		}
 	}
 
+	// Kanal adresi M3U kaynaklarında kimlik bilgisi taşıyabilir
+	var current *db.Channel
+	if h.currentChannel != nil {
+		channel := *h.currentChannel
+		channel.URL = redact.URL(channel.URL)
+		current = &channel
+	}
 	status := PlayerStatus{
 		IsRunning:      isActive,
-		CurrentChannel: h.currentChannel,
+		CurrentChannel: current,
+		Catchup:        h.currentCatchup,
+		Profile:        h.currentProfile,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,415 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"remote-iptv/internal/db"
+	"remote-iptv/internal/player"
+	"remote-iptv/internal/redact"
+	"remote-iptv/internal/streamcheck"
+	"remote-iptv/internal/xtream"
+)
+
+// Kanal sağlık yoklaması: canlı kanallar arka planda hafif HTTP/HLS
+// istekleriyle (liste, ilk parça) yoklanır. Aynı anda açılan bağlantı sayısı
+// sağlayıcının boştaki bağlantı sınırını aşmaz, böylece süren oynatma
+// kesilmez. Sonuçlar kanal kimliğiyle saklanır; ölü kanallar listelerde
+// gizlenebilir (?hide_dead=true) ya da sona sıralanabilir (?sort=health).
+
+// Yoklamada aynı anda açılan en fazla bağlantı sayısı. Sağlayıcı sınırı
+// bilinmeyen kaynaklarda (M3U, sınırsız hesap) defaultProbeWorkers kullanılır.
+const (
+	maxProbeWorkers     = 4
+	defaultProbeWorkers = 2
+)
+
+// errHealthRunning başka bir yoklama sürerken yenisi başlatılamaz
+var errHealthRunning = errors.New("a health check is already running")
+
+// HealthRun bir sağlık yoklaması çalışmasının durumudur
+type HealthRun struct {
+	SourceIDs  []int      `json:"source_ids"`
+	Trigger    string     `json:"trigger"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Cancelled  bool       `json:"cancelled,omitempty"`
+	// Total yoklanacak, Checked yoklanan, Failed yoklanamayan kanal sayısıdır
+	Total   int `json:"total"`
+	Checked int `json:"checked"`
+	Failed  int `json:"failed"`
+}
+
+// healthRuns süren ve son biten yoklamayı tutar
+type healthRuns struct {
+	mu      sync.Mutex
+	running *HealthRun
+	last    *HealthRun
+	cancel  context.CancelFunc
+}
+
+// snapshot çalışmaların kopyalarını döndürür
+func (s *healthRuns) snapshot() (running, last *HealthRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running != nil {
+		copied := *s.running
+		running = &copied
+	}
+	if s.last != nil {
+		copied := *s.last
+		last = &copied
+	}
+	return running, last
+}
+
+// update süren çalışmayı kilit altında değiştirir
+func (s *healthRuns) update(fn func(run *HealthRun)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running != nil {
+		fn(s.running)
+	}
+}
+
+// startHealthRun kaynakların canlı kanallarını arka planda yoklamaya başlar.
+// Başka bir yoklama sürüyorsa onu ve errHealthRunning döndürür.
+func (h *Handler) startHealthRun(trigger string, sources []db.Source) (*HealthRun, error) {
+	h.health.mu.Lock()
+	defer h.health.mu.Unlock()
+	if h.health.running != nil {
+		copied := *h.health.running
+		return &copied, errHealthRunning
+	}
+
+	run := &HealthRun{Trigger: trigger, StartedAt: time.Now(), SourceIDs: []int{}}
+	for _, source := range sources {
+		run.SourceIDs = append(run.SourceIDs, source.ID)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h.health.running = run
+	h.health.cancel = cancel
+	copied := *run
+
+	go func() {
+		defer cancel()
+		for i := range sources {
+			if ctx.Err() != nil {
+				break
+			}
+			h.checkSourceHealth(ctx, &sources[i], trigger)
+		}
+
+		h.health.mu.Lock()
+		defer h.health.mu.Unlock()
+		finished := time.Now()
+		run.FinishedAt = &finished
+		run.Cancelled = ctx.Err() != nil
+		h.health.last = run
+		h.health.running = nil
+		h.health.cancel = nil
+		log.Printf("Health check finished: %d/%d channels checked, %d failed", run.Checked, run.Total, run.Failed)
+	}()
+	return &copied, nil
+}
+
+// probeWorkers kaynak için aynı anda açılabilecek yoklama bağlantısı
+// sayısını döndürür. Sağlayıcıda boş bağlantı yoksa 0 ve nedenini döndürür.
+func (h *Handler) probeWorkers(source *db.Source, client *xtream.Client) (int, string) {
+	if client == nil {
+		return defaultProbeWorkers, ""
+	}
+	info, err := client.GetAccountInfo()
+	if err != nil {
+		// Hesap bilgisi alınamazsa tek bağlantıyla devam edilir
+		log.Printf("Health check: error getting account info of source %d: %v", source.ID, err)
+		return 1, ""
+	}
+	max := info.UserInfo.MaxConnections.Int()
+	if max <= 0 {
+		return defaultProbeWorkers, ""
+	}
+	active := info.UserInfo.ActiveConnections.Int()
+	free := max - active
+	if free <= 0 {
+		reason := fmt.Sprintf("provider connection limit reached (%d/%d active)", active, max)
+		if h.playingSource() == source.ID {
+			reason += ", playback in progress"
+		}
+		return 0, reason
+	}
+	if free > maxProbeWorkers {
+		free = maxProbeWorkers
+	}
+	return free, ""
+}
+
+// checkSourceHealth kaynağın canlı kanallarını yoklar ve çalışmayı
+// senkronizasyon geçmişine kaydeder
+func (h *Handler) checkSourceHealth(ctx context.Context, source *db.Source, trigger string) {
+	started := time.Now()
+	record := func(status string, checked int, reason string) {
+		run := db.SyncRun{
+			SourceID:   source.ID,
+			Kind:       db.SyncRunHealth,
+			Trigger:    trigger,
+			Status:     status,
+			StartedAt:  started,
+			DurationMS: time.Since(started).Milliseconds(),
+			Channels:   checked,
+			Error:      reason,
+		}
+		if err := h.db.AddSyncRun(run); err != nil {
+			log.Printf("Error recording health check for source %d: %v", source.ID, err)
+		}
+	}
+
+	channels, err := h.db.GetChannelsByType("live", source.ID)
+	if err != nil {
+		log.Printf("Health check: error getting channels of source %d: %v", source.ID, err)
+		record(db.SyncRunFailed, 0, err.Error())
+		return
+	}
+
+	var client *xtream.Client
+	if source.Type == db.SourceXtream {
+		client = h.xtreamClient(source)
+		h.ensureHealthyServer(source, client)
+	}
+	workers, reason := h.probeWorkers(source, client)
+	if workers == 0 {
+		log.Printf("Health check: skipping source %d: %s", source.ID, reason)
+		record(db.SyncRunSkipped, 0, reason)
+		return
+	}
+	h.health.update(func(run *HealthRun) { run.Total += len(channels) })
+	log.Printf("Health check: probing %d channels of source %d with %d connections", len(channels), source.ID, workers)
+
+	queue := make(chan db.Channel)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	checked, failed := 0, 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ch := range queue {
+				ok, probed := h.probeChannel(ctx, source, client, ch)
+				if !probed {
+					continue
+				}
+				mu.Lock()
+				checked++
+				if !ok {
+					failed++
+				}
+				mu.Unlock()
+				h.health.update(func(run *HealthRun) {
+					run.Checked++
+					if !ok {
+						run.Failed++
+					}
+				})
+			}
+		}()
+	}
+feed:
+	for _, ch := range channels {
+		select {
+		case queue <- ch:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	status := db.SyncRunCompleted
+	if ctx.Err() != nil {
+		status = db.SyncRunCancelled
+	}
+	log.Printf("Health check: %d of %d channels of source %d failed", failed, checked, source.ID)
+	record(status, checked, "")
+}
+
+// probeChannel kanalı yoklayıp sonucu kaydeder. HTTP dışı adresler
+// yoklanmaz; probed false döner.
+func (h *Handler) probeChannel(ctx context.Context, source *db.Source, client *xtream.Client, ch db.Channel) (ok, probed bool) {
+	streamURL := ch.URL
+	if client != nil {
+		streamURL = xtreamLiveURL(client, source, ch)
+	}
+	if !strings.HasPrefix(streamURL, "http://") && !strings.HasPrefix(streamURL, "https://") {
+		return false, false
+	}
+
+	userAgent := ch.HTTPUserAgent
+	if userAgent == "" {
+		userAgent = player.DefaultUserAgent
+	}
+	result := streamcheck.Check(ctx, streamURL, streamcheck.Options{UserAgent: userAgent, Referrer: ch.HTTPReferrer})
+	if ctx.Err() != nil {
+		// İptal edilen yoklama kanalın durumunu değiştirmez
+		return false, false
+	}
+
+	check := db.HealthCheck{
+		OK:         result.OK(),
+		LatencyMS:  result.Latency.Milliseconds(),
+		StatusCode: result.StatusCode,
+		CheckedAt:  time.Now(),
+	}
+	if result.Err != nil {
+		check.Error = redact.String(result.Err.Error())
+	}
+	if err := h.db.RecordChannelHealth(ch.ID, check); err != nil && !errors.Is(err, db.ErrChannelNotFound) {
+		log.Printf("Error recording health of channel %d: %v", ch.ID, err)
+	}
+	return check.OK, true
+}
+
+// scheduleHealthCheck kaynağın zamanlanmış yoklamasını başlatır. Başka bir
+// yoklama sürüyorsa sonraki kontrolde tekrar denenir.
+func (h *Handler) scheduleHealthCheck(source *db.Source) {
+	if _, err := h.startHealthRun(TriggerSchedule, []db.Source{*source}); err == nil {
+		log.Printf("Scheduler: started health check for source %d (%s)", source.ID, source.Name)
+	}
+}
+
+// GetHealth süren ve son yoklamayı ve kaynakların sağlık özetini döndürür
+func (h *Handler) GetHealth(w http.ResponseWriter, r *http.Request) {
+	sources, err := h.db.GetSourceHealth()
+	if err != nil {
+		log.Printf("Error getting source health: %v", err)
+		http.Error(w, "Failed to get health report", http.StatusInternalServerError)
+		return
+	}
+	running, last := h.health.snapshot()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"running": running,
+		"last":    last,
+		"sources": sources,
+	})
+}
+
+// GetChannelHealth kanalların yoklama sonuçlarını ölüler önce olmak üzere
+// döndürür: ?source=ID, ?status=ok|failing|dead|unknown, ?offset=N,
+// ?limit=N. Toplam sayı X-Total-Count başlığında döner.
+func (h *Handler) GetChannelHealth(w http.ResponseWriter, r *http.Request) {
+	var q db.HealthQuery
+	var err error
+	if q.SourceID, err = sourceFilter(r); err != nil {
+		http.Error(w, "Invalid source ID", http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	if q.Status = query.Get("status"); q.Status != "" && !db.ValidHealthStatus(q.Status) {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+	if value := query.Get("offset"); value != "" {
+		if q.Offset, err = strconv.Atoi(value); err != nil || q.Offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if q.Limit, err = strconv.Atoi(value); err != nil || q.Limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		if q.Limit > maxChannelPageSize {
+			q.Limit = maxChannelPageSize
+		}
+	}
+
+	health, total, err := h.db.GetChannelHealth(q)
+	if err != nil {
+		log.Printf("Error getting channel health: %v", err)
+		http.Error(w, "Failed to get channel health", http.StatusInternalServerError)
+		return
+	}
+	for i := range health {
+		health[i].LastError = redact.String(health[i].LastError)
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health)
+}
+
+// StartHealthCheck etkin kaynakların ya da gövdede verilen kaynağın canlı
+// kanallarını arka planda yoklamaya başlar: {"source_id": 1}. Başka bir
+// yoklama sürüyorsa 409 döner.
+func (h *Handler) StartHealthCheck(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SourceID int `json:"source_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var sources []db.Source
+	if req.SourceID != 0 {
+		source, err := h.db.GetSource(req.SourceID)
+		if err != nil {
+			http.Error(w, "Failed to get source", http.StatusInternalServerError)
+			return
+		}
+		if source == nil {
+			http.Error(w, "Source not found", http.StatusNotFound)
+			return
+		}
+		sources = append(sources, *source)
+	} else {
+		all, err := h.db.GetSources()
+		if err != nil {
+			http.Error(w, "Failed to get sources", http.StatusInternalServerError)
+			return
+		}
+		for _, source := range all {
+			if source.Enabled {
+				sources = append(sources, source)
+			}
+		}
+	}
+
+	run, err := h.startHealthRun(TriggerManual, sources)
+	w.Header().Set("Content-Type", "application/json")
+	if errors.Is(err, errHealthRunning) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": "health_check_running",
+			"run":   run,
+		})
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(run)
+}
+
+// CancelHealthCheck süren yoklamayı durdurur. Yoklanmış kanalların sonuçları
+// korunur.
+func (h *Handler) CancelHealthCheck(w http.ResponseWriter, r *http.Request) {
+	h.health.mu.Lock()
+	cancel := h.health.cancel
+	h.health.mu.Unlock()
+	if cancel == nil {
+		http.Error(w, "No health check is running", http.StatusNotFound)
+		return
+	}
+	cancel()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"remote-iptv/internal/db"
+	"remote-iptv/internal/imagecache"
+)
+
+// Logo önbelleği: kanal logoları ve afişler sağlayıcıların yavaş ya da
+// bozuk CDN'lerinden tarayıcıya değil, sunucu üzerinden gelir. Görseller
+// istendiğinde ya da senkronizasyondan sonra indirilir, diskte boyut
+// sınırıyla tutulur ve ?w= ile küçültülmüş olarak sunulur. Logosu olmayan
+// ya da indirilemeyen öğeler için adın baş harfleriyle bir görsel üretilir.
+
+// Görsel önceden indirme seçenekleri (IMAGE_PREFETCH)
+const (
+	ImagePrefetchLive = "live"
+	ImagePrefetchAll  = "all"
+	ImagePrefetchOff  = "off"
+)
+
+const (
+	// imageFetchTimeout bir isteğin görseli beklediği en uzun süredir
+	imageFetchTimeout = 20 * time.Second
+	// prefetchWorkers aynı anda indirilen görsel sayısıdır
+	prefetchWorkers = 4
+	// imageMaxAge ve placeholderMaxAge tarayıcının görselleri önbellekte
+	// tuttuğu sürelerdir (saniye). Üretilen görsel, logo sonradan
+	// indirilebileceği için kısa tutulur.
+	imageMaxAge       = 7 * 24 * 3600
+	placeholderMaxAge = 3600
+)
+
+// imageState logo önbelleğinin ayarları ve süren önceden indirmelerdir
+type imageState struct {
+	cache    *imagecache.Cache
+	prefetch string
+
+	mu       sync.Mutex
+	fetching map[int]bool
+}
+
+// SetImageCache logo önbelleğini etkinleştirir. prefetch senkronizasyondan
+// sonra hangi kanalların logolarının indirileceğidir (live, all ya da off).
+// Önbellek verilmezse /api/images logoları sağlayıcıya yönlendirir.
+func (h *Handler) SetImageCache(cache *imagecache.Cache, prefetch string) {
+	h.images.mu.Lock()
+	defer h.images.mu.Unlock()
+	h.images.cache = cache
+	h.images.prefetch = prefetch
+}
+
+// GetChannelImage kanalın logosunu döndürür, ?w=N ile küçültülmüş olarak
+func (h *Handler) GetChannelImage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid channel ID", http.StatusBadRequest)
+		return
+	}
+	img, err := h.db.GetChannelImage(id)
+	if err != nil {
+		log.Printf("Error getting channel %d: %v", id, err)
+		http.Error(w, "Failed to get channel", http.StatusInternalServerError)
+		return
+	}
+	if img == nil {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	h.serveImage(w, r, img)
+}
+
+// GetCategoryImage kategorinin yerel olarak verilmiş logosunu döndürür
+func (h *Handler) GetCategoryImage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+	img, err := h.db.GetCategoryImage(id)
+	if err != nil {
+		log.Printf("Error getting category %d: %v", id, err)
+		http.Error(w, "Failed to get category", http.StatusInternalServerError)
+		return
+	}
+	if img == nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	h.serveImage(w, r, img)
+}
+
+// serveImage görseli önbellekten yazar; logo yoksa ya da indirilemezse adın
+// baş harfleriyle üretilen görseli döndürür
+func (h *Handler) serveImage(w http.ResponseWriter, r *http.Request, img *db.LocalImage) {
+	width := 0
+	if value := r.URL.Query().Get("w"); value != "" {
+		var err error
+		if width, err = strconv.Atoi(value); err != nil || width <= 0 {
+			http.Error(w, "Invalid width", http.StatusBadRequest)
+			return
+		}
+	}
+
+	h.images.mu.Lock()
+	cache := h.images.cache
+	h.images.mu.Unlock()
+	if img.Icon != "" && cache == nil {
+		http.Redirect(w, r, img.Icon, http.StatusFound)
+		return
+	}
+
+	// Görseller uygulamanın kendi adresinden sunulur; tarayıcı içeriği
+	// tahmin etmesin ve belgede betik çalıştırılmasın
+	w.Header().Set("Content-Security-Policy", "sandbox; script-src 'none'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if img.Icon != "" {
+		ctx, cancel := context.WithTimeout(r.Context(), imageFetchTimeout)
+		defer cancel()
+		cached, err := cache.Get(ctx, img.Icon, width)
+		if err == nil {
+			if f, err := os.Open(cached.Path); err == nil {
+				defer f.Close()
+				w.Header().Set("Content-Type", cached.ContentType)
+				w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(imageMaxAge))
+				http.ServeContent(w, r, "", cached.ModTime, f)
+				return
+			}
+		}
+		if r.Context().Err() != nil {
+			return
+		}
+		if !errors.Is(err, imagecache.ErrUnavailable) {
+			log.Printf("Error caching image: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", imagecache.PlaceholderType)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(placeholderMaxAge))
+	w.Write(imagecache.Placeholder(img.Name))
+}
+
+// prefetchImages kaynağın logolarını arka planda önbelleğe indirir. Aynı
+// kaynak için süren bir indirme varsa yenisi başlatılmaz.
+func (h *Handler) prefetchImages(sourceID int) {
+	h.images.mu.Lock()
+	defer h.images.mu.Unlock()
+	cache := h.images.cache
+	var types []string
+	switch h.images.prefetch {
+	case ImagePrefetchLive:
+		types = []string{"live"}
+	case ImagePrefetchAll:
+		types = []string{"live", "movie", "series"}
+	}
+	if cache == nil || len(types) == 0 || h.images.fetching[sourceID] {
+		return
+	}
+	if h.images.fetching == nil {
+		h.images.fetching = make(map[int]bool)
+	}
+	h.images.fetching[sourceID] = true
+
+	go func() {
+		defer func() {
+			h.images.mu.Lock()
+			delete(h.images.fetching, sourceID)
+			h.images.mu.Unlock()
+		}()
+
+		urls, err := h.db.GetImageURLs(sourceID, types)
+		if err != nil {
+			log.Printf("Error getting images of source %d: %v", sourceID, err)
+			return
+		}
+		queue := make(chan string)
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		fetched, failed := 0, 0
+		for i := 0; i < prefetchWorkers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for url := range queue {
+					ctx, cancel := context.WithTimeout(context.Background(), imageFetchTimeout)
+					_, err := cache.Get(ctx, url, 0)
+					cancel()
+					mu.Lock()
+					if err != nil {
+						failed++
+					} else {
+						fetched++
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+		for _, url := range urls {
+			if !cache.Cached(url) {
+				queue <- url
+			}
+		}
+		close(queue)
+		wg.Wait()
+		if fetched+failed > 0 {
+			log.Printf("Prefetched %d images of source %d (%d unavailable)", fetched, sourceID, failed)
+		}
+	}()
+}
@@ -0,0 +1,485 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"remote-iptv/internal/db"
+	"remote-iptv/internal/redact"
+)
+
+// Senkronizasyon işi durumları
+const (
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Senkronizasyon aşamaları. Canlı, film ve dizi listeleri paralel çekildiği
+// için bu üç aşama aynı anda çalışabilir.
+const (
+	PhaseCategories = "categories"
+	PhaseLive       = "live"
+	PhaseVOD        = "vod"
+	PhaseSeries     = "series"
+	PhaseSaving     = "saving"
+)
+
+// İşi başlatan taraf
+const (
+	TriggerManual   = "manual"
+	TriggerSchedule = "schedule"
+)
+
+// Aşama durumları
+const (
+	PhasePending = "pending"
+	PhaseActive  = "running"
+	PhaseDone    = "done"
+)
+
+var syncPhases = []string{PhaseCategories, PhaseLive, PhaseVOD, PhaseSeries, PhaseSaving}
+
+// streamPhases Xtream akış türlerini aşamalara eşler
+var streamPhases = map[string]string{
+	"live":   PhaseLive,
+	"movie":  PhaseVOD,
+	"series": PhaseSeries,
+}
+
+// maxFinishedJobs bellekte tutulan bitmiş iş sayısıdır
+const maxFinishedJobs = 20
+
+// errSyncRunning başka bir senkronizasyon sürerken yeni iş başlatılamaz
+var errSyncRunning = errors.New("a sync job is already running")
+
+// SyncPhase bir senkronizasyon aşamasının durumudur
+type SyncPhase struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Items  int    `json:"items"`
+}
+
+// SyncJobStatus bir işin API'de gösterilen anlık görüntüsüdür
+type SyncJobStatus struct {
+	ID            string        `json:"id"`
+	Status        string        `json:"status"`
+	Trigger       string        `json:"trigger"`
+	SourceIDs     []int         `json:"source_ids"`
+	CurrentSource int           `json:"current_source,omitempty"`
+	Phases        []SyncPhase   `json:"phases"`
+	Reports       []*SyncReport `json:"reports"`
+	SourceErrors  []SourceError `json:"source_errors,omitempty"`
+	Error         string        `json:"error,omitempty"`
+	StartedAt     time.Time     `json:"started_at"`
+	FinishedAt    *time.Time    `json:"finished_at,omitempty"`
+}
+
+// SourceError senkronize edilemeyen bir kaynağın hatasıdır. Bir kaynağın
+// hatası işi durdurmaz, sıradaki kaynaklarla devam edilir.
+type SourceError struct {
+	SourceID   int    `json:"source_id"`
+	SourceName string `json:"source_name,omitempty"`
+	Error      string `json:"error"`
+}
+
+// SyncJob arka planda çalışan bir senkronizasyondur. Aşama ve sayaçlar iş
+// sürerken güncellenir, /api/sync/jobs/{id} ile izlenebilir.
+type SyncJob struct {
+	mu     sync.Mutex
+	status SyncJobStatus
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Status işin anlık görüntüsünü döndürür
+func (j *SyncJob) Status() SyncJobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	status := j.status
+	status.SourceIDs = append([]int(nil), j.status.SourceIDs...)
+	status.Phases = append([]SyncPhase(nil), j.status.Phases...)
+	status.Reports = append([]*SyncReport{}, j.status.Reports...)
+	status.SourceErrors = append([]SourceError(nil), j.status.SourceErrors...)
+	return status
+}
+
+// Cancel işi iptal eder. Yarım kalan kaynak güncellemesi geri alınır.
+func (j *SyncJob) Cancel() {
+	j.cancel()
+}
+
+// Done iş bittiğinde kapanan kanalı döndürür
+func (j *SyncJob) Done() <-chan struct{} {
+	return j.done
+}
+
+// startSource yeni bir kaynağa geçer ve aşamaları sıfırlar
+func (j *SyncJob) startSource(sourceID int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.status.CurrentSource = sourceID
+	j.status.Phases = make([]SyncPhase, len(syncPhases))
+	for i, name := range syncPhases {
+		j.status.Phases[i] = SyncPhase{Name: name, Status: PhasePending}
+	}
+}
+
+func (j *SyncJob) phase(name string) *SyncPhase {
+	for i := range j.status.Phases {
+		if j.status.Phases[i].Name == name {
+			return &j.status.Phases[i]
+		}
+	}
+	return nil
+}
+
+// setPhase aşamanın durumunu değiştirir
+func (j *SyncJob) setPhase(name, status string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if p := j.phase(name); p != nil {
+		p.Status = status
+	}
+}
+
+// addItems aşamada işlenen öğe sayısını artırır
+func (j *SyncJob) addItems(name string, n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if p := j.phase(name); p != nil {
+		p.Items += n
+	}
+}
+
+func (j *SyncJob) addReport(report *SyncReport) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.Reports = append(j.status.Reports, report)
+}
+
+// addSourceError kaynağın hatasını iş durumuna ekler
+func (j *SyncJob) addSourceError(sourceID int, sourceName string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.SourceErrors = append(j.status.SourceErrors, SourceError{
+		SourceID:   sourceID,
+		SourceName: sourceName,
+		Error:      redact.Error(err),
+	})
+}
+
+// finish işi sonucuna göre kapatır
+func (j *SyncJob) finish(err error) {
+	j.mu.Lock()
+	now := time.Now()
+	j.status.FinishedAt = &now
+	j.status.CurrentSource = 0
+	switch {
+	case err == nil:
+		j.status.Status = JobCompleted
+	case errors.Is(err, context.Canceled):
+		j.status.Status = JobCancelled
+	default:
+		j.status.Status = JobFailed
+		j.status.Error = redact.Error(err)
+	}
+	j.mu.Unlock()
+
+	j.cancel()
+	close(j.done)
+}
+
+// syncJobs çalışan ve son bitmiş senkronizasyon işlerini tutar. Aynı anda
+// yalnızca bir iş çalışır.
+type syncJobs struct {
+	mu      sync.Mutex
+	jobs    map[string]*SyncJob
+	order   []string
+	running *SyncJob
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// start yeni bir iş kaydeder. Başka bir iş sürüyorsa onu ve errSyncRunning döndürür.
+func (s *syncJobs) start(trigger string, sourceIDs []int) (*SyncJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running != nil {
+		return s.running, errSyncRunning
+	}
+	if s.jobs == nil {
+		s.jobs = make(map[string]*SyncJob)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &SyncJob{
+		status: SyncJobStatus{
+			ID:        newJobID(),
+			Status:    JobRunning,
+			Trigger:   trigger,
+			SourceIDs: sourceIDs,
+			Reports:   []*SyncReport{},
+			StartedAt: time.Now(),
+		},
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	job.startSource(0)
+	s.jobs[job.status.ID] = job
+	s.order = append(s.order, job.status.ID)
+	s.running = job
+
+	// En eski bitmiş işleri unut
+	for len(s.order) > maxFinishedJobs {
+		oldest := s.order[0]
+		if s.jobs[oldest] == s.running {
+			break
+		}
+		delete(s.jobs, oldest)
+		s.order = s.order[1:]
+	}
+	return job, nil
+}
+
+func (s *syncJobs) finished(job *SyncJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running == job {
+		s.running = nil
+	}
+}
+
+// current çalışan işi döndürür, yoksa nil
+func (s *syncJobs) current() *SyncJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+func (s *syncJobs) get(id string) *SyncJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+// list işleri en yeniden eskiye döndürür
+func (s *syncJobs) list() []*SyncJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]*SyncJob, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		jobs = append(jobs, s.jobs[s.order[i]])
+	}
+	return jobs
+}
+
+// startSyncJob kaynakları arka planda sırayla senkronize eden bir iş başlatır
+func (h *Handler) startSyncJob(trigger string, sourceIDs []int) (*SyncJob, error) {
+	job, err := h.jobs.start(trigger, sourceIDs)
+	if err != nil {
+		return job, err
+	}
+	go h.runSyncJob(job)
+	return job, nil
+}
+
+func (h *Handler) runSyncJob(job *SyncJob) {
+	// Kaynak verisini yazan diğer işlemler (M3U yükleme, kaynak silme) beklesin
+	h.syncMu.Lock()
+	defer h.syncMu.Unlock()
+
+	err := h.syncSources(job)
+	if err != nil {
+		log.Printf("Sync job %s stopped: %v", job.status.ID, err)
+	} else {
+		log.Printf("Sync job %s completed", job.status.ID)
+	}
+	h.jobs.finished(job)
+	job.finish(err)
+}
+
+// syncSources kaynakları sırayla senkronize eder. Başarısız olan kaynak
+// kaydedilip atlanır; iş yalnızca iptal edilirse erken biter. Kaynaklardan
+// biri bile başarısız olduysa iş hata ile sonlanır.
+func (h *Handler) syncSources(job *SyncJob) error {
+	failed := 0
+	for _, id := range job.status.SourceIDs {
+		if err := job.ctx.Err(); err != nil {
+			return err
+		}
+
+		source, err := h.db.GetSource(id)
+		if err == nil && source == nil {
+			err = fmt.Errorf("source %d not found", id)
+		}
+		if err != nil {
+			log.Printf("Sync job %s: source %d: %v", job.status.ID, id, err)
+			job.addSourceError(id, "", err)
+			failed++
+			continue
+		}
+
+		job.startSource(id)
+		started := time.Now()
+		report, err := h.syncSource(job, source)
+		if err != nil && (errors.Is(err, context.Canceled) || job.ctx.Err() != nil) {
+			err = context.Canceled
+		}
+		h.recordSyncRun(job, source.ID, started, report, err)
+		if errors.Is(err, context.Canceled) {
+			return err
+		}
+		if err != nil {
+			log.Printf("Sync job %s: source %s failed: %s", job.status.ID, source.Name, redact.Error(err))
+			job.addSourceError(source.ID, source.Name, err)
+			failed++
+			continue
+		}
+		job.addReport(report)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d sources failed", failed, len(job.status.SourceIDs))
+	}
+	return nil
+}
+
+// recordSyncRun kaynağın senkronizasyon sonucunu çalışma geçmişine yazar
+func (h *Handler) recordSyncRun(job *SyncJob, sourceID int, started time.Time, report *SyncReport, err error) {
+	run := db.SyncRun{
+		SourceID:   sourceID,
+		Kind:       db.SyncRunChannels,
+		Trigger:    job.status.Trigger,
+		Status:     db.SyncRunCompleted,
+		StartedAt:  started,
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		run.Status = db.SyncRunCancelled
+	case err != nil:
+		run.Status = db.SyncRunFailed
+		run.Error = redact.Error(err)
+	}
+	if report != nil {
+		run.Categories = report.Categories
+		run.Channels = report.Live + report.Movies + report.Series
+	}
+	if err := h.db.AddSyncRun(run); err != nil {
+		log.Printf("Error recording sync run for source %d: %v", sourceID, err)
+	}
+}
+
+// writeSyncJob yeni başlatılan işi döndürür. wait=true verilirse iş bitene
+// kadar beklenir ve senkronizasyon raporları doğrudan döndürülür.
+func (h *Handler) writeSyncJob(w http.ResponseWriter, r *http.Request, job *SyncJob, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if errors.Is(err, errSyncRunning) {
+		writeSyncRunning(w, job)
+		return
+	}
+
+	if r.URL.Query().Get("wait") != "true" {
+		w.Header().Set("Location", "/api/sync/jobs/"+job.status.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job.Status())
+		return
+	}
+
+	select {
+	case <-job.Done():
+	case <-r.Context().Done():
+		// İstemci ayrıldı, iş arka planda devam eder
+		return
+	}
+	status := job.Status()
+	if status.Status != JobCompleted {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// writeSyncRunning başka bir senkronizasyon sürdüğü için reddedilen isteğe
+// 409 ile çalışan işi yazar. İçe aktarma gibi iş olarak izlenmeyen bir
+// işlem sürüyorsa job alanı boş kalır.
+func writeSyncRunning(w http.ResponseWriter, job *SyncJob) {
+	body := map[string]interface{}{"error": "sync_running"}
+	if job != nil {
+		body["job"] = job.Status()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(body)
+}
+
+// GetSyncJobs son senkronizasyon işlerini listeler
+func (h *Handler) GetSyncJobs(w http.ResponseWriter, r *http.Request) {
+	statuses := []SyncJobStatus{}
+	for _, job := range h.jobs.list() {
+		statuses = append(statuses, job.Status())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// GetSyncJob bir senkronizasyon işinin ilerlemesini döndürür
+func (h *Handler) GetSyncJob(w http.ResponseWriter, r *http.Request) {
+	job := h.jobs.get(mux.Vars(r)["id"])
+	if job == nil {
+		http.Error(w, "Sync job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.Status())
+}
+
+// CancelSyncJob çalışan bir senkronizasyonu iptal eder
+func (h *Handler) CancelSyncJob(w http.ResponseWriter, r *http.Request) {
+	job := h.jobs.get(mux.Vars(r)["id"])
+	if job == nil {
+		http.Error(w, "Sync job not found", http.StatusNotFound)
+		return
+	}
+
+	job.Cancel()
+	select {
+	case <-job.Done():
+	case <-time.After(10 * time.Second):
+		// İptal, çalışan isteğin kapanmasını bekliyor
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.Status())
+}
+
+// enabledSourceIDs etkin kaynakların ID'lerini döndürür
+func enabledSourceIDs(sources []db.Source) []int {
+	var ids []int
+	for _, source := range sources {
+		if source.Enabled {
+			ids = append(ids, source.ID)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"remote-iptv/internal/db"
+	"remote-iptv/internal/m3u"
+	"remote-iptv/internal/redact"
+)
+
+// ImportM3U M3U / M3U Plus listesini http(s) adresinden veya yüklenen
+// dosyadan okuyup kanal ve kategorileri günceller. ?source=ID verilirse o
+// kaynağın içeriği değiştirilir, verilmezse liste için yeni bir M3U kaynağı
+// oluşturulur.
+func (h *Handler) ImportM3U(w http.ResponseWriter, r *http.Request) {
+	sourceID, err := sourceFilter(r)
+	if err != nil {
+		http.Error(w, "Invalid source ID", http.StatusBadRequest)
+		return
+	}
+
+	upload, location, err := sourceRequest(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid playlist source: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	playlist := upload
+	if playlist == nil {
+		if location == "" {
+			http.Error(w, "Playlist url or file is required", http.StatusBadRequest)
+			return
+		}
+		redact.AddURLSecrets(location)
+		log.Printf("Importing M3U playlist from: %s", redact.URL(location))
+		playlist, err = m3u.Open(location)
+		if err != nil {
+			log.Printf("Error opening playlist: %v", err)
+			http.Error(w, fmt.Sprintf("Failed to open playlist: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	defer playlist.Close()
+
+	h.syncMu.Lock()
+	defer h.syncMu.Unlock()
+
+	if sourceID != 0 {
+		source, err := h.db.GetSource(sourceID)
+		if err != nil {
+			http.Error(w, "Failed to get source", http.StatusInternalServerError)
+			return
+		}
+		if source == nil || source.Type != db.SourceM3U {
+			http.Error(w, "M3U source not found", http.StatusNotFound)
+			return
+		}
+	} else {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			name = "M3U"
+		}
+		sourceID, err = h.db.CreateSource(db.Source{
+			Name:    name,
+			Type:    db.SourceM3U,
+			URL:     location,
+			Enabled: true,
+		})
+		if err != nil {
+			log.Printf("Error creating M3U source: %v", err)
+			http.Error(w, "Failed to create source", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	result, err := m3u.Import(h.db, sourceID, playlist)
+	if err != nil {
+		log.Printf("Error importing playlist: %v", err)
+		http.Error(w, "Failed to import playlist", http.StatusInternalServerError)
+		return
+	}
+	if err := h.db.MarkSourceSynced(sourceID, time.Now()); err != nil {
+		log.Printf("Error updating source sync time: %v", err)
+	}
+	h.prefetchImages(sourceID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"remote-iptv/internal/db"
+)
+
+// Yerel ayarlar: kategori ve kanallar gizlenebilir, yeniden adlandırılabilir,
+// logoları değiştirilebilir ve sıralanabilir. Ayarlar sağlayıcı verisinden
+// ayrı saklanır, senkronizasyonlardan etkilenmez ve tüm listelerde uygulanır.
+
+// GetOverrides tüm yerel ayarları döndürür
+func (h *Handler) GetOverrides(w http.ResponseWriter, r *http.Request) {
+	overrides, err := h.db.GetOverrides()
+	if err != nil {
+		log.Printf("Error getting overrides: %v", err)
+		http.Error(w, "Failed to get overrides", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(overrides)
+}
+
+// overrideHandlers kategori ve kanal yerel ayar uç noktalarının ortak
+// gövdesidir
+type overrideHandlers struct {
+	kind    string
+	set     func(id int, u db.OverrideUpdate) error
+	reset   func(id int) error
+	reorder func(ids []int) error
+}
+
+func (h *Handler) categoryOverrides() overrideHandlers {
+	return overrideHandlers{"category", h.db.SetCategoryOverride, h.db.ResetCategoryOverride, h.db.ReorderCategories}
+}
+
+func (h *Handler) channelOverrides() overrideHandlers {
+	return overrideHandlers{"channel", h.db.SetChannelOverride, h.db.ResetChannelOverride, h.db.ReorderChannels}
+}
+
+// writeOverrideError yerel ayar hatasını durum koduna çevirir
+func writeOverrideError(w http.ResponseWriter, kind string, id int, err error) {
+	switch {
+	case errors.Is(err, db.ErrCategoryNotFound), errors.Is(err, db.ErrChannelNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, db.ErrInvalidOrder):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("Error updating %s override %d: %v", kind, id, err)
+		http.Error(w, "Failed to update override", http.StatusInternalServerError)
+	}
+}
+
+// update öğenin yerel ayarlarını değiştirir:
+// {"hidden": true, "name": "Ulusal", "icon": "https://..."}. Gönderilmeyen
+// alanlar korunur, boş ad ya da logo sağlayıcınınkine döner.
+func (o overrideHandlers) update(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	var u db.OverrideUpdate
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := o.set(id, u); err != nil {
+		writeOverrideError(w, o.kind, id, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// remove öğenin tüm yerel ayarlarını siler
+func (o overrideHandlers) remove(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	if err := o.reset(id); err != nil {
+		writeOverrideError(w, o.kind, id, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// order öğeleri gövdedeki sırayla listenin başına alır: {"ids": [7, 3]}.
+// Kategoriler aynı türden, kanallar aynı kategoriden olmalıdır.
+func (o overrideHandlers) order(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []int `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := o.reorder(req.IDs); err != nil {
+		writeOverrideError(w, o.kind, 0, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) UpdateCategoryOverride(w http.ResponseWriter, r *http.Request) {
+	h.categoryOverrides().update(w, r)
+}
+
+func (h *Handler) ResetCategoryOverride(w http.ResponseWriter, r *http.Request) {
+	h.categoryOverrides().remove(w, r)
+}
+
+func (h *Handler) ReorderCategories(w http.ResponseWriter, r *http.Request) {
+	h.categoryOverrides().order(w, r)
+}
+
+func (h *Handler) UpdateChannelOverride(w http.ResponseWriter, r *http.Request) {
+	h.channelOverrides().update(w, r)
+}
+
+func (h *Handler) ResetChannelOverride(w http.ResponseWriter, r *http.Request) {
+	h.channelOverrides().remove(w, r)
+}
+
+func (h *Handler) ReorderChannels(w http.ResponseWriter, r *http.Request) {
+	h.channelOverrides().order(w, r)
+}
@@ -0,0 +1,347 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"remote-iptv/internal/db"
+)
+
+// Ebeveyn denetimi: kilitli kategori ve kanallar ile yaş sınırını aşan
+// film ve diziler, ebeveyn PIN'iyle açılan oturum (başlık ya da çerez)
+// olmadan listelenmez ve oynatılmaz. Denetim PIN belirlenene kadar
+// uygulanmaz.
+const (
+	parentalSessionHeader = "X-Parental-Session"
+	parentalSessionCookie = "parental_session"
+)
+
+// parentalPINAttempts ebeveyn PIN'i denemelerinin pinAttempts'teki anahtarıdır
+const parentalPINAttempts = 0
+
+// parentalToken istekteki kilit açma oturumu anahtarını okur
+func parentalToken(r *http.Request) string {
+	if token := r.Header.Get(parentalSessionHeader); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(parentalSessionCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// parentalUnlocked istekte geçerli bir kilit açma oturumu olup olmadığını
+// döndürür
+func (h *Handler) parentalUnlocked(r *http.Request) (bool, error) {
+	token := parentalToken(r)
+	if token == "" {
+		return false, nil
+	}
+	return h.db.ParentalSessionActive(token)
+}
+
+// parentalFilter isteğe uygulanacak ebeveyn denetimi süzgecini döndürür
+func (h *Handler) parentalFilter(r *http.Request) (db.ParentalFilter, error) {
+	settings, err := h.db.GetParentalSettings()
+	if err != nil || !settings.Enabled {
+		return db.ParentalFilter{}, err
+	}
+	unlocked, err := h.parentalUnlocked(r)
+	if err != nil || unlocked {
+		return db.ParentalFilter{}, err
+	}
+	return db.ParentalFilter{HideLocked: true, MaxAge: settings.MaxAge}, nil
+}
+
+// requireParentalFilter süzgeci döndürür; okunamazsa 500 yazar
+func (h *Handler) requireParentalFilter(w http.ResponseWriter, r *http.Request) (db.ParentalFilter, bool) {
+	filter, err := h.parentalFilter(r)
+	if err != nil {
+		log.Printf("Error reading parental controls: %v", err)
+		http.Error(w, "Failed to read parental controls", http.StatusInternalServerError)
+		return filter, false
+	}
+	return filter, true
+}
+
+// writeParentalLocked kilitli içerik isteğine 403 yazar
+func writeParentalLocked(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   "parental_lock",
+		"message": "content is locked by parental controls",
+	})
+}
+
+// checkChannelAllowed kanal ebeveyn denetimine takılıyorsa 403 yazar ve
+// false döner
+func (h *Handler) checkChannelAllowed(w http.ResponseWriter, r *http.Request, channelID int) bool {
+	filter, ok := h.requireParentalFilter(w, r)
+	if !ok {
+		return false
+	}
+	allowed, err := h.db.ChannelAllowed(channelID, filter)
+	if err != nil {
+		log.Printf("Error checking parental lock for channel %d: %v", channelID, err)
+		http.Error(w, "Failed to check parental controls", http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		log.Printf("Refused to play locked channel %d", channelID)
+		writeParentalLocked(w)
+		return false
+	}
+	return true
+}
+
+// requireParentalAccess ebeveyn denetimi ayarlarını değiştiren istekler
+// için kilit açma oturumu ister. PIN belirlenmemişse herkes değiştirebilir.
+func (h *Handler) requireParentalAccess(w http.ResponseWriter, r *http.Request) bool {
+	settings, err := h.db.GetParentalSettings()
+	if err != nil {
+		http.Error(w, "Failed to read parental controls", http.StatusInternalServerError)
+		return false
+	}
+	if !settings.Enabled {
+		return true
+	}
+	unlocked, err := h.parentalUnlocked(r)
+	if err != nil {
+		http.Error(w, "Failed to read parental controls", http.StatusInternalServerError)
+		return false
+	}
+	if !unlocked {
+		writeParentalLocked(w)
+		return false
+	}
+	return true
+}
+
+// GetParentalSettings ebeveyn denetimi ayarlarını ve isteğin kilidinin açık
+// olup olmadığını döndürür
+func (h *Handler) GetParentalSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.db.GetParentalSettings()
+	if err != nil {
+		log.Printf("Error getting parental settings: %v", err)
+		http.Error(w, "Failed to get parental settings", http.StatusInternalServerError)
+		return
+	}
+	unlocked, err := h.parentalUnlocked(r)
+	if err != nil {
+		http.Error(w, "Failed to get parental settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		*db.ParentalSettings
+		Unlocked bool `json:"unlocked"`
+	}{settings, unlocked})
+}
+
+// UpdateParentalSettings yaş sınırını ve otomatik kilit kelimelerini
+// günceller: {"max_age": 13, "keywords": ["XXX", "+18"]}. Gönderilmeyen
+// alanlar korunur.
+func (h *Handler) UpdateParentalSettings(w http.ResponseWriter, r *http.Request) {
+	if !h.requireParentalAccess(w, r) {
+		return
+	}
+	var req struct {
+		MaxAge   *int     `json:"max_age"`
+		Keywords []string `json:"keywords"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.db.GetParentalSettings()
+	if err != nil {
+		http.Error(w, "Failed to get parental settings", http.StatusInternalServerError)
+		return
+	}
+	if req.MaxAge != nil {
+		if *req.MaxAge < 0 {
+			http.Error(w, "max_age must not be negative", http.StatusBadRequest)
+			return
+		}
+		settings.MaxAge = *req.MaxAge
+	}
+	if req.Keywords != nil {
+		settings.Keywords = req.Keywords
+	}
+
+	if err := h.db.UpdateParentalSettings(settings.MaxAge, settings.Keywords); err != nil {
+		log.Printf("Error updating parental settings: %v", err)
+		http.Error(w, "Failed to update parental settings", http.StatusInternalServerError)
+		return
+	}
+	h.GetParentalSettings(w, r)
+}
+
+// SetParentalPIN ebeveyn PIN'ini belirler ya da boş PIN ile denetimi
+// kapatır: {"pin": "1234"}. PIN belirlenmişse kilit açma oturumu gerekir;
+// açık oturumlar kapanır.
+func (h *Handler) SetParentalPIN(w http.ResponseWriter, r *http.Request) {
+	if !h.requireParentalAccess(w, r) {
+		return
+	}
+	var req struct {
+		PIN string `json:"pin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validatePIN(req.PIN); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.SetParentalPIN(req.PIN); err != nil {
+		log.Printf("Error setting parental PIN: %v", err)
+		http.Error(w, "Failed to set PIN", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Parental PIN updated (enabled: %v)", req.PIN != "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnlockParental ebeveyn PIN'ini doğrulayıp kilitli içerikleri geçici olarak
+// açan bir oturum başlatır: {"pin": "1234"}
+func (h *Handler) UnlockParental(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PIN string `json:"pin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !h.pinAttempts.allow(parentalPINAttempts) {
+		http.Error(w, "Too many wrong PIN attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+	ok, err := h.db.CheckParentalPIN(req.PIN)
+	if err != nil {
+		http.Error(w, "Failed to check PIN", http.StatusInternalServerError)
+		return
+	}
+	h.pinAttempts.record(parentalPINAttempts, ok)
+	if !ok {
+		log.Printf("Wrong parental PIN")
+		http.Error(w, "Wrong PIN", http.StatusUnauthorized)
+		return
+	}
+
+	token, expires, err := h.db.CreateParentalSession()
+	if err != nil {
+		log.Printf("Error creating parental session: %v", err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     parentalSessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":      token,
+		"expires_at": expires,
+	})
+}
+
+// LockParental isteğin kilit açma oturumunu kapatır
+func (h *Handler) LockParental(w http.ResponseWriter, r *http.Request) {
+	if token := parentalToken(r); token != "" {
+		if err := h.db.DeleteParentalSession(token); err != nil {
+			http.Error(w, "Failed to delete session", http.StatusInternalServerError)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: parentalSessionCookie, Value: "", Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeLocked gövdedeki kilit durumunu okur: {"locked": true}
+func decodeLocked(r *http.Request) (bool, error) {
+	var req struct {
+		Locked *bool `json:"locked"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return false, errors.New("invalid request body")
+	}
+	if req.Locked == nil {
+		return false, errors.New("locked is required")
+	}
+	return *req.Locked, nil
+}
+
+// SetCategoryLocked kategoriyi elle kilitler ya da kilidini açar. Elle
+// açılan kategori anahtar kelimelere uysa da yeniden kilitlenmez.
+func (h *Handler) SetCategoryLocked(w http.ResponseWriter, r *http.Request) {
+	if !h.requireParentalAccess(w, r) {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+	locked, err := decodeLocked(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.db.SetCategoryLocked(id, locked)
+	if errors.Is(err, db.ErrCategoryNotFound) {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error locking category %d: %v", id, err)
+		http.Error(w, "Failed to update category", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetChannelLocked kanalı kilitler ya da kanal kilidini kaldırır
+func (h *Handler) SetChannelLocked(w http.ResponseWriter, r *http.Request) {
+	if !h.requireParentalAccess(w, r) {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid channel ID", http.StatusBadRequest)
+		return
+	}
+	locked, err := decodeLocked(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.db.SetChannelLocked(id, locked)
+	if errors.Is(err, db.ErrChannelNotFound) {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error locking channel %d: %v", id, err)
+		http.Error(w, "Failed to update channel", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,593 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"remote-iptv/internal/channelname"
+	"remote-iptv/internal/db"
+)
+
+// Profil seçimi: PIN'li profiller POST /api/profiles/{id}/session ile açılan
+// oturumla (başlık ya da çerez), PIN'siz profiller X-Profile-ID başlığıyla
+// seçilebilir. Seçim yapılmazsa PIN'siz olduğu sürece varsayılan profil
+// kullanılır.
+const (
+	profileHeader        = "X-Profile-ID"
+	profileSessionHeader = "X-Profile-Session"
+	profileSessionCookie = "profile_session"
+	profileSessionMaxAge = 30 * 24 * 60 * 60
+)
+
+// Art arda hatalı PIN denemelerinde profil kısa süre kilitlenir
+const (
+	maxPINAttempts = 5
+	pinLockout     = time.Minute
+)
+
+// profileError profil seçilemediğinde dönen hatadır; code yanıt gövdesinde
+// istemcinin ayırt edebileceği koddur
+type profileError struct {
+	code    string
+	message string
+}
+
+func (e *profileError) Error() string { return e.message }
+
+var (
+	errInvalidProfile  = &profileError{"invalid_profile", "profile not found"}
+	errInvalidSession  = &profileError{"invalid_session", "profile session is invalid or expired"}
+	errProfileLocked   = &profileError{"pin_required", "profile requires a PIN session"}
+	errProfileRequired = &profileError{"profile_required", "select a profile"}
+)
+
+// PlaybackProfile oynatmayı başlatan profildir
+type PlaybackProfile struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// pinAttempts profillerin hatalı PIN denemelerini sayar
+type pinAttempts struct {
+	mu       sync.Mutex
+	failures map[int]int
+	locked   map[int]time.Time
+}
+
+// allow profil kilitli değilse doğru döner
+func (a *pinAttempts) allow(profileID int) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return time.Now().After(a.locked[profileID])
+}
+
+// record denemenin sonucunu kaydeder; üst üste maxPINAttempts hatadan sonra
+// profil pinLockout süresince kilitlenir
+func (a *pinAttempts) record(profileID int, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failures == nil {
+		a.failures = map[int]int{}
+		a.locked = map[int]time.Time{}
+	}
+	if ok {
+		delete(a.failures, profileID)
+		return
+	}
+	a.failures[profileID]++
+	if a.failures[profileID] >= maxPINAttempts {
+		a.locked[profileID] = time.Now().Add(pinLockout)
+		delete(a.failures, profileID)
+	}
+}
+
+// sessionToken istekteki profil oturum anahtarını okur
+func sessionToken(r *http.Request) string {
+	if token := r.Header.Get(profileSessionHeader); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(profileSessionCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// requestProfile isteğin profilini çözer. Oturum anahtarı X-Profile-ID
+// başlığından önceliklidir.
+func (h *Handler) requestProfile(r *http.Request) (*db.Profile, error) {
+	if token := sessionToken(r); token != "" {
+		profile, err := h.db.ProfileSession(token)
+		if err != nil {
+			return nil, err
+		}
+		if profile == nil {
+			return nil, errInvalidSession
+		}
+		return profile, nil
+	}
+
+	id := db.DefaultProfile
+	if value := r.Header.Get(profileHeader); value != "" {
+		var err error
+		if id, err = strconv.Atoi(value); err != nil {
+			return nil, errInvalidProfile
+		}
+	}
+	profile, err := h.db.GetProfile(id)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		return nil, errInvalidProfile
+	}
+	if profile.HasPIN {
+		if r.Header.Get(profileHeader) == "" {
+			return nil, errProfileRequired
+		}
+		return nil, errProfileLocked
+	}
+	return profile, nil
+}
+
+// requireProfile isteğin profilini döndürür; profil seçilemezse 401 yazar
+func (h *Handler) requireProfile(w http.ResponseWriter, r *http.Request) (*db.Profile, bool) {
+	profile, err := h.requestProfile(r)
+	if err == nil {
+		return profile, true
+	}
+
+	var perr *profileError
+	if !errors.As(err, &perr) {
+		log.Printf("Error resolving profile: %v", err)
+		http.Error(w, "Failed to resolve profile", http.StatusInternalServerError)
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   perr.code,
+		"message": perr.message,
+	})
+	return nil, false
+}
+
+// canManageProfile profilin ayarlarının bu istekle değiştirilip
+// değiştirilemeyeceğini döndürür. PIN'li profiller yalnızca kendi
+// oturumlarından yönetilebilir.
+func (h *Handler) canManageProfile(r *http.Request, target *db.Profile) bool {
+	if !target.HasPIN {
+		return true
+	}
+	current, err := h.requestProfile(r)
+	return err == nil && current.ID == target.ID
+}
+
+// validatePIN PIN'in 4-8 rakamdan oluştuğunu doğrular, boş PIN geçerlidir
+func validatePIN(pin string) error {
+	if pin == "" {
+		return nil
+	}
+	if len(pin) < 4 || len(pin) > 8 {
+		return errors.New("pin must be 4-8 digits")
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return errors.New("pin must be 4-8 digits")
+		}
+	}
+	return nil
+}
+
+// profileParam URL'deki profili getirir; bulunamazsa yanıtı yazar ve nil
+// döner
+func (h *Handler) profileParam(w http.ResponseWriter, r *http.Request) *db.Profile {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid profile ID", http.StatusBadRequest)
+		return nil
+	}
+	profile, err := h.db.GetProfile(id)
+	if err != nil {
+		http.Error(w, "Failed to get profile", http.StatusInternalServerError)
+		return nil
+	}
+	if profile == nil {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return nil
+	}
+	return profile
+}
+
+// GetProfiles profilleri listeler. Profil seçim ekranı için profil
+// seçilmeden de kullanılabilir.
+func (h *Handler) GetProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles, err := h.db.GetProfiles()
+	if err != nil {
+		log.Printf("Error getting profiles: %v", err)
+		http.Error(w, "Failed to get profiles", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profiles)
+}
+
+// GetCurrentProfile isteğin kullandığı profili döndürür
+func (h *Handler) GetCurrentProfile(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// CreateProfile yeni bir profil oluşturur:
+// {"name": "Çocuklar", "pin": "1234", "audio_language": "tr"}
+func (h *Handler) CreateProfile(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		db.Profile
+		PIN string `json:"pin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if err := validatePIN(req.PIN); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !channelname.ValidQuality(req.PreferredQuality) {
+		http.Error(w, "Invalid preferred quality", http.StatusBadRequest)
+		return
+	}
+
+	id, err := h.db.CreateProfile(req.Profile, req.PIN)
+	if err != nil {
+		log.Printf("Error creating profile: %v", err)
+		http.Error(w, "Failed to create profile", http.StatusInternalServerError)
+		return
+	}
+	profile, err := h.db.GetProfile(id)
+	if err != nil || profile == nil {
+		http.Error(w, "Failed to get profile", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(profile)
+}
+
+// UpdateProfile profilin adını, dil ve kalite tercihlerini günceller. Gövdede
+// gönderilmeyen alanlar mevcut değerlerini korur.
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	profile := h.profileParam(w, r)
+	if profile == nil {
+		return
+	}
+	if !h.canManageProfile(r, profile) {
+		http.Error(w, "Profile requires a PIN session", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Name             *string `json:"name"`
+		AudioLanguage    *string `json:"audio_language"`
+		SubtitleLanguage *string `json:"subtitle_language"`
+		PreferredQuality *string `json:"preferred_quality"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name != nil {
+		if profile.Name = strings.TrimSpace(*req.Name); profile.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.AudioLanguage != nil {
+		profile.AudioLanguage = strings.TrimSpace(*req.AudioLanguage)
+	}
+	if req.SubtitleLanguage != nil {
+		profile.SubtitleLanguage = strings.TrimSpace(*req.SubtitleLanguage)
+	}
+	if req.PreferredQuality != nil {
+		if !channelname.ValidQuality(*req.PreferredQuality) {
+			http.Error(w, "Invalid preferred quality", http.StatusBadRequest)
+			return
+		}
+		profile.PreferredQuality = *req.PreferredQuality
+	}
+
+	if err := h.db.UpdateProfile(*profile); err != nil {
+		log.Printf("Error updating profile %d: %v", profile.ID, err)
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// SetProfilePIN profilin PIN'ini değiştirir ya da boş PIN ile kaldırır.
+// Profilin açık oturumları kapanır; istek profilin kendi oturumundan
+// geldiyse yerine yeni bir oturum açılır.
+func (h *Handler) SetProfilePIN(w http.ResponseWriter, r *http.Request) {
+	profile := h.profileParam(w, r)
+	if profile == nil {
+		return
+	}
+	if !h.canManageProfile(r, profile) {
+		http.Error(w, "Profile requires a PIN session", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		PIN string `json:"pin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validatePIN(req.PIN); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ownSession := false
+	if token := sessionToken(r); token != "" {
+		current, err := h.db.ProfileSession(token)
+		ownSession = err == nil && current != nil && current.ID == profile.ID
+	}
+	if err := h.db.SetProfilePIN(profile.ID, req.PIN); err != nil {
+		log.Printf("Error setting PIN for profile %d: %v", profile.ID, err)
+		http.Error(w, "Failed to set PIN", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("PIN updated for profile %d", profile.ID)
+
+	if ownSession {
+		h.startProfileSession(w, profile.ID, http.StatusOK)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteProfile profili ve ona ait tüm verileri siler
+func (h *Handler) DeleteProfile(w http.ResponseWriter, r *http.Request) {
+	profile := h.profileParam(w, r)
+	if profile == nil {
+		return
+	}
+	if !h.canManageProfile(r, profile) {
+		http.Error(w, "Profile requires a PIN session", http.StatusForbidden)
+		return
+	}
+
+	if err := h.db.DeleteProfile(profile.ID); err != nil {
+		if errors.Is(err, db.ErrDefaultProfile) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error deleting profile %d: %v", profile.ID, err)
+		http.Error(w, "Failed to delete profile", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateProfileSession PIN'i doğrulayıp profil oturumu açar: {"pin": "1234"}.
+// Oturum anahtarı yanıtta ve çerezde döner; istemciler X-Profile-Session
+// başlığıyla da gönderebilir.
+func (h *Handler) CreateProfileSession(w http.ResponseWriter, r *http.Request) {
+	profile := h.profileParam(w, r)
+	if profile == nil {
+		return
+	}
+
+	var req struct {
+		PIN string `json:"pin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if profile.HasPIN {
+		if !h.pinAttempts.allow(profile.ID) {
+			http.Error(w, "Too many wrong PIN attempts, try again later", http.StatusTooManyRequests)
+			return
+		}
+		ok, err := h.db.CheckProfilePIN(profile.ID, req.PIN)
+		if err != nil {
+			http.Error(w, "Failed to check PIN", http.StatusInternalServerError)
+			return
+		}
+		h.pinAttempts.record(profile.ID, ok)
+		if !ok {
+			log.Printf("Wrong PIN for profile %d", profile.ID)
+			http.Error(w, "Wrong PIN", http.StatusUnauthorized)
+			return
+		}
+	}
+	h.startProfileSession(w, profile.ID, http.StatusCreated)
+}
+
+// startProfileSession profil için oturum açar, anahtarı çereze ve yanıta
+// yazar
+func (h *Handler) startProfileSession(w http.ResponseWriter, profileID int, status int) {
+	token, err := h.db.CreateProfileSession(profileID)
+	if err != nil {
+		log.Printf("Error creating session for profile %d: %v", profileID, err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	profile, err := h.db.GetProfile(profileID)
+	if err != nil || profile == nil {
+		http.Error(w, "Failed to get profile", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     profileSessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   profileSessionMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":   token,
+		"profile": profile,
+	})
+}
+
+// DeleteProfileSession isteğin profil oturumunu kapatır
+func (h *Handler) DeleteProfileSession(w http.ResponseWriter, r *http.Request) {
+	if token := sessionToken(r); token != "" {
+		if err := h.db.DeleteProfileSession(token); err != nil {
+			http.Error(w, "Failed to delete session", http.StatusInternalServerError)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: profileSessionCookie, Value: "", Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWatchHistory profilin son izlediklerini döndürür (?limit=N, en fazla 200)
+func (h *Handler) GetWatchHistory(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := h.db.GetWatchHistory(profile.ID, limit)
+	if err != nil {
+		log.Printf("Error getting watch history: %v", err)
+		http.Error(w, "Failed to get history", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// ClearWatchHistory profilin izleme geçmişini siler
+func (h *Handler) ClearWatchHistory(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	if err := h.db.ClearWatchHistory(profile.ID); err != nil {
+		http.Error(w, "Failed to clear history", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteResumePoint kanalın kalınan yer kaydını siler, böylece içerik bir
+// sonraki oynatmada baştan başlar
+func (h *Handler) DeleteResumePoint(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	channelID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid channel ID", http.StatusBadRequest)
+		return
+	}
+	ch, err := h.db.GetChannel(channelID)
+	if err != nil {
+		http.Error(w, "Failed to get channel", http.StatusInternalServerError)
+		return
+	}
+	if ch == nil {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	if err := h.db.DeleteResumePoint(profile.ID, *ch); err != nil {
+		http.Error(w, "Failed to delete resume point", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetCategoryHidden kategoriyi profil için gizler ya da yeniden gösterir:
+// {"hidden": true}. Gizli kategoriler ve kanalları listelerde ve aramada
+// görünmez.
+func (h *Handler) SetCategoryHidden(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	categoryID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Hidden bool `json:"hidden"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err = h.db.SetCategoryHidden(profile.ID, categoryID, req.Hidden)
+	if errors.Is(err, db.ErrCategoryNotFound) {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating hidden category %d: %v", categoryID, err)
+		http.Error(w, "Failed to update category", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// saveResumePoint oynatılan film ya da dizide kalınan yeri, oynatmayı
+// başlatan profil için kaydeder. Oynatma değişmeden ya da durmadan önce
+// çağrılır.
+func (h *Handler) saveResumePoint() {
+	ch, catchup, profile := h.playback()
+	if ch == nil || profile == nil || catchup != nil || ch.SourceID == 0 {
+		return
+	}
+	if ch.StreamType != "movie" && ch.StreamType != "series" {
+		return
+	}
+	if h.player == nil || !h.player.IsActive() {
+		return
+	}
+	position, duration, err := h.player.GetPlaybackPosition()
+	if err != nil {
+		log.Printf("Error getting playback position: %v", err)
+		return
+	}
+	if err := h.db.SaveResumePoint(profile.ID, *ch, position, duration); err != nil {
+		log.Printf("Error saving resume point: %v", err)
+	}
+}
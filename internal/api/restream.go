@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"remote-iptv/internal/db"
+	"remote-iptv/internal/player"
+	"remote-iptv/internal/redact"
+	"remote-iptv/internal/restream"
+	"remote-iptv/internal/xtream"
+)
+
+// Yerel yeniden yayın: /stream/{type}/{id} sağlayıcı yayınını sunucu
+// üzerinden aktarır; ağdaki telefonlar ve televizyonlar VLC ya da tarayıcıda
+// hls.js ile izleyebilir. Sağlayıcı adresleri ve kimlik bilgileri istemciye
+// gitmez. Aynı kanalı izleyenler tek bir sağlayıcı bağlantısını paylaşır;
+// yeni bağlantılar hesabın max_connections sınırını aşmaz, mpv'nin oynattığı
+// kanal da bu sınırdan düşülür.
+
+// StreamChannel kanalın yayınını aktarır. Canlı kanallar paylaşılır; HLS
+// listelerinin girişleri /stream/{type}/{id}/{resource} adreslerine
+// çevrilir. Xtream canlı kanalları ?format=ts ile MPEG-TS olarak alınabilir.
+// Film ve bölümler istemci başına aktarılır, ileri sarma (Range) desteklenir.
+func (h *Handler) StreamChannel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	streamType := vars["type"]
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid channel ID", http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "ts" {
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+		return
+	}
+
+	key := fmt.Sprintf("%s/%d", streamType, id)
+	if format != "" {
+		key += "." + format
+	}
+	resource := vars["resource"]
+	if resource != "" {
+		// Liste girişleri yalnızca açık oturumlarda geçerlidir; kanal ve
+		// ebeveyn denetimi oturum açılırken kontrol edildi
+		session := h.streams.Get(key)
+		if session == nil {
+			http.Error(w, "Stream not found", http.StatusNotFound)
+			return
+		}
+		h.serveStream(w, session, r, resource, id)
+		return
+	}
+
+	ch, err := h.db.GetChannel(id)
+	if err != nil {
+		log.Printf("Error getting channel %d: %v", id, err)
+		http.Error(w, "Failed to get channel", http.StatusInternalServerError)
+		return
+	}
+	if ch == nil || ch.StreamType != streamType {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	if !h.checkChannelAllowed(w, r, ch.ID) {
+		return
+	}
+
+	if session := h.streams.Get(key); session != nil {
+		h.serveStream(w, session, r, "", id)
+		return
+	}
+
+	source, err := h.db.GetSource(ch.SourceID)
+	if err != nil {
+		log.Printf("Error getting source %d: %v", ch.SourceID, err)
+		http.Error(w, "Failed to get source", http.StatusInternalServerError)
+		return
+	}
+	if source == nil {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	if format == "ts" && (streamType != "live" || source.Type != db.SourceXtream) {
+		http.Error(w, "Format is only supported for Xtream live channels", http.StatusBadRequest)
+		return
+	}
+
+	streamURL := h.upstreamURL(source, *ch)
+	if format == "ts" {
+		streamURL = strings.TrimSuffix(streamURL, ".m3u8") + ".ts"
+	}
+	if !strings.HasPrefix(streamURL, "http://") && !strings.HasPrefix(streamURL, "https://") {
+		http.Error(w, "Stream cannot be relayed", http.StatusBadRequest)
+		return
+	}
+	userAgent := ch.HTTPUserAgent
+	if userAgent == "" {
+		userAgent = player.DefaultUserAgent
+	}
+	stream := restream.Stream{
+		Key:       key,
+		Name:      ch.Name,
+		Account:   source.ID,
+		URL:       streamURL,
+		Path:      "/stream/" + key,
+		UserAgent: userAgent,
+		Referrer:  ch.HTTPReferrer,
+	}
+	limit := h.streamLimit(source)
+
+	if streamType != "live" {
+		err := h.streams.Proxy(w, r, stream, limit)
+		if err != nil {
+			writeStreamError(w, err, id)
+		}
+		return
+	}
+	session, err := h.streams.Open(stream, limit)
+	if err != nil {
+		writeStreamError(w, err, id)
+		return
+	}
+	log.Printf("Relaying channel %d (%s) from source %d", ch.ID, ch.Name, source.ID)
+	h.serveStream(w, session, r, "", id)
+}
+
+// serveStream oturumun yayınını ya da liste girişini yazar
+func (h *Handler) serveStream(w http.ResponseWriter, session *restream.Session, r *http.Request, resource string, channelID int) {
+	if err := session.Serve(w, r, resource); err != nil {
+		writeStreamError(w, err, channelID)
+	}
+}
+
+// writeStreamError aktarma hatasını yanıta yazar. Bağlantı sınırı 503 ile
+// istemcinin ayırt edebileceği bir kodla döner.
+func writeStreamError(w http.ResponseWriter, err error, channelID int) {
+	switch {
+	case errors.Is(err, restream.ErrLimit):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":   "connection_limit",
+			"message": "provider connection limit reached",
+		})
+	case errors.Is(err, restream.ErrNotFound):
+		http.Error(w, "Stream not found", http.StatusNotFound)
+	default:
+		log.Printf("Error relaying channel %d: %s", channelID, redact.Error(err))
+		http.Error(w, "Failed to open stream", http.StatusBadGateway)
+	}
+}
+
+// upstreamURL kanalın sağlayıcıdaki adresini oluşturur. Xtream adresleri o
+// an sağlıklı olan sunucuya göre kurulur.
+func (h *Handler) upstreamURL(source *db.Source, ch db.Channel) string {
+	if source.Type != db.SourceXtream {
+		return ch.URL
+	}
+	client := h.xtreamClient(source)
+	h.ensureHealthyServer(source, client)
+	return xtreamStreamURL(client, source, ch)
+}
+
+// xtreamStreamURL Xtream kanalının, filminin ya da bölümünün adresini
+// istemcinin aktif sunucusuna göre oluşturur
+func xtreamStreamURL(client *xtream.Client, source *db.Source, ch db.Channel) string {
+	if ch.StreamType == "live" {
+		return xtreamLiveURL(client, source, ch)
+	}
+	if resolved, ok := client.ResolveStreamPath(ch.URL); ok {
+		return resolved
+	}
+	if strings.Contains(ch.URL, "://") {
+		return client.RebaseURL(ch.URL)
+	}
+	extension := ch.Extension
+	if extension == "" {
+		extension = "mp4"
+	}
+	return fmt.Sprintf("%s/%s/%s/%s/%d.%s", strings.TrimSuffix(client.ActiveServer(), "/"),
+		ch.StreamType, source.Username, source.Password, ch.RemoteID, extension)
+}
+
+// streamLimit kaynaktan aynı anda açılabilecek aktarma bağlantısı sayısını
+// döndürür. mpv kaynaktan oynatıyorsa bir bağlantı ona ayrılır. Hesap
+// bilgisi alınamazsa ya da sınır yoksa sınırsızdır.
+func (h *Handler) streamLimit(source *db.Source) int {
+	if source.Type != db.SourceXtream {
+		return restream.Unlimited
+	}
+	info, err := h.xtreamClient(source).GetAccountInfo()
+	if err != nil {
+		log.Printf("Error getting account info of source %d: %v", source.ID, err)
+		return restream.Unlimited
+	}
+	max := info.UserInfo.MaxConnections.Int()
+	if max <= 0 {
+		return restream.Unlimited
+	}
+	if h.playingSource() == source.ID {
+		max--
+	}
+	return max
+}
+
+// GetStreams açık aktarma oturumlarını döndürür
+func (h *Handler) GetStreams(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.streams.Sessions())
+}
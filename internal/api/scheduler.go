@@ -0,0 +1,274 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"remote-iptv/internal/db"
+	"remote-iptv/internal/epg"
+	"remote-iptv/internal/redact"
+	"remote-iptv/internal/schedule"
+)
+
+// schedulerInterval zamanlayıcının kaynakları kontrol etme sıklığıdır
+const schedulerInterval = time.Minute
+
+// skipRetryDelay bağlantı sınırı yüzünden atlanan bir çalışmanın yeniden
+// denenmesinden önce beklenen süredir
+const skipRetryDelay = 15 * time.Minute
+
+// RunScheduler kaynakların sync_schedule, epg_schedule ve health_schedule
+// ayarlarına göre kanal senkronizasyonu, rehber yenilemesi ve sağlık
+// yoklaması başlatır. ctx kapanana kadar
+// çalışır.
+func (h *Handler) RunScheduler(ctx context.Context) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		h.runDueSyncs(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDueSyncs zamanı gelmiş işleri başlatır
+func (h *Handler) runDueSyncs(now time.Time) {
+	sources, err := h.db.GetSources()
+	if err != nil {
+		log.Printf("Scheduler: error getting sources: %v", err)
+		return
+	}
+
+	for i := range sources {
+		source := &sources[i]
+		if !source.Enabled {
+			continue
+		}
+		if h.syncDue(source, db.SyncRunChannels, source.SyncSchedule, now) {
+			h.scheduleChannelSync(source, now)
+		}
+		if source.Type == db.SourceXtream && h.syncDue(source, db.SyncRunEPG, source.EPGSchedule, now) {
+			h.refreshEPG(source, now)
+		}
+		if h.syncDue(source, db.SyncRunHealth, source.HealthSchedule, now) {
+			h.scheduleHealthCheck(source)
+		}
+	}
+}
+
+// syncDue kaynağın verilen türdeki çalışmasının zamanının gelip gelmediğini
+// döndürür. Sonraki çalışma, atlananlar hariç son çalışmanın başlangıcından
+// hesaplanır; hiç çalışma yoksa kaynağın son senkronizasyonu ya da eklenme
+// zamanı esas alınır.
+func (h *Handler) syncDue(source *db.Source, kind, expr string, now time.Time) bool {
+	if expr == "" {
+		return false
+	}
+	sched, err := schedule.Parse(expr)
+	if err != nil {
+		log.Printf("Scheduler: invalid %s schedule for source %d: %v", kind, source.ID, err)
+		return false
+	}
+
+	last, err := h.db.LastSyncRun(source.ID, kind, false)
+	if err != nil {
+		log.Printf("Scheduler: error getting last %s run of source %d: %v", kind, source.ID, err)
+		return false
+	}
+	base := source.CreatedAt
+	switch {
+	case last != nil:
+		base = last.StartedAt
+	case kind == db.SyncRunChannels && source.LastSync != nil:
+		base = *source.LastSync
+	}
+	next := sched.Next(base)
+	if next.IsZero() || now.Before(next) {
+		return false
+	}
+
+	// Bağlantı sınırı yüzünden atlandıysa bir süre bekle
+	last, err = h.db.LastSyncRun(source.ID, kind, true)
+	if err != nil {
+		log.Printf("Scheduler: error getting last %s run of source %d: %v", kind, source.ID, err)
+		return false
+	}
+	if last != nil && last.Status == db.SyncRunSkipped && now.Sub(last.StartedAt) < skipRetryDelay {
+		return false
+	}
+	return true
+}
+
+// scheduleChannelSync kaynağın kanal senkronizasyonunu arka plan işi olarak
+// başlatır. Başka bir iş sürüyorsa sonraki kontrolde tekrar denenir.
+func (h *Handler) scheduleChannelSync(source *db.Source, now time.Time) {
+	if reason := h.connectionLimitReached(source); reason != "" {
+		h.recordSkippedRun(source, db.SyncRunChannels, now, reason)
+		return
+	}
+
+	job, err := h.startSyncJob(TriggerSchedule, []int{source.ID})
+	if err == errSyncRunning {
+		return
+	}
+	log.Printf("Scheduler: started sync job %s for source %d (%s)", job.status.ID, source.ID, source.Name)
+}
+
+// refreshEPG sağlayıcının xmltv.php rehberini içe aktarır. Kanal
+// senkronizasyonu sürüyorsa sonraki kontrole bırakılır.
+func (h *Handler) refreshEPG(source *db.Source, now time.Time) {
+	if !h.syncMu.TryLock() {
+		return
+	}
+	defer h.syncMu.Unlock()
+
+	if reason := h.connectionLimitReached(source); reason != "" {
+		h.recordSkippedRun(source, db.SyncRunEPG, now, reason)
+		return
+	}
+
+	started := time.Now()
+	run := db.SyncRun{
+		SourceID:  source.ID,
+		Kind:      db.SyncRunEPG,
+		Trigger:   TriggerSchedule,
+		Status:    db.SyncRunCompleted,
+		StartedAt: started,
+	}
+	result, err := h.importProviderEPG(source)
+	run.DurationMS = time.Since(started).Milliseconds()
+	if err != nil {
+		log.Printf("Scheduler: EPG refresh of source %d failed: %v", source.ID, err)
+		run.Status = db.SyncRunFailed
+		run.Error = redact.Error(err)
+	} else {
+		log.Printf("Scheduler: refreshed EPG of source %d, %d programmes", source.ID, result.Programmes)
+		run.Channels = result.MappedChannels
+		run.Programmes = result.Programmes
+	}
+	if err := h.db.AddSyncRun(run); err != nil {
+		log.Printf("Error recording EPG run for source %d: %v", source.ID, err)
+	}
+}
+
+func (h *Handler) importProviderEPG(source *db.Source) (*epg.Result, error) {
+	client := h.xtreamClient(source)
+	h.ensureHealthyServer(source, client)
+	guide, err := epg.Open(client.XMLTVURL())
+	if err != nil {
+		return nil, err
+	}
+	defer guide.Close()
+
+	importer := &epg.Importer{DB: h.db, SourceID: source.ID}
+	return importer.Import(guide)
+}
+
+// connectionLimitReached sağlayıcıdaki açık bağlantılar hesabın sınırına
+// ulaştıysa nedenini döndürür. Senkronizasyon ek bir bağlantı açacağından bu
+// durumda oynatma kesilmesin diye çalışma atlanır. Hesap bilgisi alınamazsa
+// çalışmaya izin verilir, hata senkronizasyonun kendisinde görülür.
+func (h *Handler) connectionLimitReached(source *db.Source) string {
+	if source.Type != db.SourceXtream {
+		return ""
+	}
+	info, err := h.xtreamClient(source).GetAccountInfo()
+	if err != nil {
+		log.Printf("Scheduler: error getting account info of source %d: %v", source.ID, err)
+		return ""
+	}
+
+	active := info.UserInfo.ActiveConnections.Int()
+	max := info.UserInfo.MaxConnections.Int()
+	if max <= 0 || active < max {
+		return ""
+	}
+	reason := fmt.Sprintf("provider connection limit reached (%d/%d active)", active, max)
+	if h.playingSource() == source.ID {
+		reason += ", playback in progress"
+	}
+	return reason
+}
+
+// playingSource oynatılan kanalın kaynağını döndürür, oynatma yoksa 0
+func (h *Handler) playingSource() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.currentChannel == nil {
+		return 0
+	}
+	return h.currentChannel.SourceID
+}
+
+func (h *Handler) recordSkippedRun(source *db.Source, kind string, now time.Time, reason string) {
+	log.Printf("Scheduler: skipping %s run of source %d: %s", kind, source.ID, reason)
+	run := db.SyncRun{
+		SourceID:  source.ID,
+		Kind:      kind,
+		Trigger:   TriggerSchedule,
+		Status:    db.SyncRunSkipped,
+		StartedAt: now,
+		Error:     reason,
+	}
+	if err := h.db.AddSyncRun(run); err != nil {
+		log.Printf("Error recording skipped run for source %d: %v", source.ID, err)
+	}
+}
+
+// defaultSyncHistoryLimit ve maxSyncHistoryLimit geçmiş listesinin
+// varsayılan ve en fazla uzunluğudur
+const (
+	defaultSyncHistoryLimit = 50
+	maxSyncHistoryLimit     = 500
+)
+
+// GetSyncHistory kanal senkronizasyonu, rehber yenilemesi ve sağlık
+// yoklaması geçmişini döndürür. ?source=ID, ?kind=channels|epg|health ve
+// ?limit=N ile süzülebilir.
+func (h *Handler) GetSyncHistory(w http.ResponseWriter, r *http.Request) {
+	sourceID, err := sourceFilter(r)
+	if err != nil {
+		http.Error(w, "Invalid source ID", http.StatusBadRequest)
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && kind != db.SyncRunChannels && kind != db.SyncRunEPG && kind != db.SyncRunHealth {
+		http.Error(w, "Invalid kind", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSyncHistoryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		if limit > maxSyncHistoryLimit {
+			limit = maxSyncHistoryLimit
+		}
+	}
+
+	runs, err := h.db.GetSyncRuns(sourceID, kind, limit)
+	if err != nil {
+		log.Printf("Error getting sync history: %v", err)
+		http.Error(w, "Failed to get sync history", http.StatusInternalServerError)
+		return
+	}
+	if runs == nil {
+		runs = []db.SyncRun{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"remote-iptv/internal/db"
+)
+
+// defaultSearchLimit ve maxSearchLimit arama sonucu sayısının varsayılanı ve
+// üst sınırıdır
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+)
+
+// searchTypes aranabilecek akış türleridir
+var searchTypes = map[string]bool{"live": true, "movie": true, "series": true}
+
+// Search kanal, film ve dizilerde arama yapar. ?q= aranan metin, ?type=
+// live|movie|series, ?source=ID ve ?limit=N ile süzülür. Eşleşme büyük-küçük
+// harf ve aksan duyarsızdır ("sahin" "Şahin"i, "isik" "Işık"ı bulur).
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := db.SearchQuery{
+		Query:      query.Get("q"),
+		StreamType: query.Get("type"),
+		Limit:      defaultSearchLimit,
+	}
+	if q.Query == "" {
+		http.Error(w, "Missing search query", http.StatusBadRequest)
+		return
+	}
+	if q.StreamType != "" && !searchTypes[q.StreamType] {
+		http.Error(w, "Invalid type", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if q.SourceID, err = sourceFilter(r); err != nil {
+		http.Error(w, "Invalid source ID", http.StatusBadRequest)
+		return
+	}
+	if value := query.Get("limit"); value != "" {
+		q.Limit, err = strconv.Atoi(value)
+		if err != nil || q.Limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		if q.Limit > maxSearchLimit {
+			q.Limit = maxSearchLimit
+		}
+	}
+
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	q.ProfileID = profile.ID
+	if q.Parental, ok = h.requireParentalFilter(w, r); !ok {
+		return
+	}
+
+	results, err := h.db.SearchChannels(q)
+	if err != nil {
+		log.Printf("Error searching channels: %v", err)
+		http.Error(w, "Failed to search channels", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"remote-iptv/internal/db"
+	"remote-iptv/internal/redact"
+	"remote-iptv/internal/xtream"
+)
+
+// serverEventLimit API'de gösterilen son sunucu olayı sayısıdır
+const serverEventLimit = 50
+
+// xtreamClient kaynağın tüm sunucularını bilen bir istemci oluşturur. İstemcinin
+// yaptığı sunucu değişimleri ve aldığı hatalar veritabanına kaydedilir.
+func (h *Handler) xtreamClient(source *db.Source) *xtream.Client {
+	servers := source.Servers
+	if len(servers) == 0 {
+		servers = []string{source.URL}
+	}
+	client := xtream.NewClientWithServers(servers, source.Username, source.Password)
+	if source.ActiveServer != "" {
+		client.UseServer(source.ActiveServer)
+	}
+
+	sourceID := source.ID
+	client.OnServerError = func(server string, err error) {
+		if err := h.db.RecordServerFailure(sourceID, server, err.Error()); err != nil {
+			log.Printf("Error recording server failure for source %d: %v", sourceID, err)
+		}
+	}
+	client.OnFailover = func(from, to string) {
+		log.Printf("Source %d switched from %s to %s", sourceID, redact.URL(from), redact.URL(to))
+		if err := h.db.SetActiveServer(sourceID, to); err != nil {
+			log.Printf("Error saving active server for source %d: %v", sourceID, err)
+		}
+	}
+	return client
+}
+
+// ensureHealthyServer aktif sunucu son isteğinde hata verdiyse tüm sunucuları
+// yoklayıp sağlıklı olanı seçer. Tek sunuculu kaynaklarda bir şey yapmaz.
+func (h *Handler) ensureHealthyServer(source *db.Source, client *xtream.Client) {
+	if len(client.Servers()) < 2 {
+		return
+	}
+	servers, err := h.db.GetSourceServers(source.ID)
+	if err != nil {
+		log.Printf("Error getting servers of source %d: %v", source.ID, err)
+		return
+	}
+	for _, server := range servers {
+		if server.Active && server.Failures == 0 {
+			return
+		}
+	}
+	h.probeServers(source, client)
+}
+
+// probeServers kaynağın sunucularını yoklar, sonuçları kaydeder ve öncelik
+// sırasındaki ilk sağlıklı sunucuyu aktif yapar
+func (h *Handler) probeServers(source *db.Source, client *xtream.Client) []xtream.ProbeResult {
+	results := client.ProbeAll()
+	for _, result := range results {
+		var err error
+		if result.Err != nil {
+			log.Printf("Server %s of source %d is unhealthy: %v", redact.URL(result.Server), source.ID, result.Err)
+			err = h.db.RecordServerFailure(source.ID, result.Server, result.Err.Error())
+		} else {
+			err = h.db.RecordServerSuccess(source.ID, result.Server, result.Latency)
+		}
+		if err != nil {
+			log.Printf("Error recording probe result for source %d: %v", source.ID, err)
+		}
+	}
+
+	previous := client.ActiveServer()
+	if selected := client.SelectHealthy(results); selected != "" && selected != previous {
+		log.Printf("Source %d switched from %s to %s after probing", source.ID, redact.URL(previous), redact.URL(selected))
+		if err := h.db.SetActiveServer(source.ID, selected); err != nil {
+			log.Printf("Error saving active server for source %d: %v", source.ID, err)
+		}
+	}
+	return results
+}
+
+// GetSourceServers kaynağın sunucularını, sağlık durumlarını ve son sunucu
+// olaylarını döndürür
+func (h *Handler) GetSourceServers(w http.ResponseWriter, r *http.Request) {
+	id, err := sourceIDParam(r)
+	if err != nil {
+		http.Error(w, "Invalid source ID", http.StatusBadRequest)
+		return
+	}
+
+	source, err := h.db.GetSource(id)
+	if err != nil {
+		http.Error(w, "Failed to get source", http.StatusInternalServerError)
+		return
+	}
+	if source == nil {
+		http.Error(w, "Source not found", http.StatusNotFound)
+		return
+	}
+
+	h.writeSourceServers(w, source)
+}
+
+// ProbeSourceServers kaynağın tüm sunucularını yoklayıp sağlıklı olanı seçer
+func (h *Handler) ProbeSourceServers(w http.ResponseWriter, r *http.Request) {
+	id, err := sourceIDParam(r)
+	if err != nil {
+		http.Error(w, "Invalid source ID", http.StatusBadRequest)
+		return
+	}
+
+	source, err := h.db.GetSource(id)
+	if err != nil {
+		http.Error(w, "Failed to get source", http.StatusInternalServerError)
+		return
+	}
+	if source == nil {
+		http.Error(w, "Source not found", http.StatusNotFound)
+		return
+	}
+	if source.Type != db.SourceXtream {
+		http.Error(w, "Probing is only supported for Xtream sources", http.StatusBadRequest)
+		return
+	}
+
+	h.probeServers(source, h.xtreamClient(source))
+
+	source, err = h.db.GetSource(id)
+	if err != nil || source == nil {
+		http.Error(w, "Failed to get source", http.StatusInternalServerError)
+		return
+	}
+	h.writeSourceServers(w, source)
+}
+
+func (h *Handler) writeSourceServers(w http.ResponseWriter, source *db.Source) {
+	servers, err := h.db.GetSourceServers(source.ID)
+	if err != nil {
+		log.Printf("Error getting servers of source %d: %v", source.ID, err)
+		http.Error(w, "Failed to get servers", http.StatusInternalServerError)
+		return
+	}
+	events, err := h.db.GetServerEvents(source.ID, serverEventLimit)
+	if err != nil {
+		log.Printf("Error getting server events of source %d: %v", source.ID, err)
+		http.Error(w, "Failed to get server events", http.StatusInternalServerError)
+		return
+	}
+	if servers == nil {
+		servers = []db.SourceServer{}
+	}
+	if events == nil {
+		events = []db.ServerEvent{}
+	}
+	for i := range servers {
+		servers[i].URL = redact.URL(servers[i].URL)
+		servers[i].LastError = redact.String(servers[i].LastError)
+	}
+	for i := range events {
+		events[i].URL = redact.URL(events[i].URL)
+		events[i].Error = redact.String(events[i].Error)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"active_server": redact.URL(source.ActiveServer),
+		"servers":       servers,
+		"events":        events,
+	})
+}
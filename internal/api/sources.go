@@ -0,0 +1,270 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"remote-iptv/internal/db"
+	"remote-iptv/internal/redact"
+	"remote-iptv/internal/schedule"
+)
+
+// validateSource kaynak ayarlarını kaydetmeden önce kontrol eder
+func validateSource(src *db.Source) error {
+	src.Name = strings.TrimSpace(src.Name)
+	src.URL = strings.TrimSpace(src.URL)
+	src.SyncSchedule = strings.TrimSpace(src.SyncSchedule)
+	src.EPGSchedule = strings.TrimSpace(src.EPGSchedule)
+	src.HealthSchedule = strings.TrimSpace(src.HealthSchedule)
+
+	var servers []string
+	for _, server := range src.Servers {
+		if server = strings.TrimSpace(server); server != "" {
+			servers = append(servers, server)
+		}
+	}
+	src.Servers = servers
+	if src.URL == "" && len(servers) > 0 {
+		src.URL = servers[0]
+	}
+
+	switch src.Type {
+	case db.SourceXtream:
+		if src.URL == "" || src.Username == "" || src.Password == "" {
+			return fmt.Errorf("xtream sources require url, username and password")
+		}
+	case db.SourceM3U:
+		if src.URL == "" {
+			return fmt.Errorf("m3u sources require a playlist url")
+		}
+	default:
+		return fmt.Errorf("unknown source type %q", src.Type)
+	}
+	// Sunucudaki dosyalar kaynak olarak eklenemez, adresler http(s) olmalıdır
+	for _, server := range append([]string{src.URL}, servers...) {
+		if err := checkRemoteURL(server); err != nil {
+			return err
+		}
+	}
+
+	if src.Name == "" {
+		src.Name = src.URL
+	}
+	if src.SyncSchedule != "" {
+		if _, err := schedule.Parse(src.SyncSchedule); err != nil {
+			return fmt.Errorf("invalid sync_schedule: %v", err)
+		}
+	}
+	if src.EPGSchedule != "" {
+		// M3U listelerinin sağlayıcı rehberi yok
+		if src.Type != db.SourceXtream {
+			return fmt.Errorf("epg_schedule is only supported for xtream sources")
+		}
+		if _, err := schedule.Parse(src.EPGSchedule); err != nil {
+			return fmt.Errorf("invalid epg_schedule: %v", err)
+		}
+	}
+	if src.HealthSchedule != "" {
+		if _, err := schedule.Parse(src.HealthSchedule); err != nil {
+			return fmt.Errorf("invalid health_schedule: %v", err)
+		}
+	}
+	return nil
+}
+
+// RegisterSourceSecrets kaynağın şifresini ve adreslerindeki kimlik
+// bilgilerini (M3U get.php adresinin username ve password değerleri gibi)
+// loglarda gizlenecek değerlere ekler. M3U kaynaklarının şifre alanı boş
+// olduğundan kanal adreslerindeki kimlik bilgileri ancak böyle gizlenir.
+func RegisterSourceSecrets(src db.Source) {
+	redact.AddSecret(src.Password)
+	for _, server := range append([]string{src.URL}, src.Servers...) {
+		redact.AddURLSecrets(server)
+	}
+}
+
+// redactSource kaynağı API yanıtı için kimlik bilgilerinden arındırır. Şifre
+// maskelenir, adreslerdeki kullanıcı bilgileri gizlenir.
+func redactSource(src db.Source) db.Source {
+	if src.Password != "" {
+		src.Password = redact.Mask
+	}
+	src.URL = redact.URL(src.URL)
+	src.ActiveServer = redact.URL(src.ActiveServer)
+	servers := make([]string, len(src.Servers))
+	for i, server := range src.Servers {
+		servers[i] = redact.URL(server)
+	}
+	src.Servers = servers
+	return src
+}
+
+// restoreRedacted istemcinin geri gönderdiği maskeli değerleri kayıtlı
+// değerlerle değiştirir
+func restoreRedacted(src *db.Source, stored db.Source) {
+	if src.Password == redact.Mask {
+		src.Password = stored.Password
+	}
+
+	originals := map[string]string{}
+	for _, server := range append([]string{stored.URL}, stored.Servers...) {
+		originals[redact.URL(server)] = server
+	}
+	if original, ok := originals[src.URL]; ok {
+		src.URL = original
+	}
+	for i, server := range src.Servers {
+		if original, ok := originals[server]; ok {
+			src.Servers[i] = original
+		}
+	}
+}
+
+// sourceIDParam URL'deki kaynak ID'sini okur
+func sourceIDParam(r *http.Request) (int, error) {
+	return strconv.Atoi(mux.Vars(r)["id"])
+}
+
+// GetSources kayıtlı tüm kaynakları listeler
+func (h *Handler) GetSources(w http.ResponseWriter, r *http.Request) {
+	sources, err := h.db.GetSources()
+	if err != nil {
+		log.Printf("Error getting sources: %v", err)
+		http.Error(w, "Failed to get sources", http.StatusInternalServerError)
+		return
+	}
+	if sources == nil {
+		sources = []db.Source{}
+	}
+	for i := range sources {
+		sources[i] = redactSource(sources[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sources)
+}
+
+// GetSource tek bir kaynağı döndürür
+func (h *Handler) GetSource(w http.ResponseWriter, r *http.Request) {
+	id, err := sourceIDParam(r)
+	if err != nil {
+		http.Error(w, "Invalid source ID", http.StatusBadRequest)
+		return
+	}
+
+	source, err := h.db.GetSource(id)
+	if err != nil {
+		http.Error(w, "Failed to get source", http.StatusInternalServerError)
+		return
+	}
+	if source == nil {
+		http.Error(w, "Source not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(redactSource(*source))
+}
+
+// CreateSource yeni bir Xtream hesabı veya M3U listesi ekler
+func (h *Handler) CreateSource(w http.ResponseWriter, r *http.Request) {
+	source := db.Source{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&source); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validateSource(&source); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	RegisterSourceSecrets(source)
+	id, err := h.db.CreateSource(source)
+	if err != nil {
+		log.Printf("Error creating source: %v", err)
+		http.Error(w, "Failed to create source", http.StatusInternalServerError)
+		return
+	}
+
+	created, err := h.db.GetSource(id)
+	if err != nil {
+		http.Error(w, "Failed to get source", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(redactSource(*created))
+}
+
+// UpdateSource kaynağın ayarlarını günceller. Gövdede gönderilmeyen alanlar
+// mevcut değerlerini korur.
+func (h *Handler) UpdateSource(w http.ResponseWriter, r *http.Request) {
+	id, err := sourceIDParam(r)
+	if err != nil {
+		http.Error(w, "Invalid source ID", http.StatusBadRequest)
+		return
+	}
+
+	source, err := h.db.GetSource(id)
+	if err != nil {
+		http.Error(w, "Failed to get source", http.StatusInternalServerError)
+		return
+	}
+	if source == nil {
+		http.Error(w, "Source not found", http.StatusNotFound)
+		return
+	}
+
+	stored := *source
+	stored.Servers = append([]string(nil), source.Servers...)
+	if err := json.NewDecoder(r.Body).Decode(source); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	source.ID = id
+	restoreRedacted(source, stored)
+	if err := validateSource(source); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	RegisterSourceSecrets(*source)
+	if err := h.db.UpdateSource(*source); err != nil {
+		log.Printf("Error updating source %d: %v", id, err)
+		http.Error(w, "Failed to update source", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(redactSource(*source))
+}
+
+// DeleteSource kaynağı ve ona ait tüm kanalları siler
+func (h *Handler) DeleteSource(w http.ResponseWriter, r *http.Request) {
+	id, err := sourceIDParam(r)
+	if err != nil {
+		http.Error(w, "Invalid source ID", http.StatusBadRequest)
+		return
+	}
+
+	// Senkronizasyon ya da içe aktarma sürerken istek beklemez, 409 döner
+	if !h.syncMu.TryLock() {
+		writeSyncRunning(w, h.jobs.current())
+		return
+	}
+	defer h.syncMu.Unlock()
+
+	if err := h.db.DeleteSource(id); err != nil {
+		log.Printf("Error deleting source %d: %v", id, err)
+		http.Error(w, "Failed to delete source", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
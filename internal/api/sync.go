@@ -0,0 +1,341 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"remote-iptv/internal/db"
+	"remote-iptv/internal/m3u"
+	"remote-iptv/internal/xtream"
+)
+
+// channelQueueSize çekilen kanallar ile veritabanı yazıcısı arasındaki tampon boyutudur
+const channelQueueSize = 256
+
+// errSyncAborted kanal yazımı başarısız olduğunda çekme işlemlerini durdurur
+var errSyncAborted = errors.New("sync aborted")
+
+// UpdateChannels etkin tüm kaynakların kanal ve kategorilerini arka planda
+// güncelleyen bir iş başlatır. İlerleme /api/sync/jobs/{id} ile izlenir.
+func (h *Handler) UpdateChannels(w http.ResponseWriter, r *http.Request) {
+	log.Println("Starting channel update process...")
+
+	sources, err := h.db.GetSources()
+	if err != nil {
+		log.Printf("Error getting sources: %v", err)
+		http.Error(w, "Failed to get sources", http.StatusInternalServerError)
+		return
+	}
+
+	ids := enabledSourceIDs(sources)
+	if len(ids) == 0 {
+		log.Println("No enabled sources found")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "xtream_settings_required",
+		})
+		return
+	}
+
+	job, err := h.startSyncJob(TriggerManual, ids)
+	h.writeSyncJob(w, r, job, err)
+}
+
+// SyncSource tek bir kaynağın kanal ve kategorilerini arka planda günceller
+func (h *Handler) SyncSource(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid source ID", http.StatusBadRequest)
+		return
+	}
+
+	source, err := h.db.GetSource(id)
+	if err != nil {
+		http.Error(w, "Failed to get source", http.StatusInternalServerError)
+		return
+	}
+	if source == nil {
+		http.Error(w, "Source not found", http.StatusNotFound)
+		return
+	}
+
+	job, err := h.startSyncJob(TriggerManual, []int{source.ID})
+	h.writeSyncJob(w, r, job, err)
+}
+
+// SyncReport bir kaynağın senkronizasyon sonucunu özetler. Çözülemeyen
+// öğeler senkronizasyonu durdurmaz, atlanıp burada sayılır.
+type SyncReport struct {
+	SourceID   int      `json:"source_id"`
+	SourceName string   `json:"source_name"`
+	Categories int      `json:"categories"`
+	Live       int      `json:"live"`
+	Movies     int      `json:"movies"`
+	Series     int      `json:"series"`
+	Skipped    int      `json:"skipped"`
+	Errors     []string `json:"errors,omitempty"`
+
+	CategoryChanges db.SyncDiff `json:"category_changes"`
+	ChannelChanges  db.SyncDiff `json:"channel_changes"`
+}
+
+// maxSyncReportErrors raporda gösterilen örnek hata sayısıdır
+const maxSyncReportErrors = 20
+
+func (r *SyncReport) addSkipped(list string, decodeReport xtream.DecodeReport) {
+	r.Skipped += decodeReport.Skipped
+	for _, msg := range decodeReport.Errors {
+		if len(r.Errors) >= maxSyncReportErrors {
+			return
+		}
+		r.Errors = append(r.Errors, list+": "+msg)
+	}
+}
+
+// syncSource kaynağın türüne göre kanal listesini çekip kaydeder
+func (h *Handler) syncSource(job *SyncJob, source *db.Source) (*SyncReport, error) {
+	report := &SyncReport{SourceID: source.ID, SourceName: source.Name}
+
+	var err error
+	switch source.Type {
+	case db.SourceXtream:
+		err = h.syncXtreamSource(job, source, report)
+	case db.SourceM3U:
+		err = h.syncM3USource(job, source, report)
+	default:
+		err = fmt.Errorf("unknown source type %q", source.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := h.db.MarkSourceSynced(source.ID, time.Now()); err != nil {
+		return nil, err
+	}
+	h.prefetchImages(source.ID)
+	return report, nil
+}
+
+func (h *Handler) syncM3USource(job *SyncJob, source *db.Source, report *SyncReport) error {
+	servers := source.Servers
+	if len(servers) == 0 {
+		servers = []string{source.URL}
+	}
+	if servers[0] == "" {
+		return fmt.Errorf("source has no playlist URL")
+	}
+
+	// Liste adresleri öncelik sırasıyla denenir, açılabilen adres aktif olur
+	var playlist io.ReadCloser
+	var err error
+	job.setPhase(PhaseCategories, PhaseActive)
+	for _, location := range servers {
+		log.Printf("Fetching M3U playlist for source %d (%s)", source.ID, source.Name)
+		playlist, err = m3u.Open(location)
+		if err == nil {
+			if location != source.ActiveServer {
+				if err := h.db.SetActiveServer(source.ID, location); err != nil {
+					log.Printf("Error saving active server for source %d: %v", source.ID, err)
+				}
+			}
+			break
+		}
+		log.Printf("Error opening playlist of source %d: %v", source.ID, err)
+		if err := h.db.RecordServerFailure(source.ID, location, err.Error()); err != nil {
+			log.Printf("Error recording server failure for source %d: %v", source.ID, err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer playlist.Close()
+	if err := job.ctx.Err(); err != nil {
+		return err
+	}
+
+	// Liste tek seferde okunup kaydedildiği için aşamalar birlikte ilerler
+	for _, phase := range syncPhases[1:] {
+		job.setPhase(phase, PhaseActive)
+	}
+	result, err := m3u.Import(h.db, source.ID, playlist)
+	if err != nil {
+		return err
+	}
+	job.addItems(PhaseCategories, result.Categories)
+	job.addItems(PhaseLive, result.Live)
+	job.addItems(PhaseVOD, result.Movies)
+	job.addItems(PhaseSeries, result.Series)
+	job.addItems(PhaseSaving, result.Live+result.Movies+result.Series)
+	for _, phase := range syncPhases {
+		job.setPhase(phase, PhaseDone)
+	}
+	report.Categories = result.Categories
+	report.Live = result.Live
+	report.Movies = result.Movies
+	report.Series = result.Series
+	report.CategoryChanges = result.CategoryChanges
+	report.ChannelChanges = result.ChannelChanges
+	return nil
+}
+
+func (h *Handler) syncXtreamSource(job *SyncJob, source *db.Source, report *SyncReport) error {
+	client := h.xtreamClient(source)
+	client.SetContext(job.ctx)
+
+	// Timeshift URL'leri sunucu saatiyle oluşturulduğu için saat dilimini sakla
+	if info, err := client.GetAccountInfo(); err != nil {
+		log.Printf("Error fetching account info for source %d: %v", source.ID, err)
+	} else if info.ServerInfo.Timezone != "" && info.ServerInfo.Timezone != source.Timezone {
+		if err := h.db.SetSourceTimezone(source.ID, info.ServerInfo.Timezone); err != nil {
+			log.Printf("Error saving timezone for source %d: %v", source.ID, err)
+		}
+	}
+
+	streamTypes := []string{"live", "movie", "series"}
+
+	// Kategorileri paralel olarak çek
+	job.setPhase(PhaseCategories, PhaseActive)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var categoryErr error
+	categories := make(map[string][]xtream.Category)
+	decodeReports := make(map[string]xtream.DecodeReport)
+
+	for _, streamType := range streamTypes {
+		wg.Add(1)
+		go func(streamType string) {
+			defer wg.Done()
+			list, decodeReport, err := client.FetchCategories(streamType)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				categoryErr = err
+				return
+			}
+			categories[streamType] = list
+			decodeReports[streamType+" categories"] = decodeReport
+			job.addItems(PhaseCategories, len(list))
+		}(streamType)
+	}
+	wg.Wait()
+
+	if categoryErr != nil {
+		return fmt.Errorf("fetching categories: %w", categoryErr)
+	}
+
+	// Kategoriler ve kanallar Commit'te tek transaction'da güncellenir;
+	// herhangi bir adım başarısız olursa kayıtlı liste olduğu gibi kalır.
+	// İndirme sürerken ana veritabanında transaction açık tutulmaz.
+	channelImport, err := h.db.BeginChannelImport(source.ID)
+	if err != nil {
+		return fmt.Errorf("starting channel import: %w", err)
+	}
+
+	for _, streamType := range streamTypes {
+		converted := convertXtreamCategories(categories[streamType], streamType)
+		channelImport.SaveCategories(streamType, converted)
+		report.Categories += len(converted)
+	}
+	job.setPhase(PhaseCategories, PhaseDone)
+
+	// Kanal listeleri paralel olarak çekilip öğe öğe çözülür ve tek bir
+	// yazıcıya aktarılır; böylece katalog hiçbir zaman tamamen bellekte tutulmaz
+	items := make(chan db.Channel, channelQueueSize)
+	stop := make(chan struct{})
+	var channelErr error
+
+	streams := map[string]func(func(xtream.Channel) error) (xtream.DecodeReport, error){
+		"live":   client.StreamLiveStreams,
+		"movie":  client.StreamMovieStreams,
+		"series": client.StreamSeriesStreams,
+	}
+	for _, streamType := range streamTypes {
+		wg.Add(1)
+		go func(streamType string) {
+			defer wg.Done()
+			phase := streamPhases[streamType]
+			job.setPhase(phase, PhaseActive)
+			converter := newXtreamChannelConverter(client)
+			decodeReport, err := streams[streamType](func(ch xtream.Channel) error {
+				select {
+				case items <- converter.convert(ch):
+					job.addItems(phase, 1)
+					return nil
+				case <-stop:
+					return errSyncAborted
+				case <-job.ctx.Done():
+					return job.ctx.Err()
+				}
+			})
+			if err == nil {
+				job.setPhase(phase, PhaseDone)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if err != errSyncAborted && channelErr == nil {
+					channelErr = err
+				}
+				return
+			}
+			decodeReports[streamType] = decodeReport
+		}(streamType)
+	}
+	go func() {
+		wg.Wait()
+		close(items)
+	}()
+
+	// Tüm kanalları veritabanına kaydet
+	log.Println("Saving channels to database...")
+	job.setPhase(PhaseSaving, PhaseActive)
+	var saveErr error
+	for ch := range items {
+		if saveErr != nil {
+			continue
+		}
+		if saveErr = channelImport.Add(ch); saveErr != nil {
+			close(stop)
+			continue
+		}
+		job.addItems(PhaseSaving, 1)
+	}
+
+	if err := job.ctx.Err(); err != nil {
+		channelImport.Rollback()
+		return err
+	}
+	if saveErr != nil {
+		channelImport.Rollback()
+		return fmt.Errorf("saving channels: %w", saveErr)
+	}
+	if channelErr != nil {
+		channelImport.Rollback()
+		return fmt.Errorf("fetching channel data: %w", channelErr)
+	}
+	if report.CategoryChanges, report.ChannelChanges, err = channelImport.Commit(); err != nil {
+		return fmt.Errorf("saving channels: %w", err)
+	}
+	job.setPhase(PhaseSaving, PhaseDone)
+
+	report.Live = decodeReports["live"].Decoded
+	report.Movies = decodeReports["movie"].Decoded
+	report.Series = decodeReports["series"].Decoded
+	for _, list := range []string{"live categories", "movie categories", "series categories", "live", "movie", "series"} {
+		report.addSkipped(list, decodeReports[list])
+	}
+
+	changes := report.ChannelChanges
+	log.Printf("Source %d (%s) updated with %d channels (%d added, %d removed, %d renamed, %d moved), %d items skipped",
+		source.ID, source.Name, channelImport.Channels(), changes.Added, changes.Removed, changes.Renamed, changes.Moved, report.Skipped)
+	return nil
+}
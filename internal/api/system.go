@@ -0,0 +1,20 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// GetSchemaStatus veritabanının şema sürümünü ve uygulanan migration'ları döndürür
+func (h *Handler) GetSchemaStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.db.SchemaStatus()
+	if err != nil {
+		log.Printf("Error reading schema status: %v", err)
+		http.Error(w, "Failed to read schema status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"remote-iptv/internal/db"
+	"remote-iptv/internal/player"
+	"remote-iptv/internal/redact"
+	"remote-iptv/internal/xtream"
+)
+
+// Kanal sürümleri: aynı canlı kanalın kalite ve yedek sürümleri tek bir
+// mantıksal kanal olarak gruplanır. Listeler ?group_variants=true ile, oynatma
+// "preferred_variant": true ile her gruptan profilin kalite tercihine uyan
+// sürümü seçer; oynatılan sürüm açılamazsa grubun diğer sürümleri aynı
+// sırayla denenir.
+
+// variantStartTimeout sürümü olan canlı kanalda oynatmanın başlaması için
+// beklenen süredir; başlamazsa sıradaki sürüm denenir
+const variantStartTimeout = 10 * time.Second
+
+// GetChannelVariants kanalın grubundaki sürümleri profilin kalite
+// tercihine göre sıralı döndürür. Ebeveyn denetimine takılan sürümler
+// listelenmez.
+func (h *Handler) GetChannelVariants(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid channel ID", http.StatusBadRequest)
+		return
+	}
+	profile, ok := h.requireProfile(w, r)
+	if !ok {
+		return
+	}
+	filter, ok := h.requireParentalFilter(w, r)
+	if !ok {
+		return
+	}
+
+	variants, err := h.db.ChannelVariants(id, profile.PreferredQuality)
+	if errors.Is(err, db.ErrChannelNotFound) {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting variants of channel %d: %v", id, err)
+		http.Error(w, "Failed to get channel variants", http.StatusInternalServerError)
+		return
+	}
+
+	allowed := variants[:0]
+	for _, v := range variants {
+		ok, err := h.db.ChannelAllowed(v.ID, filter)
+		if err != nil {
+			http.Error(w, "Failed to check parental controls", http.StatusInternalServerError)
+			return
+		}
+		if ok {
+			allowed = append(allowed, v)
+		}
+	}
+	writeCachedJSON(w, r, allowed)
+}
+
+// preferredVariant kanalın grubundan profilin kalite tercihine uyan ve
+// ebeveyn denetimine takılmayan ilk sürümü döndürür
+func (h *Handler) preferredVariant(r *http.Request, profile *db.Profile, channelID int) *db.ChannelVariant {
+	variants, err := h.db.ChannelVariants(channelID, profile.PreferredQuality)
+	if err != nil {
+		if !errors.Is(err, db.ErrChannelNotFound) {
+			log.Printf("Error getting variants of channel %d: %v", channelID, err)
+		}
+		return nil
+	}
+	filter, err := h.parentalFilter(r)
+	if err != nil {
+		log.Printf("Error reading parental controls: %v", err)
+		return nil
+	}
+	for i := range variants {
+		if allowed, err := h.db.ChannelAllowed(variants[i].ID, filter); err == nil && allowed {
+			return &variants[i]
+		}
+	}
+	return nil
+}
+
+// liveStreamURL canlı kanalın oynatılacak adresini oluşturur. Xtream
+// kaynaklarında adres o an sağlıklı olan sunucuya göre kurulur.
+func (h *Handler) liveStreamURL(source *db.Source, ch db.Channel) string {
+	if source.Type != db.SourceXtream {
+		return ch.URL
+	}
+	client := h.xtreamClient(source)
+	h.ensureHealthyServer(source, client)
+	return xtreamLiveURL(client, source, ch)
+}
+
+// xtreamLiveURL Xtream kanalının adresini istemcinin aktif sunucusuna göre
+// oluşturur
+func xtreamLiveURL(client *xtream.Client, source *db.Source, ch db.Channel) string {
+	if resolved, ok := client.ResolveStreamPath(ch.URL); ok {
+		return resolved
+	}
+	if strings.Contains(ch.URL, "://") {
+		return client.RebaseURL(ch.URL)
+	}
+	return fmt.Sprintf("%s/live/%s/%s/%d", strings.TrimSuffix(client.ActiveServer(), "/"),
+		source.Username, source.Password, ch.RemoteID)
+}
+
+// hasVariants kanalın oynatılamazsa yerine denenecek başka sürümleri olup
+// olmadığını döndürür
+func (h *Handler) hasVariants(profile *db.Profile, ch *db.Channel) bool {
+	if ch == nil || ch.StreamType != "live" {
+		return false
+	}
+	variants, err := h.db.ChannelVariants(ch.ID, profile.PreferredQuality)
+	if err != nil {
+		log.Printf("Error getting variants of channel %d: %v", ch.ID, err)
+		return false
+	}
+	return len(variants) > 1
+}
+
+// playVariantFallback açılamayan canlı kanalın yerine grubundaki diğer
+// sürümleri profilin kalite tercihine göre sırayla dener ve açılan sürümü
+// kaynağıyla döndürür. Ebeveyn denetimine takılan sürümler atlanır; hiçbiri
+// açılamazsa nil döner.
+func (h *Handler) playVariantFallback(r *http.Request, profile *db.Profile, failed *db.Channel) (*db.Channel, *db.Source) {
+	if failed == nil || failed.StreamType != "live" {
+		return nil, nil
+	}
+	variants, err := h.db.ChannelVariants(failed.ID, profile.PreferredQuality)
+	if err != nil {
+		log.Printf("Error getting variants of channel %d: %v", failed.ID, err)
+		return nil, nil
+	}
+	filter, err := h.parentalFilter(r)
+	if err != nil {
+		log.Printf("Error reading parental controls: %v", err)
+		return nil, nil
+	}
+
+	for i := range variants {
+		v := &variants[i]
+		if v.ID == failed.ID {
+			continue
+		}
+		if allowed, err := h.db.ChannelAllowed(v.ID, filter); err != nil || !allowed {
+			continue
+		}
+		source, err := h.db.GetSource(v.SourceID)
+		if err != nil || source == nil {
+			log.Printf("Error getting source %d: %v", v.SourceID, err)
+			continue
+		}
+
+		playURL := h.liveStreamURL(source, v.Channel)
+		log.Printf("Trying variant %d (quality %q, backup %v) of channel %d: %s",
+			v.ID, v.Quality, v.Backup, failed.ID, redact.URL(playURL))
+		opts := player.PlayOptions{
+			UserAgent:        v.HTTPUserAgent,
+			Referrer:         v.HTTPReferrer,
+			AudioLanguage:    profile.AudioLanguage,
+			SubtitleLanguage: profile.SubtitleLanguage,
+		}
+		if err := h.player.PlayWithOptions(playURL, opts); err != nil {
+			log.Printf("Error playing variant %d: %v", v.ID, err)
+			continue
+		}
+		if err := h.player.WaitForPlayback(playURL, variantStartTimeout); err != nil {
+			log.Printf("Variant %d did not start: %v", v.ID, err)
+			continue
+		}
+		log.Printf("Playing variant %d instead of channel %d", v.ID, failed.ID)
+		return &v.Channel, source
+	}
+	return nil, nil
+}
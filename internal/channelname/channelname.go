@@ -0,0 +1,156 @@
+// Package channelname parses provider channel names. Providers list the same
+// channel several times with country prefixes, quality tags and backup
+// markers ("TR: TRT 1 HD", "TRT 1 FHD", "TRT 1 (Backup)"); Parse splits
+// those tags from the base name so the variants can be grouped.
+package channelname
+
+import (
+	"regexp"
+	"strings"
+
+	"remote-iptv/internal/search"
+)
+
+// Quality tags, lowest to highest. An empty quality means the name carried
+// no tag.
+const (
+	QualitySD  = "SD"
+	QualityHD  = "HD"
+	QualityFHD = "FHD"
+	QualityUHD = "4K"
+)
+
+var qualityRanks = map[string]int{
+	QualitySD:  1,
+	QualityHD:  2,
+	QualityFHD: 3,
+	QualityUHD: 4,
+}
+
+// qualityTokens maps the spellings providers use to a quality tag. Tokens
+// are compared upper-cased.
+var qualityTokens = map[string]string{
+	"SD": QualitySD, "480P": QualitySD, "576P": QualitySD, "LQ": QualitySD,
+	"HD": QualityHD, "720P": QualityHD, "HQ": QualityHD,
+	"FHD": QualityFHD, "FULLHD": QualityFHD, "1080P": QualityFHD, "1080I": QualityFHD,
+	"4K": QualityUHD, "UHD": QualityUHD, "2160P": QualityUHD, "8K": QualityUHD,
+	// Superscript tags ("TRT 1 ᴴᴰ")
+	"ˢᴰ": QualitySD, "ᴴᴰ": QualityHD, "ᶠᴴᴰ": QualityFHD, "ᵁᴴᴰ": QualityUHD, "⁴ᴷ": QualityUHD,
+}
+
+// backupTokens mark a provider's fallback copy of a channel
+var backupTokens = map[string]bool{
+	"BACKUP": true, "YEDEK": true, "BKP": true,
+}
+
+// threeLetterCountries are the three letter prefixes accepted as country
+// codes. Two letter prefixes are always treated as country codes; longer
+// ones are usually part of the name ("TRT: ...") and must be listed here.
+var threeLetterCountries = map[string]bool{
+	"USA": true, "UAE": true, "GER": true, "FRA": true, "ITA": true, "ESP": true,
+	"POR": true, "NED": true, "ARA": true, "ARB": true, "AZE": true, "KSA": true,
+}
+
+var (
+	// countryPrefix matches "TR:", "TR |", "TR - ", "[TR]", "|TR|" and "(TR)"
+	// at the start of a name. A hyphen needs a space after it so names like
+	// "TV-5" keep their prefix.
+	countryPrefix = regexp.MustCompile(`^\s*[\[(|]?\s*([A-Za-z]{2,3})\s*(?:[\])|]\s*[:|-]?|[:|]|-\s)\s*`)
+	// spacedTags joins tags that providers write as two words
+	spacedTags = regexp.MustCompile(`(?i)\b(full|ultra)\s+hd\b`)
+	// separators split tags that are glued to the name with punctuation
+	separators = strings.NewReplacer("(", " ", ")", " ", "[", " ", "]", " ", "|", " ", "{", " ", "}", " ")
+)
+
+// Info is a channel name split into its base name and tags
+type Info struct {
+	// Base is the name without country prefix, quality and backup tags
+	Base    string
+	Country string
+	Quality string
+	Backup  bool
+}
+
+// Parse splits a provider channel name into its base name and tags. Names
+// that consist of tags only keep the original name as base.
+func Parse(name string) Info {
+	var info Info
+	rest := name
+	if m := countryPrefix.FindStringSubmatchIndex(rest); m != nil {
+		code := strings.ToUpper(rest[m[2]:m[3]])
+		if len(code) == 2 || threeLetterCountries[code] {
+			info.Country = code
+			rest = rest[m[1]:]
+		}
+	}
+
+	rest = spacedTags.ReplaceAllStringFunc(rest, func(tag string) string {
+		if strings.HasPrefix(strings.ToUpper(tag), "FULL") {
+			return "FHD"
+		}
+		return "UHD"
+	})
+
+	var base []string
+	afterBackup := false
+	for _, field := range strings.Fields(separators.Replace(rest)) {
+		token := strings.ToUpper(strings.Trim(field, ".,:;-_/"))
+		if quality, ok := qualityTokens[token]; ok {
+			if qualityRanks[quality] > qualityRanks[info.Quality] {
+				info.Quality = quality
+			}
+			afterBackup = false
+			continue
+		}
+		if backupTokens[token] {
+			info.Backup = true
+			afterBackup = true
+			continue
+		}
+		// "Backup 2" numbers the provider's copies
+		if afterBackup && isNumber(token) {
+			continue
+		}
+		afterBackup = false
+		if token == "" {
+			// Stray separators ("TRT 1 - HD")
+			continue
+		}
+		base = append(base, field)
+	}
+
+	info.Base = strings.Join(base, " ")
+	if info.Base == "" {
+		info.Base = strings.TrimSpace(name)
+	}
+	return info
+}
+
+// Key identifies the logical channel: variants of the same channel share a
+// key regardless of quality, backup markers, casing and diacritics
+func (i Info) Key() string {
+	return strings.ToLower(i.Country) + ":" + search.Fold(i.Base)
+}
+
+// QualityRank orders quality tags; unknown and empty tags rank 0
+func QualityRank(quality string) int {
+	return qualityRanks[quality]
+}
+
+// ValidQuality reports whether quality is a known tag or empty
+func ValidQuality(quality string) bool {
+	_, ok := qualityRanks[quality]
+	return ok || quality == ""
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
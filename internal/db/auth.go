@@ -0,0 +1,261 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adminSessionTTL yönetici parolasıyla açılan oturumun ne kadar açık
+// kalacağıdır
+const adminSessionTTL = 30 * 24 * time.Hour
+
+// tokenUseInterval API anahtarının son kullanım zamanının en sık hangi
+// aralıkla yazılacağıdır; her istekte yazılmaz
+const tokenUseInterval = time.Minute
+
+// passwordHashPrefix scrypt ile özetlenmiş yönetici parolasını eski
+// sürümlerin PIN özetinden (tuz$özet) ayırır
+const passwordHashPrefix = "scrypt$"
+
+// ErrAPITokenNotFound silinecek API anahtarı bulunamazsa döner
+var ErrAPITokenNotFound = errors.New("api token not found")
+
+// APIToken otomasyonlar için verilmiş bir API anahtarıdır. Anahtarın
+// kendisi yalnızca oluşturulurken döner, saklanmaz.
+type APIToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// AuthEnabled yönetici parolası belirlenmiş olup olmadığını döndürür
+func (d *Database) AuthEnabled() (bool, error) {
+	var enabled bool
+	err := d.db.QueryRow("SELECT password_hash != '' FROM auth_settings WHERE id = 1").Scan(&enabled)
+	return enabled, err
+}
+
+// SetAdminPassword yönetici parolasını değiştirir; parola boşsa kimlik
+// doğrulama kapanır. Açık oturumlar kapatılır, API anahtarları korunur.
+func (d *Database) SetAdminPassword(password string) error {
+	passwordHash := ""
+	if password != "" {
+		var err error
+		if passwordHash, err = hashPassword(password); err != nil {
+			return err
+		}
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE auth_settings SET password_hash = ? WHERE id = 1", passwordHash); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM auth_sessions"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CheckAdminPassword parolanın yönetici parolasıyla eşleşip eşleşmediğini
+// döndürür. Parola belirlenmemişse hiçbir parola eşleşmez.
+func (d *Database) CheckAdminPassword(password string) (bool, error) {
+	var passwordHash string
+	if err := d.db.QueryRow("SELECT password_hash FROM auth_settings WHERE id = 1").Scan(&passwordHash); err != nil {
+		return false, err
+	}
+	if passwordHash == "" {
+		return false, nil
+	}
+	if strings.HasPrefix(passwordHash, passwordHashPrefix) {
+		return checkPassword(passwordHash, password), nil
+	}
+
+	// Eski sürümlerde parola PIN gibi özetlenirdi; doğru girildiğinde
+	// scrypt özetiyle değiştirilir
+	if !checkPIN(passwordHash, password) {
+		return false, nil
+	}
+	upgraded, err := hashPassword(password)
+	if err != nil {
+		return false, err
+	}
+	if _, err := d.db.Exec("UPDATE auth_settings SET password_hash = ? WHERE id = 1 AND password_hash = ?",
+		upgraded, passwordHash); err != nil {
+		return false, err
+	}
+	log.Printf("Upgraded the admin password hash to scrypt")
+	return true, nil
+}
+
+// hashPassword parolayı rastgele tuzla scrypt'ten geçirir. Parametreler
+// özetle birlikte saklanır: scrypt$N$r$p$tuz$özet
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := scryptKey([]byte(password), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%d$%d$%d$%s$%s", passwordHashPrefix, scryptN, scryptR, scryptP,
+		hex.EncodeToString(salt), hex.EncodeToString(key)), nil
+}
+
+// checkPassword parolanın hashPassword özetiyle eşleşip eşleşmediğini döndürür
+func checkPassword(passwordHash, password string) bool {
+	parts := strings.Split(strings.TrimPrefix(passwordHash, passwordHashPrefix), "$")
+	if len(parts) != 5 {
+		return false
+	}
+	var params [3]int
+	for i := range params {
+		value, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return false
+		}
+		params[i] = value
+	}
+	salt, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	want, err := hex.DecodeString(parts[4])
+	if err != nil || len(want) == 0 {
+		return false
+	}
+	got, err := scryptKey([]byte(password), salt, params[0], params[1], params[2], len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// CreateAdminSession adminSessionTTL süresince geçerli bir yönetici oturumu
+// açar ve anahtarını bitiş zamanıyla döndürür
+func (d *Database) CreateAdminSession() (string, time.Time, error) {
+	token, err := newSessionToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expires := now.Add(adminSessionTTL)
+	// Süresi dolan oturumlar yenileri açılırken temizlenir
+	if _, err := d.db.Exec("DELETE FROM auth_sessions WHERE expires_at < ?", now); err != nil {
+		return "", time.Time{}, err
+	}
+	_, err = d.db.Exec("INSERT INTO auth_sessions (token_hash, created_at, expires_at) VALUES (?, ?, ?)",
+		sessionTokenHash(token), now, expires)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expires, nil
+}
+
+// AdminSessionActive yönetici oturumunun geçerli olup olmadığını döndürür
+func (d *Database) AdminSessionActive(token string) (bool, error) {
+	var expires time.Time
+	err := d.db.QueryRow("SELECT expires_at FROM auth_sessions WHERE token_hash = ?", sessionTokenHash(token)).
+		Scan(&expires)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return time.Now().Before(expires), nil
+}
+
+// DeleteAdminSession yönetici oturumunu kapatır
+func (d *Database) DeleteAdminSession(token string) error {
+	_, err := d.db.Exec("DELETE FROM auth_sessions WHERE token_hash = ?", sessionTokenHash(token))
+	return err
+}
+
+// CreateAPIToken yeni bir API anahtarı oluşturur ve anahtarı bilgileriyle
+// döndürür
+func (d *Database) CreateAPIToken(name string) (*APIToken, string, error) {
+	token, err := newSessionToken()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	res, err := d.db.Exec("INSERT INTO api_tokens (name, token_hash, created_at) VALUES (?, ?, ?)",
+		name, sessionTokenHash(token), now)
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, "", err
+	}
+	return &APIToken{ID: int(id), Name: name, CreatedAt: now}, token, nil
+}
+
+// GetAPITokens API anahtarlarını oluşturulma sırasıyla döndürür
+func (d *Database) GetAPITokens() ([]APIToken, error) {
+	rows, err := d.db.Query("SELECT id, name, created_at, last_used_at FROM api_tokens ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			t.LastUsedAt = &lastUsed.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteAPIToken API anahtarını iptal eder
+func (d *Database) DeleteAPIToken(id int) error {
+	res, err := d.db.Exec("DELETE FROM api_tokens WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrAPITokenNotFound
+	}
+	return err
+}
+
+// CheckAPIToken anahtarın geçerli bir API anahtarı olup olmadığını döndürür
+// ve son kullanım zamanını günceller
+func (d *Database) CheckAPIToken(token string) (bool, error) {
+	now := time.Now()
+	res, err := d.db.Exec(`UPDATE api_tokens SET last_used_at = ?
+		WHERE token_hash = ? AND (last_used_at IS NULL OR last_used_at < ?)`,
+		now, sessionTokenHash(token), now.Add(-tokenUseInterval))
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		return true, nil
+	}
+	var exists bool
+	err = d.db.QueryRow("SELECT EXISTS (SELECT 1 FROM api_tokens WHERE token_hash = ?)", sessionTokenHash(token)).
+		Scan(&exists)
+	return exists, err
+}
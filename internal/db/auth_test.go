@@ -0,0 +1,70 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAdminPassword(t *testing.T) {
+	d, err := NewDatabase(testDBPath(t))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer d.Close()
+
+	if ok, err := d.CheckAdminPassword(""); err != nil || ok {
+		t.Errorf("CheckAdminPassword without a password = %v, %v", ok, err)
+	}
+
+	if err := d.SetAdminPassword("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	var stored string
+	if err := d.db.QueryRow("SELECT password_hash FROM auth_settings WHERE id = 1").Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, passwordHashPrefix) {
+		t.Errorf("password hash %q is not an scrypt hash", stored)
+	}
+	if ok, err := d.CheckAdminPassword("correct horse"); err != nil || !ok {
+		t.Errorf("CheckAdminPassword(correct) = %v, %v", ok, err)
+	}
+	if ok, err := d.CheckAdminPassword("wrong horse"); err != nil || ok {
+		t.Errorf("CheckAdminPassword(wrong) = %v, %v", ok, err)
+	}
+}
+
+func TestAdminPasswordLegacyHash(t *testing.T) {
+	d, err := NewDatabase(testDBPath(t))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer d.Close()
+
+	legacy, err := hashPIN("old password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.db.Exec("UPDATE auth_settings SET password_hash = ? WHERE id = 1", legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := d.CheckAdminPassword("wrong password"); err != nil || ok {
+		t.Errorf("CheckAdminPassword(wrong) = %v, %v", ok, err)
+	}
+	if ok, err := d.CheckAdminPassword("old password"); err != nil || !ok {
+		t.Fatalf("CheckAdminPassword(legacy) = %v, %v", ok, err)
+	}
+
+	// A successful login replaces the legacy hash
+	var stored string
+	if err := d.db.QueryRow("SELECT password_hash FROM auth_settings WHERE id = 1").Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, passwordHashPrefix) {
+		t.Errorf("legacy hash was not upgraded: %q", stored)
+	}
+	if ok, err := d.CheckAdminPassword("old password"); err != nil || !ok {
+		t.Errorf("CheckAdminPassword after upgrade = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,386 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+)
+
+// channelBatchSize tek INSERT ifadesiyle yazılan kanal sayısıdır
+const channelBatchSize = 500
+
+const channelInsertColumns = `remote_id, name, url, stream_type, category_id, stream_icon, rating, extension,
+	epg_channel_id, http_user_agent, http_referrer, catchup, catchup_days, catchup_source, plot, genre, actors, number`
+
+// channelInsertArgs channelInsertColumns sırasındaki kolon sayısıdır
+const channelInsertArgs = 18
+
+// channelStagingSchema senkronizasyon sırasında gelen kanalların toplandığı
+// geçici tablodur. Aynı kanal iki kez gelirse sonuncusu geçerli olur.
+const channelStagingSchema = `CREATE TEMP TABLE channel_staging (
+	remote_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	url TEXT NOT NULL,
+	stream_type TEXT NOT NULL,
+	category_id INTEGER NOT NULL,
+	stream_icon TEXT,
+	rating TEXT,
+	extension TEXT,
+	epg_channel_id TEXT,
+	http_user_agent TEXT,
+	http_referrer TEXT,
+	catchup TEXT,
+	catchup_days INTEGER,
+	catchup_source TEXT,
+	plot TEXT,
+	genre TEXT,
+	actors TEXT,
+	number INTEGER,
+	PRIMARY KEY (stream_type, remote_id)
+)`
+
+// channelDetailsChanged ad ve kategori dışındaki alanlardan biri değiştiyse
+// doğru olan koşuldur (c: kayıtlı kanal, s: gelen kanal)
+const channelDetailsChanged = `(c.url IS NOT s.url OR c.stream_icon IS NOT s.stream_icon OR c.rating IS NOT s.rating
+	OR c.extension IS NOT s.extension OR c.epg_channel_id IS NOT s.epg_channel_id
+	OR c.http_user_agent IS NOT s.http_user_agent OR c.http_referrer IS NOT s.http_referrer
+	OR c.catchup IS NOT s.catchup OR c.catchup_days IS NOT s.catchup_days OR c.catchup_source IS NOT s.catchup_source
+	OR c.plot IS NOT s.plot OR c.genre IS NOT s.genre OR c.actors IS NOT s.actors OR c.number IS NOT s.number)`
+
+// SyncDiff bir senkronizasyonda kayıtlara uygulanan değişiklikleri sayar.
+// Bir kanal hem yeniden adlandırılıp hem taşınabilir, o zaman iki sayaçta da
+// görünür.
+type SyncDiff struct {
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+	Renamed   int `json:"renamed"`
+	Moved     int `json:"moved"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+}
+
+// ChannelImport bir kaynağın kategori ve kanal listesini günceller.
+// Kanallar geldikçe küçük gruplar halinde ayrı bir bağlantının geçici
+// tablosuna yazılır; indirme sürerken ana veritabanında transaction açık
+// kalmaz, diğer yazmalar (oynatma geçmişi, sağlık sonuçları) beklemez.
+// Commit kategorileri günceller, kayıtlı liste ile farkı hesaplar ve
+// yalnızca eklenen, silinen ve değişen kanalları tek bir kısa transaction'da
+// uygular. Böylece değişmeyen kanalların yerel ID'leri ve onlara bağlı
+// kayıtlar korunur.
+type ChannelImport struct {
+	sourceID  int
+	fts       bool
+	conn      *sql.Conn
+	tx        *sql.Tx
+	batchStmt *sql.Stmt
+	args      []interface{}
+	pending   int
+	channels  int
+	// categories SaveCategories ile verilen, Commit'te yazılacak kategorilerdir
+	categories map[string][]Category
+}
+
+// BeginChannelImport kaynak için yeni bir yükleme başlatır. Commit edilene
+// kadar mevcut liste değişmez.
+func (d *Database) BeginChannelImport(sourceID int) (*ChannelImport, error) {
+	// Geçici tablo bağlantıya özeldir, yükleme boyunca aynı bağlantı kullanılır
+	conn, err := d.db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stmt := range []string{"DROP TABLE IF EXISTS temp.channel_staging", channelStagingSchema} {
+		if _, err := conn.ExecContext(context.Background(), stmt); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	batchStmt, err := conn.PrepareContext(context.Background(), channelInsertQuery(channelBatchSize))
+	if err != nil {
+		dropStaging(conn)
+		return nil, err
+	}
+
+	return &ChannelImport{
+		sourceID:   sourceID,
+		fts:        d.fts,
+		conn:       conn,
+		batchStmt:  batchStmt,
+		args:       make([]interface{}, 0, channelBatchSize*channelInsertArgs),
+		categories: make(map[string][]Category),
+	}, nil
+}
+
+// dropStaging geçici tabloyu silip bağlantıyı havuza geri verir
+func dropStaging(conn *sql.Conn) {
+	conn.ExecContext(context.Background(), "DROP TABLE IF EXISTS temp.channel_staging")
+	conn.Close()
+}
+
+func channelInsertQuery(rows int) string {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", channelInsertArgs), ", ") + ")"
+	return "INSERT OR REPLACE INTO temp.channel_staging (" + channelInsertColumns + ") VALUES " +
+		strings.TrimSuffix(strings.Repeat(row+", ", rows), ", ")
+}
+
+// SaveCategories kaynağın verilen türdeki kategorilerini Commit'te
+// yazılmak üzere kaydeder. Bu türdeki kanalların CategoryID'si yerel ID
+// değil, kategorinin sağlayıcıdaki (uzak) ID'sidir; Commit yerel ID'ye
+// çevirir. Listede olmayan kategoriye bağlı kanallar kategorisiz kalır.
+func (c *ChannelImport) SaveCategories(categoryType string, categories []Category) {
+	c.categories[categoryType] = append(c.categories[categoryType], categories...)
+}
+
+// Add kanalı yazılacak gruba ekler, grup dolduğunda geçici tabloya yazar
+func (c *ChannelImport) Add(ch Channel) error {
+	c.args = append(c.args, ch.RemoteID, ch.Name, ch.URL, ch.StreamType, ch.CategoryID, ch.StreamIcon, ch.Rating, ch.Extension,
+		ch.EPGChannelID, ch.HTTPUserAgent, ch.HTTPReferrer, ch.Catchup, ch.CatchupDays, ch.CatchupSource,
+		ch.Plot, ch.Genre, ch.Cast, ch.Number)
+	c.pending++
+	c.channels++
+
+	if c.pending == channelBatchSize {
+		if _, err := c.batchStmt.Exec(c.args...); err != nil {
+			return err
+		}
+		c.args = c.args[:0]
+		c.pending = 0
+	}
+	return nil
+}
+
+// flush gruptaki kalan kanalları yazar
+func (c *ChannelImport) flush() error {
+	if c.pending == 0 {
+		return nil
+	}
+	if _, err := c.conn.ExecContext(context.Background(), channelInsertQuery(c.pending), c.args...); err != nil {
+		return err
+	}
+	c.args = c.args[:0]
+	c.pending = 0
+	return nil
+}
+
+// Channels şu ana kadar eklenen kanal sayısını döndürür
+func (c *ChannelImport) Channels() int {
+	return c.channels
+}
+
+// Commit gelen liste ile kayıtlı liste arasındaki farkı uygular ve
+// kategori ve kanal değişikliklerini döndürür
+func (c *ChannelImport) Commit() (categories SyncDiff, channels SyncDiff, err error) {
+	defer func() {
+		if err != nil {
+			c.Rollback()
+		}
+	}()
+
+	if err = c.flush(); err != nil {
+		return
+	}
+	if c.tx, err = c.conn.BeginTx(context.Background(), nil); err != nil {
+		return
+	}
+
+	types := make([]string, 0, len(c.categories))
+	for categoryType := range c.categories {
+		types = append(types, categoryType)
+	}
+	sort.Strings(types)
+	for _, categoryType := range types {
+		var diff SyncDiff
+		if _, diff, err = upsertCategories(c.tx, c.sourceID, categoryType, c.categories[categoryType]); err != nil {
+			return
+		}
+		categories.add(diff)
+		// Kanallar sağlayıcının kategori ID'siyle geldi, yerel ID'ye çevrilir
+		if _, err = c.tx.Exec(`UPDATE temp.channel_staging SET category_id = COALESCE(
+				(SELECT id FROM categories WHERE source_id = ? AND type = ? AND remote_id = channel_staging.category_id), 0)
+			WHERE stream_type = ?`, c.sourceID, categoryType, categoryType); err != nil {
+			return
+		}
+	}
+
+	if channels, err = c.diff(); err != nil {
+		return
+	}
+
+	statements := []string{
+		// Yeni kanallar eklenir, değişenler yerinde güncellenir
+		`INSERT INTO channels (source_id, ` + channelInsertColumns + `, added_at)
+		SELECT ?, ` + channelInsertColumns + `, CURRENT_TIMESTAMP FROM temp.channel_staging WHERE true
+		ON CONFLICT (source_id, stream_type, remote_id) DO UPDATE SET
+			name = excluded.name, url = excluded.url, category_id = excluded.category_id,
+			stream_icon = excluded.stream_icon, rating = excluded.rating, extension = excluded.extension,
+			epg_channel_id = excluded.epg_channel_id, http_user_agent = excluded.http_user_agent,
+			http_referrer = excluded.http_referrer, catchup = excluded.catchup, catchup_days = excluded.catchup_days,
+			catchup_source = excluded.catchup_source, plot = excluded.plot, genre = excluded.genre,
+			actors = excluded.actors, number = excluded.number, last_updated = CURRENT_TIMESTAMP
+		WHERE ` + strings.NewReplacer("c.", "channels.", "s.", "excluded.").Replace(
+			`(c.name IS NOT s.name OR c.category_id IS NOT s.category_id OR `+channelDetailsChanged+`)`),
+		// Listeden çıkan kanallar eklemelerden sonra silinir, böylece yeni
+		// kanallar silinenlerin ID'lerini almaz
+		`DELETE FROM channels WHERE source_id = ? AND NOT EXISTS (
+			SELECT 1 FROM temp.channel_staging s WHERE s.stream_type = channels.stream_type AND s.remote_id = channels.remote_id)`,
+	}
+	for _, stmt := range statements {
+		if _, err = c.tx.Exec(stmt, c.sourceID); err != nil {
+			return
+		}
+	}
+
+	// Silinen kanalların EPG eşleşmeleri artık bir kanala ait değil
+	if _, err = c.tx.Exec("DELETE FROM epg_channel_map WHERE channel_id NOT IN (SELECT id FROM channels)"); err != nil {
+		return
+	}
+	// Favorilerdeki ad ve logo kopyaları kanal listeden çıktığında da
+	// gösterilebilmesi için güncel tutulur
+	if _, err = c.tx.Exec(`UPDATE favorites SET name = c.name, url = c.url, category_id = c.category_id,
+			stream_icon = COALESCE(c.stream_icon, '')
+		FROM channels c
+		WHERE favorites.source_id = ?1 AND c.source_id = ?1 AND c.stream_type = favorites.stream_type
+			AND c.remote_id = favorites.remote_id`, c.sourceID); err != nil {
+		return
+	}
+	if err = applyCategoryAutoLocks(c.tx, c.sourceID); err != nil {
+		return
+	}
+	if _, err = refreshChannelVariants(c.tx, c.sourceID); err != nil {
+		return
+	}
+	if _, err = refreshSearchIndex(c.tx, c.fts, c.sourceID); err != nil {
+		return
+	}
+	if err = c.tx.Commit(); err != nil {
+		return
+	}
+	c.batchStmt.Close()
+	dropStaging(c.conn)
+	return categories, channels, nil
+}
+
+// diff geçici tablodaki kanalları kayıtlı kanallarla karşılaştırır
+func (c *ChannelImport) diff() (SyncDiff, error) {
+	var diff SyncDiff
+	var matched int
+	err := c.tx.QueryRow(`SELECT
+			COUNT(*),
+			COALESCE(SUM(c.name IS NOT s.name), 0),
+			COALESCE(SUM(c.category_id IS NOT s.category_id), 0),
+			COALESCE(SUM(`+channelDetailsChanged+`), 0),
+			COALESCE(SUM(c.name IS s.name AND c.category_id IS s.category_id AND NOT `+channelDetailsChanged+`), 0)
+		FROM temp.channel_staging s
+		JOIN channels c ON c.source_id = ? AND c.stream_type = s.stream_type AND c.remote_id = s.remote_id`,
+		c.sourceID).Scan(&matched, &diff.Renamed, &diff.Moved, &diff.Updated, &diff.Unchanged)
+	if err != nil {
+		return diff, err
+	}
+
+	var staged, existing int
+	if err := c.tx.QueryRow("SELECT COUNT(*) FROM temp.channel_staging").Scan(&staged); err != nil {
+		return diff, err
+	}
+	if err := c.tx.QueryRow("SELECT COUNT(*) FROM channels WHERE source_id = ?", c.sourceID).Scan(&existing); err != nil {
+		return diff, err
+	}
+	diff.Added = staged - matched
+	diff.Removed = existing - matched
+	return diff, nil
+}
+
+// Rollback yüklemeyi iptal eder, önceki liste korunur
+func (c *ChannelImport) Rollback() error {
+	var err error
+	if c.tx != nil {
+		err = c.tx.Rollback()
+	}
+	c.batchStmt.Close()
+	dropStaging(c.conn)
+	return err
+}
+
+func (d *SyncDiff) add(other SyncDiff) {
+	d.Added += other.Added
+	d.Removed += other.Removed
+	d.Renamed += other.Renamed
+	d.Moved += other.Moved
+	d.Updated += other.Updated
+	d.Unchanged += other.Unchanged
+}
+
+// upsertCategories kaynağın bir türdeki kategorilerini gelen listeye göre
+// günceller. Kayıtlı kategoriler yerel ID'lerini korur; adı değişenler
+// güncellenir, listeden çıkanlar silinir.
+func upsertCategories(tx *sql.Tx, sourceID int, categoryType string, categories []Category) (map[int]int, SyncDiff, error) {
+	var diff SyncDiff
+
+	type stored struct {
+		id   int
+		name string
+	}
+	existing := map[int]stored{}
+	rows, err := tx.Query("SELECT id, remote_id, name FROM categories WHERE source_id = ? AND type = ?", sourceID, categoryType)
+	if err != nil {
+		return nil, diff, err
+	}
+	for rows.Next() {
+		var remoteID int
+		var cat stored
+		if err := rows.Scan(&cat.id, &remoteID, &cat.name); err != nil {
+			rows.Close()
+			return nil, diff, err
+		}
+		existing[remoteID] = cat
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, diff, err
+	}
+
+	ids := make(map[int]int, len(categories))
+	for _, cat := range categories {
+		if _, exists := ids[cat.RemoteID]; exists {
+			continue
+		}
+
+		if old, ok := existing[cat.RemoteID]; ok {
+			ids[cat.RemoteID] = old.id
+			if old.name == cat.Name {
+				diff.Unchanged++
+				continue
+			}
+			if _, err := tx.Exec("UPDATE categories SET name = ? WHERE id = ?", cat.Name, old.id); err != nil {
+				return nil, diff, err
+			}
+			diff.Renamed++
+			continue
+		}
+
+		res, err := tx.Exec("INSERT INTO categories (source_id, remote_id, name, type) VALUES (?, ?, ?, ?)",
+			sourceID, cat.RemoteID, cat.Name, categoryType)
+		if err != nil {
+			return nil, diff, err
+		}
+		localID, err := res.LastInsertId()
+		if err != nil {
+			return nil, diff, err
+		}
+		ids[cat.RemoteID] = int(localID)
+		diff.Added++
+	}
+
+	for remoteID, old := range existing {
+		if _, ok := ids[remoteID]; ok {
+			continue
+		}
+		if _, err := tx.Exec("DELETE FROM categories WHERE id = ?", old.id); err != nil {
+			return nil, diff, err
+		}
+		diff.Removed++
+	}
+
+	return ids, diff, nil
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kanal listesi sıralama seçenekleri
+const (
+	SortDefault = ""
+	SortName    = "name"
+	SortRating  = "rating"
+	SortAdded   = "added"
+	SortNumber  = "number"
+	SortHealth  = "health"
+)
+
+// channelSorts sıralama seçeneklerinin ORDER BY ifadeleri ve varsayılan
+// yönleridir. Varsayılan sıralama yerel sırayı izler. Eşit değerlerde
+// sayfalama kararlı olsun diye ID'ye göre sıralanır.
+var channelSorts = map[string]struct {
+	expr string
+	desc bool
+}{
+	SortDefault: {"position", false},
+	SortName:    {"name COLLATE NOCASE", false},
+	SortRating:  {"CAST(NULLIF(rating, '') AS REAL)", true},
+	SortAdded:   {"added_at", true},
+	SortNumber:  {"NULLIF(number, 0)", false},
+	SortHealth:  {healthRank, false},
+}
+
+// ValidChannelSort sıralama seçeneğinin geçerli olup olmadığını döndürür
+func ValidChannelSort(sort string) bool {
+	_, ok := channelSorts[sort]
+	return ok
+}
+
+// ChannelQuery kanal listesi sorgusudur. Sıfır değerli alanlar süzme
+// yapmaz; Limit 0 ise Offset'ten sonraki tüm kanallar döner.
+type ChannelQuery struct {
+	SourceID   int
+	StreamType string
+	// CategoryID HasCategory doğruysa uygulanır, 0 da geçerli bir kategoridir
+	CategoryID  int
+	HasCategory bool
+	// ProfileID sıfır değilse profilin gizlediği kategorilerdeki kanallar
+	// listelenmez
+	ProfileID int
+	// IncludeHidden yerel olarak ya da profilde gizlenen kanalları da listeler
+	IncludeHidden bool
+	// Parental kilitli ve yaş sınırını aşan kanalları süzer
+	Parental ParentalFilter
+	// HideDead sağlık yoklamasında ölü bulunan kanalları listelemez
+	HideDead bool
+	// GroupVariants aynı kanalın süzgeçten geçen sürümlerinden yalnızca
+	// PreferredQuality'ye göre tercih edilenini listeler
+	GroupVariants    bool
+	PreferredQuality string
+
+	Sort string
+	// Order "asc" ya da "desc" olabilir, boşsa sıralamanın varsayılanı kullanılır
+	Order string
+
+	Offset int
+	Limit  int
+}
+
+// ListChannels sorguya uyan kanalları ve sayfalamadan önceki toplam sayıyı
+// döndürür
+func (d *Database) ListChannels(q ChannelQuery) ([]Channel, int, error) {
+	sort, ok := channelSorts[q.Sort]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown sort %q", q.Sort)
+	}
+	desc := sort.desc
+	switch q.Order {
+	case "":
+	case "asc":
+		desc = false
+	case "desc":
+		desc = true
+	default:
+		return nil, 0, fmt.Errorf("unknown order %q", q.Order)
+	}
+
+	var where []string
+	var args []interface{}
+	if q.SourceID != 0 {
+		where = append(where, "source_id = ?")
+		args = append(args, q.SourceID)
+	}
+	if q.StreamType != "" {
+		where = append(where, "stream_type = ?")
+		args = append(args, q.StreamType)
+	}
+	if q.HasCategory {
+		where = append(where, "category_id = ?")
+		args = append(args, q.CategoryID)
+	}
+	if !q.IncludeHidden {
+		where = append(where, "NOT hidden")
+		if q.ProfileID != 0 {
+			where = append(where, "category_id NOT IN ("+hiddenCategoryIDs+")")
+			args = append(args, q.ProfileID)
+		}
+	}
+	if q.HideDead {
+		where = append(where, "NOT "+deadChannel)
+	}
+	parentalWhere, parentalArgs := q.Parental.conditions("channels")
+	where = append(where, parentalWhere...)
+	args = append(args, parentalArgs...)
+	filter := ""
+	if len(where) > 0 {
+		filter = " WHERE " + strings.Join(where, " AND ")
+	}
+	from := localChannels + " channels"
+	if q.GroupVariants {
+		// Süzgeç gruplamadan önce uygulanır; böylece gizli ya da kilitli
+		// sürümün yerine grubun listelenebilen başka bir sürümü gelir
+		from = `(SELECT * FROM (SELECT channels.*, ROW_NUMBER() OVER (
+				PARTITION BY COALESCE(v.group_key, '#' || channels.id)
+				ORDER BY ` + variantOrder(q.PreferredQuality) + `) AS variant_rank
+			FROM ` + localChannels + ` channels LEFT JOIN channel_variants v ON v.channel_id = channels.id` + filter + `)
+			WHERE variant_rank = 1) channels`
+		filter = ""
+	}
+
+	// Boş değerler (puansız film, numarasız kanal) yönden bağımsız olarak sona kalır
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+	query := "SELECT " + channelColumns + " FROM " + from + filter +
+		fmt.Sprintf(" ORDER BY %s %s NULLS LAST, id %s", sort.expr, direction, direction)
+	paged := q.Limit > 0 || q.Offset > 0
+	if paged {
+		limit := q.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, q.Offset)
+	}
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	channels := []Channel{}
+	for rows.Next() {
+		ch, err := scanChannel(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		channels = append(channels, ch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	total := len(channels)
+	if paged {
+		countArgs := args[:len(args)-2]
+		if err := d.db.QueryRow("SELECT COUNT(*) FROM "+from+filter, countArgs...).Scan(&total); err != nil {
+			return nil, 0, err
+		}
+	}
+	return channels, total, nil
+}
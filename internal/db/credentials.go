@@ -0,0 +1,113 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// xtreamStreamTypes kimlik bilgisi içeren Xtream akış yollarının önekleridir
+var xtreamStreamTypes = map[string]bool{"live": true, "movie": true, "series": true}
+
+// stripStreamCredentials eski sürümlerin kanal ve favori URL'lerine gömdüğü
+// Xtream kullanıcı adı ve şifresini kaldırır. {sunucu}/live/{kullanıcı}/{şifre}/123.m3u8
+// biçimindeki adresler live/123.m3u8 olarak saklanır; tam adres oynatma
+// sırasında aktif sunucu ve güncel bilgilerle yeniden oluşturulur.
+func stripStreamCredentials(tx *sql.Tx, box *secretBox) error {
+	rows, err := tx.Query("SELECT id, username, password FROM sources WHERE type = ? AND username != ''", SourceXtream)
+	if err != nil {
+		return err
+	}
+	type credentials struct {
+		sourceID           int
+		username, password string
+	}
+	var accounts []credentials
+	for rows.Next() {
+		var c credentials
+		if err := rows.Scan(&c.sourceID, &c.username, &c.password); err != nil {
+			rows.Close()
+			return err
+		}
+		if c.username, err = box.open(c.username); err != nil {
+			rows.Close()
+			return err
+		}
+		if c.password, err = box.open(c.password); err != nil {
+			rows.Close()
+			return err
+		}
+		accounts = append(accounts, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(accounts) == 0 {
+		return err
+	}
+
+	total := 0
+	for _, account := range accounts {
+		n, err := stripTableCredentials(tx, "channels", "source_id = ?", []interface{}{account.sourceID}, account.username, account.password)
+		if err != nil {
+			return err
+		}
+		total += n
+		// Favoriler kaynağa bağlı değil, her hesabın bilgileriyle taranır
+		n, err = stripTableCredentials(tx, "favorites", "1 = 1", nil, account.username, account.password)
+		if err != nil {
+			return err
+		}
+		total += n
+	}
+	if total > 0 {
+		log.Printf("Removed credentials from %d stored stream urls", total)
+	}
+	return nil
+}
+
+func stripTableCredentials(tx *sql.Tx, table, where string, args []interface{}, username, password string) (int, error) {
+	rows, err := tx.Query("SELECT id, url FROM "+table+" WHERE "+where+" AND url LIKE '%://%'", args...)
+	if err != nil {
+		return 0, err
+	}
+	updates := map[int]string{}
+	for rows.Next() {
+		var id int
+		var streamURL string
+		if err := rows.Scan(&id, &streamURL); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if path, ok := streamPath(streamURL, username, password); ok {
+			updates[id] = path
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, path := range updates {
+		if _, err := tx.Exec("UPDATE "+table+" SET url = ? WHERE id = ?", path, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(updates), nil
+}
+
+// streamPath {sunucu}/{tür}/{kullanıcı}/{şifre}/{dosya} adresini {tür}/{dosya}
+// yoluna çevirir
+func streamPath(streamURL, username, password string) (string, bool) {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return "", false
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) != 4 || !xtreamStreamTypes[segments[0]] {
+		return "", false
+	}
+	if segments[1] != username || segments[2] != password || segments[3] == "" {
+		return "", false
+	}
+	return segments[0] + "/" + segments[3], true
+}
@@ -0,0 +1,273 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Programme bir kanalın yayın akışındaki tek bir programı temsil eder
+type Programme struct {
+	ID          int       `json:"id"`
+	XMLTVID     string    `json:"xmltv_id"`
+	Start       time.Time `json:"start"`
+	Stop        time.Time `json:"stop"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	Category    string    `json:"category,omitempty"`
+}
+
+// programmeBatchSize tek INSERT ifadesiyle yazılan program sayısıdır
+const programmeBatchSize = 500
+
+// programmeInsertArgs bir program satırının kolon sayısıdır
+const programmeInsertArgs = 6
+
+// epgStagingSchema yükleme sırasında gelen programların ve kanal
+// eşleşmelerinin toplandığı geçici tablolardır
+var epgStagingSchema = []string{
+	"DROP TABLE IF EXISTS temp.epg_programme_staging",
+	"DROP TABLE IF EXISTS temp.epg_map_staging",
+	`CREATE TEMP TABLE epg_programme_staging (
+		xmltv_id TEXT NOT NULL,
+		start INTEGER NOT NULL,
+		stop INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		description TEXT,
+		category TEXT
+	)`,
+	`CREATE TEMP TABLE epg_map_staging (
+		channel_id INTEGER PRIMARY KEY,
+		xmltv_id TEXT NOT NULL,
+		matched_by TEXT NOT NULL
+	)`,
+}
+
+// EPGImport bir rehberin (kaynak ID'si, kaynaktan bağımsız rehberler için 0)
+// yüklemesini temsil eder. Programlar geldikçe küçük gruplar halinde ayrı bir
+// bağlantının geçici tablosuna yazılır, böylece rehberin tamamı bellekte
+// tutulmaz ve indirme ile ayrıştırma sürerken ana veritabanında transaction
+// açık kalmaz. Commit eski rehberi yenisiyle tek bir kısa transaction'da
+// değiştirir.
+type EPGImport struct {
+	sourceID   int
+	conn       *sql.Conn
+	batchStmt  *sql.Stmt
+	args       []interface{}
+	pending    int
+	programmes int
+}
+
+// BeginEPGImport verilen rehber için yeni bir yükleme başlatır. Commit
+// edilene kadar mevcut rehber değişmez.
+func (d *Database) BeginEPGImport(sourceID int) (*EPGImport, error) {
+	// Geçici tablolar bağlantıya özeldir, yükleme boyunca aynı bağlantı kullanılır
+	conn, err := d.db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stmt := range epgStagingSchema {
+		if _, err := conn.ExecContext(context.Background(), stmt); err != nil {
+			dropEPGStaging(conn)
+			return nil, err
+		}
+	}
+
+	batchStmt, err := conn.PrepareContext(context.Background(), programmeInsertQuery(programmeBatchSize))
+	if err != nil {
+		dropEPGStaging(conn)
+		return nil, err
+	}
+
+	return &EPGImport{
+		sourceID:  sourceID,
+		conn:      conn,
+		batchStmt: batchStmt,
+		args:      make([]interface{}, 0, programmeBatchSize*programmeInsertArgs),
+	}, nil
+}
+
+// dropEPGStaging geçici tabloları silip bağlantıyı havuza geri verir
+func dropEPGStaging(conn *sql.Conn) {
+	conn.ExecContext(context.Background(), "DROP TABLE IF EXISTS temp.epg_programme_staging")
+	conn.ExecContext(context.Background(), "DROP TABLE IF EXISTS temp.epg_map_staging")
+	conn.Close()
+}
+
+func programmeInsertQuery(rows int) string {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", programmeInsertArgs), ", ") + ")"
+	return "INSERT INTO temp.epg_programme_staging (xmltv_id, start, stop, title, description, category) VALUES " +
+		strings.TrimSuffix(strings.Repeat(row+", ", rows), ", ")
+}
+
+// MapChannel bir kanalı XMLTV kanal kimliğiyle eşler
+func (e *EPGImport) MapChannel(channelID int, xmltvID, matchedBy string) error {
+	_, err := e.conn.ExecContext(context.Background(),
+		"INSERT OR REPLACE INTO temp.epg_map_staging (channel_id, xmltv_id, matched_by) VALUES (?, ?, ?)",
+		channelID, xmltvID, matchedBy)
+	return err
+}
+
+// AddProgramme programı yazılacak gruba ekler, grup dolduğunda geçici tabloya yazar
+func (e *EPGImport) AddProgramme(p Programme) error {
+	e.args = append(e.args, p.XMLTVID, p.Start.Unix(), p.Stop.Unix(), p.Title, p.Description, p.Category)
+	e.pending++
+	e.programmes++
+
+	if e.pending == programmeBatchSize {
+		if _, err := e.batchStmt.Exec(e.args...); err != nil {
+			return err
+		}
+		e.args = e.args[:0]
+		e.pending = 0
+	}
+	return nil
+}
+
+// flush gruptaki kalan programları yazar
+func (e *EPGImport) flush() error {
+	if e.pending == 0 {
+		return nil
+	}
+	if _, err := e.conn.ExecContext(context.Background(), programmeInsertQuery(e.pending), e.args...); err != nil {
+		return err
+	}
+	e.args = e.args[:0]
+	e.pending = 0
+	return nil
+}
+
+// Programmes şu ana kadar eklenen program sayısını döndürür
+func (e *EPGImport) Programmes() int {
+	return e.programmes
+}
+
+// Commit rehberin kayıtlı programlarını ve kanal eşleşmelerini geçici
+// tablodakilerle değiştirir
+func (e *EPGImport) Commit() (err error) {
+	defer func() {
+		if err != nil {
+			e.Rollback()
+		}
+	}()
+
+	if err = e.flush(); err != nil {
+		return err
+	}
+	tx, err := e.conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		"DELETE FROM epg_programmes WHERE source_id = ?",
+		`INSERT INTO epg_programmes (source_id, xmltv_id, start, stop, title, description, category)
+		SELECT ?, xmltv_id, start, stop, title, description, category FROM temp.epg_programme_staging`,
+		"DELETE FROM epg_channel_map WHERE guide_source_id = ?",
+		`INSERT OR REPLACE INTO epg_channel_map (channel_id, guide_source_id, xmltv_id, matched_by)
+		SELECT channel_id, ?, xmltv_id, matched_by FROM temp.epg_map_staging`,
+	}
+	for _, stmt := range statements {
+		if _, err = tx.Exec(stmt, e.sourceID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	e.batchStmt.Close()
+	dropEPGStaging(e.conn)
+	return nil
+}
+
+// Rollback yüklemeyi iptal eder, önceki rehber korunur
+func (e *EPGImport) Rollback() error {
+	e.batchStmt.Close()
+	dropEPGStaging(e.conn)
+	return nil
+}
+
+// GetProgrammes bir kanalın verilen zaman aralığıyla kesişen programlarını
+// getirir. Programlar kanalın eşlendiği rehberden gelir; rehberde aynı
+// başlangıç, bitiş ve başlıkla birden çok kez geçen program bir kez döner.
+func (d *Database) GetProgrammes(channelID int, from, to time.Time) ([]Programme, error) {
+	rows, err := d.db.Query(`
+		SELECT MIN(p.id), p.xmltv_id, p.start, p.stop, p.title, COALESCE(p.description, ''), COALESCE(p.category, '')
+		FROM epg_programmes p
+		JOIN epg_channel_map m ON m.xmltv_id = p.xmltv_id AND m.guide_source_id = p.source_id
+		WHERE m.channel_id = ? AND p.stop > ? AND p.start < ?
+		GROUP BY p.start, p.stop, p.title
+		ORDER BY p.start`, channelID, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var programmes []Programme
+	for rows.Next() {
+		var p Programme
+		var start, stop int64
+		if err := rows.Scan(&p.ID, &p.XMLTVID, &start, &stop, &p.Title, &p.Description, &p.Category); err != nil {
+			return nil, err
+		}
+		p.Start = time.Unix(start, 0)
+		p.Stop = time.Unix(stop, 0)
+		programmes = append(programmes, p)
+	}
+	return programmes, rows.Err()
+}
+
+// GetProgramme tek bir programı getirir, bulunamazsa nil döner
+func (d *Database) GetProgramme(id int) (*Programme, error) {
+	var p Programme
+	var start, stop int64
+	err := d.db.QueryRow(`
+		SELECT id, xmltv_id, start, stop, title, COALESCE(description, ''), COALESCE(category, '')
+		FROM epg_programmes WHERE id = ?`, id).
+		Scan(&p.ID, &p.XMLTVID, &start, &stop, &p.Title, &p.Description, &p.Category)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.Start = time.Unix(start, 0)
+	p.Stop = time.Unix(stop, 0)
+	return &p, nil
+}
+
+// EachProgramme kanallarla eşlenmiş ve verilen zaman aralığıyla kesişen
+// programları kanal ve başlangıç sırasıyla fn'e verir. Tekrarlanan
+// programlar GetProgrammes'teki gibi bir kez verilir. Rehber bellekte
+// toplanmaz; fn hata döndürürse okuma durur.
+func (d *Database) EachProgramme(from, to time.Time, fn func(channelID int, p Programme) error) error {
+	rows, err := d.db.Query(`
+		SELECT m.channel_id, MIN(p.id), p.xmltv_id, p.start, p.stop, p.title, COALESCE(p.description, ''), COALESCE(p.category, '')
+		FROM epg_programmes p
+		JOIN epg_channel_map m ON m.xmltv_id = p.xmltv_id AND m.guide_source_id = p.source_id
+		WHERE p.stop > ? AND p.start < ?
+		GROUP BY m.channel_id, p.start, p.stop, p.title
+		ORDER BY m.channel_id, p.start`, from.Unix(), to.Unix())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var channelID int
+		var p Programme
+		var start, stop int64
+		if err := rows.Scan(&channelID, &p.ID, &p.XMLTVID, &start, &stop, &p.Title, &p.Description, &p.Category); err != nil {
+			return err
+		}
+		p.Start = time.Unix(start, 0)
+		p.Stop = time.Unix(stop, 0)
+		if err := fn(channelID, p); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
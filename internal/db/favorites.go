@@ -0,0 +1,522 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"remote-iptv/internal/search"
+)
+
+var (
+	// ErrFavoriteExists kanal hedef listede zaten varsa döner
+	ErrFavoriteExists = errors.New("channel is already in the favorite list")
+	// ErrFavoriteListNotFound favori listesi bulunamazsa döner
+	ErrFavoriteListNotFound = errors.New("favorite list not found")
+	// ErrDefaultFavoriteList profilin varsayılan listesi silinmek istenirse
+	// döner
+	ErrDefaultFavoriteList = errors.New("the default favorite list cannot be deleted")
+	// ErrInvalidOrder sıralama listesinde bilinmeyen ya da tekrar eden ID
+	// varsa döner
+	ErrInvalidOrder = errors.New("invalid order")
+)
+
+// Favorite bir favori kaydıdır. Kanal kaynak, yayın türü ve sağlayıcıdaki
+// ID ile tutulur; ad, logo ve kategori kanal listeden çıksa da
+// gösterilebilsin diye kopyalanır. Kanal hâlâ listedeyse ChannelID yerel
+// kanal ID'sidir ve oynatma bu ID ile yapılır.
+type Favorite struct {
+	ID         int       `json:"id"`
+	ListID     int       `json:"list_id"`
+	Position   int       `json:"position"`
+	ChannelID  int       `json:"channel_id"`
+	SourceID   int       `json:"source_id"`
+	StreamType string    `json:"stream_type"`
+	RemoteID   int       `json:"remote_id,omitempty"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	CategoryID int       `json:"category_id"`
+	StreamIcon string    `json:"stream_icon"`
+	Available  bool      `json:"available"`
+	AddedAt    time.Time `json:"added_at"`
+}
+
+// FavoriteList bir profilin adlandırılmış favori listesidir ("Spor",
+// "Çocuk"). Her profilin kanal eklenirken liste belirtilmezse kullanılan
+// ve silinemeyen bir varsayılan listesi vardır.
+type FavoriteList struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Position  int       `json:"position"`
+	Default   bool      `json:"default"`
+	Count     int       `json:"count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FavoriteDuplicate aynı içeriği gösteren favori grubudur. Reason
+// "same_channel" ise aynı kanal birden fazla listededir, "same_name" ise
+// bir listede aynı adlı içerik farklı kaynaklardan eklenmiştir.
+type FavoriteDuplicate struct {
+	Reason    string     `json:"reason"`
+	Favorites []Favorite `json:"favorites"`
+}
+
+// FavoriteQuery bir profilin favori sorgusudur. ListID ve ChannelID sıfırsa
+// süzme yapmaz.
+type FavoriteQuery struct {
+	ProfileID int
+	ListID    int
+	ChannelID int
+	// Parental kilitli ve yaş sınırını aşan kanalları süzer. Listeden
+	// çıkmış kanalların favorileri süzülmez.
+	Parental ParentalFilter
+}
+
+// Favori kolonları güncel kanal bilgisiyle birleştirilir; kanal listeden
+// çıktıysa kayıttaki kopya kullanılır
+const favoriteColumns = `f.id, f.list_id, f.position, COALESCE(c.id, 0), f.source_id, f.stream_type,
+	COALESCE(f.remote_id, 0), COALESCE(c.name, f.name), COALESCE(c.url, f.url),
+	COALESCE(c.category_id, f.category_id), COALESCE(NULLIF(c.stream_icon, ''), f.stream_icon), f.added_at`
+
+const favoriteJoin = ` FROM favorites f
+	JOIN favorite_lists l ON l.id = f.list_id
+	LEFT JOIN ` + localChannels + ` c ON c.source_id = f.source_id AND c.stream_type = f.stream_type AND c.remote_id = f.remote_id`
+
+func scanFavorite(row rowScanner) (Favorite, error) {
+	var f Favorite
+	var addedAt sql.NullTime
+	err := row.Scan(&f.ID, &f.ListID, &f.Position, &f.ChannelID, &f.SourceID, &f.StreamType,
+		&f.RemoteID, &f.Name, &f.URL, &f.CategoryID, &f.StreamIcon, &addedAt)
+	f.Available = f.ChannelID != 0
+	f.AddedAt = addedAt.Time
+	return f, err
+}
+
+// GetFavorites profilin favorilerini liste ve kullanıcı sırasına göre
+// döndürür
+func (d *Database) GetFavorites(q FavoriteQuery) ([]Favorite, error) {
+	where := []string{"l.profile_id = ?"}
+	args := []interface{}{q.ProfileID}
+	if q.ListID != 0 {
+		where = append(where, "f.list_id = ?")
+		args = append(args, q.ListID)
+	}
+	if q.ChannelID != 0 {
+		where = append(where, "c.id = ?")
+		args = append(args, q.ChannelID)
+	}
+	if parentalWhere, parentalArgs := q.Parental.conditions("c"); len(parentalWhere) > 0 {
+		where = append(where, "(c.id IS NULL OR ("+strings.Join(parentalWhere, " AND ")+"))")
+		args = append(args, parentalArgs...)
+	}
+	filter := " WHERE " + strings.Join(where, " AND ")
+
+	rows, err := d.db.Query("SELECT "+favoriteColumns+favoriteJoin+filter+
+		" ORDER BY l.position, l.id, f.position, f.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	favorites := []Favorite{}
+	for rows.Next() {
+		f, err := scanFavorite(rows)
+		if err != nil {
+			return nil, err
+		}
+		favorites = append(favorites, f)
+	}
+	return favorites, rows.Err()
+}
+
+// GetFavorite profilin tek bir favorisini getirir, bulunamazsa nil döner
+func (d *Database) GetFavorite(profileID, id int) (*Favorite, error) {
+	f, err := scanFavorite(d.db.QueryRow("SELECT "+favoriteColumns+favoriteJoin+" WHERE f.id = ? AND l.profile_id = ?", id, profileID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// findFavorite kanalın listedeki favori kaydının ID'sini döndürür, yoksa 0
+func findFavorite(tx *sql.Tx, listID int, ch Channel) (int, error) {
+	var id int
+	err := tx.QueryRow(`SELECT id FROM favorites
+		WHERE list_id = ? AND source_id = ? AND stream_type = ? AND remote_id = ?`,
+		listID, ch.SourceID, ch.StreamType, ch.RemoteID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// profileFavoriteList listenin profile ait olduğunu doğrular. listID 0 ise
+// profilin varsayılan listesini döndürür.
+func profileFavoriteList(tx *sql.Tx, profileID, listID int) (int, error) {
+	var id int
+	err := tx.QueryRow(`SELECT id FROM favorite_lists
+		WHERE profile_id = ?1 AND ((?2 = 0 AND is_default = 1) OR id = ?2)`, profileID, listID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrFavoriteListNotFound
+	}
+	return id, err
+}
+
+// AddFavorite kanalı profilin listesinin sonuna ekler ve yeni favorinin
+// ID'sini döndürür. listID 0 ise profilin varsayılan listesi kullanılır.
+// Kanal listede zaten varsa mevcut kaydın ID'si ile ErrFavoriteExists döner.
+func (d *Database) AddFavorite(profileID, listID int, ch Channel) (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if listID, err = profileFavoriteList(tx, profileID, listID); err != nil {
+		return 0, err
+	}
+	existing, err := findFavorite(tx, listID, ch)
+	if err != nil {
+		return 0, err
+	}
+	if existing != 0 {
+		return existing, ErrFavoriteExists
+	}
+
+	res, err := tx.Exec(`INSERT INTO favorites (list_id, position, source_id, stream_type, remote_id, name, url, category_id, stream_icon)
+		SELECT ?, COALESCE(MAX(position) + 1, 0), ?, ?, ?, ?, ?, ?, ? FROM favorites WHERE list_id = ?`,
+		listID, ch.SourceID, ch.StreamType, ch.RemoteID, ch.Name, ch.URL, ch.CategoryID, ch.StreamIcon, listID)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), tx.Commit()
+}
+
+// RemoveFavorite profilin favorisini siler
+func (d *Database) RemoveFavorite(profileID, id int) error {
+	_, err := d.db.Exec("DELETE FROM favorites WHERE id = ? AND list_id IN (SELECT id FROM favorite_lists WHERE profile_id = ?)",
+		id, profileID)
+	return err
+}
+
+// favoriteIDs listedeki favorilerin ID'lerini sırasıyla döndürür
+func favoriteIDs(tx *sql.Tx, listID int) ([]int, error) {
+	return queryIDs(tx, "SELECT id FROM favorites WHERE list_id = ? ORDER BY position, id", listID)
+}
+
+func queryIDs(tx *sql.Tx, query string, args ...interface{}) ([]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// setPositions kayıtların sırasını verilen ID sırasına göre yeniden yazar
+func setPositions(tx *sql.Tx, table string, ids []int) error {
+	stmt, err := tx.Prepare("UPDATE " + table + " SET position = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, id := range ids {
+		if _, err := stmt.Exec(i, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reorderIDs istenen ID'leri başa alır, kalanları mevcut sıralarıyla
+// arkalarına ekler. Listede olmayan ya da tekrar eden ID'ler hata döndürür.
+func reorderIDs(current, requested []int) ([]int, error) {
+	known := make(map[int]bool, len(current))
+	for _, id := range current {
+		known[id] = true
+	}
+	ordered := make([]int, 0, len(current))
+	seen := make(map[int]bool, len(requested))
+	for _, id := range requested {
+		if !known[id] {
+			return nil, fmt.Errorf("%w: id %d is not in the list", ErrInvalidOrder, id)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("%w: id %d is listed more than once", ErrInvalidOrder, id)
+		}
+		seen[id] = true
+		ordered = append(ordered, id)
+	}
+	for _, id := range current {
+		if !seen[id] {
+			ordered = append(ordered, id)
+		}
+	}
+	return ordered, nil
+}
+
+// ReorderFavorites listedeki favorileri verilen sıraya dizer. Verilmeyen
+// favoriler mevcut sıralarıyla sona kalır.
+func (d *Database) ReorderFavorites(profileID, listID int, ids []int) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if listID, err = profileFavoriteList(tx, profileID, listID); err != nil {
+		return err
+	}
+	current, err := favoriteIDs(tx, listID)
+	if err != nil {
+		return err
+	}
+	ordered, err := reorderIDs(current, ids)
+	if err != nil {
+		return err
+	}
+	if err := setPositions(tx, "favorites", ordered); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MoveFavorite profilin favorisini hedef listenin verilen sırasına taşır;
+// listID 0 ise favori kendi listesinde kalır, position negatifse ya da
+// liste uzunluğunu aşıyorsa sona eklenir. Favori yoksa sql.ErrNoRows, aynı
+// kanal hedef listede zaten varsa o kaydın ID'si ile ErrFavoriteExists
+// döner.
+func (d *Database) MoveFavorite(profileID, id, listID, position int) (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var fromList int
+	var ch Channel
+	var remoteID sql.NullInt64
+	err = tx.QueryRow(`SELECT f.list_id, f.source_id, f.stream_type, f.remote_id
+		FROM favorites f JOIN favorite_lists l ON l.id = f.list_id
+		WHERE f.id = ? AND l.profile_id = ?`, id, profileID).
+		Scan(&fromList, &ch.SourceID, &ch.StreamType, &remoteID)
+	if err != nil {
+		return 0, err
+	}
+	if listID == 0 {
+		listID = fromList
+	} else if _, err := profileFavoriteList(tx, profileID, listID); err != nil {
+		return 0, err
+	}
+	// URL'siyle taşınmış eski favorilerin kimliği yok, tekrar kontrolü yapılamaz
+	if fromList != listID && remoteID.Valid {
+		ch.RemoteID = int(remoteID.Int64)
+		existing, err := findFavorite(tx, listID, ch)
+		if err != nil {
+			return 0, err
+		}
+		if existing != 0 {
+			return existing, ErrFavoriteExists
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE favorites SET list_id = ? WHERE id = ?", listID, id); err != nil {
+		return 0, err
+	}
+	current, err := favoriteIDs(tx, listID)
+	if err != nil {
+		return 0, err
+	}
+	ordered := make([]int, 0, len(current))
+	for _, other := range current {
+		if other != id {
+			ordered = append(ordered, other)
+		}
+	}
+	if position < 0 || position > len(ordered) {
+		position = len(ordered)
+	}
+	ordered = append(ordered[:position], append([]int{id}, ordered[position:]...)...)
+	if err := setPositions(tx, "favorites", ordered); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// FindFavoriteDuplicates profilin birden fazla listesinde bulunan kanalları
+// ve bir listede farklı kaynaklardan eklenmiş aynı adlı içerikleri gruplar.
+// Süzgece takılan favoriler gruplara girmez.
+func (d *Database) FindFavoriteDuplicates(profileID int, parental ParentalFilter) ([]FavoriteDuplicate, error) {
+	favorites, err := d.GetFavorites(FavoriteQuery{ProfileID: profileID, Parental: parental})
+	if err != nil {
+		return nil, err
+	}
+
+	type groupKey struct {
+		reason, key string
+	}
+	groups := map[groupKey][]Favorite{}
+	var keys []groupKey
+	add := func(k groupKey, f Favorite) {
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], f)
+	}
+	for _, f := range favorites {
+		if f.RemoteID != 0 {
+			add(groupKey{"same_channel", fmt.Sprintf("%d/%s/%d", f.SourceID, f.StreamType, f.RemoteID)}, f)
+		}
+		if name := search.Fold(f.Name); name != "" {
+			add(groupKey{"same_name", fmt.Sprintf("%d/%s/%s", f.ListID, f.StreamType, name)}, f)
+		}
+	}
+
+	duplicates := []FavoriteDuplicate{}
+	for _, k := range keys {
+		if len(groups[k]) > 1 {
+			duplicates = append(duplicates, FavoriteDuplicate{Reason: k.reason, Favorites: groups[k]})
+		}
+	}
+	return duplicates, nil
+}
+
+const favoriteListQuery = `SELECT l.id, l.name, l.position, l.is_default, COUNT(f.id), l.created_at
+	FROM favorite_lists l LEFT JOIN favorites f ON f.list_id = l.id`
+
+func scanFavoriteList(row rowScanner) (FavoriteList, error) {
+	var l FavoriteList
+	var createdAt sql.NullTime
+	err := row.Scan(&l.ID, &l.Name, &l.Position, &l.Default, &l.Count, &createdAt)
+	l.CreatedAt = createdAt.Time
+	return l, err
+}
+
+// GetFavoriteLists profilin favori listelerini favori sayılarıyla döndürür
+func (d *Database) GetFavoriteLists(profileID int) ([]FavoriteList, error) {
+	rows, err := d.db.Query(favoriteListQuery+" WHERE l.profile_id = ? GROUP BY l.id ORDER BY l.position, l.id", profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []FavoriteList{}
+	for rows.Next() {
+		l, err := scanFavoriteList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	return lists, rows.Err()
+}
+
+// GetFavoriteList profilin tek bir favori listesini getirir, bulunamazsa nil
+// döner
+func (d *Database) GetFavoriteList(profileID, id int) (*FavoriteList, error) {
+	l, err := scanFavoriteList(d.db.QueryRow(favoriteListQuery+" WHERE l.id = ? AND l.profile_id = ? GROUP BY l.id", id, profileID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// CreateFavoriteList profilin listelerinin sonuna yeni bir favori listesi
+// ekler
+func (d *Database) CreateFavoriteList(profileID int, name string) (int, error) {
+	return createFavoriteList(d.db, profileID, name, false)
+}
+
+func createFavoriteList(db execer, profileID int, name string, isDefault bool) (int, error) {
+	res, err := db.Exec(`INSERT INTO favorite_lists (profile_id, name, position, is_default)
+		SELECT ?1, ?2, COALESCE(MAX(position) + 1, 0), ?3 FROM favorite_lists WHERE profile_id = ?1`, profileID, name, isDefault)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// RenameFavoriteList profilin listesinin adını değiştirir
+func (d *Database) RenameFavoriteList(profileID, id int, name string) error {
+	res, err := d.db.Exec("UPDATE favorite_lists SET name = ? WHERE id = ? AND profile_id = ?", name, id, profileID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrFavoriteListNotFound
+	}
+	return err
+}
+
+// DeleteFavoriteList profilin listesini içindeki favorilerle birlikte siler
+func (d *Database) DeleteFavoriteList(profileID, id int) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var isDefault bool
+	err = tx.QueryRow("SELECT is_default FROM favorite_lists WHERE id = ? AND profile_id = ?", id, profileID).Scan(&isDefault)
+	if err == sql.ErrNoRows {
+		return ErrFavoriteListNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if isDefault {
+		return ErrDefaultFavoriteList
+	}
+	if _, err := tx.Exec("DELETE FROM favorites WHERE list_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM favorite_lists WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReorderFavoriteLists profilin listelerini verilen sıraya dizer
+func (d *Database) ReorderFavoriteLists(profileID int, ids []int) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := queryIDs(tx, "SELECT id FROM favorite_lists WHERE profile_id = ? ORDER BY position, id", profileID)
+	if err != nil {
+		return err
+	}
+	ordered, err := reorderIDs(current, ids)
+	if err != nil {
+		return err
+	}
+	if err := setPositions(tx, "favorite_lists", ordered); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,226 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Kanal sağlık durumları. Art arda deadAfterFailures kez yoklanamayan
+// kanal ölü sayılır; daha az hatası olan kanal "failing" durumundadır.
+const (
+	HealthOK      = "ok"
+	HealthFailing = "failing"
+	HealthDead    = "dead"
+	HealthUnknown = "unknown"
+)
+
+const deadAfterFailures = 3
+
+// SyncRunHealth sağlık yoklaması çalışmalarının sync_runs'taki türüdür
+const SyncRunHealth = "health"
+
+// Sağlık kayıtları kanal kimliğiyle (kaynak, yayın türü, sağlayıcıdaki ID)
+// tutulur; senkronizasyonda kanal yeniden eklense de geçmiş korunur.
+const healthMatch = `h.source_id = channels.source_id AND h.stream_type = channels.stream_type AND h.remote_id = channels.remote_id`
+
+// healthRank kanal listesini sağlık durumuna göre sıralar: sağlıklılar,
+// yoklanmamışlar, hata verenler ve ölüler
+var healthRank = fmt.Sprintf(`COALESCE((SELECT CASE WHEN h.failures = 0 THEN 0 WHEN h.failures < %d THEN 2 ELSE 3 END
+	FROM channel_health h WHERE `+healthMatch+`), 1)`, deadAfterFailures)
+
+// deadChannel kanal ölüyse doğru olan koşuldur
+var deadChannel = fmt.Sprintf(`EXISTS (SELECT 1 FROM channel_health h WHERE `+healthMatch+` AND h.failures >= %d)`,
+	deadAfterFailures)
+
+// healthStatus sağlık kaydının durumunu hesaplayan ifadedir
+var healthStatus = fmt.Sprintf(`CASE WHEN h.checked_at IS NULL THEN '%s' WHEN h.failures = 0 THEN '%s'
+	WHEN h.failures < %d THEN '%s' ELSE '%s' END`, HealthUnknown, HealthOK, deadAfterFailures, HealthFailing, HealthDead)
+
+// HealthCheck tek bir yoklamanın sonucudur
+type HealthCheck struct {
+	OK         bool
+	LatencyMS  int64
+	StatusCode int
+	Error      string
+	CheckedAt  time.Time
+}
+
+// ChannelHealth bir canlı kanalın yoklama geçmişinin özetidir
+type ChannelHealth struct {
+	ChannelID  int        `json:"channel_id"`
+	SourceID   int        `json:"source_id"`
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	CheckedAt  *time.Time `json:"checked_at,omitempty"`
+	LastOKAt   *time.Time `json:"last_ok_at,omitempty"`
+	LatencyMS  int64      `json:"latency_ms,omitempty"`
+	StatusCode int        `json:"status_code,omitempty"`
+	// Failures art arda başarısız yoklama sayısıdır
+	Failures      int    `json:"failures"`
+	Checks        int    `json:"checks"`
+	TotalFailures int    `json:"total_failures"`
+	LastError     string `json:"last_error,omitempty"`
+}
+
+// SourceHealth bir kaynağın canlı kanallarının sağlık özetidir
+type SourceHealth struct {
+	SourceID  int        `json:"source_id"`
+	Name      string     `json:"name"`
+	Channels  int        `json:"channels"`
+	OK        int        `json:"ok"`
+	Failing   int        `json:"failing"`
+	Dead      int        `json:"dead"`
+	Unknown   int        `json:"unknown"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+}
+
+// HealthQuery kanal sağlık listesi sorgusudur. Sıfır değerli alanlar süzme
+// yapmaz.
+type HealthQuery struct {
+	SourceID int
+	Status   string
+	Offset   int
+	Limit    int
+}
+
+// ValidHealthStatus durumun bilinen bir sağlık durumu olup olmadığını döndürür
+func ValidHealthStatus(status string) bool {
+	switch status {
+	case HealthOK, HealthFailing, HealthDead, HealthUnknown:
+		return true
+	}
+	return false
+}
+
+// RecordChannelHealth kanalın yoklama sonucunu kaydeder. Başarılı yoklama
+// art arda hata sayısını sıfırlar.
+func (d *Database) RecordChannelHealth(channelID int, check HealthCheck) error {
+	var lastOK interface{}
+	if check.OK {
+		lastOK = check.CheckedAt
+	}
+	failed := 0
+	if !check.OK {
+		failed = 1
+	}
+	res, err := d.db.Exec(`INSERT INTO channel_health (source_id, stream_type, remote_id, checked_at, last_ok_at,
+			latency_ms, status_code, failures, checks, total_failures, last_error)
+		SELECT source_id, stream_type, remote_id, ?1, ?2, ?3, ?4, ?5, 1, ?5, ?6 FROM channels WHERE id = ?7
+		ON CONFLICT (source_id, stream_type, remote_id) DO UPDATE SET
+			checked_at = excluded.checked_at,
+			last_ok_at = COALESCE(excluded.last_ok_at, channel_health.last_ok_at),
+			latency_ms = excluded.latency_ms,
+			status_code = excluded.status_code,
+			failures = CASE WHEN excluded.failures = 0 THEN 0 ELSE channel_health.failures + 1 END,
+			checks = channel_health.checks + 1,
+			total_failures = channel_health.total_failures + excluded.failures,
+			last_error = excluded.last_error`,
+		check.CheckedAt, lastOK, check.LatencyMS, check.StatusCode, failed, check.Error, channelID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrChannelNotFound
+	}
+	return nil
+}
+
+// GetChannelHealth canlı kanalların sağlık kayıtlarını döndürür. Ölü ve hata
+// veren kanallar önce, her durumda en uzun süredir sorunlu olanlar başta
+// listelenir. İkinci değer sayfalamadan önceki toplam sayıdır.
+func (d *Database) GetChannelHealth(q HealthQuery) ([]ChannelHealth, int, error) {
+	where := "channels.stream_type = 'live' AND (?1 = 0 OR channels.source_id = ?1) AND (?2 = '' OR status = ?2)"
+	from := `FROM (SELECT channels.id, channels.source_id, channels.name, ` + healthStatus + ` AS status,
+			h.checked_at, h.last_ok_at, COALESCE(h.latency_ms, 0) AS latency_ms, COALESCE(h.status_code, 0) AS status_code,
+			COALESCE(h.failures, 0) AS failures, COALESCE(h.checks, 0) AS checks,
+			COALESCE(h.total_failures, 0) AS total_failures, COALESCE(h.last_error, '') AS last_error,
+			channels.stream_type
+		FROM ` + localChannels + ` channels LEFT JOIN channel_health h ON ` + healthMatch + `) channels
+		WHERE ` + where
+
+	var total int
+	if err := d.db.QueryRow("SELECT COUNT(*) "+from, q.SourceID, q.Status).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := d.db.Query(`SELECT id, source_id, name, status, checked_at, last_ok_at, latency_ms, status_code,
+			failures, checks, total_failures, last_error `+from+`
+		ORDER BY CASE status WHEN 'dead' THEN 0 WHEN 'failing' THEN 1 WHEN 'unknown' THEN 2 ELSE 3 END,
+			failures DESC, last_ok_at IS NOT NULL, last_ok_at, name COLLATE NOCASE, id
+		LIMIT ?3 OFFSET ?4`, q.SourceID, q.Status, limit, q.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	health := []ChannelHealth{}
+	for rows.Next() {
+		var ch ChannelHealth
+		var checkedAt, lastOK sql.NullTime
+		err := rows.Scan(&ch.ChannelID, &ch.SourceID, &ch.Name, &ch.Status, &checkedAt, &lastOK, &ch.LatencyMS,
+			&ch.StatusCode, &ch.Failures, &ch.Checks, &ch.TotalFailures, &ch.LastError)
+		if err != nil {
+			return nil, 0, err
+		}
+		if checkedAt.Valid {
+			ch.CheckedAt = &checkedAt.Time
+		}
+		if lastOK.Valid {
+			ch.LastOKAt = &lastOK.Time
+		}
+		health = append(health, ch)
+	}
+	return health, total, rows.Err()
+}
+
+// GetSourceHealth kaynakların canlı kanal sayılarını sağlık durumlarına göre
+// döndürür
+func (d *Database) GetSourceHealth() ([]SourceHealth, error) {
+	rows, err := d.db.Query(`SELECT s.id, s.name, COUNT(channels.id),
+			COALESCE(SUM(` + healthStatus + ` = 'ok'), 0), COALESCE(SUM(` + healthStatus + ` = 'failing'), 0),
+			COALESCE(SUM(` + healthStatus + ` = 'dead'), 0), COALESCE(SUM(channels.id IS NOT NULL AND h.checked_at IS NULL), 0)
+		FROM sources s
+		LEFT JOIN channels ON channels.source_id = s.id AND channels.stream_type = 'live'
+		LEFT JOIN channel_health h ON ` + healthMatch + `
+		GROUP BY s.id ORDER BY s.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sources := []SourceHealth{}
+	for rows.Next() {
+		var s SourceHealth
+		if err := rows.Scan(&s.SourceID, &s.Name, &s.Channels, &s.OK, &s.Failing, &s.Dead, &s.Unknown); err != nil {
+			return nil, err
+		}
+		sources = append(sources, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Son yoklama zamanı ayrı okunur; toplama fonksiyonları kolon türünü
+	// kaybettiğinden zaman olarak taranamaz
+	for i := range sources {
+		var checkedAt time.Time
+		err := d.db.QueryRow(`SELECT checked_at FROM channel_health WHERE source_id = ?
+			ORDER BY checked_at DESC LIMIT 1`, sources[i].SourceID).Scan(&checkedAt)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sources[i].CheckedAt = &checkedAt
+	}
+	return sources, nil
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// LocalImage bir kanal ya da kategorinin yerel ayarlar uygulanmış adı ve
+// logosudur
+type LocalImage struct {
+	Name string
+	Icon string
+}
+
+// GetChannelImage kanalın yerel adını ve logosunu döndürür; kanal yoksa nil
+func (d *Database) GetChannelImage(id int) (*LocalImage, error) {
+	var img LocalImage
+	err := d.db.QueryRow(`SELECT name, COALESCE(stream_icon, '') FROM `+localChannels+` c WHERE id = ?`, id).
+		Scan(&img.Name, &img.Icon)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &img, nil
+}
+
+// GetCategoryImage kategorinin yerel adını ve logosunu döndürür; kategori
+// yoksa nil. Sağlayıcılar kategori logosu vermez, logo yalnızca yerel
+// ayardan gelir.
+func (d *Database) GetCategoryImage(id int) (*LocalImage, error) {
+	var img LocalImage
+	err := d.db.QueryRow(`SELECT COALESCE(o.name, c.name), COALESCE(o.icon, '')
+		FROM categories c
+		LEFT JOIN category_overrides o ON o.source_id = c.source_id AND o.type = c.type AND o.remote_id = c.remote_id
+		WHERE c.id = ?`, id).Scan(&img.Name, &img.Icon)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &img, nil
+}
+
+// GetImageURLs kaynağın verilen türlerdeki kanallarının yerel logo
+// adreslerini tekrarsız döndürür. Gizli kanallar atlanır.
+func (d *Database) GetImageURLs(sourceID int, streamTypes []string) ([]string, error) {
+	if len(streamTypes) == 0 {
+		return nil, nil
+	}
+	args := []interface{}{sourceID}
+	for _, t := range streamTypes {
+		args = append(args, t)
+	}
+	rows, err := d.db.Query(`SELECT DISTINCT stream_icon FROM `+localChannels+` c
+		WHERE source_id = ? AND stream_type IN (?`+strings.Repeat(", ?", len(streamTypes)-1)+`)
+			AND NOT hidden AND stream_icon LIKE 'http%'`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
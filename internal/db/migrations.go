@@ -0,0 +1,598 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// migration şemayı bir sürüm ilerleten adımdır. Uygulanmış bir migration
+// değiştirilmez; şema değişiklikleri listenin sonuna yeni sürüm olarak
+// eklenir.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx, box *secretBox) error
+}
+
+// migrations sürüm sırasıyla uygulanır. İlk beş adım, migration tablosundan
+// önceki sürümlerin başlangıçta çalıştırdığı kurulum adımlarıdır; eski bir
+// veritabanı hangi durumda olursa olsun güvenle yeniden çalıştırılabilirler.
+var migrations = []migration{
+	{1, "create_tables", createTables},
+	{2, "add_channel_columns", addChannelColumns},
+	{3, "per_source_schema", perSourceSchema},
+	{4, "strip_stream_credentials", stripStreamCredentials},
+	{5, "create_indexes", createIndexes},
+	{6, "favorites_by_identity", favoritesByIdentity},
+	{7, "profiles", createProfiles},
+	{8, "parental_controls", createParentalControls},
+	{9, "local_overrides", createLocalOverrides},
+	{10, "channel_variants", createChannelVariants},
+	{11, "channel_health", createChannelHealth},
+	{12, "authentication", createAuthentication},
+	{13, "encrypt_credentials", encryptStoredCredentials},
+}
+
+// LatestSchemaVersion bu sürümün bildiği en yeni şema sürümüdür
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// MigrationStatus bir migration'ın uygulanma durumudur
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// SchemaStatus veritabanının şema sürümü ve migration geçmişidir
+type SchemaStatus struct {
+	Version    int               `json:"version"`
+	Latest     int               `json:"latest"`
+	Migrations []MigrationStatus `json:"migrations"`
+}
+
+// Pending uygulanmamış migration sayısını döndürür
+func (s *SchemaStatus) Pending() int {
+	n := 0
+	for _, m := range s.Migrations {
+		if m.AppliedAt == nil {
+			n++
+		}
+	}
+	return n
+}
+
+const schemaMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`
+
+// migrate bekleyen migration'ları sırayla uygular. Her migration kendi
+// transaction'ında çalışır ve schema_migrations kaydıyla birlikte commit
+// edilir; başarısız olan migration geri alınır ve açılış durdurulur.
+func migrate(db *sql.DB, box *secretBox) error {
+	if _, err := db.Exec(schemaMigrationsTable); err != nil {
+		return err
+	}
+	status, err := schemaStatus(db)
+	if err != nil {
+		return err
+	}
+	if status.Version > status.Latest {
+		return fmt.Errorf("database schema version %d is newer than this build supports (%d)", status.Version, status.Latest)
+	}
+
+	applied := map[int]bool{}
+	for _, m := range status.Migrations {
+		applied[m.Version] = m.AppliedAt != nil
+	}
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		if err := applyMigration(db, box, m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+		log.Printf("Applied schema migration %d (%s)", m.version, m.name)
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, box *secretBox, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx, box); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.version, m.name, time.Now()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// schemaStatus uygulanan migration'ları bilinen migration listesiyle
+// birleştirir. Sürüm, uygulanmış en yüksek migration'dır.
+func schemaStatus(db queryer) (*SchemaStatus, error) {
+	status := &SchemaStatus{Latest: LatestSchemaVersion()}
+
+	rows, err := db.Query("SELECT version, name, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]MigrationStatus{}
+	for rows.Next() {
+		var m MigrationStatus
+		var at time.Time
+		if err := rows.Scan(&m.Version, &m.Name, &at); err != nil {
+			return nil, err
+		}
+		m.AppliedAt = &at
+		applied[m.Version] = m
+		if m.Version > status.Version {
+			status.Version = m.Version
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, m := range migrations {
+		if done, ok := applied[m.version]; ok {
+			status.Migrations = append(status.Migrations, done)
+			delete(applied, m.version)
+			continue
+		}
+		status.Migrations = append(status.Migrations, MigrationStatus{Version: m.version, Name: m.name})
+	}
+	// Daha yeni bir sürümün uyguladığı, bu sürümün bilmediği migration'lar
+	for _, m := range applied {
+		status.Migrations = append(status.Migrations, m)
+	}
+	return status, nil
+}
+
+// SchemaStatus veritabanının şema sürümünü döndürür
+func (d *Database) SchemaStatus() (*SchemaStatus, error) {
+	return schemaStatus(d.db)
+}
+
+// ReadSchemaStatus veritabanını açıp migration uygulamadan şema sürümünü
+// okur. Veritabanı hiç migration görmemişse sürüm 0'dır.
+func ReadSchemaStatus(dbPath string) (*SchemaStatus, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	exists, err := tableExists(db, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		status := &SchemaStatus{Latest: LatestSchemaVersion()}
+		for _, m := range migrations {
+			status.Migrations = append(status.Migrations, MigrationStatus{Version: m.version, Name: m.name})
+		}
+		return status, nil
+	}
+	return schemaStatus(db)
+}
+
+// createTables ilk kurulumun tablolarını oluşturur
+func createTables(tx *sql.Tx, _ *secretBox) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS xtream_settings (
+		id INTEGER PRIMARY KEY,
+		url TEXT NOT NULL,
+		username TEXT NOT NULL,
+		password TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS favorites (
+		id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		url TEXT NOT NULL,
+		stream_type TEXT,
+		category_id INTEGER,
+		stream_icon TEXT
+	);
+	CREATE TABLE IF NOT EXISTS sources (
+		id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		url TEXT NOT NULL,
+		username TEXT NOT NULL DEFAULT '',
+		password TEXT NOT NULL DEFAULT '',
+		enabled INTEGER NOT NULL DEFAULT 1,
+		sync_schedule TEXT NOT NULL DEFAULT '',
+		epg_schedule TEXT NOT NULL DEFAULT '',
+		last_sync TIMESTAMP,
+		timezone TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS sync_runs (
+		id INTEGER PRIMARY KEY,
+		source_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		triggered_by TEXT NOT NULL,
+		status TEXT NOT NULL,
+		started_at TIMESTAMP NOT NULL,
+		duration_ms INTEGER NOT NULL DEFAULT 0,
+		categories INTEGER NOT NULL DEFAULT 0,
+		channels INTEGER NOT NULL DEFAULT 0,
+		programmes INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE IF NOT EXISTS source_servers (
+		source_id INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		position INTEGER NOT NULL DEFAULT 0,
+		active INTEGER NOT NULL DEFAULT 0,
+		failures INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		latency_ms INTEGER NOT NULL DEFAULT 0,
+		last_checked TIMESTAMP,
+		last_ok TIMESTAMP,
+		PRIMARY KEY (source_id, url)
+	);
+	CREATE TABLE IF NOT EXISTS source_server_events (
+		id INTEGER PRIMARY KEY,
+		source_id INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		event TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS categories ` + categoriesTableSchema + `;
+	CREATE TABLE IF NOT EXISTS channels ` + channelsTableSchema + `;
+	CREATE TABLE IF NOT EXISTS epg_channel_map (
+		channel_id INTEGER PRIMARY KEY,
+		guide_source_id INTEGER NOT NULL DEFAULT 0,
+		xmltv_id TEXT NOT NULL,
+		matched_by TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS epg_programmes (
+		id INTEGER PRIMARY KEY,
+		source_id INTEGER NOT NULL DEFAULT 0,
+		xmltv_id TEXT NOT NULL,
+		start INTEGER NOT NULL,
+		stop INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		description TEXT,
+		category TEXT
+	);
+	`)
+	return err
+}
+
+// addChannelColumns eski kurulumlarda eksik olan kolonları ekler
+func addChannelColumns(tx *sql.Tx, _ *secretBox) error {
+	channelColumnsToAdd := []struct{ name, definition string }{
+		{"epg_channel_id", "TEXT"},
+		{"http_user_agent", "TEXT"},
+		{"http_referrer", "TEXT"},
+		{"catchup", "TEXT"},
+		{"catchup_days", "INTEGER"},
+		{"catchup_source", "TEXT"},
+		{"plot", "TEXT DEFAULT ''"},
+		{"genre", "TEXT DEFAULT ''"},
+		{"actors", "TEXT DEFAULT ''"},
+		{"number", "INTEGER DEFAULT 0"},
+		{"added_at", "TIMESTAMP"},
+	}
+	for _, col := range channelColumnsToAdd {
+		if err := ensureColumn(tx, "channels", col.name, col.definition); err != nil {
+			return err
+		}
+	}
+	// Eklenme zamanı bilinmeyen eski kanallar için son güncelleme esas alınır
+	_, err := tx.Exec("UPDATE channels SET added_at = COALESCE(last_updated, CURRENT_TIMESTAMP) WHERE added_at IS NULL")
+	return err
+}
+
+// perSourceSchema tek sağlayıcılı eski şemayı kaynak bazlı şemaya taşır
+func perSourceSchema(tx *sql.Tx, _ *secretBox) error {
+	for _, col := range []struct{ table, name, definition string }{
+		{"epg_channel_map", "guide_source_id", "INTEGER NOT NULL DEFAULT 0"},
+		{"epg_programmes", "source_id", "INTEGER NOT NULL DEFAULT 0"},
+		{"sources", "timezone", "TEXT NOT NULL DEFAULT ''"},
+		{"sources", "epg_schedule", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		if err := ensureColumn(tx, col.table, col.name, col.definition); err != nil {
+			return err
+		}
+	}
+
+	if err := migrateToSources(tx); err != nil {
+		return err
+	}
+
+	// Sunucu listesi olmayan kaynakların ana adresini ilk sunucu olarak ekle
+	_, err := tx.Exec(`INSERT OR IGNORE INTO source_servers (source_id, url, position, active)
+		SELECT id, url, 0, 1 FROM sources
+		WHERE url != '' AND id NOT IN (SELECT source_id FROM source_servers)`)
+	return err
+}
+
+func createIndexes(tx *sql.Tx, _ *secretBox) error {
+	_, err := tx.Exec(`
+		DROP INDEX IF EXISTS idx_epg_programmes_channel;
+		CREATE INDEX IF NOT EXISTS idx_source_server_events_source ON source_server_events (source_id, id);
+		CREATE INDEX IF NOT EXISTS idx_sync_runs_source ON sync_runs (source_id, kind, started_at);
+		CREATE INDEX IF NOT EXISTS idx_epg_programmes_source_channel ON epg_programmes (source_id, xmltv_id, start);
+		CREATE INDEX IF NOT EXISTS idx_channels_source ON channels (source_id, stream_type, category_id);
+	`)
+	return err
+}
+
+// favoritesByIdentity favorileri URL yerine kaynak, yayın türü ve
+// sağlayıcıdaki ID ile saklanacak şekilde yeniden kurar ve favori
+// listelerini ekler. Eski favoriler kayıtlı URL'leri üzerinden kanallarla
+// eşleştirilir; eşleşmeyenler URL'leriyle korunur. Aynı kanalı gösteren
+// eski kayıtlardan yalnızca ilki taşınır.
+func favoritesByIdentity(tx *sql.Tx, _ *secretBox) error {
+	_, err := tx.Exec(`
+	CREATE TABLE favorite_lists (
+		id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		position INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO favorite_lists (id, name, position) VALUES (1, 'Favoriler', 0);
+
+	ALTER TABLE favorites RENAME TO favorites_legacy;
+	CREATE TABLE favorites (
+		id INTEGER PRIMARY KEY,
+		list_id INTEGER NOT NULL,
+		position INTEGER NOT NULL DEFAULT 0,
+		source_id INTEGER NOT NULL DEFAULT 0,
+		stream_type TEXT NOT NULL DEFAULT '',
+		remote_id INTEGER,
+		name TEXT NOT NULL,
+		url TEXT NOT NULL DEFAULT '',
+		category_id INTEGER NOT NULL DEFAULT 0,
+		stream_icon TEXT NOT NULL DEFAULT '',
+		added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (list_id, source_id, stream_type, remote_id)
+	);
+	INSERT OR IGNORE INTO favorites (id, list_id, position, source_id, stream_type, remote_id, name, url, category_id, stream_icon)
+		SELECT f.id, 1, f.id, COALESCE(c.source_id, 0), COALESCE(c.stream_type, f.stream_type, ''), c.remote_id,
+			COALESCE(c.name, f.name), f.url, COALESCE(c.category_id, f.category_id, 0),
+			COALESCE(NULLIF(c.stream_icon, ''), f.stream_icon, '')
+		FROM favorites_legacy f
+		LEFT JOIN channels c ON c.id = (SELECT id FROM channels WHERE url = f.url ORDER BY id LIMIT 1)
+		ORDER BY f.id;
+	DROP TABLE favorites_legacy;
+
+	CREATE INDEX idx_favorites_list ON favorites (list_id, position);
+	CREATE INDEX idx_favorites_channel ON favorites (source_id, stream_type, remote_id);
+	`)
+	return err
+}
+
+// createProfiles profil tablolarını ekler. Mevcut favoriler, PIN'siz
+// oluşturulan varsayılan profile ait olur.
+func createProfiles(tx *sql.Tx, _ *secretBox) error {
+	_, err := tx.Exec(`
+	CREATE TABLE profiles (
+		id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		pin_hash TEXT NOT NULL DEFAULT '',
+		audio_language TEXT NOT NULL DEFAULT '',
+		subtitle_language TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO profiles (id, name) VALUES (1, 'Varsayılan');
+
+	CREATE TABLE profile_sessions (
+		token_hash TEXT PRIMARY KEY,
+		profile_id INTEGER NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		last_used TIMESTAMP NOT NULL
+	);
+
+	ALTER TABLE favorite_lists ADD COLUMN profile_id INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE favorite_lists ADD COLUMN is_default INTEGER NOT NULL DEFAULT 0;
+	UPDATE favorite_lists SET is_default = 1 WHERE id = 1;
+
+	CREATE TABLE watch_history (
+		id INTEGER PRIMARY KEY,
+		profile_id INTEGER NOT NULL,
+		source_id INTEGER NOT NULL,
+		stream_type TEXT NOT NULL,
+		remote_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		url TEXT NOT NULL DEFAULT '',
+		stream_icon TEXT NOT NULL DEFAULT '',
+		watched_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE resume_points (
+		profile_id INTEGER NOT NULL,
+		source_id INTEGER NOT NULL,
+		stream_type TEXT NOT NULL,
+		remote_id INTEGER NOT NULL,
+		position REAL NOT NULL,
+		duration REAL NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (profile_id, source_id, stream_type, remote_id)
+	);
+	CREATE TABLE hidden_categories (
+		profile_id INTEGER NOT NULL,
+		source_id INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		remote_id INTEGER NOT NULL,
+		PRIMARY KEY (profile_id, source_id, type, remote_id)
+	);
+
+	CREATE INDEX idx_favorite_lists_profile ON favorite_lists (profile_id, position);
+	CREATE INDEX idx_watch_history_profile ON watch_history (profile_id, watched_at);
+	`)
+	return err
+}
+
+// createParentalControls ebeveyn denetimi ayarlarını, kilit tablolarını ve
+// kilit açma oturumlarını ekler. Varsayılan anahtar kelimelere uyan mevcut
+// kategoriler hemen kilitlenir; denetim PIN belirlenene kadar uygulanmaz.
+func createParentalControls(tx *sql.Tx, _ *secretBox) error {
+	_, err := tx.Exec(`
+	CREATE TABLE parental_settings (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		pin_hash TEXT NOT NULL DEFAULT '',
+		max_age INTEGER NOT NULL DEFAULT 0,
+		keywords TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE parental_sessions (
+		token_hash TEXT PRIMARY KEY,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE category_locks (
+		source_id INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		remote_id INTEGER NOT NULL,
+		locked INTEGER NOT NULL,
+		auto INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (source_id, type, remote_id)
+	);
+	CREATE TABLE channel_locks (
+		source_id INTEGER NOT NULL,
+		stream_type TEXT NOT NULL,
+		remote_id INTEGER NOT NULL,
+		PRIMARY KEY (source_id, stream_type, remote_id)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO parental_settings (id, keywords) VALUES (1, ?)",
+		strings.Join(defaultLockKeywords, ",")); err != nil {
+		return err
+	}
+	return applyCategoryAutoLocks(tx, 0)
+}
+
+// createLocalOverrides kategori ve kanallara verilen yerel ad, logo, sıra ve
+// gizleme ayarlarının tablolarını ekler. Ayarlar sağlayıcı verisinden ayrı,
+// kaynak, tür ve sağlayıcıdaki ID ile saklanır.
+func createLocalOverrides(tx *sql.Tx, _ *secretBox) error {
+	_, err := tx.Exec(`
+	CREATE TABLE category_overrides (
+		source_id INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		remote_id INTEGER NOT NULL,
+		hidden INTEGER NOT NULL DEFAULT 0,
+		name TEXT,
+		icon TEXT,
+		position INTEGER,
+		PRIMARY KEY (source_id, type, remote_id)
+	);
+	CREATE TABLE channel_overrides (
+		source_id INTEGER NOT NULL,
+		stream_type TEXT NOT NULL,
+		remote_id INTEGER NOT NULL,
+		hidden INTEGER NOT NULL DEFAULT 0,
+		name TEXT,
+		icon TEXT,
+		position INTEGER,
+		PRIMARY KEY (source_id, stream_type, remote_id)
+	);
+	`)
+	return err
+}
+
+// createChannelVariants kanal sürüm tablosunu ve profillerin kalite
+// tercihini ekler; mevcut kanallar hemen gruplanır
+func createChannelVariants(tx *sql.Tx, _ *secretBox) error {
+	_, err := tx.Exec(`
+	CREATE TABLE channel_variants (
+		channel_id INTEGER PRIMARY KEY,
+		group_key TEXT NOT NULL,
+		base_name TEXT NOT NULL,
+		country TEXT NOT NULL DEFAULT '',
+		quality TEXT NOT NULL DEFAULT '',
+		quality_rank INTEGER NOT NULL DEFAULT 0,
+		backup INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX idx_channel_variants_group ON channel_variants(group_key);
+	`)
+	if err != nil {
+		return err
+	}
+	if err := ensureColumn(tx, "profiles", "preferred_quality", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	n, err := refreshChannelVariants(tx, 0)
+	if err != nil {
+		return err
+	}
+	log.Printf("Grouped %d live channels into variants", n)
+	return nil
+}
+
+// createChannelHealth kanal sağlık kayıtlarını ve kaynakların yoklama
+// zamanlamasını ekler
+func createChannelHealth(tx *sql.Tx, _ *secretBox) error {
+	_, err := tx.Exec(`
+	CREATE TABLE channel_health (
+		source_id INTEGER NOT NULL,
+		stream_type TEXT NOT NULL,
+		remote_id INTEGER NOT NULL,
+		checked_at DATETIME,
+		last_ok_at DATETIME,
+		latency_ms INTEGER NOT NULL DEFAULT 0,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		failures INTEGER NOT NULL DEFAULT 0,
+		checks INTEGER NOT NULL DEFAULT 0,
+		total_failures INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (source_id, stream_type, remote_id)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+	return ensureColumn(tx, "sources", "health_schedule", "TEXT NOT NULL DEFAULT ''")
+}
+
+// createAuthentication yönetici parolasını, oturumlarını ve otomasyonlar
+// için API anahtarlarını ekler. Parola belirlenene kadar kimlik doğrulama
+// uygulanmaz.
+func createAuthentication(tx *sql.Tx, _ *secretBox) error {
+	_, err := tx.Exec(`
+	CREATE TABLE auth_settings (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		password_hash TEXT NOT NULL DEFAULT ''
+	);
+	INSERT INTO auth_settings (id) VALUES (1);
+	CREATE TABLE auth_sessions (
+		token_hash TEXT PRIMARY KEY,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL
+	);
+	CREATE TABLE api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at TIMESTAMP NOT NULL,
+		last_used_at TIMESTAMP
+	);
+	`)
+	return err
+}
@@ -0,0 +1,267 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// baselineSchema is the schema of the first release, before migrations
+// were tracked
+const baselineSchema = `
+CREATE TABLE xtream_settings (
+	id INTEGER PRIMARY KEY,
+	url TEXT NOT NULL,
+	username TEXT NOT NULL,
+	password TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE favorites (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	url TEXT NOT NULL,
+	stream_type TEXT,
+	category_id INTEGER,
+	stream_icon TEXT
+);
+CREATE TABLE categories (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	type TEXT NOT NULL
+);
+CREATE TABLE channels (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	url TEXT NOT NULL,
+	stream_type TEXT NOT NULL,
+	category_id INTEGER NOT NULL,
+	stream_icon TEXT,
+	rating TEXT,
+	last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	extension TEXT
+);
+`
+
+func testDBPath(t *testing.T) string {
+	t.Helper()
+	t.Setenv(SecretKeyEnv, "")
+	t.Setenv(SecretKeyFileEnv, "")
+	return filepath.Join(t.TempDir(), "iptv.db")
+}
+
+func execSQL(t *testing.T, path string, statements ...string) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	path := testDBPath(t)
+	d, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer d.Close()
+
+	status, err := d.SchemaStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != LatestSchemaVersion() || status.Pending() != 0 {
+		t.Errorf("schema version %d with %d pending, want %d with none", status.Version, status.Pending(), LatestSchemaVersion())
+	}
+	if len(status.Migrations) != len(migrations) {
+		t.Errorf("%d migrations recorded, want %d", len(status.Migrations), len(migrations))
+	}
+}
+
+func TestMigrateFromBaseline(t *testing.T) {
+	path := testDBPath(t)
+	execSQL(t, path,
+		baselineSchema,
+		`INSERT INTO xtream_settings (url, username, password) VALUES ('http://old.example', 'olduser', 'oldpass')`,
+		`INSERT INTO xtream_settings (url, username, password) VALUES ('http://panel.example:8080', 'john', 'secret')`,
+		`INSERT INTO categories (id, name, type) VALUES (3, 'Ulusal', 'live')`,
+		`INSERT INTO channels (id, name, url, stream_type, category_id, stream_icon) VALUES
+			(10, 'TRT 1', 'http://panel.example:8080/live/john/secret/101.ts', 'live', 3, 'http://logo/trt1.png'),
+			(11, 'Kanal D', 'http://panel.example:8080/live/john/secret/102.ts', 'live', 3, '')`,
+		`INSERT INTO favorites (id, name, url, stream_type, category_id, stream_icon) VALUES
+			(1, 'TRT 1 (eski)', 'http://panel.example:8080/live/john/secret/101.ts', 'live', 3, ''),
+			(2, 'Gone', 'http://elsewhere.example/stream.m3u8', 'live', 0, 'http://logo/gone.png'),
+			(3, 'TRT 1 again', 'http://panel.example:8080/live/john/secret/101.ts', 'live', 3, '')`,
+	)
+
+	status, err := ReadSchemaStatus(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != 0 || status.Pending() != len(migrations) {
+		t.Fatalf("baseline schema version %d with %d pending, want 0 with %d", status.Version, status.Pending(), len(migrations))
+	}
+
+	d, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	defer d.Close()
+
+	if status, err = d.SchemaStatus(); err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != LatestSchemaVersion() || status.Pending() != 0 {
+		t.Errorf("schema version %d with %d pending after upgrade", status.Version, status.Pending())
+	}
+
+	// The newest legacy settings become source 1
+	sources, err := d.GetSources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 1 {
+		t.Fatalf("%d sources after upgrade, want 1", len(sources))
+	}
+	src := sources[0]
+	if src.ID != 1 || src.Type != SourceXtream || src.URL != "http://panel.example:8080" ||
+		src.Username != "john" || src.Password != "secret" {
+		t.Errorf("migrated source = %+v", src)
+	}
+	var storedURL, storedUsername, storedPassword string
+	if err := d.db.QueryRow("SELECT url, username, password FROM sources WHERE id = 1").
+		Scan(&storedURL, &storedUsername, &storedPassword); err != nil {
+		t.Fatal(err)
+	}
+	if storedURL == src.URL || storedUsername == "john" || storedPassword == "secret" {
+		t.Error("source url or credentials are stored in plain text")
+	}
+
+	// Channels keep their IDs and lose the embedded credentials
+	ch, err := d.GetChannel(10)
+	if err != nil || ch == nil {
+		t.Fatalf("GetChannel(10) = %v, %v", ch, err)
+	}
+	if ch.SourceID != 1 || ch.Name != "TRT 1" || ch.StreamType != "live" {
+		t.Errorf("migrated channel = %+v", ch)
+	}
+	if strings.Contains(ch.URL, "john") || strings.Contains(ch.URL, "secret") {
+		t.Errorf("channel url %q still has credentials", ch.URL)
+	}
+
+	// Favorites move to the default list of the default profile; the
+	// duplicate of a channel is dropped and unmatched ones keep their URL
+	favorites, err := d.GetFavorites(FavoriteQuery{ProfileID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(favorites) != 2 {
+		t.Fatalf("%d favorites after upgrade, want 2: %+v", len(favorites), favorites)
+	}
+	if f := favorites[0]; f.ID != 1 || !f.Available || f.ChannelID != 10 || f.Name != "TRT 1" || f.StreamIcon != "http://logo/trt1.png" {
+		t.Errorf("matched favorite = %+v", f)
+	}
+	if f := favorites[1]; f.ID != 2 || f.Available || f.Name != "Gone" || f.URL != "http://elsewhere.example/stream.m3u8" {
+		t.Errorf("unmatched favorite = %+v", f)
+	}
+
+	// Opening an up to date database applies nothing
+	d.Close()
+	d, err = NewDatabase(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer d.Close()
+	if again, err := d.SchemaStatus(); err != nil || len(again.Migrations) != len(status.Migrations) {
+		t.Errorf("reopening changed the migration history: %+v, %v", again, err)
+	}
+}
+
+func TestFailingMigrationRollsBack(t *testing.T) {
+	path := testDBPath(t)
+	d, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	d.Close()
+
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	errBroken := errors.New("broken migration")
+	migrations = append(append([]migration(nil), saved...), migration{
+		version: LatestSchemaVersion() + 1,
+		name:    "broken",
+		up: func(tx *sql.Tx, _ *secretBox) error {
+			if _, err := tx.Exec("CREATE TABLE half_done (id INTEGER)"); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE sources SET name = 'changed'"); err != nil {
+				return err
+			}
+			return errBroken
+		},
+	})
+
+	if _, err := NewDatabase(path); !errors.Is(err, errBroken) {
+		t.Fatalf("NewDatabase error = %v, want %v", err, errBroken)
+	}
+
+	raw, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	if exists, err := tableExists(raw, "half_done"); err != nil || exists {
+		t.Errorf("table of the failed migration exists: %v, %v", exists, err)
+	}
+	status, err := schemaStatus(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != saved[len(saved)-1].version || status.Pending() != 1 {
+		t.Errorf("schema version %d with %d pending, want %d with 1", status.Version, status.Pending(), saved[len(saved)-1].version)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	path := testDBPath(t)
+	d, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	d.Close()
+	execSQL(t, path, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (999, 'future', CURRENT_TIMESTAMP)`)
+
+	if _, err := NewDatabase(path); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("NewDatabase error = %v, want a newer schema error", err)
+	}
+}
+
+func TestWrongKeyIsRejected(t *testing.T) {
+	path := testDBPath(t)
+	d, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	if _, err := d.CreateSource(Source{Name: "x", Type: SourceXtream, URL: "http://h", Username: "u", Password: "p"}); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	key, err := GenerateSecretKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(SecretKeyEnv, hex.EncodeToString(key))
+	if _, err := NewDatabase(path); err == nil || !strings.Contains(err.Error(), "wrong key") {
+		t.Errorf("NewDatabase with another key = %v, want a wrong key error", err)
+	}
+}
@@ -0,0 +1,259 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// localChannels kanalları yerel ad, logo, sıra ve gizleme ayarlarıyla
+// döndüren alt sorgudur. Gizlenen kategorilerdeki kanallar da gizli sayılır.
+// Sağlayıcı verisi değişmez; yerel ayarlar yalnızca okurken uygulanır.
+const localChannels = `(SELECT c.id, c.source_id, c.remote_id, COALESCE(o.name, c.name) AS name, c.url, c.stream_type,
+	c.category_id, COALESCE(o.icon, c.stream_icon) AS stream_icon, c.rating, c.last_updated, c.extension,
+	c.epg_channel_id, c.http_user_agent, c.http_referrer, c.catchup, c.catchup_days, c.catchup_source,
+	c.plot, c.genre, c.actors, c.number, c.added_at,
+	COALESCE(o.hidden, 0) OR COALESCE(co.hidden, 0) AS hidden, o.position AS position
+	FROM channels c
+	LEFT JOIN channel_overrides o ON o.source_id = c.source_id AND o.stream_type = c.stream_type AND o.remote_id = c.remote_id
+	LEFT JOIN categories cat ON cat.id = c.category_id
+	LEFT JOIN category_overrides co ON co.source_id = cat.source_id AND co.type = cat.type AND co.remote_id = cat.remote_id)`
+
+// OverrideUpdate yerel ayar değişikliğidir. Nil alanlar korunur; boş ad ya
+// da logo sağlayıcının değerine döner.
+type OverrideUpdate struct {
+	Hidden *bool   `json:"hidden"`
+	Name   *string `json:"name"`
+	Icon   *string `json:"icon"`
+}
+
+// LocalOverride bir kategori ya da kanala verilmiş yerel ayarlardır
+type LocalOverride struct {
+	Kind string `json:"kind"`
+	// ID yerel ID'dir; öğe sağlayıcının listesinden çıktıysa 0
+	ID           int    `json:"id"`
+	SourceID     int    `json:"source_id"`
+	Type         string `json:"type"`
+	RemoteID     int    `json:"remote_id"`
+	ProviderName string `json:"provider_name,omitempty"`
+	Hidden       bool   `json:"hidden"`
+	Name         string `json:"name,omitempty"`
+	Icon         string `json:"icon,omitempty"`
+	Position     *int   `json:"position,omitempty"`
+}
+
+// overrideTarget yerel ayarların uygulandığı tabloyu tanımlar
+type overrideTarget struct {
+	kind       string
+	table      string
+	overrides  string
+	typeColumn string
+	// scopeColumn sıralamanın geçerli olduğu gruptur
+	scopeColumn string
+	notFound    error
+}
+
+var (
+	categoryOverrideTarget = overrideTarget{"category", "categories", "category_overrides", "type", "type", ErrCategoryNotFound}
+	channelOverrideTarget  = overrideTarget{"channel", "channels", "channel_overrides", "stream_type", "category_id", ErrChannelNotFound}
+)
+
+// identityMatch yerel ayar satırını tablodaki öğeyle eşleştiren koşuldur
+func (t overrideTarget) identityMatch(o, item string) string {
+	return fmt.Sprintf("%[1]s.source_id = %[2]s.source_id AND %[1]s.%[3]s = %[2]s.%[3]s AND %[1]s.remote_id = %[2]s.remote_id",
+		o, item, t.typeColumn)
+}
+
+// SetCategoryOverride kategorinin yerel ayarlarını günceller
+func (d *Database) SetCategoryOverride(categoryID int, u OverrideUpdate) error {
+	return d.setOverride(categoryOverrideTarget, categoryID, u)
+}
+
+// SetChannelOverride kanalın yerel ayarlarını günceller
+func (d *Database) SetChannelOverride(channelID int, u OverrideUpdate) error {
+	return d.setOverride(channelOverrideTarget, channelID, u)
+}
+
+// ResetCategoryOverride kategorinin tüm yerel ayarlarını siler
+func (d *Database) ResetCategoryOverride(categoryID int) error {
+	return d.resetOverride(categoryOverrideTarget, categoryID)
+}
+
+// ResetChannelOverride kanalın tüm yerel ayarlarını siler
+func (d *Database) ResetChannelOverride(channelID int) error {
+	return d.resetOverride(channelOverrideTarget, channelID)
+}
+
+func (d *Database) setOverride(t overrideTarget, id int, u OverrideUpdate) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(fmt.Sprintf(`INSERT OR IGNORE INTO %s (source_id, %s, remote_id)
+		SELECT source_id, %s, remote_id FROM %s WHERE id = ?`, t.overrides, t.typeColumn, t.typeColumn, t.table), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM "+t.table+" WHERE id = ?)", id).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return t.notFound
+		}
+	}
+
+	var set []string
+	var args []interface{}
+	if u.Hidden != nil {
+		set = append(set, "hidden = ?")
+		args = append(args, *u.Hidden)
+	}
+	if u.Name != nil {
+		set = append(set, "name = NULLIF(?, '')")
+		args = append(args, strings.TrimSpace(*u.Name))
+	}
+	if u.Icon != nil {
+		set = append(set, "icon = NULLIF(?, '')")
+		args = append(args, strings.TrimSpace(*u.Icon))
+	}
+	if len(set) > 0 {
+		args = append(args, id)
+		_, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s WHERE EXISTS (SELECT 1 FROM %s i WHERE i.id = ? AND %s)",
+			t.overrides, strings.Join(set, ", "), t.table, t.identityMatch(t.overrides, "i")), args...)
+		if err != nil {
+			return err
+		}
+	}
+	if err := pruneOverrides(tx, t); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// pruneOverrides hiçbir ayar taşımayan satırları siler
+func pruneOverrides(tx *sql.Tx, t overrideTarget) error {
+	_, err := tx.Exec("DELETE FROM " + t.overrides +
+		" WHERE hidden = 0 AND name IS NULL AND icon IS NULL AND position IS NULL")
+	return err
+}
+
+func (d *Database) resetOverride(t overrideTarget, id int) error {
+	var exists bool
+	if err := d.db.QueryRow("SELECT EXISTS (SELECT 1 FROM "+t.table+" WHERE id = ?)", id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return t.notFound
+	}
+	_, err := d.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE EXISTS (SELECT 1 FROM %s i WHERE i.id = ? AND %s)",
+		t.overrides, t.table, t.identityMatch(t.overrides, "i")), id)
+	return err
+}
+
+// ReorderCategories aynı türdeki kategorileri verilen sırayla listenin
+// başına alır; diğer kategoriler sağlayıcının sırasıyla arkalarından gelir.
+// Boş liste türün yerel sırasını temizlemez, ID'ler aynı türden olmalıdır.
+func (d *Database) ReorderCategories(ids []int) error {
+	return d.reorderOverrides(categoryOverrideTarget, ids)
+}
+
+// ReorderChannels aynı kategorideki kanalları verilen sırayla listenin
+// başına alır; diğer kanallar varsayılan sırayla arkalarından gelir
+func (d *Database) ReorderChannels(ids []int) error {
+	return d.reorderOverrides(channelOverrideTarget, ids)
+}
+
+func (d *Database) reorderOverrides(t overrideTarget, ids []int) error {
+	if len(ids) == 0 {
+		return fmt.Errorf("%w: ids are required", ErrInvalidOrder)
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := make([]interface{}, len(ids))
+	seen := map[int]bool{}
+	for i, id := range ids {
+		if seen[id] {
+			return fmt.Errorf("%w: duplicate id %d", ErrInvalidOrder, id)
+		}
+		seen[id] = true
+		args[i] = id
+	}
+	var count, scopes int
+	var scope interface{}
+	err = tx.QueryRow(fmt.Sprintf("SELECT COUNT(*), COUNT(DISTINCT %[1]s), MIN(%[1]s) FROM %[2]s WHERE id IN (%[3]s)",
+		t.scopeColumn, t.table, placeholders), args...).Scan(&count, &scopes, &scope)
+	if err != nil {
+		return err
+	}
+	if count != len(ids) {
+		return fmt.Errorf("%w: unknown %s id", ErrInvalidOrder, t.kind)
+	}
+	if scopes != 1 {
+		return fmt.Errorf("%w: all ids must share the same %s", ErrInvalidOrder, t.scopeColumn)
+	}
+
+	// Gruptaki önceki sıra temizlenir, verilen öğeler baştan numaralanır
+	_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET position = NULL WHERE EXISTS (SELECT 1 FROM %s i WHERE i.%s = ? AND %s)",
+		t.overrides, t.table, t.scopeColumn, t.identityMatch(t.overrides, "i")), scope)
+	if err != nil {
+		return err
+	}
+	for position, id := range ids {
+		_, err := tx.Exec(fmt.Sprintf(`INSERT INTO %[1]s (source_id, %[2]s, remote_id, position)
+			SELECT source_id, %[2]s, remote_id, ? FROM %[3]s WHERE id = ?
+			ON CONFLICT (source_id, %[2]s, remote_id) DO UPDATE SET position = excluded.position`,
+			t.overrides, t.typeColumn, t.table), position, id)
+		if err != nil {
+			return err
+		}
+	}
+	if err := pruneOverrides(tx, t); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetOverrides tüm yerel ayarları kategoriler önce olmak üzere döndürür
+func (d *Database) GetOverrides() ([]LocalOverride, error) {
+	overrides := []LocalOverride{}
+	for _, t := range []overrideTarget{categoryOverrideTarget, channelOverrideTarget} {
+		rows, err := d.db.Query(fmt.Sprintf(`SELECT COALESCE(i.id, 0), o.source_id, o.%[1]s, o.remote_id, COALESCE(i.name, ''),
+				o.hidden, COALESCE(o.name, ''), COALESCE(o.icon, ''), o.position
+			FROM %[2]s o LEFT JOIN %[3]s i ON %[4]s
+			ORDER BY o.source_id, o.%[1]s, o.position IS NULL, o.position, o.remote_id`,
+			t.typeColumn, t.overrides, t.table, t.identityMatch("o", "i")))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			o := LocalOverride{Kind: t.kind}
+			var position sql.NullInt64
+			if err := rows.Scan(&o.ID, &o.SourceID, &o.Type, &o.RemoteID, &o.ProviderName,
+				&o.Hidden, &o.Name, &o.Icon, &position); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if position.Valid {
+				p := int(position.Int64)
+				o.Position = &p
+			}
+			overrides = append(overrides, o)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return overrides, nil
+}
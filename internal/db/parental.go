@@ -0,0 +1,360 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"remote-iptv/internal/search"
+)
+
+// parentalSessionTTL ebeveyn PIN'iyle açılan kilidin ne kadar açık kalacağıdır
+const parentalSessionTTL = 4 * time.Hour
+
+// defaultLockKeywords adı bunlardan birini içeren kategorilerin
+// senkronizasyonda otomatik kilitlendiği varsayılan kelimelerdir
+var defaultLockKeywords = []string{"XXX", "+18", "18+", "Adult", "Yetişkin"}
+
+// ErrChannelNotFound kilitlenecek kanal bulunamazsa döner
+var ErrChannelNotFound = errors.New("channel not found")
+
+// ParentalSettings ebeveyn denetimi ayarlarıdır. Denetim yalnızca PIN
+// belirlenmişse (Enabled) uygulanır.
+type ParentalSettings struct {
+	Enabled bool `json:"enabled"`
+	// MaxAge film ve dizilerde izin verilen en yüksek yaş sınırıdır, 0 ise sınır yok
+	MaxAge int `json:"max_age"`
+	// Keywords adında geçtiğinde kategoriyi otomatik kilitleyen kelimelerdir
+	Keywords []string `json:"keywords"`
+}
+
+// ParentalFilter kilitli ve yaş sınırını aşan içeriklerin süzülmesidir.
+// Sıfır değeri süzme yapmaz.
+type ParentalFilter struct {
+	HideLocked bool
+	MaxAge     int
+}
+
+// ratingAges sağlayıcıların kullandığı yaş sınıflandırmalarının karşılığı
+// olan yaşlardır. Puan biçimindeki değerler (7.5 gibi) yaş sınırı taşımaz.
+var ratingAges = func() map[string]int {
+	ages := map[string]int{
+		"G": 0, "PG": 10, "PG-13": 13, "R": 17, "NC-17": 18,
+		"TV-Y": 0, "TV-Y7": 7, "TV-G": 0, "TV-PG": 10, "TV-14": 14, "TV-MA": 17,
+		"U": 0, "12A": 12, "GENEL İZLEYICI": 0,
+	}
+	for _, age := range []int{6, 7, 10, 12, 13, 15, 16, 18} {
+		ages[fmt.Sprintf("%d+", age)] = age
+		ages[fmt.Sprintf("+%d", age)] = age
+		ages[fmt.Sprintf("FSK %d", age)] = age
+		// 10'dan büyük sayılar puan olamaz, yaş sınırı kabul edilir
+		if age > 10 {
+			ages[fmt.Sprint(age)] = age
+		}
+	}
+	return ages
+}()
+
+// ratingAgeExpr kanalın yaş sınırını hesaplayan SQL ifadesidir; %[1]s
+// tablo adıdır. Tanınmayan değerler 0 kabul edilir.
+var ratingAgeExpr = func() string {
+	ratings := make([]string, 0, len(ratingAges))
+	for rating := range ratingAges {
+		ratings = append(ratings, rating)
+	}
+	sort.Strings(ratings)
+
+	var b strings.Builder
+	b.WriteString("CASE UPPER(TRIM(COALESCE(%[1]s.rating, '')))")
+	for _, rating := range ratings {
+		fmt.Fprintf(&b, " WHEN '%s' THEN %d", rating, ratingAges[rating])
+	}
+	b.WriteString(" ELSE 0 END")
+	return b.String()
+}()
+
+// lockedCategoryIDs kilitli kategorilerin yerel ID'lerini seçen alt sorgudur
+const lockedCategoryIDs = `SELECT cat.id FROM categories cat
+	JOIN category_locks cl ON cl.source_id = cat.source_id AND cl.type = cat.type AND cl.remote_id = cat.remote_id
+	WHERE cl.locked = 1`
+
+// conditions süzgecin kanal tablosu için WHERE koşullarını döndürür
+func (f ParentalFilter) conditions(table string) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if f.HideLocked {
+		where = append(where,
+			table+".category_id NOT IN ("+lockedCategoryIDs+")",
+			fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM channel_locks cl WHERE cl.source_id = %[1]s.source_id
+				AND cl.stream_type = %[1]s.stream_type AND cl.remote_id = %[1]s.remote_id)`, table))
+	}
+	if f.MaxAge > 0 {
+		where = append(where, fmt.Sprintf("(%[1]s.stream_type = 'live' OR "+ratingAgeExpr+" <= ?)", table))
+		args = append(args, f.MaxAge)
+	}
+	return where, args
+}
+
+// GetParentalSettings ebeveyn denetimi ayarlarını döndürür
+func (d *Database) GetParentalSettings() (*ParentalSettings, error) {
+	var s ParentalSettings
+	var keywords string
+	err := d.db.QueryRow("SELECT pin_hash != '', max_age, keywords FROM parental_settings WHERE id = 1").
+		Scan(&s.Enabled, &s.MaxAge, &keywords)
+	if err != nil {
+		return nil, err
+	}
+	s.Keywords = splitKeywords(keywords)
+	return &s, nil
+}
+
+func splitKeywords(value string) []string {
+	keywords := []string{}
+	for _, keyword := range strings.Split(value, ",") {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+	return keywords
+}
+
+// UpdateParentalSettings yaş sınırını ve anahtar kelimeleri günceller.
+// Otomatik kategori kilitleri yeni kelimelere göre yeniden hesaplanır.
+func (d *Database) UpdateParentalSettings(maxAge int, keywords []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	value := strings.Join(splitKeywords(strings.Join(keywords, ",")), ",")
+	if _, err := tx.Exec("UPDATE parental_settings SET max_age = ?, keywords = ? WHERE id = 1", maxAge, value); err != nil {
+		return err
+	}
+	if err := applyCategoryAutoLocks(tx, 0); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetParentalPIN ebeveyn PIN'ini değiştirir; pin boşsa denetim kapanır.
+// Açık kilit oturumları kapatılır.
+func (d *Database) SetParentalPIN(pin string) error {
+	pinHash := ""
+	if pin != "" {
+		var err error
+		if pinHash, err = hashPIN(pin); err != nil {
+			return err
+		}
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE parental_settings SET pin_hash = ? WHERE id = 1", pinHash); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM parental_sessions"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CheckParentalPIN PIN'in ebeveyn PIN'iyle eşleşip eşleşmediğini döndürür.
+// PIN belirlenmemişse her PIN kabul edilir.
+func (d *Database) CheckParentalPIN(pin string) (bool, error) {
+	var pinHash string
+	if err := d.db.QueryRow("SELECT pin_hash FROM parental_settings WHERE id = 1").Scan(&pinHash); err != nil {
+		return false, err
+	}
+	if pinHash == "" {
+		return true, nil
+	}
+	return checkPIN(pinHash, pin), nil
+}
+
+// CreateParentalSession kilitli içerikleri parentalSessionTTL süresince
+// açan bir oturum açar ve anahtarını bitiş zamanıyla döndürür
+func (d *Database) CreateParentalSession() (string, time.Time, error) {
+	token, err := newSessionToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expires := now.Add(parentalSessionTTL)
+	// Süresi dolan oturumlar yenileri açılırken temizlenir
+	if _, err := d.db.Exec("DELETE FROM parental_sessions WHERE expires_at < ?", now); err != nil {
+		return "", time.Time{}, err
+	}
+	_, err = d.db.Exec("INSERT INTO parental_sessions (token_hash, created_at, expires_at) VALUES (?, ?, ?)",
+		sessionTokenHash(token), now, expires)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expires, nil
+}
+
+// ParentalSessionActive kilit açma oturumunun geçerli olup olmadığını döndürür
+func (d *Database) ParentalSessionActive(token string) (bool, error) {
+	var expires time.Time
+	err := d.db.QueryRow("SELECT expires_at FROM parental_sessions WHERE token_hash = ?", sessionTokenHash(token)).
+		Scan(&expires)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return time.Now().Before(expires), nil
+}
+
+// DeleteParentalSession kilit açma oturumunu kapatır
+func (d *Database) DeleteParentalSession(token string) error {
+	_, err := d.db.Exec("DELETE FROM parental_sessions WHERE token_hash = ?", sessionTokenHash(token))
+	return err
+}
+
+// SetCategoryLocked kategoriyi elle kilitler ya da kilidini açar. Elle
+// verilen karar otomatik algılamadan önceliklidir.
+func (d *Database) SetCategoryLocked(categoryID int, locked bool) error {
+	res, err := d.db.Exec(`INSERT OR REPLACE INTO category_locks (source_id, type, remote_id, locked, auto)
+		SELECT source_id, type, remote_id, ?, 0 FROM categories WHERE id = ?`, locked, categoryID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+// SetChannelLocked kanalı kilitler ya da kanala verilmiş kilidi kaldırır.
+// Kilitli bir kategorideki kanal kategori kilidi açılmadan görünmez.
+func (d *Database) SetChannelLocked(channelID int, locked bool) error {
+	var res sql.Result
+	var err error
+	if locked {
+		res, err = d.db.Exec(`INSERT OR IGNORE INTO channel_locks (source_id, stream_type, remote_id)
+			SELECT source_id, stream_type, remote_id FROM channels WHERE id = ?`, channelID)
+	} else {
+		res, err = d.db.Exec(`DELETE FROM channel_locks WHERE (source_id, stream_type, remote_id) IN
+			(SELECT source_id, stream_type, remote_id FROM channels WHERE id = ?)`, channelID)
+	}
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		var exists bool
+		if err := d.db.QueryRow("SELECT EXISTS (SELECT 1 FROM channels WHERE id = ?)", channelID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrChannelNotFound
+		}
+	}
+	return nil
+}
+
+// LockedCategories kilitli kategorilerin yerel ID'lerini döndürür
+func (d *Database) LockedCategories() (map[int]bool, error) {
+	rows, err := d.db.Query(lockedCategoryIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locked := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		locked[id] = true
+	}
+	return locked, rows.Err()
+}
+
+// ChannelAllowed kanalın süzgeçten geçip geçmediğini döndürür. Kayıtlı
+// olmayan kanallar süzülmez.
+func (d *Database) ChannelAllowed(channelID int, f ParentalFilter) (bool, error) {
+	where, args := f.conditions("channels")
+	if len(where) == 0 {
+		return true, nil
+	}
+	var blocked bool
+	err := d.db.QueryRow("SELECT EXISTS (SELECT 1 FROM channels WHERE id = ? AND NOT ("+strings.Join(where, " AND ")+"))",
+		append([]interface{}{channelID}, args...)...).Scan(&blocked)
+	return !blocked, err
+}
+
+// applyCategoryAutoLocks adı ebeveyn denetimi anahtar kelimelerinden birini
+// içeren kategorileri kilitler. Kelimeler katlanmış adda tam kelime olarak
+// aranır ("+18" "Filmler +18"i bulur, "2018"i bulmaz). Elle kilitlenen ya
+// da kilidi açılan kategorilere dokunulmaz. sourceID 0 ise tüm kaynaklar
+// yeniden hesaplanır.
+func applyCategoryAutoLocks(tx *sql.Tx, sourceID int) error {
+	var value string
+	if err := tx.QueryRow("SELECT keywords FROM parental_settings WHERE id = 1").Scan(&value); err != nil {
+		return err
+	}
+	var keywords []string
+	for _, keyword := range splitKeywords(value) {
+		if folded := search.Fold(keyword); folded != "" {
+			keywords = append(keywords, " "+folded+" ")
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM category_locks WHERE auto = 1 AND (?1 = 0 OR source_id = ?1)", sourceID); err != nil {
+		return err
+	}
+	if len(keywords) == 0 {
+		return nil
+	}
+
+	rows, err := tx.Query("SELECT source_id, type, remote_id, name FROM categories WHERE ?1 = 0 OR source_id = ?1", sourceID)
+	if err != nil {
+		return err
+	}
+	type categoryKey struct {
+		sourceID, remoteID int
+		categoryType       string
+	}
+	var matched []categoryKey
+	for rows.Next() {
+		var key categoryKey
+		var name string
+		if err := rows.Scan(&key.sourceID, &key.categoryType, &key.remoteID, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		name = " " + search.Fold(name) + " "
+		for _, keyword := range keywords {
+			if strings.Contains(name, keyword) {
+				matched = append(matched, key)
+				break
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range matched {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO category_locks (source_id, type, remote_id, locked, auto)
+			VALUES (?, ?, ?, 1, 1)`, key.sourceID, key.categoryType, key.remoteID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// DefaultProfile profil seçilmeyen isteklerin kullandığı ve silinemeyen
+// profildir
+const DefaultProfile = 1
+
+// profileSessionTTL kullanılmayan profil oturumlarının geçerlilik süresidir
+const profileSessionTTL = 30 * 24 * time.Hour
+
+// pinHashRounds PIN özetinin kaç kez tekrarlanacağıdır. PIN'ler kısa olduğu
+// için özet kaba kuvvete karşı yavaşlatılır.
+const pinHashRounds = 10000
+
+var (
+	// ErrDefaultProfile varsayılan profil silinmek istenirse döner
+	ErrDefaultProfile = errors.New("the default profile cannot be deleted")
+	// ErrCategoryNotFound gizlenecek kategori bulunamazsa döner
+	ErrCategoryNotFound = errors.New("category not found")
+)
+
+// Profile evdeki bir kullanıcının profilidir. Favoriler, izleme geçmişi,
+// kalınan yerler, dil tercihleri ve gizlenen kategoriler profile aittir.
+// PIN'li profiller yalnızca PIN ile açılan oturumla kullanılabilir.
+type Profile struct {
+	ID               int    `json:"id"`
+	Name             string `json:"name"`
+	HasPIN           bool   `json:"has_pin"`
+	AudioLanguage    string `json:"audio_language"`
+	SubtitleLanguage string `json:"subtitle_language"`
+	// PreferredQuality birden fazla sürümü olan kanallarda seçilecek
+	// kalitedir (channelname kalite etiketleri), boşsa en yüksek kalite
+	PreferredQuality string    `json:"preferred_quality"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+const profileColumns = "id, name, pin_hash != '', audio_language, subtitle_language, preferred_quality, created_at"
+
+func scanProfile(row rowScanner) (Profile, error) {
+	var p Profile
+	var createdAt sql.NullTime
+	err := row.Scan(&p.ID, &p.Name, &p.HasPIN, &p.AudioLanguage, &p.SubtitleLanguage, &p.PreferredQuality, &createdAt)
+	p.CreatedAt = createdAt.Time
+	return p, err
+}
+
+// GetProfiles tüm profilleri döndürür
+func (d *Database) GetProfiles() ([]Profile, error) {
+	rows, err := d.db.Query("SELECT " + profileColumns + " FROM profiles ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []Profile{}
+	for rows.Next() {
+		p, err := scanProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+// GetProfile tek bir profili getirir, bulunamazsa nil döner
+func (d *Database) GetProfile(id int) (*Profile, error) {
+	p, err := scanProfile(d.db.QueryRow("SELECT "+profileColumns+" FROM profiles WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CreateProfile profili varsayılan favori listesiyle birlikte oluşturur.
+// pin boşsa profil PIN'siz olur.
+func (d *Database) CreateProfile(p Profile, pin string) (int, error) {
+	pinHash := ""
+	if pin != "" {
+		var err error
+		if pinHash, err = hashPIN(pin); err != nil {
+			return 0, err
+		}
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO profiles (name, pin_hash, audio_language, subtitle_language, preferred_quality)
+		VALUES (?, ?, ?, ?, ?)`, p.Name, pinHash, p.AudioLanguage, p.SubtitleLanguage, p.PreferredQuality)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := createFavoriteList(tx, int(id), "Favoriler", true); err != nil {
+		return 0, err
+	}
+	return int(id), tx.Commit()
+}
+
+// UpdateProfile profilin adını, dil ve kalite tercihlerini günceller
+func (d *Database) UpdateProfile(p Profile) error {
+	_, err := d.db.Exec("UPDATE profiles SET name = ?, audio_language = ?, subtitle_language = ?, preferred_quality = ? WHERE id = ?",
+		p.Name, p.AudioLanguage, p.SubtitleLanguage, p.PreferredQuality, p.ID)
+	return err
+}
+
+// SetProfilePIN profilin PIN'ini değiştirir, pin boşsa kaldırır. Profilin
+// açık oturumları kapatılır.
+func (d *Database) SetProfilePIN(id int, pin string) error {
+	pinHash := ""
+	if pin != "" {
+		var err error
+		if pinHash, err = hashPIN(pin); err != nil {
+			return err
+		}
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE profiles SET pin_hash = ? WHERE id = ?", pinHash, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM profile_sessions WHERE profile_id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CheckProfilePIN PIN'in profilinkiyle eşleşip eşleşmediğini döndürür.
+// PIN'siz profiller her PIN'i kabul eder.
+func (d *Database) CheckProfilePIN(id int, pin string) (bool, error) {
+	var pinHash string
+	err := d.db.QueryRow("SELECT pin_hash FROM profiles WHERE id = ?", id).Scan(&pinHash)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if pinHash == "" {
+		return true, nil
+	}
+	return checkPIN(pinHash, pin), nil
+}
+
+// DeleteProfile profili ve ona ait favori, geçmiş ve tercihleri siler
+func (d *Database) DeleteProfile(id int) error {
+	if id == DefaultProfile {
+		return ErrDefaultProfile
+	}
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		"DELETE FROM favorites WHERE list_id IN (SELECT id FROM favorite_lists WHERE profile_id = ?1)",
+		"DELETE FROM favorite_lists WHERE profile_id = ?1",
+		"DELETE FROM watch_history WHERE profile_id = ?1",
+		"DELETE FROM resume_points WHERE profile_id = ?1",
+		"DELETE FROM hidden_categories WHERE profile_id = ?1",
+		"DELETE FROM profile_sessions WHERE profile_id = ?1",
+		"DELETE FROM profiles WHERE id = ?1",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// hashPIN PIN'i rastgele tuzla tekrarlı SHA-256 özetine çevirir.
+// Biçim: "tuz$özet" (hex).
+func hashPIN(pin string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(salt) + "$" + hex.EncodeToString(pinDigest(salt, pin)), nil
+}
+
+func pinDigest(salt []byte, pin string) []byte {
+	sum := sha256.Sum256(append(append([]byte{}, salt...), pin...))
+	for i := 1; i < pinHashRounds; i++ {
+		sum = sha256.Sum256(append(sum[:], salt...))
+	}
+	return sum[:]
+}
+
+func checkPIN(pinHash, pin string) bool {
+	saltHex, digestHex, ok := strings.Cut(pinHash, "$")
+	if !ok {
+		return false
+	}
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return false
+	}
+	digest, err := hex.DecodeString(digestHex)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(digest, pinDigest(salt, pin)) == 1
+}
+
+// newSessionToken rastgele bir oturum anahtarı üretir
+func newSessionToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// sessionTokenHash oturum anahtarının veritabanında saklanan özetidir
+func sessionTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateProfileSession profil için yeni bir oturum açar ve oturum
+// anahtarını döndürür. Anahtarın kendisi saklanmaz.
+func (d *Database) CreateProfileSession(profileID int) (string, error) {
+	token, err := newSessionToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	_, err = d.db.Exec("INSERT INTO profile_sessions (token_hash, profile_id, created_at, last_used) VALUES (?, ?, ?, ?)",
+		sessionTokenHash(token), profileID, now, now)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ProfileSession oturum anahtarının profilini döndürür. Anahtar geçersizse
+// ya da süresi dolduysa nil döner.
+func (d *Database) ProfileSession(token string) (*Profile, error) {
+	tokenHash := sessionTokenHash(token)
+	var profileID int
+	var lastUsed time.Time
+	err := d.db.QueryRow("SELECT profile_id, last_used FROM profile_sessions WHERE token_hash = ?", tokenHash).
+		Scan(&profileID, &lastUsed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if now.Sub(lastUsed) > profileSessionTTL {
+		_, err := d.db.Exec("DELETE FROM profile_sessions WHERE token_hash = ?", tokenHash)
+		return nil, err
+	}
+	// Her istekte yazmamak için kullanım zamanı saatte bir güncellenir
+	if now.Sub(lastUsed) > time.Hour {
+		if _, err := d.db.Exec("UPDATE profile_sessions SET last_used = ? WHERE token_hash = ?", now, tokenHash); err != nil {
+			return nil, err
+		}
+	}
+	return d.GetProfile(profileID)
+}
+
+// DeleteProfileSession oturumu kapatır
+func (d *Database) DeleteProfileSession(token string) error {
+	_, err := d.db.Exec("DELETE FROM profile_sessions WHERE token_hash = ?", sessionTokenHash(token))
+	return err
+}
+
+// hiddenCategoryIDs profilin gizlediği kategorilerin yerel ID'lerini seçen
+// alt sorgudur; tek parametresi profil ID'sidir
+const hiddenCategoryIDs = `SELECT cat.id FROM categories cat
+	JOIN hidden_categories hc ON hc.source_id = cat.source_id AND hc.type = cat.type AND hc.remote_id = cat.remote_id
+	WHERE hc.profile_id = ?`
+
+// SetCategoryHidden kategoriyi profil için gizler ya da yeniden gösterir.
+// Kategori kaynak, tür ve sağlayıcıdaki ID ile saklanır, böylece
+// senkronizasyonlardan etkilenmez.
+func (d *Database) SetCategoryHidden(profileID, categoryID int, hidden bool) error {
+	var sourceID, remoteID int
+	var categoryType string
+	err := d.db.QueryRow("SELECT source_id, type, remote_id FROM categories WHERE id = ?", categoryID).
+		Scan(&sourceID, &categoryType, &remoteID)
+	if err == sql.ErrNoRows {
+		return ErrCategoryNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if hidden {
+		_, err = d.db.Exec("INSERT OR IGNORE INTO hidden_categories (profile_id, source_id, type, remote_id) VALUES (?, ?, ?, ?)",
+			profileID, sourceID, categoryType, remoteID)
+	} else {
+		_, err = d.db.Exec("DELETE FROM hidden_categories WHERE profile_id = ? AND source_id = ? AND type = ? AND remote_id = ?",
+			profileID, sourceID, categoryType, remoteID)
+	}
+	return err
+}
+
+// HiddenCategories profilin gizlediği kategorilerin yerel ID'lerini döndürür
+func (d *Database) HiddenCategories(profileID int) (map[int]bool, error) {
+	rows, err := d.db.Query(hiddenCategoryIDs, profileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hidden := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		hidden[id] = true
+	}
+	return hidden, rows.Err()
+}
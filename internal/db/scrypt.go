@@ -0,0 +1,153 @@
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// scrypt parametreleri (RFC 7914). N=32768, r=8 her türetmede 32 MB bellek
+// ve yaklaşık 100 ms kullanır.
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+// scryptKey parola ve tuzdan RFC 7914'teki scrypt ile keyLen baytlık anahtar
+// türetir. N ikinin kuvveti olmalıdır.
+func scryptKey(password, salt []byte, N, r, p, keyLen int) ([]byte, error) {
+	if N <= 1 || N&(N-1) != 0 {
+		return nil, fmt.Errorf("scrypt: N must be a power of two greater than 1")
+	}
+	if r <= 0 || p <= 0 || uint64(r)*uint64(p) >= 1<<30 || r > (1<<31-1)/128/p || N > (1<<31-1)/128/r {
+		return nil, fmt.Errorf("scrypt: parameters are too large")
+	}
+
+	xy := make([]uint32, 64*r)
+	v := make([]uint32, 32*N*r)
+	b := pbkdf2SHA256(password, salt, 1, p*128*r)
+	for i := 0; i < p; i++ {
+		smix(b[i*128*r:], r, N, v, xy)
+	}
+	return pbkdf2SHA256(password, b, 1, keyLen), nil
+}
+
+// pbkdf2SHA256 HMAC-SHA256 ile PBKDF2 (RFC 8018) anahtar türetmesidir
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	var counter [4]byte
+	dk := make([]byte, 0, blocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
+
+// smix scrypt'in bellek yoğun ROMix adımını b üzerinde uygular
+func smix(b []byte, r, N int, v, xy []uint32) {
+	var tmp [16]uint32
+	R := 32 * r
+	x := xy
+	y := xy[R:]
+
+	for i := 0; i < R; i++ {
+		x[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	for i := 0; i < N; i += 2 {
+		copy(v[i*R:], x[:R])
+		blockMix(&tmp, x, y, r)
+		copy(v[(i+1)*R:], y[:R])
+		blockMix(&tmp, y, x, r)
+	}
+	for i := 0; i < N; i += 2 {
+		j := int(integerify(x, r) & uint64(N-1))
+		blockXOR(x, v[j*R:], R)
+		blockMix(&tmp, x, y, r)
+
+		j = int(integerify(y, r) & uint64(N-1))
+		blockXOR(y, v[j*R:], R)
+		blockMix(&tmp, y, x, r)
+	}
+	for i, w := range x[:R] {
+		binary.LittleEndian.PutUint32(b[i*4:], w)
+	}
+}
+
+// blockMix scrypt'in BlockMix adımıdır; tek indisli bloklar çıktının ikinci
+// yarısına yazılır
+func blockMix(tmp *[16]uint32, in, out []uint32, r int) {
+	copy(tmp[:], in[(2*r-1)*16:])
+	for i := 0; i < 2*r; i += 2 {
+		salsaXOR(tmp, in[i*16:], out[i*8:])
+		salsaXOR(tmp, in[i*16+16:], out[i*8+r*16:])
+	}
+}
+
+func blockXOR(dst, src []uint32, n int) {
+	for i, w := range src[:n] {
+		dst[i] ^= w
+	}
+}
+
+func integerify(b []uint32, r int) uint64 {
+	j := (2*r - 1) * 16
+	return uint64(b[j]) | uint64(b[j+1])<<32
+}
+
+// salsaXOR tmp'yi in ile XOR'layıp Salsa20/8 çekirdeğinden geçirir, sonucu
+// hem out'a hem tmp'ye yazar
+func salsaXOR(tmp *[16]uint32, in, out []uint32) {
+	var w [16]uint32
+	for i := range w {
+		w[i] = tmp[i] ^ in[i]
+	}
+
+	x := w
+	quarter := func(a, b, c, d int) {
+		x[b] ^= bits.RotateLeft32(x[a]+x[d], 7)
+		x[c] ^= bits.RotateLeft32(x[b]+x[a], 9)
+		x[d] ^= bits.RotateLeft32(x[c]+x[b], 13)
+		x[a] ^= bits.RotateLeft32(x[d]+x[c], 18)
+	}
+	for i := 0; i < 8; i += 2 {
+		// Sütun turu
+		quarter(0, 4, 8, 12)
+		quarter(5, 9, 13, 1)
+		quarter(10, 14, 2, 6)
+		quarter(15, 3, 7, 11)
+		// Satır turu
+		quarter(0, 1, 2, 3)
+		quarter(5, 6, 7, 4)
+		quarter(10, 11, 8, 9)
+		quarter(15, 12, 13, 14)
+	}
+
+	for i := range x {
+		x[i] += w[i]
+		out[i] = x[i]
+		tmp[i] = x[i]
+	}
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// RFC 7914, section 11
+	tests := []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+			"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56" +
+			"a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(tt.password), []byte(tt.salt), tt.iterations, 64))
+		if got != tt.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestScryptKey(t *testing.T) {
+	// RFC 7914, section 12
+	tests := []struct {
+		password, salt string
+		N, r, p        int
+		want           string
+	}{
+		{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442" +
+			"fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b373162" +
+			"2eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+	}
+	for _, tt := range tests {
+		key, err := scryptKey([]byte(tt.password), []byte(tt.salt), tt.N, tt.r, tt.p, 64)
+		if err != nil {
+			t.Fatalf("scryptKey(%q, %q): %v", tt.password, tt.salt, err)
+		}
+		if got := hex.EncodeToString(key); got != tt.want {
+			t.Errorf("scryptKey(%q, %q, %d, %d, %d) = %s, want %s", tt.password, tt.salt, tt.N, tt.r, tt.p, got, tt.want)
+		}
+	}
+
+	for _, N := range []int{0, 1, 3, 1000} {
+		if _, err := scryptKey([]byte("x"), []byte("y"), N, 8, 1, 32); err == nil {
+			t.Errorf("scryptKey with N=%d succeeded, want an error", N)
+		}
+	}
+}
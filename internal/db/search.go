@@ -0,0 +1,261 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"remote-iptv/internal/search"
+)
+
+// Arama dizini tabloları. SQLite FTS5 ile derlendiyse (sqlite_fts5 etiketi)
+// channel_fts, değilse LIKE ile taranan düz channel_search tablosu kullanılır.
+// İki tabloda da metinler search.Fold ile katlanmış olarak saklanır.
+const (
+	ftsSearchTable   = "channel_fts"
+	plainSearchTable = "channel_search"
+)
+
+const ftsSearchSchema = `CREATE VIRTUAL TABLE channel_fts USING fts5(
+	name, category, details,
+	channel_id UNINDEXED, source_id UNINDEXED, stream_type UNINDEXED,
+	prefix = '2 3'
+)`
+
+const plainSearchSchema = `CREATE TABLE channel_search (
+	channel_id INTEGER PRIMARY KEY,
+	source_id INTEGER NOT NULL,
+	stream_type TEXT NOT NULL,
+	name TEXT NOT NULL,
+	category TEXT NOT NULL,
+	details TEXT NOT NULL
+)`
+
+// SearchResult arama sonucunda dönen kanal ve kategorisinin adıdır
+type SearchResult struct {
+	Channel
+	CategoryName string `json:"category_name"`
+}
+
+// SearchQuery arama seçenekleridir. StreamType ve SourceID boşsa tüm türler
+// ve kaynaklar aranır. ProfileID sıfır değilse profilin gizlediği
+// kategoriler sonuçlara girmez, Parental kilitli içerikleri süzer. Yerel
+// olarak gizlenen kanallar aranmaz, sonuçlar yerel adlarla döner.
+type SearchQuery struct {
+	Query      string
+	StreamType string
+	SourceID   int
+	ProfileID  int
+	Parental   ParentalFilter
+	Limit      int
+}
+
+// ftsAvailable SQLite'ın FTS5 ile derlenip derlenmediğini döndürür
+func ftsAvailable(db *sql.DB) bool {
+	var used bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used); err != nil {
+		return false
+	}
+	return used
+}
+
+func tableExists(db queryer, name string) (bool, error) {
+	rows, err := db.Query("SELECT 1 FROM sqlite_master WHERE name = ?", name)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
+
+// initSearchIndex arama tablosunu oluşturur. Tablo yeni oluşturulduysa ya da
+// veritabanı en son diğer arama türüyle derlenmiş bir sürümle açıldıysa
+// dizin kanallardan yeniden kurulur.
+func initSearchIndex(db *sql.DB) (fts bool, err error) {
+	fts = ftsAvailable(db)
+	table, schema, other := plainSearchTable, plainSearchSchema, ftsSearchTable
+	if fts {
+		table, schema, other = ftsSearchTable, ftsSearchSchema, plainSearchTable
+	}
+
+	exists, err := tableExists(db, table)
+	if err != nil {
+		return fts, err
+	}
+	otherExists, err := tableExists(db, other)
+	if err != nil {
+		return fts, err
+	}
+	if exists && !otherExists {
+		return fts, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fts, err
+	}
+	defer tx.Rollback()
+
+	if !exists {
+		if _, err := tx.Exec(schema); err != nil {
+			return fts, err
+		}
+	}
+	// FTS5 modülü olmadan sanal tablo silinemez, bu yüzden yalnızca düz
+	// tablo kaldırılır
+	if otherExists && fts {
+		if _, err := tx.Exec("DROP TABLE " + plainSearchTable); err != nil {
+			return fts, err
+		}
+	}
+	n, err := refreshSearchIndex(tx, fts, 0)
+	if err != nil {
+		return fts, err
+	}
+	log.Printf("Built search index (%s) with %d entries", table, n)
+	return fts, tx.Commit()
+}
+
+func searchTable(fts bool) string {
+	if fts {
+		return ftsSearchTable
+	}
+	return plainSearchTable
+}
+
+// refreshSearchIndex kaynağın (sourceID 0 ise tüm kaynakların) arama
+// kayıtlarını kanal ve kategori tablolarından yeniden yazar
+func refreshSearchIndex(tx *sql.Tx, fts bool, sourceID int) (int, error) {
+	table := searchTable(fts)
+	if _, err := tx.Exec("DELETE FROM "+table+" WHERE (?1 = 0 OR source_id = ?1)", sourceID); err != nil {
+		return 0, err
+	}
+
+	insert, err := tx.Prepare("INSERT INTO " + table +
+		" (channel_id, source_id, stream_type, name, category, details) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return 0, err
+	}
+	defer insert.Close()
+
+	rows, err := tx.Query(`SELECT c.id, c.source_id, c.stream_type, c.name, COALESCE(cat.name, ''),
+			COALESCE(c.plot, ''), COALESCE(c.genre, ''), COALESCE(c.actors, '')
+		FROM channels c LEFT JOIN categories cat ON cat.id = c.category_id
+		WHERE (?1 = 0 OR c.source_id = ?1)`, sourceID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var id, channelSourceID int
+		var streamType, name, category, plot, genre, cast string
+		if err := rows.Scan(&id, &channelSourceID, &streamType, &name, &category, &plot, &genre, &cast); err != nil {
+			return n, err
+		}
+		details := search.Fold(strings.Join([]string{genre, cast, plot}, " "))
+		if _, err := insert.Exec(id, channelSourceID, streamType, search.Fold(name), search.Fold(category), details); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// SearchChannels kanal, film ve dizileri adlarına, kategorilerine ve
+// varsa açıklama, tür ve oyuncu bilgilerine göre arar. Sonuçlar ilgiye göre
+// sıralanır: adı aramayla aynı olanlar, adı aramayla başlayanlar, adında
+// geçenler ve yalnızca kategori ya da açıklamada geçenler.
+func (d *Database) SearchChannels(q SearchQuery) ([]SearchResult, error) {
+	terms := search.Terms(q.Query)
+	if len(terms) == 0 {
+		return []SearchResult{}, nil
+	}
+	phrase := strings.Join(terms, " ")
+
+	var where []string
+	var args []interface{}
+	var rank string
+	if d.fts {
+		// Her terim önek araması olarak aranır, terimler VE ile bağlanır
+		match := make([]string, len(terms))
+		for i, term := range terms {
+			match[i] = `"` + term + `"*`
+		}
+		where = append(where, "channel_fts MATCH ?")
+		args = append(args, strings.Join(match, " "))
+		// Ad alanındaki eşleşmeler kategori ve açıklamadan ağır basar
+		rank = "bm25(channel_fts, 10.0, 2.0, 1.0)"
+	} else {
+		for _, term := range terms {
+			like := "%" + escapeLike(term) + "%"
+			where = append(where, `(s.name LIKE ? ESCAPE '\' OR s.category LIKE ? ESCAPE '\' OR s.details LIKE ? ESCAPE '\')`)
+			args = append(args, like, like, like)
+		}
+		rank = "length(s.name)"
+	}
+	if q.StreamType != "" {
+		where = append(where, "s.stream_type = ?")
+		args = append(args, q.StreamType)
+	}
+	if q.SourceID != 0 {
+		where = append(where, "s.source_id = ?")
+		args = append(args, q.SourceID)
+	}
+	where = append(where, "NOT c.hidden")
+	if q.ProfileID != 0 {
+		where = append(where, "c.category_id NOT IN ("+hiddenCategoryIDs+")")
+		args = append(args, q.ProfileID)
+	}
+	parentalWhere, parentalArgs := q.Parental.conditions("c")
+	where = append(where, parentalWhere...)
+	args = append(args, parentalArgs...)
+
+	// Alt sorgu c.* ile kanal kolonlarını tekil adlarla döndürür, böylece
+	// ortak kolon listesi dış sorguda olduğu gibi kullanılabilir
+	query := fmt.Sprintf(`SELECT `+channelColumns+`, category_name FROM (
+			SELECT c.*, COALESCE(co.name, cat.name, '') AS category_name,
+				CASE
+					WHEN s.name = ? THEN 0
+					WHEN s.name LIKE ? ESCAPE '\' THEN 1
+					WHEN s.name LIKE ? ESCAPE '\' THEN 2
+					ELSE 3 END AS match_group,
+				%s AS match_rank
+			FROM %s s
+			JOIN `+localChannels+` c ON c.id = s.channel_id
+			LEFT JOIN categories cat ON cat.id = c.category_id
+			LEFT JOIN category_overrides co ON co.source_id = cat.source_id AND co.type = cat.type AND co.remote_id = cat.remote_id
+			WHERE %s
+			ORDER BY match_group, match_rank, c.name
+			LIMIT ?)
+		ORDER BY match_group, match_rank, name`, rank, searchTable(d.fts), strings.Join(where, " AND "))
+	args = append([]interface{}{phrase, escapeLike(phrase) + "%", "%" + escapeLike(phrase) + "%"}, args...)
+	args = append(args, q.Limit)
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var result SearchResult
+		ch := &result.Channel
+		err := rows.Scan(&ch.ID, &ch.SourceID, &ch.RemoteID, &ch.Name, &ch.URL, &ch.StreamType, &ch.CategoryID, &ch.StreamIcon, &ch.Rating, &ch.Extension,
+			&ch.EPGChannelID, &ch.HTTPUserAgent, &ch.HTTPReferrer, &ch.Catchup, &ch.CatchupDays, &ch.CatchupSource,
+			&ch.Plot, &ch.Genre, &ch.Cast, &ch.Number, &ch.AddedAt, &result.CategoryName)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// escapeLike LIKE desenindeki özel karakterleri kaçırır
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,393 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// SecretKeyEnv şifreleme anahtarını doğrudan veren ortam değişkenidir.
+	// Değer base64 ya da hex kodlu 32 bayt veya serbest bir parola olabilir.
+	SecretKeyEnv = "IPTV_SECRET_KEY"
+	// SecretKeyFileEnv anahtar dosyasının yolunu veren ortam değişkenidir
+	SecretKeyFileEnv = "IPTV_SECRET_KEY_FILE"
+
+	// secretKeyFileName veritabanının yanında oluşturulan anahtar dosyasıdır
+	secretKeyFileName = "secret.key"
+	// secretSaltFileName parolalardan anahtar türetilirken kullanılan tuzun
+	// veritabanının yanında saklandığı dosyadır
+	secretSaltFileName = "secret.salt"
+	// secretSaltSize tuzun bayt uzunluğudur
+	secretSaltSize = 16
+
+	// encryptedPrefix şifrelenmiş değerleri düz metinden ayırır
+	encryptedPrefix = "enc:v1:"
+)
+
+// SecretKey kimlik bilgilerini şifreleyen anahtar ve nereden okunduğudur
+type SecretKey struct {
+	Key []byte
+	// Origin anahtarın kaynağını açıklar (ortam değişkeni ya da dosya yolu)
+	Origin string
+	// File anahtar bir dosyadan geliyorsa o dosyanın yoludur
+	File string
+
+	// legacy anahtar bir paroladan türetildiyse eski sürümlerin aynı
+	// paroladan tuzsuz SHA-256 ile türettiği anahtardır
+	legacy []byte
+}
+
+// LoadSecretKey anahtarı sırasıyla IPTV_SECRET_KEY, IPTV_SECRET_KEY_FILE ve
+// veritabanının yanındaki secret.key dosyasından okur. Hiçbiri yoksa yeni bir
+// anahtar üretip secret.key dosyasına 0600 izinleriyle yazar.
+func LoadSecretKey(dbPath string) (*SecretKey, error) {
+	if value := os.Getenv(SecretKeyEnv); value != "" {
+		key, legacy, err := parseSecretKey(dbPath, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", SecretKeyEnv, err)
+		}
+		return &SecretKey{Key: key, Origin: SecretKeyEnv, legacy: legacy}, nil
+	}
+
+	path := os.Getenv(SecretKeyFileEnv)
+	if path == "" {
+		path = filepath.Join(filepath.Dir(dbPath), secretKeyFileName)
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && os.Getenv(SecretKeyFileEnv) == "" {
+		key, err := GenerateSecretKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := WriteSecretKeyFile(path, key); err != nil {
+			return nil, err
+		}
+		log.Printf("Generated new credential encryption key: %s", path)
+		return &SecretKey{Key: key, Origin: path, File: path}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0077 != 0 {
+		log.Printf("Warning: key file %s is accessible by other users (mode %v)", path, info.Mode().Perm())
+	}
+	key, legacy, err := parseSecretKey(dbPath, string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &SecretKey{Key: key, Origin: path, File: path, legacy: legacy}, nil
+}
+
+// ParseSecretKey base64 ya da hex kodlu 32 baytlık anahtarı çözer. Başka
+// bir değer parola kabul edilir ve veritabanının yanındaki secret.salt
+// dosyasındaki tuzla scrypt'ten geçirilerek anahtara çevrilir; dosya yoksa
+// rastgele bir tuzla oluşturulur.
+func ParseSecretKey(dbPath, value string) ([]byte, error) {
+	key, _, err := parseSecretKey(dbPath, value)
+	return key, err
+}
+
+// parseSecretKey ParseSecretKey gibidir; değer bir parolaysa eski sürümlerin
+// türettiği anahtarı da döndürür
+func parseSecretKey(dbPath, value string) (key, legacy []byte, err error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil, fmt.Errorf("empty key")
+	}
+	if key, err := base64.StdEncoding.DecodeString(value); err == nil && len(key) == 32 {
+		return key, nil, nil
+	}
+	if key, err := hex.DecodeString(value); err == nil && len(key) == 32 {
+		return key, nil, nil
+	}
+
+	salt, err := loadSecretSalt(filepath.Join(filepath.Dir(dbPath), secretSaltFileName))
+	if err != nil {
+		return nil, nil, err
+	}
+	if key, err = scryptKey([]byte(value), salt, scryptN, scryptR, scryptP, scryptKeyLen); err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256([]byte(value))
+	return key, sum[:], nil
+}
+
+// loadSecretSalt tuzu dosyadan okur, dosya yoksa yeni bir tuz üretip yazar.
+// Tuz gizli değildir ama kaybolursa paroladan aynı anahtar türetilemez.
+func loadSecretSalt(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		salt := make([]byte, secretSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		if err := WriteSecretKeyFile(path, salt); err != nil {
+			return nil, err
+		}
+		log.Printf("Generated new key derivation salt: %s", path)
+		return salt, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	salt, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(salt) < secretSaltSize {
+		return nil, fmt.Errorf("%s: invalid salt", path)
+	}
+	return salt, nil
+}
+
+// GenerateSecretKey rastgele 32 baytlık yeni bir anahtar üretir
+func GenerateSecretKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// WriteSecretKeyFile anahtarı base64 olarak 0600 izinli dosyaya yazar. Dosya
+// önce geçici adla yazılıp yerine taşınır, yarım kalmış anahtar oluşmaz.
+func WriteSecretKeyFile(path string, key []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	data := base64.StdEncoding.EncodeToString(key) + "\n"
+	if err := os.WriteFile(tmp, []byte(data), 0600); err != nil {
+		return err
+	}
+	// WriteFile mevcut dosyanın izinlerini değiştirmez
+	if err := os.Chmod(tmp, 0600); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// secretBox değerleri AES-256-GCM ile şifreler
+type secretBox struct {
+	aead cipher.AEAD
+}
+
+func newSecretBox(key []byte) (*secretBox, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &secretBox{aead: aead}, nil
+}
+
+// seal değeri şifreler. Boş değerler boş kalır.
+func (b *secretBox) seal(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open şifrelenmiş değeri çözer. Henüz şifrelenmemiş eski değerler olduğu
+// gibi döner.
+func (b *secretBox) open(value string) (string, error) {
+	if !isEncrypted(value) {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+	nonceSize := b.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", fmt.Errorf("encrypted value is too short")
+	}
+	plaintext, err := b.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt credentials, wrong key?")
+	}
+	return string(plaintext), nil
+}
+
+func isEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// credentialColumns şifreli saklanan tablo kolonlarıdır. M3U adresleri
+// (get.php?username=...&password=...) ve sunucu adresleri kimlik bilgisi
+// taşıyabildiğinden adres kolonları da şifrelenir.
+var credentialColumns = []struct{ table, column string }{
+	{"sources", "url"},
+	{"sources", "username"},
+	{"sources", "password"},
+	{"source_servers", "url"},
+	{"source_server_events", "url"},
+	{"xtream_settings", "url"},
+	{"xtream_settings", "username"},
+	{"xtream_settings", "password"},
+}
+
+// encryptCredentials from ile şifrelenmiş kimlik bilgilerini tek bir
+// transaction'da to ile yeniden şifreler (anahtar değişimi)
+func encryptCredentials(db *sql.DB, from, to *secretBox) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n, err := sealCredentials(tx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// encryptStoredCredentials eski sürümlerden kalan düz metin kimlik
+// bilgilerini ve adresleri şifreleyen migration'dır
+func encryptStoredCredentials(tx *sql.Tx, box *secretBox) error {
+	n, err := sealCredentials(tx, nil, box)
+	if n > 0 {
+		log.Printf("Encrypted %d stored credentials", n)
+	}
+	return err
+}
+
+// sealCredentials düz metin kimlik bilgilerini şifreler, şifreli olanların
+// anahtarla çözülebildiğini doğrular. from verilirse şifreli değerler önce
+// onunla çözülüp to ile yeniden şifrelenir.
+func sealCredentials(tx *sql.Tx, from, to *secretBox) (int, error) {
+	if from == nil {
+		from = to
+	}
+
+	changed := 0
+	for _, col := range credentialColumns {
+		rows, err := tx.Query(fmt.Sprintf("SELECT rowid, %s FROM %s WHERE %s != ''", col.column, col.table, col.column))
+		if err != nil {
+			return 0, err
+		}
+		updates := map[int64]string{}
+		for rows.Next() {
+			var rowID int64
+			var value string
+			if err := rows.Scan(&rowID, &value); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			plaintext, err := from.open(value)
+			if err != nil {
+				rows.Close()
+				return 0, fmt.Errorf("%s %d: %w", col.table, rowID, err)
+			}
+			if isEncrypted(value) && from == to {
+				continue
+			}
+			sealed, err := to.seal(plaintext)
+			if err != nil {
+				rows.Close()
+				return 0, err
+			}
+			updates[rowID] = sealed
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		for rowID, sealed := range updates {
+			query := fmt.Sprintf("UPDATE %s SET %s = ? WHERE rowid = ?", col.table, col.column)
+			if _, err := tx.Exec(query, sealed, rowID); err != nil {
+				return 0, err
+			}
+		}
+		changed += len(updates)
+	}
+	return changed, nil
+}
+
+// verifyKey kayıtlı şifreli değerlerden birinin anahtarla çözülebildiğini
+// doğrular; yanlış anahtarla açılan veritabanı hiçbir şeyi değiştirmeden
+// reddedilir
+func verifyKey(db *sql.DB, box *secretBox) error {
+	value, err := sampleEncryptedValue(db)
+	if err != nil || value == "" {
+		return err
+	}
+	_, err = box.open(value)
+	return err
+}
+
+// upgradeLegacyKey kimlik bilgileri eski sürümlerin paroladan tuzsuz
+// türettiği anahtarla şifrelenmişse onları yeni anahtarla yeniden şifreler.
+// Şifreli değerlerden biri yeni anahtarla çözülebiliyorsa bir şey yapılmaz.
+func upgradeLegacyKey(db *sql.DB, legacy, box *secretBox) (int, error) {
+	value, err := sampleEncryptedValue(db)
+	if err != nil || value == "" {
+		return 0, err
+	}
+	if _, err := box.open(value); err == nil {
+		return 0, nil
+	}
+	// Eski anahtar da çözemiyorsa anahtar yanlıştır, hata sonra raporlanır
+	if _, err := legacy.open(value); err != nil {
+		return 0, nil
+	}
+	return encryptCredentials(db, legacy, box)
+}
+
+// sampleEncryptedValue kayıtlı şifreli değerlerden birini döndürür, yoksa
+// boş döner
+func sampleEncryptedValue(db *sql.DB) (string, error) {
+	for _, col := range credentialColumns {
+		exists, err := tableExists(db, col.table)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			continue
+		}
+		var value string
+		err = db.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE %s LIKE ? LIMIT 1", col.column, col.table, col.column),
+			encryptedPrefix+"%").Scan(&value)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		return value, err
+	}
+	return "", nil
+}
+
+// RotateKey tüm kimlik bilgilerini yeni anahtarla yeniden şifreler. Yeni
+// anahtarı saklamak çağıranın işidir; işlem tek transaction'da yapılır.
+func (d *Database) RotateKey(newKey []byte) (int, error) {
+	box, err := newSecretBox(newKey)
+	if err != nil {
+		return 0, err
+	}
+	n, err := encryptCredentials(d.db, d.box, box)
+	if err != nil {
+		return 0, err
+	}
+	d.box = box
+	return n, nil
+}
@@ -0,0 +1,520 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kaynak türleri
+const (
+	SourceXtream = "xtream"
+	SourceM3U    = "m3u"
+)
+
+// Source bir sağlayıcı hesabını ya da M3U listesini temsil eder
+type Source struct {
+	ID             int        `json:"id"`
+	Name           string     `json:"name"`
+	Type           string     `json:"type"`
+	URL            string     `json:"url"`
+	Username       string     `json:"username,omitempty"`
+	Password       string     `json:"password,omitempty"`
+	Enabled        bool       `json:"enabled"`
+	SyncSchedule   string     `json:"sync_schedule"`
+	EPGSchedule    string     `json:"epg_schedule"`
+	HealthSchedule string     `json:"health_schedule"`
+	LastSync       *time.Time `json:"last_sync,omitempty"`
+	Timezone       string     `json:"timezone,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+
+	// Servers sağlayıcının öncelik sırasına göre sunucu adresleridir, ilki URL'dir.
+	// ActiveServer istek ve akış URL'leri için şu an kullanılan sunucudur.
+	Servers      []string `json:"servers,omitempty"`
+	ActiveServer string   `json:"active_server,omitempty"`
+}
+
+// SourceServer bir kaynağın sunucu adreslerinden birini ve sağlık durumunu tutar
+type SourceServer struct {
+	URL         string     `json:"url"`
+	Position    int        `json:"position"`
+	Active      bool       `json:"active"`
+	Failures    int        `json:"failures"`
+	LastError   string     `json:"last_error,omitempty"`
+	LatencyMS   int        `json:"latency_ms,omitempty"`
+	LastChecked *time.Time `json:"last_checked,omitempty"`
+	LastOK      *time.Time `json:"last_ok,omitempty"`
+}
+
+// ServerEvent sunucu hatası, sunucu değişimi veya toparlanma kaydıdır
+type ServerEvent struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Event     string    `json:"event"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Sunucu olay türleri
+const (
+	ServerEventFailure   = "failure"
+	ServerEventFailover  = "failover"
+	ServerEventRecovered = "recovered"
+)
+
+// maxServerEvents kaynak başına saklanan sunucu olayı sayısıdır
+const maxServerEvents = 200
+
+const sourceColumns = `id, name, type, url, username, password, enabled, sync_schedule, epg_schedule, health_schedule, last_sync, timezone, created_at`
+
+func scanSource(row rowScanner) (Source, error) {
+	var src Source
+	var lastSync sql.NullTime
+	err := row.Scan(&src.ID, &src.Name, &src.Type, &src.URL, &src.Username, &src.Password,
+		&src.Enabled, &src.SyncSchedule, &src.EPGSchedule, &src.HealthSchedule, &lastSync, &src.Timezone, &src.CreatedAt)
+	if lastSync.Valid {
+		src.LastSync = &lastSync.Time
+	}
+	return src, err
+}
+
+// GetSources tüm kaynakları getirir
+func (d *Database) GetSources() ([]Source, error) {
+	rows, err := d.db.Query("SELECT " + sourceColumns + " FROM sources ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []Source
+	for rows.Next() {
+		src, err := scanSource(rows)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range sources {
+		if err := d.loadSource(&sources[i]); err != nil {
+			return nil, err
+		}
+	}
+	return sources, nil
+}
+
+// GetSource tek bir kaynağı getirir, bulunamazsa nil döner
+func (d *Database) GetSource(id int) (*Source, error) {
+	src, err := scanSource(d.db.QueryRow("SELECT "+sourceColumns+" FROM sources WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &src, d.loadSource(&src)
+}
+
+// GetDefaultXtreamSource ilk eklenen Xtream kaynağını döndürür. Tek
+// sağlayıcılı eski /api/xtream/settings uç noktaları bu kaynağı kullanır.
+func (d *Database) GetDefaultXtreamSource() (*Source, error) {
+	src, err := scanSource(d.db.QueryRow("SELECT "+sourceColumns+" FROM sources WHERE type = ? ORDER BY id LIMIT 1", SourceXtream))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &src, d.loadSource(&src)
+}
+
+// loadSource okunan kaynağın adresini ve kimlik bilgilerini çözer, sunucu
+// listesini yükler
+func (d *Database) loadSource(src *Source) error {
+	for _, field := range []*string{&src.URL, &src.Username, &src.Password} {
+		value, err := d.box.open(*field)
+		if err != nil {
+			return fmt.Errorf("source %d: %w", src.ID, err)
+		}
+		*field = value
+	}
+	return d.loadServers(src)
+}
+
+// sealSource kaynağın diske yazılacak şifreli adresini, kullanıcı adını ve
+// şifresini döndürür. M3U adresleri ve sunucu adresleri kimlik bilgisi
+// taşıyabildiğinden adresler de şifrelenir.
+func (d *Database) sealSource(src Source) (url, username, password string, err error) {
+	if url, err = d.box.seal(src.URL); err != nil {
+		return
+	}
+	if username, err = d.box.seal(src.Username); err != nil {
+		return
+	}
+	password, err = d.box.seal(src.Password)
+	return
+}
+
+// CreateSource yeni bir kaynak ekler ve ID'sini döndürür
+func (d *Database) CreateSource(src Source) (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	servers := sourceServerList(&src)
+	url, username, password, err := d.sealSource(src)
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(`INSERT INTO sources (name, type, url, username, password, enabled, sync_schedule, epg_schedule,
+			health_schedule)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		src.Name, src.Type, url, username, password, src.Enabled, src.SyncSchedule, src.EPGSchedule, src.HealthSchedule)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := replaceSourceServers(tx, d.box, int(id), servers); err != nil {
+		return 0, err
+	}
+	return int(id), tx.Commit()
+}
+
+// UpdateSource kaynağın ayarlarını ve sunucu listesini günceller
+func (d *Database) UpdateSource(src Source) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	servers := sourceServerList(&src)
+	url, username, password, err := d.sealSource(src)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE sources SET name = ?, type = ?, url = ?, username = ?, password = ?, enabled = ?, sync_schedule = ?,
+		epg_schedule = ?, health_schedule = ? WHERE id = ?`,
+		src.Name, src.Type, url, username, password, src.Enabled, src.SyncSchedule, src.EPGSchedule,
+		src.HealthSchedule, src.ID)
+	if err != nil {
+		return err
+	}
+	if err := replaceSourceServers(tx, d.box, src.ID, servers); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sourceServerList ana adresi başa alarak tekrarsız sunucu listesini
+// oluşturur. URL boşsa listedeki ilk sunucu ana adres olur.
+func sourceServerList(src *Source) []string {
+	var servers []string
+	seen := map[string]bool{}
+	for _, server := range append([]string{src.URL}, src.Servers...) {
+		server = strings.TrimSuffix(strings.TrimSpace(server), "/")
+		if server == "" || seen[server] {
+			continue
+		}
+		seen[server] = true
+		servers = append(servers, server)
+	}
+	if src.URL == "" && len(servers) > 0 {
+		src.URL = servers[0]
+	}
+	src.Servers = servers
+	return servers
+}
+
+// replaceSourceServers sunucu listesini yazar. Listede kalan sunucuların
+// sağlık bilgileri korunur; aktif sunucu listeden çıktıysa ilk sunucu aktif olur.
+func replaceSourceServers(tx *sql.Tx, box *secretBox, sourceID int, servers []string) error {
+	existing, err := sourceServerRows(tx, box, sourceID)
+	if err != nil {
+		return err
+	}
+
+	listed := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		listed[server] = true
+	}
+	for server, rowID := range existing {
+		if listed[server] {
+			continue
+		}
+		if _, err := tx.Exec("DELETE FROM source_servers WHERE rowid = ?", rowID); err != nil {
+			return err
+		}
+	}
+	if len(servers) == 0 {
+		return nil
+	}
+
+	for position, server := range servers {
+		if rowID, ok := existing[server]; ok {
+			if _, err := tx.Exec("UPDATE source_servers SET position = ? WHERE rowid = ?", position, rowID); err != nil {
+				return err
+			}
+			continue
+		}
+		sealed, err := box.seal(server)
+		if err != nil {
+			return err
+		}
+		res, err := tx.Exec("INSERT INTO source_servers (source_id, url, position) VALUES (?, ?, ?)", sourceID, sealed, position)
+		if err != nil {
+			return err
+		}
+		if existing[server], err = res.LastInsertId(); err != nil {
+			return err
+		}
+	}
+
+	var active int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM source_servers WHERE source_id = ? AND active = 1", sourceID).Scan(&active); err != nil {
+		return err
+	}
+	if active == 0 {
+		_, err := tx.Exec("UPDATE source_servers SET active = (rowid = ?) WHERE source_id = ?", existing[servers[0]], sourceID)
+		return err
+	}
+	return nil
+}
+
+// sourceServerRows kaynağın sunucu adreslerini satır kimlikleriyle
+// döndürür. Adresler şifreli saklandığından SQL'de karşılaştırılamaz,
+// eşleştirme çözülmüş adreslerle yapılır.
+func sourceServerRows(q queryer, box *secretBox, sourceID int) (map[string]int64, error) {
+	rows, err := q.Query("SELECT rowid, url FROM source_servers WHERE source_id = ?", sourceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	servers := map[string]int64{}
+	for rows.Next() {
+		var rowID int64
+		var url string
+		if err := rows.Scan(&rowID, &url); err != nil {
+			return nil, err
+		}
+		if url, err = box.open(url); err != nil {
+			return nil, fmt.Errorf("source %d server: %w", sourceID, err)
+		}
+		servers[url] = rowID
+	}
+	return servers, rows.Err()
+}
+
+// serverRowID kaynağın verilen adresteki sunucusunun satır kimliğini
+// döndürür, sunucu listede yoksa 0 döner
+func (d *Database) serverRowID(sourceID int, url string) (int64, error) {
+	servers, err := sourceServerRows(d.db, d.box, sourceID)
+	if err != nil {
+		return 0, err
+	}
+	return servers[url], nil
+}
+
+// loadServers kaynağın sunucu listesini ve aktif sunucusunu doldurur
+func (d *Database) loadServers(src *Source) error {
+	servers, err := d.GetSourceServers(src.ID)
+	if err != nil {
+		return err
+	}
+	src.Servers = nil
+	src.ActiveServer = ""
+	for _, server := range servers {
+		src.Servers = append(src.Servers, server.URL)
+		if server.Active {
+			src.ActiveServer = server.URL
+		}
+	}
+	if src.ActiveServer == "" {
+		src.ActiveServer = src.URL
+	}
+	return nil
+}
+
+// GetSourceServers kaynağın sunucularını öncelik sırasıyla getirir
+func (d *Database) GetSourceServers(sourceID int) ([]SourceServer, error) {
+	rows, err := d.db.Query(`SELECT url, position, active, failures, last_error, latency_ms, last_checked, last_ok
+		FROM source_servers WHERE source_id = ? ORDER BY position`, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var servers []SourceServer
+	for rows.Next() {
+		var server SourceServer
+		var lastChecked, lastOK sql.NullTime
+		if err := rows.Scan(&server.URL, &server.Position, &server.Active, &server.Failures,
+			&server.LastError, &server.LatencyMS, &lastChecked, &lastOK); err != nil {
+			return nil, err
+		}
+		url, err := d.box.open(server.URL)
+		if err != nil {
+			return nil, fmt.Errorf("source %d server: %w", sourceID, err)
+		}
+		server.URL = url
+		if lastChecked.Valid {
+			server.LastChecked = &lastChecked.Time
+		}
+		if lastOK.Valid {
+			server.LastOK = &lastOK.Time
+		}
+		servers = append(servers, server)
+	}
+	return servers, rows.Err()
+}
+
+// SetActiveServer kaynağın aktif sunucusunu değiştirir ve değişimi kaydeder
+func (d *Database) SetActiveServer(sourceID int, url string) error {
+	rowID, err := d.serverRowID(sourceID, url)
+	if err != nil || rowID == 0 {
+		return err
+	}
+	if _, err := d.db.Exec("UPDATE source_servers SET active = (rowid = ?) WHERE source_id = ?", rowID, sourceID); err != nil {
+		return err
+	}
+	return d.addServerEvent(sourceID, url, ServerEventFailover, "")
+}
+
+// RecordServerFailure sunucunun bir isteğe cevap veremediğini kaydeder
+func (d *Database) RecordServerFailure(sourceID int, url, message string) error {
+	rowID, err := d.serverRowID(sourceID, url)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec("UPDATE source_servers SET failures = failures + 1, last_error = ?, last_checked = ? WHERE rowid = ?",
+		message, time.Now(), rowID)
+	if err != nil {
+		return err
+	}
+	return d.addServerEvent(sourceID, url, ServerEventFailure, message)
+}
+
+// RecordServerSuccess sunucunun sağlıklı cevap verdiğini kaydeder. Önceden
+// hata veren bir sunucu için toparlanma olayı eklenir.
+func (d *Database) RecordServerSuccess(sourceID int, url string, latency time.Duration) error {
+	rowID, err := d.serverRowID(sourceID, url)
+	if err != nil || rowID == 0 {
+		return err
+	}
+	var failures int
+	if err := d.db.QueryRow("SELECT failures FROM source_servers WHERE rowid = ?", rowID).Scan(&failures); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = d.db.Exec(`UPDATE source_servers SET failures = 0, last_error = '', latency_ms = ?, last_checked = ?, last_ok = ?
+		WHERE rowid = ?`, latency.Milliseconds(), now, now, rowID)
+	if err != nil {
+		return err
+	}
+	if failures > 0 {
+		return d.addServerEvent(sourceID, url, ServerEventRecovered, "")
+	}
+	return nil
+}
+
+func (d *Database) addServerEvent(sourceID int, url, event, message string) error {
+	sealed, err := d.box.seal(url)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec("INSERT INTO source_server_events (source_id, url, event, error) VALUES (?, ?, ?, ?)",
+		sourceID, sealed, event, message)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(`DELETE FROM source_server_events WHERE source_id = ?1 AND id NOT IN (
+		SELECT id FROM source_server_events WHERE source_id = ?1 ORDER BY id DESC LIMIT ?2)`, sourceID, maxServerEvents)
+	return err
+}
+
+// GetServerEvents kaynağın son sunucu olaylarını yeniden eskiye getirir
+func (d *Database) GetServerEvents(sourceID, limit int) ([]ServerEvent, error) {
+	rows, err := d.db.Query(`SELECT id, url, event, error, created_at FROM source_server_events
+		WHERE source_id = ? ORDER BY id DESC LIMIT ?`, sourceID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []ServerEvent
+	for rows.Next() {
+		var event ServerEvent
+		if err := rows.Scan(&event.ID, &event.URL, &event.Event, &event.Error, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		url, err := d.box.open(event.URL)
+		if err != nil {
+			return nil, fmt.Errorf("source %d server event: %w", sourceID, err)
+		}
+		event.URL = url
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// DeleteSource kaynağı ve ona ait kanal, kategori, favori ve rehber
+// verilerini siler
+func (d *Database) DeleteSource(id int) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		"DELETE FROM epg_channel_map WHERE channel_id IN (SELECT id FROM channels WHERE source_id = ?1) OR guide_source_id = ?1",
+		"DELETE FROM epg_programmes WHERE source_id = ?1",
+		"DELETE FROM channel_variants WHERE channel_id IN (SELECT id FROM channels WHERE source_id = ?1)",
+		"DELETE FROM channels WHERE source_id = ?1",
+		"DELETE FROM categories WHERE source_id = ?1",
+		"DELETE FROM source_servers WHERE source_id = ?1",
+		"DELETE FROM source_server_events WHERE source_id = ?1",
+		"DELETE FROM sync_runs WHERE source_id = ?1",
+		"DELETE FROM favorites WHERE source_id = ?1",
+		"DELETE FROM watch_history WHERE source_id = ?1",
+		"DELETE FROM resume_points WHERE source_id = ?1",
+		"DELETE FROM hidden_categories WHERE source_id = ?1",
+		"DELETE FROM category_locks WHERE source_id = ?1",
+		"DELETE FROM channel_locks WHERE source_id = ?1",
+		"DELETE FROM category_overrides WHERE source_id = ?1",
+		"DELETE FROM channel_overrides WHERE source_id = ?1",
+		"DELETE FROM channel_health WHERE source_id = ?1",
+		"DELETE FROM sources WHERE id = ?1",
+		"DELETE FROM " + searchTable(d.fts) + " WHERE source_id = ?1",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// MarkSourceSynced kaynağın son senkronizasyon zamanını günceller
+func (d *Database) MarkSourceSynced(id int, at time.Time) error {
+	_, err := d.db.Exec("UPDATE sources SET last_sync = ? WHERE id = ?", at, id)
+	return err
+}
+
+// SetSourceTimezone sağlayıcının bildirdiği sunucu saat dilimini kaydeder
+func (d *Database) SetSourceTimezone(id int, timezone string) error {
+	_, err := d.db.Exec("UPDATE sources SET timezone = ? WHERE id = ?", timezone, id)
+	return err
+}
@@ -2,23 +2,47 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 	_ "github.com/mattn/go-sqlite3"
 	"log"
+	"time"
 )
 
 type Database struct {
-	db *sql.DB
+	db  *sql.DB
+	box *secretBox
+	// fts arama dizininin FTS5 tablosu olup olmadığını gösterir
+	fts bool
 }
 
 type Channel struct {
-	ID         int    `json:"id"`
-	Name       string `json:"name"`
-	URL        string `json:"url"`
-	StreamType string `json:"stream_type"`
-	CategoryID int    `json:"category_id"`
-	StreamIcon string `json:"stream_icon"`
-	Rating     string `json:"rating,omitempty"`
-	Extension  string `json:"extension,omitempty"`
+	ID           int    `json:"id"`
+	SourceID     int    `json:"source_id"`
+	RemoteID     int    `json:"remote_id"`
+	Name         string `json:"name"`
+	URL          string `json:"url"`
+	StreamType   string `json:"stream_type"`
+	CategoryID   int    `json:"category_id"`
+	StreamIcon   string `json:"stream_icon"`
+	Rating       string `json:"rating,omitempty"`
+	Extension    string `json:"extension,omitempty"`
+	EPGChannelID string `json:"epg_channel_id,omitempty"`
+
+	// M3U kaynaklarından gelen oynatma ve catch-up bilgileri
+	HTTPUserAgent string `json:"http_user_agent,omitempty"`
+	HTTPReferrer  string `json:"http_referrer,omitempty"`
+	Catchup       string `json:"catchup,omitempty"`
+	CatchupDays   int    `json:"catchup_days,omitempty"`
+	CatchupSource string `json:"catchup_source,omitempty"`
+
+	// Film ve dizilerin sağlayıcıdan gelen açıklaması, türü ve oyuncuları
+	Plot  string `json:"plot,omitempty"`
+	Genre string `json:"genre,omitempty"`
+	Cast  string `json:"cast,omitempty"`
+
+	// Number sağlayıcının kanal numarasıdır, yoksa 0
+	Number  int       `json:"number,omitempty"`
+	AddedAt time.Time `json:"added_at"`
 }
 
 type XtreamSettings struct {
@@ -28,130 +52,293 @@ type XtreamSettings struct {
 }
 
 type Category struct {
-	ID   int    `json:"category_id"`
-	Name string `json:"category_name"`
-	Type string `json:"type"`
+	ID       int    `json:"category_id"`
+	SourceID int    `json:"source_id"`
+	RemoteID int    `json:"remote_id"`
+	Name     string `json:"category_name"`
+	Type     string `json:"type"`
+	// Hidden kategorinin yerel olarak ya da isteği yapan profil için gizli
+	// olduğunu belirtir
+	Hidden bool `json:"hidden,omitempty"`
+	// Locked kategorinin ebeveyn denetimiyle kilitli olduğunu belirtir
+	Locked bool `json:"locked,omitempty"`
+	// Icon yerel olarak verilen kategori logosudur
+	Icon string `json:"icon,omitempty"`
+	// ProviderName kategori yerel olarak yeniden adlandırıldıysa sağlayıcının verdiği addır
+	ProviderName string `json:"provider_name,omitempty"`
 }
 
+// categoriesTableSchema ve channelsTableSchema hem ilk kurulumda hem de eski
+// şemadan geçişte kullanılır. Kanallar ve kategoriler kaynak içindeki uzak
+// ID'leriyle tekildir; "id" yerel ve kaynaklar arası benzersizdir.
+const categoriesTableSchema = `(
+	id INTEGER PRIMARY KEY,
+	source_id INTEGER NOT NULL,
+	remote_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	type TEXT NOT NULL,
+	UNIQUE (source_id, type, remote_id)
+)`
+
+const channelsTableSchema = `(
+	id INTEGER PRIMARY KEY,
+	source_id INTEGER NOT NULL,
+	remote_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	url TEXT NOT NULL,
+	stream_type TEXT NOT NULL,
+	category_id INTEGER NOT NULL,
+	stream_icon TEXT,
+	rating TEXT,
+	last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	extension TEXT,
+	epg_channel_id TEXT,
+	http_user_agent TEXT,
+	http_referrer TEXT,
+	catchup TEXT,
+	catchup_days INTEGER,
+	catchup_source TEXT,
+	plot TEXT,
+	genre TEXT,
+	actors TEXT,
+	number INTEGER DEFAULT 0,
+	added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (source_id, stream_type, remote_id)
+)`
+
 func NewDatabase(dbPath string) (*Database, error) {
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create tables if they don't exist
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS xtream_settings (
-			id INTEGER PRIMARY KEY,
-			url TEXT NOT NULL,
-			username TEXT NOT NULL,
-			password TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);
-		CREATE TABLE IF NOT EXISTS favorites (
-			id INTEGER PRIMARY KEY,
-			name TEXT NOT NULL,
-			url TEXT NOT NULL,
-			stream_type TEXT,
-			category_id INTEGER,
-			stream_icon TEXT
-		);
-		CREATE TABLE IF NOT EXISTS categories (
-			id INTEGER PRIMARY KEY,
-			name TEXT NOT NULL,
-			type TEXT NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS channels (
-			id INTEGER PRIMARY KEY,
-			name TEXT NOT NULL,
-			url TEXT NOT NULL,
-			stream_type TEXT NOT NULL,
-			category_id INTEGER NOT NULL,
-			stream_icon TEXT,
-			rating TEXT,
-			last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			extension TEXT
-		);
-	`)
+	// Kimlik bilgileri diskte şifreli tutulur
+	key, err := LoadSecretKey(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading encryption key: %w", err)
+	}
+	box, err := newSecretBox(key.Key)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Database{db: db}, nil
+	// Paroladan türetilen anahtar eskiden tuzsuz SHA-256'ydı; o anahtarla
+	// şifrelenmiş kayıtlar migration'lardan önce yeni anahtara taşınır
+	if key.legacy != nil {
+		legacy, err := newSecretBox(key.legacy)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := upgradeLegacyKey(db, legacy, box); err != nil {
+			return nil, fmt.Errorf("re-encrypting credentials with the derived key: %w", err)
+		} else if n > 0 {
+			log.Printf("Re-encrypted %d stored credentials with the scrypt derived key", n)
+		}
+	}
+
+	if err := verifyKey(db, box); err != nil {
+		return nil, fmt.Errorf("stored credentials cannot be used with key from %s: %w", key.Origin, err)
+	}
+
+	if err := migrate(db, box); err != nil {
+		return nil, err
+	}
+
+	fts, err := initSearchIndex(db)
+	if err != nil {
+		return nil, fmt.Errorf("creating search index: %w", err)
+	}
+
+	return &Database{db: db, box: box, fts: fts}, nil
 }
 
-func (d *Database) SaveXtreamSettings(settings XtreamSettings) error {
-	// Önce tabloyu temizle (sadece en son ayarları tutmak için)
-	if _, err := d.db.Exec("DELETE FROM xtream_settings"); err != nil {
+// migrateToSources tek sağlayıcılı eski şemayı kaynak bazlı şemaya taşır.
+// Eski kanal ve kategori ID'leri yerel ID olarak korunur, böylece onlara
+// bağlı kayıtlar (EPG eşleşmeleri gibi) bozulmaz.
+func migrateToSources(tx *sql.Tx) error {
+	// Eski xtream_settings kaydını ilk kaynak olarak ekle
+	var sourceCount int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM sources").Scan(&sourceCount); err != nil {
 		return err
 	}
+	if sourceCount == 0 {
+		res, err := tx.Exec(`INSERT INTO sources (id, name, type, url, username, password)
+			SELECT 1, 'Xtream', 'xtream', url, username, password FROM xtream_settings ORDER BY id DESC LIMIT 1`)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			log.Printf("Migrated legacy Xtream settings to source 1")
+			sourceCount = 1
+		}
+	}
 
-	query := `INSERT INTO xtream_settings (url, username, password) VALUES (?, ?, ?)`
-	_, err := d.db.Exec(query, settings.URL, settings.Username, settings.Password)
-	return err
-}
+	for _, table := range []struct{ name, schema, columns, legacyColumns string }{
+		{
+			name:          "categories",
+			schema:        categoriesTableSchema,
+			columns:       "id, source_id, remote_id, name, type",
+			legacyColumns: "id, 1, id, name, type",
+		},
+		{
+			name:   "channels",
+			schema: channelsTableSchema,
+			columns: `id, source_id, remote_id, name, url, stream_type, category_id, stream_icon, rating, last_updated, extension,
+				epg_channel_id, http_user_agent, http_referrer, catchup, catchup_days, catchup_source,
+				plot, genre, actors, number, added_at`,
+			legacyColumns: `id, 1, id, name, url, stream_type, category_id, stream_icon, rating, last_updated, extension,
+				epg_channel_id, http_user_agent, http_referrer, catchup, catchup_days, catchup_source,
+				plot, genre, actors, number, added_at`,
+		},
+	} {
+		migrated, err := hasColumn(tx, table.name, "source_id")
+		if err != nil {
+			return err
+		}
+		if migrated {
+			continue
+		}
 
-func (d *Database) GetXtreamSettings() (*XtreamSettings, error) {
-	query := `SELECT url, username, password FROM xtream_settings ORDER BY id DESC LIMIT 1`
-	row := d.db.QueryRow(query)
+		var legacyRows int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM " + table.name).Scan(&legacyRows); err != nil {
+			return err
+		}
+		if legacyRows > 0 && sourceCount == 0 {
+			// Ayarı olmayan eski veriler (ör. M3U içe aktarma) için yer tutucu kaynak
+			if _, err := tx.Exec("INSERT INTO sources (id, name, type, url) VALUES (1, 'M3U', 'm3u', '')"); err != nil {
+				return err
+			}
+			sourceCount = 1
+		}
 
-	var settings XtreamSettings
-	err := row.Scan(&settings.URL, &settings.Username, &settings.Password)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, err
+		log.Printf("Migrating %s table to per-source schema (%d rows)", table.name, legacyRows)
+		statements := []string{
+			fmt.Sprintf("ALTER TABLE %s RENAME TO %s_legacy", table.name, table.name),
+			fmt.Sprintf("CREATE TABLE %s %s", table.name, table.schema),
+			fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s_legacy", table.name, table.columns, table.legacyColumns, table.name),
+			fmt.Sprintf("DROP TABLE %s_legacy", table.name),
+		}
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
 	}
 
-	return &settings, nil
+	return nil
 }
 
-func (d *Database) AddFavorite(name, url string) error {
-	query := `INSERT INTO favorites (name, url) VALUES (?, ?)`
-	_, err := d.db.Exec(query, name, url)
-	return err
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
-func (d *Database) GetFavorites() ([]Channel, error) {
-	query := `SELECT id, name, url, stream_type, category_id, stream_icon FROM favorites`
-	rows, err := d.db.Query(query)
+// hasColumn tabloda verilen kolonun olup olmadığını döndürür
+func hasColumn(db queryer, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 	defer rows.Close()
 
-	var channels []Channel
 	for rows.Next() {
-		var ch Channel
-		var streamType sql.NullString
-		var categoryID sql.NullInt64
-		var streamIcon sql.NullString
-		
-		if err := rows.Scan(&ch.ID, &ch.Name, &ch.URL, &streamType, &categoryID, &streamIcon); err != nil {
-			return nil, err
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
 		}
-		
-		ch.StreamType = streamType.String
-		ch.CategoryID = int(categoryID.Int64)
-		ch.StreamIcon = streamIcon.String
-		
-		channels = append(channels, ch)
 	}
-	return channels, rows.Err()
+	return false, rows.Err()
 }
 
-func (d *Database) RemoveFavorite(id int) error {
-	_, err := d.db.Exec("DELETE FROM favorites WHERE id = ?", id)
+// ensureColumn tabloda kolon yoksa ALTER TABLE ile ekler
+func ensureColumn(tx *sql.Tx, table, column, definition string) error {
+	exists, err := hasColumn(tx, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	log.Printf("Adding missing column %s.%s", table, column)
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	return err
 }
 
+// SaveXtreamSettings varsayılan Xtream kaynağını oluşturur ya da günceller
+func (d *Database) SaveXtreamSettings(settings XtreamSettings) error {
+	source, err := d.GetDefaultXtreamSource()
+	if err != nil {
+		return err
+	}
+
+	if source == nil {
+		_, err := d.CreateSource(Source{
+			Name:     "Xtream",
+			Type:     SourceXtream,
+			URL:      settings.URL,
+			Username: settings.Username,
+			Password: settings.Password,
+			Enabled:  true,
+		})
+		return err
+	}
+
+	// Eski ana adres yedek sunucu olarak kalmasın, yerini yenisi alsın
+	if source.URL != settings.URL {
+		servers := source.Servers[:0]
+		for _, server := range source.Servers {
+			if server != source.URL {
+				servers = append(servers, server)
+			}
+		}
+		source.Servers = servers
+	}
+	source.URL = settings.URL
+	source.Username = settings.Username
+	source.Password = settings.Password
+	return d.UpdateSource(*source)
+}
+
+// GetXtreamSettings varsayılan Xtream kaynağının bağlantı bilgilerini döndürür
+func (d *Database) GetXtreamSettings() (*XtreamSettings, error) {
+	source, err := d.GetDefaultXtreamSource()
+	if err != nil || source == nil {
+		return nil, err
+	}
+
+	return &XtreamSettings{
+		URL:      source.URL,
+		Username: source.Username,
+		Password: source.Password,
+	}, nil
+}
+
 func (d *Database) Close() error {
 	return d.db.Close()
 }
 
-func (db *Database) GetCategories(categoryType string) ([]Category, error) {
-	rows, err := db.db.Query("SELECT id, name, type FROM categories WHERE type = ?", categoryType)
+// GetCategories bir türdeki kategorileri yerel ad, logo ve sırayla getirir,
+// sourceID 0 ise tüm kaynaklardan. Yerel olarak gizlenenler Hidden ile
+// işaretlenir.
+func (db *Database) GetCategories(categoryType string, sourceID int) ([]Category, error) {
+	rows, err := db.db.Query(`SELECT c.id, c.source_id, c.remote_id, COALESCE(o.name, c.name), c.type,
+			COALESCE(o.hidden, 0), COALESCE(o.icon, ''), CASE WHEN o.name IS NULL THEN '' ELSE c.name END
+		FROM categories c
+		LEFT JOIN category_overrides o ON o.source_id = c.source_id AND o.type = c.type AND o.remote_id = c.remote_id
+		WHERE c.type = ? AND (? = 0 OR c.source_id = ?)
+		ORDER BY o.position IS NULL, o.position, c.id`,
+		categoryType, sourceID, sourceID)
 	if err != nil {
 		return nil, err
 	}
@@ -160,7 +347,8 @@ func (db *Database) GetCategories(categoryType string) ([]Category, error) {
 	var categories []Category
 	for rows.Next() {
 		var cat Category
-		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Type); err != nil {
+		if err := rows.Scan(&cat.ID, &cat.SourceID, &cat.RemoteID, &cat.Name, &cat.Type,
+			&cat.Hidden, &cat.Icon, &cat.ProviderName); err != nil {
 			return nil, err
 		}
 		categories = append(categories, cat)
@@ -168,71 +356,72 @@ func (db *Database) GetCategories(categoryType string) ([]Category, error) {
 	return categories, nil
 }
 
-// SaveChannels kanal listesini veritabanına kaydeder
-func (d *Database) SaveChannels(channels []Channel) error {
-	tx, err := d.db.Begin()
+// SaveChannels bir kaynağın kanal listesini kayıtlı listeyle karşılaştırarak
+// günceller ve yapılan değişiklikleri döndürür
+func (d *Database) SaveChannels(sourceID int, channels []Channel) (SyncDiff, error) {
+	channelImport, err := d.BeginChannelImport(sourceID)
 	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	// Önce mevcut kanalları temizle
-	if _, err := tx.Exec("DELETE FROM channels"); err != nil {
-		return err
+		return SyncDiff{}, err
 	}
 
-	// Yeni kanalları ekle
-	stmt, err := tx.Prepare("INSERT INTO channels (id, name, url, stream_type, category_id, stream_icon, rating, extension) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-
 	for _, ch := range channels {
-		_, err = stmt.Exec(ch.ID, ch.Name, ch.URL, ch.StreamType, ch.CategoryID, ch.StreamIcon, ch.Rating, ch.Extension)
-		if err != nil {
-			return err
+		if err := channelImport.Add(ch); err != nil {
+			channelImport.Rollback()
+			return SyncDiff{}, err
 		}
 	}
 
-	return tx.Commit()
+	_, diff, err := channelImport.Commit()
+	return diff, err
+}
+
+// channelColumns kanal sorgularında kullanılan ortak kolon listesi, scanChannel ile aynı sırada
+const channelColumns = `id, source_id, remote_id, name, url, stream_type, category_id, COALESCE(stream_icon, ''), COALESCE(rating, ''), COALESCE(extension, ''),
+	COALESCE(epg_channel_id, ''), COALESCE(http_user_agent, ''), COALESCE(http_referrer, ''),
+	COALESCE(catchup, ''), COALESCE(catchup_days, 0), COALESCE(catchup_source, ''),
+	COALESCE(plot, ''), COALESCE(genre, ''), COALESCE(actors, ''), COALESCE(number, 0), added_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanChannel(row rowScanner) (Channel, error) {
+	var ch Channel
+	err := row.Scan(&ch.ID, &ch.SourceID, &ch.RemoteID, &ch.Name, &ch.URL, &ch.StreamType, &ch.CategoryID, &ch.StreamIcon, &ch.Rating, &ch.Extension,
+		&ch.EPGChannelID, &ch.HTTPUserAgent, &ch.HTTPReferrer, &ch.Catchup, &ch.CatchupDays, &ch.CatchupSource,
+		&ch.Plot, &ch.Genre, &ch.Cast, &ch.Number, &ch.AddedAt)
+	return ch, err
 }
 
-// GetChannels veritabanından kanal listesini getirir
-func (db *Database) GetChannels() ([]Channel, error) {
-	rows, err := db.db.Query("SELECT id, name, url, stream_type, category_id, stream_icon, rating, extension FROM channels")
+// GetChannel tek bir kanalı ID ile getirir, bulunamazsa nil döner
+func (d *Database) GetChannel(id int) (*Channel, error) {
+	ch, err := scanChannel(d.db.QueryRow("SELECT "+channelColumns+" FROM channels WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return &ch, nil
+}
 
-	var channels []Channel
-	emptyURLCount := 0
-	
-	for rows.Next() {
-		var ch Channel
-		err := rows.Scan(&ch.ID, &ch.Name, &ch.URL, &ch.StreamType, &ch.CategoryID, &ch.StreamIcon, &ch.Rating, &ch.Extension)
-		if err != nil {
-			return nil, err
-		}
-		
-		if ch.URL == "" {
-			emptyURLCount++
-		}
-		
-		channels = append(channels, ch)
+// GetChannelByURL kayıtlı URL'si verilen kanalı döndürür. Aynı yol birden
+// fazla kaynakta varsa ilk eklenen kanal seçilir.
+func (d *Database) GetChannelByURL(url string) (*Channel, error) {
+	ch, err := scanChannel(d.db.QueryRow("SELECT "+channelColumns+" FROM channels WHERE url = ? ORDER BY id LIMIT 1", url))
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
-	
-	if emptyURLCount > 0 {
-		log.Printf("WARNING: Found %d channels with empty URL out of %d total channels", emptyURLCount, len(channels))
+	if err != nil {
+		return nil, err
 	}
-	
-	return channels, nil
+	return &ch, nil
 }
 
 // GetChannelsByType belirli bir türdeki kanalları getirir
-func (db *Database) GetChannelsByType(streamType string) ([]Channel, error) {
-	rows, err := db.db.Query("SELECT id, name, url, stream_type, category_id, stream_icon, rating, extension FROM channels WHERE stream_type = ?", streamType)
+func (db *Database) GetChannelsByType(streamType string, sourceID int) ([]Channel, error) {
+	rows, err := db.db.Query("SELECT "+channelColumns+" FROM channels WHERE stream_type = ? AND (? = 0 OR source_id = ?)",
+		streamType, sourceID, sourceID)
 	if err != nil {
 		return nil, err
 	}
@@ -242,8 +431,7 @@ func (db *Database) GetChannelsByType(streamType string) ([]Channel, error) {
 	emptyURLCount := 0
 	
 	for rows.Next() {
-		var ch Channel
-		err := rows.Scan(&ch.ID, &ch.Name, &ch.URL, &ch.StreamType, &ch.CategoryID, &ch.StreamIcon, &ch.Rating, &ch.Extension)
+		ch, err := scanChannel(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -263,74 +451,27 @@ func (db *Database) GetChannelsByType(streamType string) ([]Channel, error) {
 	return channels, nil
 }
 
-func (db *Database) GetChannelsByCategory(streamType string, categoryID int) ([]Channel, error) {
-	rows, err := db.db.Query("SELECT id, name, url, stream_type, category_id, stream_icon, rating, extension FROM channels WHERE stream_type = ? AND category_id = ?", streamType, categoryID)
+// SaveCategories bir kaynağın verilen türdeki kategorilerini günceller ve
+// uzak kategori ID'lerinden yerel ID'lere eşlemeyi döndürür. Kayıtlı
+// kategoriler yerel ID'lerini korur.
+func (db *Database) SaveCategories(sourceID int, categoryType string, categories []Category) (map[int]int, error) {
+	tx, err := db.db.Begin()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var channels []Channel
-	emptyURLCount := 0
-	
-	for rows.Next() {
-		var ch Channel
-		err := rows.Scan(&ch.ID, &ch.Name, &ch.URL, &ch.StreamType, &ch.CategoryID, &ch.StreamIcon, &ch.Rating, &ch.Extension)
-		if err != nil {
-			return nil, err
-		}
-		
-		if ch.URL == "" {
-			emptyURLCount++
-			log.Printf("WARNING: Empty URL for channel '%s' (ID: %d, Type: %s, Category: %d)", 
-				ch.Name, ch.ID, streamType, categoryID)
-		}
-		
-		channels = append(channels, ch)
-	}
-
-	log.Printf("Channels: %v", len(channels))
-	
-	if emptyURLCount > 0 {
-		log.Printf("WARNING: Found %d %s channels in category %d with empty URL out of %d total", 
-			emptyURLCount, streamType, categoryID, len(channels))
-	}
-	
-	return channels, nil
-}
-
-// SaveCategories kategorileri veritabanına kaydeder
-func (db *Database) SaveCategories(categories []Category) error {
-	if len(categories) == 0 {
-		return nil
-	}
-
-	// Sadece aynı tipteki kategorileri temizle
-	_, err := db.db.Exec("DELETE FROM categories WHERE type = ?", categories[0].Type)
-	if err != nil {
-		return err
-	}
+	defer tx.Rollback()
 
-	// Yeni kategorileri ekle
-	tx, err := db.db.Begin()
+	ids, _, err := upsertCategories(tx, sourceID, categoryType, categories)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	stmt, err := tx.Prepare("INSERT INTO categories (id, name, type) VALUES (?, ?, ?)")
-	if err != nil {
-		tx.Rollback()
-		return err
+	// Kategori adları arama dizininde de yer alır, ülke önekleri de
+	// kanal sürümlerini gruplar
+	if _, err := refreshSearchIndex(tx, db.fts, sourceID); err != nil {
+		return nil, err
 	}
-	defer stmt.Close()
-
-	for _, cat := range categories {
-		_, err = stmt.Exec(cat.ID, cat.Name, cat.Type)
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
+	if _, err := refreshChannelVariants(tx, sourceID); err != nil {
+		return nil, err
 	}
-
-	return tx.Commit()
-} 
\ No newline at end of file
+	return ids, tx.Commit()
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Senkronizasyon çalışma türleri
+const (
+	SyncRunChannels = "channels"
+	SyncRunEPG      = "epg"
+)
+
+// Senkronizasyon çalışma sonuçları
+const (
+	SyncRunCompleted = "completed"
+	SyncRunFailed    = "failed"
+	SyncRunCancelled = "cancelled"
+	SyncRunSkipped   = "skipped"
+)
+
+// maxSyncRuns kaynak başına saklanan çalışma kaydı sayısıdır
+const maxSyncRuns = 500
+
+// SyncRun bir kanal senkronizasyonunun ya da rehber yenilemesinin
+// geçmiş kaydıdır
+type SyncRun struct {
+	ID         int       `json:"id"`
+	SourceID   int       `json:"source_id"`
+	Kind       string    `json:"kind"`
+	Trigger    string    `json:"trigger"`
+	Status     string    `json:"status"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMS int64     `json:"duration_ms"`
+	Categories int       `json:"categories"`
+	Channels   int       `json:"channels"`
+	Programmes int       `json:"programmes"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// AddSyncRun çalışma kaydını ekler ve kaynağın en eski kayıtlarını siler
+func (d *Database) AddSyncRun(run SyncRun) error {
+	_, err := d.db.Exec(`INSERT INTO sync_runs (source_id, kind, triggered_by, status, started_at, duration_ms, categories, channels, programmes, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.SourceID, run.Kind, run.Trigger, run.Status, run.StartedAt, run.DurationMS,
+		run.Categories, run.Channels, run.Programmes, run.Error)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(`DELETE FROM sync_runs WHERE source_id = ?1 AND id NOT IN (
+		SELECT id FROM sync_runs WHERE source_id = ?1 ORDER BY id DESC LIMIT ?2)`, run.SourceID, maxSyncRuns)
+	return err
+}
+
+const syncRunColumns = `id, source_id, kind, triggered_by, status, started_at, duration_ms, categories, channels, programmes, error`
+
+func scanSyncRun(row rowScanner) (SyncRun, error) {
+	var run SyncRun
+	err := row.Scan(&run.ID, &run.SourceID, &run.Kind, &run.Trigger, &run.Status, &run.StartedAt, &run.DurationMS,
+		&run.Categories, &run.Channels, &run.Programmes, &run.Error)
+	return run, err
+}
+
+// GetSyncRuns en yeni çalışma kayıtlarını döndürür. sourceID 0 ise tüm
+// kaynaklar, kind boşsa tüm türler listelenir.
+func (d *Database) GetSyncRuns(sourceID int, kind string, limit int) ([]SyncRun, error) {
+	rows, err := d.db.Query(`SELECT `+syncRunColumns+` FROM sync_runs
+		WHERE (?1 = 0 OR source_id = ?1) AND (?2 = '' OR kind = ?2)
+		ORDER BY id DESC LIMIT ?3`, sourceID, kind, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []SyncRun
+	for rows.Next() {
+		run, err := scanSyncRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// LastSyncRun kaynağın verilen türdeki son çalışmasını döndürür. skipped
+// false ise atlanan çalışmalar yok sayılır. Kayıt yoksa nil döner.
+func (d *Database) LastSyncRun(sourceID int, kind string, skipped bool) (*SyncRun, error) {
+	run, err := scanSyncRun(d.db.QueryRow(`SELECT `+syncRunColumns+` FROM sync_runs
+		WHERE source_id = ? AND kind = ? AND (? OR status != ?)
+		ORDER BY id DESC LIMIT 1`, sourceID, kind, skipped, SyncRunSkipped))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
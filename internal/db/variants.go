@@ -0,0 +1,120 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"remote-iptv/internal/channelname"
+)
+
+// Sağlayıcılar aynı canlı kanalı farklı kalite ve yedeklerle birden fazla
+// kez listeler ("TRT 1 HD", "TR: TRT 1 FHD", "TRT 1 (Backup)"). Senkronizasyonda
+// kanal adları channelname.Parse ile ayrıştırılır ve aynı mantıksal kanalın
+// sürümleri channel_variants tablosunda ortak bir grup anahtarıyla tutulur.
+// Gruplar kaynaklar arasında da geçerlidir; bir sağlayıcıdaki kanal
+// açılamazsa diğerindeki sürüme geçilebilir.
+
+// ChannelVariant bir kanalın grup içindeki sürümüdür
+type ChannelVariant struct {
+	Channel
+	BaseName string `json:"base_name"`
+	Country  string `json:"country,omitempty"`
+	Quality  string `json:"quality,omitempty"`
+	Backup   bool   `json:"backup"`
+}
+
+// refreshChannelVariants kaynağın (sourceID 0 ise tüm kaynakların) canlı
+// kanallarının sürüm kayıtlarını yeniden yazar. Adında ülke öneki olmayan
+// kanallar kategorilerinin önekini ("TR | Ulusal") alır.
+func refreshChannelVariants(tx *sql.Tx, sourceID int) (int, error) {
+	if _, err := tx.Exec(`DELETE FROM channel_variants WHERE channel_id NOT IN (SELECT id FROM channels)
+		OR channel_id IN (SELECT id FROM channels WHERE ?1 = 0 OR source_id = ?1)`, sourceID); err != nil {
+		return 0, err
+	}
+
+	insert, err := tx.Prepare(`INSERT INTO channel_variants
+		(channel_id, group_key, base_name, country, quality, quality_rank, backup) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer insert.Close()
+
+	rows, err := tx.Query(`SELECT c.id, c.name, COALESCE(cat.name, '')
+		FROM channels c LEFT JOIN categories cat ON cat.id = c.category_id
+		WHERE c.stream_type = 'live' AND (?1 = 0 OR c.source_id = ?1)`, sourceID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var id int
+		var name, category string
+		if err := rows.Scan(&id, &name, &category); err != nil {
+			return n, err
+		}
+		info := channelname.Parse(name)
+		if info.Country == "" {
+			info.Country = channelname.Parse(category).Country
+		}
+		_, err := insert.Exec(id, info.Key(), info.Base, info.Country, info.Quality,
+			channelname.QualityRank(info.Quality), info.Backup)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// variantOrder grup içindeki sürümlerin tercih sırasıdır: sağlık
+// yoklamasında ölü bulunanlar ve yedekler en sona kalır, tercih edilen
+// kaliteye en yakın sürüm öne geçer, eşitlikte yüksek kalite seçilir.
+// Tercih boşsa en yüksek kalite önce gelir. Kanal tablosunun takma adı
+// "channels", sürüm tablosununki "v" olmalıdır.
+func variantOrder(preferred string) string {
+	order := deadChannel + ", v.backup"
+	if rank := channelname.QualityRank(preferred); rank > 0 {
+		order += fmt.Sprintf(", ABS(v.quality_rank - %d)", rank)
+	}
+	return order + ", v.quality_rank DESC, channels.id"
+}
+
+// ChannelVariants kanalın grubundaki tüm sürümleri (kanalın kendisi dahil)
+// tercih edilen kaliteye göre sıralı döndürür. Adlar ve logolar yerel
+// ayarlarla döner. Canlı olmayan kanallar yalnızca kendilerinden oluşur.
+func (d *Database) ChannelVariants(channelID int, preferred string) ([]ChannelVariant, error) {
+	var exists bool
+	if err := d.db.QueryRow("SELECT EXISTS (SELECT 1 FROM channels WHERE id = ?)", channelID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrChannelNotFound
+	}
+
+	rows, err := d.db.Query(`SELECT `+channelColumns+`, COALESCE(v.base_name, name), COALESCE(v.country, ''),
+			COALESCE(v.quality, ''), COALESCE(v.backup, 0)
+		FROM `+localChannels+` channels
+		LEFT JOIN channel_variants v ON v.channel_id = channels.id
+		WHERE channels.id = ?1 OR v.group_key = (SELECT group_key FROM channel_variants WHERE channel_id = ?1)
+		ORDER BY `+variantOrder(preferred), channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []ChannelVariant{}
+	for rows.Next() {
+		var v ChannelVariant
+		ch := &v.Channel
+		err := rows.Scan(&ch.ID, &ch.SourceID, &ch.RemoteID, &ch.Name, &ch.URL, &ch.StreamType, &ch.CategoryID, &ch.StreamIcon, &ch.Rating, &ch.Extension,
+			&ch.EPGChannelID, &ch.HTTPUserAgent, &ch.HTTPReferrer, &ch.Catchup, &ch.CatchupDays, &ch.CatchupSource,
+			&ch.Plot, &ch.Genre, &ch.Cast, &ch.Number, &ch.AddedAt, &v.BaseName, &v.Country, &v.Quality, &v.Backup)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+	return variants, rows.Err()
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// maxWatchHistory profil başına saklanan en fazla geçmiş kaydıdır
+const maxWatchHistory = 200
+
+// Kalınan yer kaydı yalnızca anlamlı bir noktadaysa tutulur: ilk saniyeler
+// ve son yüzde 5 izlenmemiş ya da bitmiş sayılır
+const (
+	minResumePosition = 30.0
+	resumeFinishedAt  = 0.95
+)
+
+// WatchHistoryEntry profilin izlediği bir içeriktir. Her içerik geçmişte bir
+// kez bulunur, son izlenme zamanına göre sıralanır. Ad ve logo izlenme
+// anındaki kopyadır; kanal hâlâ listedeyse ChannelID yerel kanal ID'sidir.
+// Film ve dizilerde kalınan yer varsa Position ve Duration saniye cinsindendir.
+type WatchHistoryEntry struct {
+	ID         int       `json:"id"`
+	ChannelID  int       `json:"channel_id"`
+	SourceID   int       `json:"source_id"`
+	StreamType string    `json:"stream_type"`
+	RemoteID   int       `json:"remote_id"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	StreamIcon string    `json:"stream_icon"`
+	WatchedAt  time.Time `json:"watched_at"`
+	Position   float64   `json:"position,omitempty"`
+	Duration   float64   `json:"duration,omitempty"`
+}
+
+// AddWatchHistory içeriği profilin geçmişinin başına ekler
+func (d *Database) AddWatchHistory(profileID int, ch Channel) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"DELETE FROM watch_history WHERE profile_id = ? AND source_id = ? AND stream_type = ? AND remote_id = ?",
+			[]interface{}{profileID, ch.SourceID, ch.StreamType, ch.RemoteID}},
+		{`INSERT INTO watch_history (profile_id, source_id, stream_type, remote_id, name, url, stream_icon, watched_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			[]interface{}{profileID, ch.SourceID, ch.StreamType, ch.RemoteID, ch.Name, ch.URL, ch.StreamIcon, time.Now()}},
+		{`DELETE FROM watch_history WHERE profile_id = ?1 AND id NOT IN (
+			SELECT id FROM watch_history WHERE profile_id = ?1 ORDER BY watched_at DESC, id DESC LIMIT ?2)`,
+			[]interface{}{profileID, maxWatchHistory}},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt.query, stmt.args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetWatchHistory profilin son izlediklerini en yeniden başlayarak döndürür
+func (d *Database) GetWatchHistory(profileID, limit int) ([]WatchHistoryEntry, error) {
+	rows, err := d.db.Query(`SELECT w.id, COALESCE(c.id, 0), w.source_id, w.stream_type, w.remote_id, COALESCE(c.name, w.name),
+			COALESCE(c.url, w.url), COALESCE(NULLIF(c.stream_icon, ''), w.stream_icon), w.watched_at,
+			COALESCE(r.position, 0), COALESCE(r.duration, 0)
+		FROM watch_history w
+		LEFT JOIN `+localChannels+` c ON c.source_id = w.source_id AND c.stream_type = w.stream_type AND c.remote_id = w.remote_id
+		LEFT JOIN resume_points r ON r.profile_id = w.profile_id AND r.source_id = w.source_id
+			AND r.stream_type = w.stream_type AND r.remote_id = w.remote_id
+		WHERE w.profile_id = ?
+		ORDER BY w.watched_at DESC, w.id DESC LIMIT ?`, profileID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []WatchHistoryEntry{}
+	for rows.Next() {
+		var e WatchHistoryEntry
+		if err := rows.Scan(&e.ID, &e.ChannelID, &e.SourceID, &e.StreamType, &e.RemoteID, &e.Name,
+			&e.URL, &e.StreamIcon, &e.WatchedAt, &e.Position, &e.Duration); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// ClearWatchHistory profilin geçmişini siler
+func (d *Database) ClearWatchHistory(profileID int) error {
+	_, err := d.db.Exec("DELETE FROM watch_history WHERE profile_id = ?", profileID)
+	return err
+}
+
+// SaveResumePoint film ya da dizide kalınan yeri kaydeder. İçerik henüz
+// başındaysa ya da bitmişse kayıt silinir.
+func (d *Database) SaveResumePoint(profileID int, ch Channel, position, duration float64) error {
+	if position < minResumePosition || (duration > 0 && position >= duration*resumeFinishedAt) {
+		_, err := d.db.Exec("DELETE FROM resume_points WHERE profile_id = ? AND source_id = ? AND stream_type = ? AND remote_id = ?",
+			profileID, ch.SourceID, ch.StreamType, ch.RemoteID)
+		return err
+	}
+	_, err := d.db.Exec(`INSERT INTO resume_points (profile_id, source_id, stream_type, remote_id, position, duration, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (profile_id, source_id, stream_type, remote_id) DO UPDATE SET
+			position = excluded.position, duration = excluded.duration, updated_at = excluded.updated_at`,
+		profileID, ch.SourceID, ch.StreamType, ch.RemoteID, position, duration, time.Now())
+	return err
+}
+
+// GetResumePoint içerikte kalınan yeri saniye cinsinden döndürür, kayıt
+// yoksa 0 döner
+func (d *Database) GetResumePoint(profileID int, ch Channel) (float64, error) {
+	var position float64
+	err := d.db.QueryRow("SELECT position FROM resume_points WHERE profile_id = ? AND source_id = ? AND stream_type = ? AND remote_id = ?",
+		profileID, ch.SourceID, ch.StreamType, ch.RemoteID).Scan(&position)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return position, err
+}
+
+// DeleteResumePoint kanalın kalınan yer kaydını siler
+func (d *Database) DeleteResumePoint(profileID int, ch Channel) error {
+	_, err := d.db.Exec("DELETE FROM resume_points WHERE profile_id = ? AND source_id = ? AND stream_type = ? AND remote_id = ?",
+		profileID, ch.SourceID, ch.StreamType, ch.RemoteID)
+	return err
+}
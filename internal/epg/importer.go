@@ -0,0 +1,185 @@
+package epg
+
+import (
+	"io"
+	"log"
+	"strings"
+	"unicode"
+
+	"remote-iptv/internal/db"
+)
+
+// Result summarises a guide import
+type Result struct {
+	GuideChannels  int `json:"guide_channels"`
+	MappedChannels int `json:"mapped_channels"`
+	Programmes     int `json:"programmes"`
+	Skipped        int `json:"skipped"`
+}
+
+// Importer loads XMLTV guides into the database
+type Importer struct {
+	DB *db.Database
+	// SourceID scopes the guide to one source's channels. Zero means a
+	// standalone guide that is matched against every source.
+	SourceID int
+}
+
+// Import parses r and replaces the stored guide once parsing succeeds.
+// Guide channels are matched to live channels by epg_channel_id first and by
+// normalised name when the channel has no usable EPG id.
+func (im *Importer) Import(r io.Reader) (*Result, error) {
+	channels, err := im.DB.GetChannelsByType("live", im.SourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	imp, err := im.DB.BeginEPGImport(im.SourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	guideNames := make(map[string]string) // xmltv id -> match key
+	guideIDs := make(map[string]string)   // lower-case xmltv id -> xmltv id
+	var mapped map[string]bool
+	var mapErr error
+
+	resolve := func() {
+		mapped, result.MappedChannels, mapErr = mapChannels(imp, channels, guideIDs, guideNames)
+	}
+
+	onChannel := func(ch Channel) error {
+		result.GuideChannels++
+		guideIDs[strings.ToLower(ch.ID)] = ch.ID
+		for _, name := range ch.DisplayNames {
+			if key := matchKey(name); key != "" {
+				guideNames[ch.ID] = key
+				break
+			}
+		}
+		return nil
+	}
+
+	onProgramme := func(p Programme) error {
+		// Kanallar programlardan önce gelir, eşleştirmeyi ilk programda yap
+		if mapped == nil {
+			resolve()
+			if mapErr != nil {
+				return mapErr
+			}
+		}
+		if !mapped[p.Channel] {
+			result.Skipped++
+			return nil
+		}
+		return imp.AddProgramme(db.Programme{
+			XMLTVID:     p.Channel,
+			Start:       p.Start,
+			Stop:        p.Stop,
+			Title:       p.Title,
+			Description: p.Description,
+			Category:    p.Category,
+		})
+	}
+
+	if err := Parse(r, onChannel, onProgramme); err != nil {
+		imp.Rollback()
+		return nil, err
+	}
+	if mapped == nil {
+		resolve()
+		if mapErr != nil {
+			imp.Rollback()
+			return nil, mapErr
+		}
+	}
+
+	result.Programmes = imp.Programmes()
+	if err := imp.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("EPG import finished: %d guide channels, %d mapped channels, %d programmes, %d skipped",
+		result.GuideChannels, result.MappedChannels, result.Programmes, result.Skipped)
+	return result, nil
+}
+
+// mapChannels writes the channel mapping and returns the set of xmltv ids
+// whose programmes should be stored along with the number of mapped channels.
+func mapChannels(imp *db.EPGImport, channels []db.Channel, guideIDs map[string]string, guideNames map[string]string) (map[string]bool, int, error) {
+	byName := make(map[string]string, len(guideNames))
+	for id, key := range guideNames {
+		if _, exists := byName[key]; !exists {
+			byName[key] = id
+		}
+	}
+
+	mapped := make(map[string]bool)
+	count := 0
+	for _, ch := range channels {
+		xmltvID, matchedBy := "", ""
+		if ch.EPGChannelID != "" {
+			if id, ok := guideIDs[strings.ToLower(ch.EPGChannelID)]; ok {
+				xmltvID, matchedBy = id, "epg_channel_id"
+			} else if len(guideIDs) == 0 {
+				// Kanal listesi olmayan rehberlerde id'ye güven
+				xmltvID, matchedBy = ch.EPGChannelID, "epg_channel_id"
+			}
+		}
+		if xmltvID == "" {
+			if id, ok := byName[matchKey(ch.Name)]; ok {
+				xmltvID, matchedBy = id, "name"
+			}
+		}
+		if xmltvID == "" {
+			continue
+		}
+
+		if err := imp.MapChannel(ch.ID, xmltvID, matchedBy); err != nil {
+			return nil, 0, err
+		}
+		mapped[xmltvID] = true
+		count++
+	}
+	return mapped, count, nil
+}
+
+var qualityTokens = map[string]bool{
+	"sd": true, "hd": true, "fhd": true, "uhd": true, "4k": true, "8k": true,
+	"hevc": true, "h265": true, "h264": true, "raw": true, "backup": true,
+}
+
+// matchKey reduces a channel name to a comparable key: lower-case, Turkish
+// letters folded, country prefix and quality tags removed.
+func matchKey(name string) string {
+	name = strings.ToLower(foldTurkish(name))
+
+	// "TR: TRT 1", "|UK| SPORTS" veya "[TR] TRT 1" gibi ülke öneklerini at
+	name = strings.TrimLeft(name, " |[")
+	if i := strings.IndexAny(name, ":|]"); i >= 0 && i <= 4 {
+		name = name[i+1:]
+	}
+
+	fields := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var b strings.Builder
+	for _, field := range fields {
+		if qualityTokens[field] {
+			continue
+		}
+		b.WriteString(field)
+	}
+	return b.String()
+}
+
+var turkishReplacer = strings.NewReplacer(
+	"ı", "i", "İ", "i", "ş", "s", "Ş", "s", "ğ", "g", "Ğ", "g",
+	"ü", "u", "Ü", "u", "ö", "o", "Ö", "o", "ç", "c", "Ç", "c",
+)
+
+func foldTurkish(s string) string {
+	return turkishReplacer.Replace(s)
+}
@@ -0,0 +1,85 @@
+package epg
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var httpClient = &http.Client{
+	// Full guides can be hundreds of MB, only bound the connection phase
+	Transport: &http.Transport{
+		ResponseHeaderTimeout: 60 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// Open returns a reader for an XMLTV guide given as an http(s) URL or a
+// local file path.
+func Open(source string) (io.ReadCloser, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		req, err := http.NewRequest("GET", source, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", "Tivimate/4.8.0")
+		req.Header.Set("Accept", "*/*")
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("guide server returned status code %d", resp.StatusCode)
+		}
+		return Decompress(resp.Body)
+	}
+
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	return Decompress(file)
+}
+
+// Decompress wraps r with a gzip reader when the content is gzipped.
+// Closing the result also closes r.
+func Decompress(r io.ReadCloser) (io.ReadCloser, error) {
+	buffered := bufio.NewReaderSize(r, 64*1024)
+	magic, err := buffered.Peek(2)
+	if err != nil && err != io.EOF {
+		r.Close()
+		return nil, err
+	}
+
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: gz, closers: []io.Closer{gz, r}}, nil
+	}
+	return &readCloser{Reader: buffered, closers: []io.Closer{r}}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (rc *readCloser) Close() error {
+	var firstErr error
+	for _, c := range rc.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,103 @@
+package epg
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+)
+
+// timeLayout is the XMLTV timestamp format written by Writer
+const timeLayout = "20060102150405 -0700"
+
+// Writer writes an XMLTV document. All channels must be written before
+// the programmes.
+type Writer struct {
+	w       *bufio.Writer
+	encoder *xml.Encoder
+	started bool
+}
+
+// NewWriter returns a writer that writes the document to w
+func NewWriter(w io.Writer) *Writer {
+	bw := bufio.NewWriter(w)
+	return &Writer{w: bw, encoder: xml.NewEncoder(bw)}
+}
+
+type xmlIcon struct {
+	Src string `xml:"src,attr"`
+}
+
+type xmlOutChannel struct {
+	XMLName      xml.Name `xml:"channel"`
+	ID           string   `xml:"id,attr"`
+	DisplayNames []string `xml:"display-name"`
+	Icon         *xmlIcon `xml:"icon,omitempty"`
+}
+
+type xmlOutProgramme struct {
+	XMLName     xml.Name `xml:"programme"`
+	Start       string   `xml:"start,attr"`
+	Stop        string   `xml:"stop,attr"`
+	Channel     string   `xml:"channel,attr"`
+	Title       string   `xml:"title"`
+	Description string   `xml:"desc,omitempty"`
+	Category    string   `xml:"category,omitempty"`
+}
+
+func (x *Writer) start() error {
+	if x.started {
+		return nil
+	}
+	x.started = true
+	if _, err := x.w.WriteString(xml.Header); err != nil {
+		return err
+	}
+	_, err := x.w.WriteString(`<tv generator-info-name="remote-iptv">` + "\n")
+	return err
+}
+
+// WriteChannel writes a <channel> element
+func (x *Writer) WriteChannel(ch Channel) error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	out := xmlOutChannel{ID: ch.ID, DisplayNames: ch.DisplayNames}
+	if ch.Icon != "" {
+		out.Icon = &xmlIcon{Src: ch.Icon}
+	}
+	return x.encode(out)
+}
+
+// WriteProgramme writes a <programme> element
+func (x *Writer) WriteProgramme(p Programme) error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	return x.encode(xmlOutProgramme{
+		Start:       p.Start.Format(timeLayout),
+		Stop:        p.Stop.Format(timeLayout),
+		Channel:     p.Channel,
+		Title:       p.Title,
+		Description: p.Description,
+		Category:    p.Category,
+	})
+}
+
+func (x *Writer) encode(v interface{}) error {
+	if err := x.encoder.Encode(v); err != nil {
+		return err
+	}
+	_, err := x.w.WriteString("\n")
+	return err
+}
+
+// Close ends the document and flushes it
+func (x *Writer) Close() error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	if _, err := x.w.WriteString("</tv>\n"); err != nil {
+		return err
+	}
+	return x.w.Flush()
+}
@@ -0,0 +1,151 @@
+package epg
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Channel is a <channel> element of an XMLTV document
+type Channel struct {
+	ID           string
+	DisplayNames []string
+	Icon         string
+}
+
+// Programme is a <programme> element of an XMLTV document
+type Programme struct {
+	Channel     string
+	Start       time.Time
+	Stop        time.Time
+	Title       string
+	Description string
+	Category    string
+}
+
+type xmlText struct {
+	Lang  string `xml:"lang,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlChannel struct {
+	ID           string    `xml:"id,attr"`
+	DisplayNames []xmlText `xml:"display-name"`
+	Icon         struct {
+		Src string `xml:"src,attr"`
+	} `xml:"icon"`
+}
+
+type xmlProgramme struct {
+	Start      string    `xml:"start,attr"`
+	Stop       string    `xml:"stop,attr"`
+	Channel    string    `xml:"channel,attr"`
+	Titles     []xmlText `xml:"title"`
+	Descs      []xmlText `xml:"desc"`
+	Categories []xmlText `xml:"category"`
+}
+
+// Parse reads an XMLTV document element by element and calls the callbacks
+// for every channel and programme. Only one element is decoded at a time, so
+// memory use does not grow with the size of the guide.
+func Parse(r io.Reader, onChannel func(Channel) error, onProgramme func(Programme) error) error {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// Most guides are UTF-8 even when they declare otherwise
+		return input, nil
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("xmltv: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "channel":
+			var ch xmlChannel
+			if err := decoder.DecodeElement(&ch, &start); err != nil {
+				return fmt.Errorf("xmltv: decoding channel: %w", err)
+			}
+			if ch.ID == "" || onChannel == nil {
+				continue
+			}
+			channel := Channel{ID: ch.ID, Icon: ch.Icon.Src}
+			for _, name := range ch.DisplayNames {
+				if value := strings.TrimSpace(name.Value); value != "" {
+					channel.DisplayNames = append(channel.DisplayNames, value)
+				}
+			}
+			if err := onChannel(channel); err != nil {
+				return err
+			}
+		case "programme":
+			var p xmlProgramme
+			if err := decoder.DecodeElement(&p, &start); err != nil {
+				return fmt.Errorf("xmltv: decoding programme: %w", err)
+			}
+			if p.Channel == "" || onProgramme == nil {
+				continue
+			}
+			startTime, err := ParseTime(p.Start)
+			if err != nil {
+				continue
+			}
+			stopTime, err := ParseTime(p.Stop)
+			if err != nil {
+				// Bitiş zamanı olmayan programları bir saatlik kabul et
+				stopTime = startTime.Add(time.Hour)
+			}
+			programme := Programme{
+				Channel:     p.Channel,
+				Start:       startTime,
+				Stop:        stopTime,
+				Title:       firstText(p.Titles),
+				Description: firstText(p.Descs),
+				Category:    firstText(p.Categories),
+			}
+			if err := onProgramme(programme); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ParseTime parses XMLTV timestamps such as "20240101203000 +0300".
+// Timestamps without a zone offset are treated as UTC.
+func ParseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	layouts := []string{
+		"20060102150405 -0700",
+		"20060102150405-0700",
+		"20060102150405",
+		"200601021504 -0700",
+		"200601021504",
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid xmltv time %q", value)
+}
+
+func firstText(values []xmlText) string {
+	for _, v := range values {
+		if text := strings.TrimSpace(v.Value); text != "" {
+			return text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,372 @@
+// Package imagecache downloads remote images (channel logos, posters) on
+// demand, keeps them on disk within a size limit and serves resized
+// variants. Images that cannot be fetched are remembered for a while, so a
+// broken URL is not requested again on every page view.
+package imagecache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxImageSize bounds a downloaded image
+	maxImageSize = 8 << 20
+	// fetchTimeout bounds a download
+	fetchTimeout = 15 * time.Second
+	// failureTTL is how long a broken image is not requested again
+	failureTTL = time.Hour
+	// touchInterval limits how often access times are written
+	touchInterval = time.Hour
+	// originalDir holds the downloaded images, variants live next to it in
+	// one directory per width
+	originalDir = "original"
+)
+
+// Widths are the widths resized variants are generated in. Requested widths
+// are rounded up to the next one, so the number of variants stays bounded.
+var Widths = []int{64, 128, 256, 512}
+
+// ErrUnavailable is returned for images that cannot be downloaded or are
+// not images
+var ErrUnavailable = errors.New("image unavailable")
+
+// extensions maps sniffed content types to file extensions. SVG is not
+// accepted: it can carry scripts and would be served from the app's origin.
+var extensions = map[string]string{
+	"image/png":                ".png",
+	"image/jpeg":               ".jpg",
+	"image/gif":                ".gif",
+	"image/webp":               ".webp",
+	"image/bmp":                ".bmp",
+	"image/x-icon":             ".ico",
+	"image/vnd.microsoft.icon": ".ico",
+}
+
+// Image is a cached image file
+type Image struct {
+	Path        string
+	ContentType string
+	ModTime     time.Time
+}
+
+// Cache is an on-disk image cache
+type Cache struct {
+	dir      string
+	maxBytes int64
+	client   *http.Client
+
+	mu       sync.Mutex
+	size     int64
+	evicting bool
+	failed   map[string]time.Time
+	keys     map[string]*keyLock
+}
+
+// keyLock serializes downloads and resizes of one image
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// New opens the cache in dir, creating it if needed. The files in it are
+// kept below maxBytes, least recently used images are removed first.
+func New(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(filepath.Join(dir, originalDir), 0o755); err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		client:   &http.Client{Timeout: fetchTimeout},
+		failed:   make(map[string]time.Time),
+		keys:     make(map[string]*keyLock),
+	}
+	files, err := c.files()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		c.size += f.size
+	}
+	return c, nil
+}
+
+// Size returns the number of bytes the cache uses on disk
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Get returns the image at url, downloading it if it is not cached yet.
+// A positive width returns a variant scaled down to the next of Widths;
+// images that are narrower already or cannot be decoded (WebP, icons) are
+// returned as they are.
+func (c *Cache) Get(ctx context.Context, url string, width int) (*Image, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, ErrUnavailable
+	}
+	key := cacheKey(url)
+	unlock := c.lock(key)
+	defer unlock()
+
+	original, err := c.original(ctx, key, url)
+	if err != nil || width <= 0 {
+		return original, err
+	}
+	return c.variant(key, original, snapWidth(width))
+}
+
+// Cached reports whether the original of url is on disk
+func (c *Cache) Cached(url string) bool {
+	_, err := c.find(originalDir, cacheKey(url))
+	return err == nil
+}
+
+func cacheKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:16])
+}
+
+// snapWidth rounds a width up to the next variant width
+func snapWidth(width int) int {
+	for _, w := range Widths {
+		if width <= w {
+			return w
+		}
+	}
+	return Widths[len(Widths)-1]
+}
+
+func (c *Cache) lock(key string) func() {
+	c.mu.Lock()
+	l := c.keys[key]
+	if l == nil {
+		l = &keyLock{}
+		c.keys[key] = l
+	}
+	l.refs++
+	c.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		c.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(c.keys, key)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// original returns the downloaded image, fetching it if needed
+func (c *Cache) original(ctx context.Context, key, url string) (*Image, error) {
+	if img, err := c.find(originalDir, key); err == nil {
+		return img, nil
+	}
+
+	c.mu.Lock()
+	failedAt, failed := c.failed[url]
+	c.mu.Unlock()
+	if failed && time.Since(failedAt) < failureTTL {
+		return nil, ErrUnavailable
+	}
+
+	data, contentType, err := c.download(ctx, url)
+	if err != nil {
+		// A cancelled request says nothing about the image
+		if ctx.Err() == nil {
+			c.mu.Lock()
+			c.failed[url] = time.Now()
+			c.mu.Unlock()
+		}
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	path := filepath.Join(c.dir, originalDir, key+extensions[contentType])
+	if err := c.write(path, data); err != nil {
+		return nil, err
+	}
+	return &Image{Path: path, ContentType: contentType, ModTime: time.Now()}, nil
+}
+
+func (c *Cache) download(ctx context.Context, url string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("server returned status code %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxImageSize {
+		return nil, "", fmt.Errorf("image is larger than %d bytes", maxImageSize)
+	}
+	contentType := sniff(data)
+	if contentType == "" {
+		return nil, "", errors.New("not an image")
+	}
+	return data, contentType, nil
+}
+
+// sniff returns the content type of image data, "" if it is not an image
+// of a supported type
+func sniff(data []byte) string {
+	contentType := http.DetectContentType(data)
+	if _, ok := extensions[contentType]; ok {
+		return contentType
+	}
+	return ""
+}
+
+// find returns the cached file of key in dir and marks it as used
+func (c *Cache) find(dir, key string) (*Image, error) {
+	matches, err := filepath.Glob(filepath.Join(c.dir, dir, key+".*"))
+	if err != nil || len(matches) == 0 {
+		return nil, os.ErrNotExist
+	}
+	info, err := os.Stat(matches[0])
+	if err != nil {
+		return nil, err
+	}
+	contentType := ""
+	for ct, ext := range extensions {
+		if ext == filepath.Ext(matches[0]) {
+			contentType = ct
+			break
+		}
+	}
+	// Files of types that are no longer accepted (SVG cached by older
+	// versions) are dropped and fetched again
+	if contentType == "" {
+		if os.Remove(matches[0]) == nil {
+			c.mu.Lock()
+			c.size -= info.Size()
+			c.mu.Unlock()
+		}
+		return nil, os.ErrNotExist
+	}
+	if time.Since(info.ModTime()) > touchInterval {
+		now := time.Now()
+		os.Chtimes(matches[0], now, now)
+	}
+	return &Image{Path: matches[0], ContentType: contentType, ModTime: info.ModTime()}, nil
+}
+
+// write stores a file atomically and evicts old files if the cache grew
+// over its limit
+func (c *Cache) write(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	c.size += int64(len(data))
+	evict := c.maxBytes > 0 && c.size > c.maxBytes && !c.evicting
+	if evict {
+		c.evicting = true
+	}
+	c.mu.Unlock()
+	if evict {
+		go c.evict()
+	}
+	return nil
+}
+
+type cachedFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (c *Cache) files() ([]cachedFile, error) {
+	var files []cachedFile
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, cachedFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	return files, err
+}
+
+// evict removes the least recently used files until the cache uses at most
+// 90% of its limit
+func (c *Cache) evict() {
+	defer func() {
+		c.mu.Lock()
+		c.evicting = false
+		c.mu.Unlock()
+	}()
+
+	files, err := c.files()
+	if err != nil {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	target := c.maxBytes / 10 * 9
+	for _, f := range files {
+		if total <= target {
+			break
+		}
+		if os.Remove(f.path) == nil {
+			total -= f.size
+		}
+	}
+
+	c.mu.Lock()
+	c.size = total
+	c.mu.Unlock()
+}
@@ -0,0 +1,54 @@
+package imagecache
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"strings"
+	"unicode"
+
+	"remote-iptv/internal/channelname"
+)
+
+// PlaceholderType is the content type of Placeholder images
+const PlaceholderType = "image/svg+xml"
+
+// palette holds the background colours of placeholders
+var palette = []string{
+	"#1e88e5", "#43a047", "#e53935", "#8e24aa", "#fb8c00", "#00897b",
+	"#3949ab", "#6d4c41", "#d81b60", "#546e7a", "#7cb342", "#5e35b1",
+}
+
+// Placeholder returns a square SVG image with the initials of name on a
+// colour derived from the name, so a channel keeps the same placeholder
+func Placeholder(name string) []byte {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	colour := palette[h.Sum32()%uint32(len(palette))]
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="256" height="256" viewBox="0 0 100 100">`+
+		`<rect width="100" height="100" rx="12" fill="%s"/>`+
+		`<text x="50" y="50" dy=".35em" text-anchor="middle" font-family="sans-serif" font-size="40" font-weight="bold" fill="#fff">%s</text>`+
+		`</svg>`, colour, html.EscapeString(initials(name))))
+}
+
+// initials returns the first letters of the first two words of a channel
+// name, without country prefix and quality tag: "TR: TRT 1 HD" gives "T1"
+func initials(name string) string {
+	base := channelname.Parse(name).Base
+	if base == "" {
+		base = name
+	}
+	var letters []rune
+	for _, word := range strings.FieldsFunc(base, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		letters = append(letters, unicode.ToUpper([]rune(word)[0]))
+		if len(letters) == 2 {
+			break
+		}
+	}
+	if len(letters) == 0 {
+		return "?"
+	}
+	return string(letters)
+}
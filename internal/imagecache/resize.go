@@ -0,0 +1,94 @@
+package imagecache
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// variant returns original scaled down to width, creating it if needed
+func (c *Cache) variant(key string, original *Image, width int) (*Image, error) {
+	variantDir := "w" + strconv.Itoa(width)
+	if img, err := c.find(variantDir, key); err == nil {
+		return img, nil
+	}
+
+	f, err := os.Open(original.Path)
+	if err != nil {
+		return nil, err
+	}
+	src, format, err := image.Decode(f)
+	f.Close()
+	if err != nil || src.Bounds().Dx() <= width {
+		// Formats the standard library cannot decode are served as they are
+		return original, nil
+	}
+
+	dst := resize(src, width)
+	var buf bytes.Buffer
+	ext, contentType := ".png", "image/png"
+	if format == "jpeg" {
+		ext, contentType = ".jpg", "image/jpeg"
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(c.dir, variantDir, key+ext)
+	if err := c.write(path, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return &Image{Path: path, ContentType: contentType, ModTime: original.ModTime}, nil
+}
+
+// resize scales src down to width keeping its aspect ratio. Every target
+// pixel is the average of the source pixels it covers, which is enough for
+// logos and posters and needs no dependency.
+func resize(src image.Image, width int) *image.NRGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	height := sh * width / sw
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := b.Min.Y+y*sh/height, b.Min.Y+(y+1)*sh/height
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := b.Min.X+x*sw/width, b.Min.X+(x+1)*sw/width
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(pr), g+uint64(pg), bl+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			if a == 0 {
+				continue
+			}
+			// RGBA returns premultiplied values, NRGBA stores them straight
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r * 0xffff / a >> 8),
+				G: uint8(g * 0xffff / a >> 8),
+				B: uint8(bl * 0xffff / a >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,66 @@
+package m3u
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CatchupURL builds the archive URL of a playlist entry for the programme
+// starting at start. mode and source are the entry's catchup and
+// catchup-source attributes:
+//
+//	default  source is the complete archive URL template
+//	append   source is appended to the live URL
+//	shift    utc/lutc query parameters are appended to the live URL
+//
+// Templates may use {utc}, {start}, {lutc}, {now}, {utcend}, {end},
+// {duration}, {offset} and {Y} {m} {d} {H} {M} {S} (also written as ${...}).
+func CatchupURL(streamURL, mode, source string, start time.Time, duration time.Duration) (string, error) {
+	switch strings.ToLower(mode) {
+	case "default":
+		if source == "" {
+			return "", fmt.Errorf("catchup-source is required for default catchup")
+		}
+		return expandCatchup(source, start, duration), nil
+	case "append":
+		if source == "" {
+			return "", fmt.Errorf("catchup-source is required for append catchup")
+		}
+		return streamURL + expandCatchup(source, start, duration), nil
+	case "shift", "timeshift":
+		separator := "?"
+		if strings.Contains(streamURL, "?") {
+			separator = "&"
+		}
+		return streamURL + separator + expandCatchup("utc={utc}&lutc={lutc}", start, duration), nil
+	default:
+		return "", fmt.Errorf("unsupported catchup type %q", mode)
+	}
+}
+
+func expandCatchup(template string, start time.Time, duration time.Duration) string {
+	now := time.Now()
+	end := start.Add(duration)
+	utc := start.UTC()
+	unix := func(t time.Time) string { return strconv.FormatInt(t.Unix(), 10) }
+
+	template = strings.ReplaceAll(template, "${", "{")
+	return strings.NewReplacer(
+		"{utc}", unix(start),
+		"{start}", unix(start),
+		"{lutc}", unix(now),
+		"{now}", unix(now),
+		"{utcend}", unix(end),
+		"{end}", unix(end),
+		"{duration}", strconv.Itoa(int(duration.Seconds())),
+		"{offset}", strconv.Itoa(int(now.Sub(start).Seconds())),
+		"{Y}", utc.Format("2006"),
+		"{m}", utc.Format("01"),
+		"{d}", utc.Format("02"),
+		"{H}", utc.Format("15"),
+		"{M}", utc.Format("04"),
+		"{S}", utc.Format("05"),
+	).Replace(template)
+}
@@ -0,0 +1,183 @@
+package m3u
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Entry is a single stream of an M3U / M3U Plus playlist
+type Entry struct {
+	Name          string            `json:"name"`
+	URL           string            `json:"url"`
+	Duration      float64           `json:"duration"`
+	TvgID         string            `json:"tvg_id,omitempty"`
+	TvgName       string            `json:"tvg_name,omitempty"`
+	TvgLogo       string            `json:"tvg_logo,omitempty"`
+	GroupTitle    string            `json:"group_title,omitempty"`
+	Catchup       string            `json:"catchup,omitempty"`
+	CatchupDays   int               `json:"catchup_days,omitempty"`
+	CatchupSource string            `json:"catchup_source,omitempty"`
+	ChannelNumber int               `json:"channel_number,omitempty"`
+	UserAgent     string            `json:"user_agent,omitempty"`
+	Referrer      string            `json:"referrer,omitempty"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+}
+
+// Parse reads an M3U playlist line by line and calls fn for every entry.
+// Both plain M3U and the extended M3U Plus attributes are understood.
+func Parse(r io.Reader, fn func(Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var current *Entry
+	var groupFromTag string
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if lineNo == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#EXTM3U"):
+			continue
+		case strings.HasPrefix(line, "#EXTINF:"):
+			current = parseExtInf(line[len("#EXTINF:"):])
+			groupFromTag = ""
+		case strings.HasPrefix(line, "#EXTVLCOPT:"):
+			if current == nil {
+				continue
+			}
+			key, value, ok := strings.Cut(line[len("#EXTVLCOPT:"):], "=")
+			if !ok {
+				continue
+			}
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "http-user-agent":
+				current.UserAgent = strings.TrimSpace(value)
+			case "http-referrer", "http-referer":
+				current.Referrer = strings.TrimSpace(value)
+			}
+		case strings.HasPrefix(line, "#EXTGRP:"):
+			groupFromTag = strings.TrimSpace(line[len("#EXTGRP:"):])
+		case strings.HasPrefix(line, "#"):
+			// Bilinmeyen etiketleri yok say
+			continue
+		default:
+			entry := current
+			if entry == nil {
+				// #EXTINF satırı olmayan düz M3U
+				entry = &Entry{Name: line, Duration: -1}
+			}
+			entry.URL = line
+			if entry.GroupTitle == "" {
+				entry.GroupTitle = groupFromTag
+			}
+			if entry.Name == "" {
+				entry.Name = entry.TvgName
+			}
+			if err := fn(*entry); err != nil {
+				return err
+			}
+			current = nil
+			groupFromTag = ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("m3u: %w", err)
+	}
+	return nil
+}
+
+// parseExtInf parses the part after "#EXTINF:", for example
+// `-1 tvg-id="trt1.tr" group-title="Ulusal",TRT 1 HD`.
+func parseExtInf(s string) *Entry {
+	entry := &Entry{Attributes: make(map[string]string)}
+
+	i := 0
+	for i < len(s) && s[i] != ' ' && s[i] != ',' && s[i] != '\t' {
+		i++
+	}
+	if duration, err := strconv.ParseFloat(s[:i], 64); err == nil {
+		entry.Duration = duration
+	} else {
+		entry.Duration = -1
+	}
+
+	// key="value" biçimindeki öznitelikleri oku
+	for i < len(s) {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+			i++
+		}
+		if i >= len(s) || s[i] == ',' {
+			break
+		}
+
+		keyStart := i
+		for i < len(s) && s[i] != '=' && s[i] != ' ' && s[i] != ',' {
+			i++
+		}
+		key := strings.ToLower(s[keyStart:i])
+		if i >= len(s) || s[i] != '=' {
+			continue
+		}
+		i++ // '='
+
+		var value string
+		if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+			quote := s[i]
+			i++
+			valueStart := i
+			for i < len(s) && s[i] != quote {
+				i++
+			}
+			value = s[valueStart:i]
+			if i < len(s) {
+				i++ // closing quote
+			}
+		} else {
+			valueStart := i
+			for i < len(s) && s[i] != ' ' && s[i] != ',' {
+				i++
+			}
+			value = s[valueStart:i]
+		}
+		entry.Attributes[key] = value
+	}
+
+	if i < len(s) && s[i] == ',' {
+		entry.Name = strings.TrimSpace(s[i+1:])
+	}
+
+	entry.TvgID = entry.Attributes["tvg-id"]
+	entry.TvgName = entry.Attributes["tvg-name"]
+	entry.TvgLogo = entry.Attributes["tvg-logo"]
+	entry.GroupTitle = entry.Attributes["group-title"]
+	entry.Catchup = entry.Attributes["catchup"]
+	if entry.Catchup == "" {
+		entry.Catchup = entry.Attributes["catchup-type"]
+	}
+	entry.CatchupSource = entry.Attributes["catchup-source"]
+	if days, err := strconv.Atoi(entry.Attributes["catchup-days"]); err == nil {
+		entry.CatchupDays = days
+	} else if days, err := strconv.Atoi(entry.Attributes["timeshift"]); err == nil {
+		entry.CatchupDays = days
+	}
+	if number, err := strconv.Atoi(entry.Attributes["tvg-chno"]); err == nil {
+		entry.ChannelNumber = number
+	}
+	if ua := entry.Attributes["user-agent"]; ua != "" {
+		entry.UserAgent = ua
+	}
+	if ref := entry.Attributes["referrer"]; ref != "" {
+		entry.Referrer = ref
+	}
+	return entry
+}
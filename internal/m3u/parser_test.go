@@ -0,0 +1,222 @@
+package m3u
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseExtInf(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want Entry
+	}{
+		{
+			name: "plain",
+			line: `-1,TRT 1`,
+			want: Entry{Name: "TRT 1", Duration: -1},
+		},
+		{
+			name: "attributes",
+			line: `-1 tvg-id="trt1.tr" tvg-name="TRT 1 HD" tvg-logo="http://logo/trt1.png" group-title="Ulusal",TRT 1 HD`,
+			want: Entry{
+				Name:       "TRT 1 HD",
+				Duration:   -1,
+				TvgID:      "trt1.tr",
+				TvgName:    "TRT 1 HD",
+				TvgLogo:    "http://logo/trt1.png",
+				GroupTitle: "Ulusal",
+			},
+		},
+		{
+			name: "comma inside quoted value",
+			line: `-1 group-title="Belgesel, Doğa",National Geographic`,
+			want: Entry{Name: "National Geographic", Duration: -1, GroupTitle: "Belgesel, Doğa"},
+		},
+		{
+			name: "single quotes and unquoted values",
+			line: `0 tvg-id='a.b' tvg-chno=7,Kanal 7`,
+			want: Entry{Name: "Kanal 7", TvgID: "a.b", ChannelNumber: 7},
+		},
+		{
+			name: "upper case keys",
+			line: `-1 TVG-ID="x" Group-Title="Spor",S Sport`,
+			want: Entry{Name: "S Sport", Duration: -1, TvgID: "x", GroupTitle: "Spor"},
+		},
+		{
+			name: "unterminated quote",
+			line: `-1 tvg-name="Broken,Name`,
+			want: Entry{Duration: -1, TvgName: "Broken,Name"},
+		},
+		{
+			name: "duration",
+			line: `120.5,Film`,
+			want: Entry{Name: "Film", Duration: 120.5},
+		},
+		{
+			name: "catchup",
+			line: `-1 catchup="default" catchup-days="3" catchup-source="?utc={utc}",Kanal`,
+			want: Entry{Name: "Kanal", Duration: -1, Catchup: "default", CatchupDays: 3, CatchupSource: "?utc={utc}"},
+		},
+		{
+			name: "catchup-type and timeshift",
+			line: `-1 catchup-type="shift" timeshift="2",Kanal`,
+			want: Entry{Name: "Kanal", Duration: -1, Catchup: "shift", CatchupDays: 2},
+		},
+		{
+			name: "http attributes",
+			line: `-1 user-agent="VLC/3.0" referrer="http://ref/",Kanal`,
+			want: Entry{Name: "Kanal", Duration: -1, UserAgent: "VLC/3.0", Referrer: "http://ref/"},
+		},
+		{
+			name: "name is trimmed",
+			line: "-1 tvg-id=\"x\",  Kanal D  ",
+			want: Entry{Name: "Kanal D", Duration: -1, TvgID: "x"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := *parseExtInf(tt.line)
+			got.Attributes = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseExtInf(%q)\n got %+v\nwant %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExtInfAttributes(t *testing.T) {
+	entry := parseExtInf(`-1 tvg-id="a" x-custom="some value" tvg-country=TR,Name`)
+	want := map[string]string{"tvg-id": "a", "x-custom": "some value", "tvg-country": "TR"}
+	if !reflect.DeepEqual(entry.Attributes, want) {
+		t.Errorf("attributes = %v, want %v", entry.Attributes, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		want     []Entry
+	}{
+		{
+			name: "extended",
+			playlist: "#EXTM3U\n" +
+				"#EXTINF:-1 tvg-id=\"trt1\" group-title=\"Ulusal\",TRT 1\n" +
+				"http://host/live/1.ts\n" +
+				"#EXTINF:-1,Kanal D\n" +
+				"http://host/live/2.ts\n",
+			want: []Entry{
+				{Name: "TRT 1", URL: "http://host/live/1.ts", Duration: -1, TvgID: "trt1", GroupTitle: "Ulusal"},
+				{Name: "Kanal D", URL: "http://host/live/2.ts", Duration: -1},
+			},
+		},
+		{
+			name:     "byte order mark",
+			playlist: "\ufeff#EXTM3U\n#EXTINF:-1,TRT 1\nhttp://host/1\n",
+			want:     []Entry{{Name: "TRT 1", URL: "http://host/1", Duration: -1}},
+		},
+		{
+			name:     "crlf line endings",
+			playlist: "#EXTM3U\r\n#EXTINF:-1,TRT 1\r\nhttp://host/1\r\n",
+			want:     []Entry{{Name: "TRT 1", URL: "http://host/1", Duration: -1}},
+		},
+		{
+			name: "plain m3u",
+			playlist: "http://host/1\n" +
+				"\n" +
+				"http://host/2\n",
+			want: []Entry{
+				{Name: "http://host/1", URL: "http://host/1", Duration: -1},
+				{Name: "http://host/2", URL: "http://host/2", Duration: -1},
+			},
+		},
+		{
+			name: "extvlcopt",
+			playlist: "#EXTM3U\n" +
+				"#EXTINF:-1,Kanal\n" +
+				"#EXTVLCOPT:http-user-agent=Mozilla/5.0 (X11)\n" +
+				"#EXTVLCOPT:http-referrer=http://ref/\n" +
+				"#EXTVLCOPT:network-caching=1000\n" +
+				"http://host/1\n",
+			want: []Entry{{Name: "Kanal", URL: "http://host/1", Duration: -1, UserAgent: "Mozilla/5.0 (X11)", Referrer: "http://ref/"}},
+		},
+		{
+			name: "extvlcopt overrides attributes",
+			playlist: "#EXTINF:-1 user-agent=\"A\",Kanal\n" +
+				"#EXTVLCOPT:http-referer=http://ref/\n" +
+				"#EXTVLCOPT:http-user-agent=B\n" +
+				"http://host/1\n",
+			want: []Entry{{Name: "Kanal", URL: "http://host/1", Duration: -1, UserAgent: "B", Referrer: "http://ref/"}},
+		},
+		{
+			name: "extvlcopt before extinf is ignored",
+			playlist: "#EXTVLCOPT:http-user-agent=B\n" +
+				"#EXTINF:-1,Kanal\n" +
+				"http://host/1\n",
+			want: []Entry{{Name: "Kanal", URL: "http://host/1", Duration: -1}},
+		},
+		{
+			name: "extgrp",
+			playlist: "#EXTINF:-1,Kanal\n" +
+				"#EXTGRP:Haber\n" +
+				"http://host/1\n" +
+				"#EXTINF:-1,Sonraki\n" +
+				"http://host/2\n",
+			want: []Entry{
+				{Name: "Kanal", URL: "http://host/1", Duration: -1, GroupTitle: "Haber"},
+				{Name: "Sonraki", URL: "http://host/2", Duration: -1},
+			},
+		},
+		{
+			name: "group-title wins over extgrp",
+			playlist: "#EXTINF:-1 group-title=\"Ulusal\",Kanal\n" +
+				"#EXTGRP:Haber\n" +
+				"http://host/1\n",
+			want: []Entry{{Name: "Kanal", URL: "http://host/1", Duration: -1, GroupTitle: "Ulusal"}},
+		},
+		{
+			name: "tvg-name when name is empty",
+			playlist: "#EXTINF:-1 tvg-name=\"TRT 1\",\n" +
+				"http://host/1\n",
+			want: []Entry{{Name: "TRT 1", URL: "http://host/1", Duration: -1, TvgName: "TRT 1"}},
+		},
+		{
+			name:     "unknown tags",
+			playlist: "#EXTM3U\n#PLAYLIST:Test\n#EXTINF:-1,Kanal\n#EXT-X-FOO\nhttp://host/1\n",
+			want:     []Entry{{Name: "Kanal", URL: "http://host/1", Duration: -1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Entry
+			err := Parse(strings.NewReader(tt.playlist), func(e Entry) error {
+				e.Attributes = nil
+				got = append(got, e)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse\n got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStopsOnCallbackError(t *testing.T) {
+	errStop := errors.New("stop")
+	calls := 0
+	err := Parse(strings.NewReader("http://host/1\nhttp://host/2\n"), func(Entry) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Errorf("Parse returned %v after %d calls, want %v after 1", err, calls, errStop)
+	}
+}
@@ -0,0 +1,42 @@
+package m3u
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		ResponseHeaderTimeout: 60 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// Open returns a reader for a playlist given as an http(s) URL, such as a
+// provider's get.php?type=m3u_plus link, or as a local file path.
+func Open(source string) (io.ReadCloser, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		req, err := http.NewRequest("GET", source, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", "Tivimate/4.8.0")
+		req.Header.Set("Accept", "*/*")
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("playlist server returned status code %d", resp.StatusCode)
+		}
+		return resp.Body, nil
+	}
+
+	return os.Open(source)
+}
@@ -0,0 +1,135 @@
+package m3u
+
+import (
+	"hash/crc32"
+	"io"
+	"log"
+	"strings"
+
+	"remote-iptv/internal/db"
+)
+
+// Result summarises a playlist import
+type Result struct {
+	SourceID   int `json:"source_id"`
+	Live       int `json:"live"`
+	Movies     int `json:"movies"`
+	Series     int `json:"series"`
+	Categories int `json:"categories"`
+
+	CategoryChanges db.SyncDiff `json:"category_changes"`
+	ChannelChanges  db.SyncDiff `json:"channel_changes"`
+}
+
+// StreamType guesses the stream type of an entry from its URL. Xtream
+// panels serve VOD under /movie/ and episodes under /series/.
+func StreamType(e Entry) string {
+	lower := strings.ToLower(e.URL)
+	switch {
+	case strings.Contains(lower, "/movie/") || strings.Contains(lower, "/vod/"):
+		return "movie"
+	case strings.Contains(lower, "/series/"):
+		return "series"
+	default:
+		return "live"
+	}
+}
+
+// stableID derives a positive remote ID from key so that the same stream
+// keeps its identity between imports.
+func stableID(key string) int {
+	id := int(crc32.ChecksumIEEE([]byte(key)) & 0x7fffffff)
+	if id == 0 {
+		id = 1
+	}
+	return id
+}
+
+// Import parses a playlist and updates the channels and categories of the
+// given source to match it. Unchanged entries keep their local IDs.
+func Import(d *db.Database, sourceID int, r io.Reader) (*Result, error) {
+	result := &Result{SourceID: sourceID}
+	categories := map[string][]db.Category{}
+	seenCategories := map[int]bool{}
+	usedIDs := map[int]bool{}
+	var channels []db.Channel
+
+	err := Parse(r, func(e Entry) error {
+		streamType := StreamType(e)
+
+		group := e.GroupTitle
+		if group == "" {
+			group = "Uncategorized"
+		}
+		categoryID := stableID(streamType + ":" + group)
+		if !seenCategories[categoryID] {
+			seenCategories[categoryID] = true
+			categories[streamType] = append(categories[streamType], db.Category{
+				RemoteID: categoryID,
+				Name:     group,
+				Type:     streamType,
+			})
+		}
+
+		// Aynı URL birden fazla kez listelenebilir, çakışmada sonraki ID'yi kullan
+		id := stableID(e.URL)
+		for usedIDs[id] {
+			id++
+		}
+		usedIDs[id] = true
+
+		channels = append(channels, db.Channel{
+			RemoteID:      id,
+			Name:          e.Name,
+			URL:           e.URL,
+			StreamType:    streamType,
+			CategoryID:    categoryID,
+			StreamIcon:    e.TvgLogo,
+			EPGChannelID:  e.TvgID,
+			HTTPUserAgent: e.UserAgent,
+			HTTPReferrer:  e.Referrer,
+			Catchup:       e.Catchup,
+			CatchupDays:   e.CatchupDays,
+			CatchupSource: e.CatchupSource,
+			Number:        e.ChannelNumber,
+		})
+
+		switch streamType {
+		case "movie":
+			result.Movies++
+		case "series":
+			result.Series++
+		default:
+			result.Live++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	channelImport, err := d.BeginChannelImport(sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Kanalların CategoryID'si kategorinin uzak ID'sidir, Commit yerel ID'ye çevirir
+	for _, streamType := range []string{"live", "movie", "series"} {
+		channelImport.SaveCategories(streamType, categories[streamType])
+		result.Categories += len(categories[streamType])
+	}
+	for _, ch := range channels {
+		if err := channelImport.Add(ch); err != nil {
+			channelImport.Rollback()
+			return nil, err
+		}
+	}
+
+	if result.CategoryChanges, result.ChannelChanges, err = channelImport.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("M3U import finished: %d live, %d movies, %d series in %d categories",
+		result.Live, result.Movies, result.Series, result.Categories)
+	return result, nil
+}
@@ -0,0 +1,83 @@
+package m3u
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Writer writes an M3U Plus playlist
+type Writer struct {
+	w      *bufio.Writer
+	header bool
+}
+
+// NewWriter returns a writer that writes the playlist to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Write writes an entry. Only the fields Parse understands are written, so
+// the playlist can be read back by Parse and by other players.
+func (pw *Writer) Write(e Entry) error {
+	if !pw.header {
+		pw.w.WriteString("#EXTM3U\n")
+		pw.header = true
+	}
+
+	duration := "-1"
+	if e.Duration > 0 {
+		duration = strconv.FormatFloat(e.Duration, 'f', -1, 64)
+	}
+	var line strings.Builder
+	line.WriteString("#EXTINF:" + duration)
+	attr := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&line, ` %s="%s"`, key, attribute(value))
+		}
+	}
+	attr("tvg-id", e.TvgID)
+	attr("tvg-name", e.TvgName)
+	attr("tvg-logo", e.TvgLogo)
+	if e.ChannelNumber > 0 {
+		attr("tvg-chno", strconv.Itoa(e.ChannelNumber))
+	}
+	attr("group-title", e.GroupTitle)
+	attr("catchup", e.Catchup)
+	if e.CatchupDays > 0 {
+		attr("catchup-days", strconv.Itoa(e.CatchupDays))
+	}
+	attr("catchup-source", e.CatchupSource)
+	line.WriteString("," + singleLine(e.Name) + "\n")
+	pw.w.WriteString(line.String())
+
+	if e.UserAgent != "" {
+		pw.w.WriteString("#EXTVLCOPT:http-user-agent=" + singleLine(e.UserAgent) + "\n")
+	}
+	if e.Referrer != "" {
+		pw.w.WriteString("#EXTVLCOPT:http-referrer=" + singleLine(e.Referrer) + "\n")
+	}
+	_, err := pw.w.WriteString(singleLine(e.URL) + "\n")
+	return err
+}
+
+// Flush writes buffered data. An empty playlist still gets its header.
+func (pw *Writer) Flush() error {
+	if !pw.header {
+		pw.w.WriteString("#EXTM3U\n")
+		pw.header = true
+	}
+	return pw.w.Flush()
+}
+
+// attribute makes a value safe inside a quoted attribute. Playlists have no
+// escaping, so quotes are replaced.
+func attribute(value string) string {
+	return strings.ReplaceAll(singleLine(value), `"`, "'")
+}
+
+func singleLine(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
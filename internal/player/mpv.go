@@ -12,6 +12,8 @@ import (
 	"syscall"
 	"time"
 	"sync"
+
+	"remote-iptv/internal/redact"
 )
 
 type MPVPlayer struct {
@@ -32,10 +34,35 @@ type MPVPlayer struct {
 
 	// New fields for auto-restart
 	currentURL   string
+	currentOpts  PlayOptions
 	autoRestart  bool
 	manualStop   bool
 }
 
+// PlayOptions carries per-stream HTTP settings, e.g. from #EXTVLCOPT lines,
+// and the viewer's playback preferences
+type PlayOptions struct {
+	UserAgent string
+	Referrer  string
+
+	// AudioLanguage and SubtitleLanguage are mpv language lists ("tr,en")
+	AudioLanguage    string
+	SubtitleLanguage string
+	// Start is the position in seconds to start playback from
+	Start float64
+}
+
+// startOption formats Start for mpv's --start option
+func (o PlayOptions) startOption() string {
+	if o.Start <= 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%.0f", o.Start)
+}
+
+// DefaultUserAgent is sent when a stream has no user agent of its own
+const DefaultUserAgent = "Tivimate"
+
 type MPVCommand struct {
 	Command []interface{} `json:"command"`
 }
@@ -161,17 +188,45 @@ func (p *MPVPlayer) processCommands() {
 }
 
 func (p *MPVPlayer) Play(url string) error {
+	return p.PlayWithOptions(url, PlayOptions{})
+}
+
+// PlayWithOptions plays url using the given HTTP user agent and referrer
+func (p *MPVPlayer) PlayWithOptions(url string, opts PlayOptions) error {
 	resultCh := make(chan error, 1)
+
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
 	
 	// Queue the play command
 	p.commandCh <- func() {
 		p.currentURL = url    // Store current URL
+		p.currentOpts = opts
 		p.manualStop = false  // Reset manual stop flag
 		
 		// Check if MPV is already running and active
 		if p.isActive && p.cmd != nil && p.cmd.Process != nil {
 			// MPV is running, try to use loadfile to change the URL instead of restarting
 			log.Printf("MPV already running, trying to change URL with loadfile command")
+
+			// HTTP ve izleyici ayarlarını yeni akıştan önce güncelle
+			properties := map[string]string{
+				"user-agent": userAgent,
+				"referrer":   opts.Referrer,
+				"alang":      opts.AudioLanguage,
+				"slang":      opts.SubtitleLanguage,
+				"start":      opts.startOption(),
+			}
+			for name, value := range properties {
+				setCmd := MPVCommand{
+					Command: []interface{}{"set_property", name, value},
+				}
+				if err := p.sendCommand(setCmd); err != nil {
+					log.Printf("Failed to set %s property: %v", name, err)
+				}
+			}
 			
 			// Use sendCommand to change URL
 			cmd := MPVCommand{
@@ -179,7 +234,7 @@ func (p *MPVPlayer) Play(url string) error {
 			}
 			
 			if err := p.sendCommand(cmd); err == nil {
-				log.Printf("Successfully changed URL to: %s", url)
+				log.Printf("Successfully changed URL to: %s", redact.URL(url))
 				resultCh <- nil
 				return
 			} else {
@@ -205,7 +260,7 @@ func (p *MPVPlayer) Play(url string) error {
 		}
 		
 		logFile := "/tmp/mpv_debug.log"
-		log.Printf("Starting MPV with URL: %s", url)
+		log.Printf("Starting MPV with URL: %s", redact.URL(url))
 		log.Printf("Debug logs will be saved to: %s", logFile)
 
 		// Determine audio device
@@ -232,7 +287,7 @@ func (p *MPVPlayer) Play(url string) error {
 			"--ytdl=no",
 			"--force-seekable=yes",
 			"--network-timeout=30",
-			"--user-agent=Tivimate",
+			"--user-agent=" + userAgent,
 			"--stream-lavf-o=reconnect=1",
 			"--stream-lavf-o=reconnect_at_eof=1",
 			"--stream-lavf-o=reconnect_streamed=1",
@@ -240,8 +295,20 @@ func (p *MPVPlayer) Play(url string) error {
 			"--hls-bitrate=max",
 			// Add IPC socket support for communication
 			"--input-ipc-server=/tmp/mpvsocket",
-			url,
 		}
+		if opts.Referrer != "" {
+			args = append(args, "--referrer="+opts.Referrer)
+		}
+		if opts.AudioLanguage != "" {
+			args = append(args, "--alang="+opts.AudioLanguage)
+		}
+		if opts.SubtitleLanguage != "" {
+			args = append(args, "--slang="+opts.SubtitleLanguage)
+		}
+		if opts.Start > 0 {
+			args = append(args, "--start="+opts.startOption())
+		}
+		args = append(args, url)
 
 		p.cmd = exec.Command("mpv", args...)
 		
@@ -253,7 +320,7 @@ func (p *MPVPlayer) Play(url string) error {
 		}
 
 		// Log tüm argümanları
-		log.Printf("MPV command: %s %s", p.cmd.Path, strings.Join(args, " "))
+		log.Printf("MPV command: %s %s", p.cmd.Path, redact.String(strings.Join(args, " ")))
 
 		// MPV'yi başlat
 		if err := p.cmd.Start(); err != nil {
@@ -266,7 +333,7 @@ func (p *MPVPlayer) Play(url string) error {
 		go func() {
 			scanner := bufio.NewScanner(stderr)
 			for scanner.Scan() {
-				log.Printf("MPV stderr: %s", scanner.Text())
+				log.Printf("MPV stderr: %s", redact.String(scanner.Text()))
 			}
 			if err := scanner.Err(); err != nil {
 				log.Printf("Error reading from MPV stderr: %v", err)
@@ -290,7 +357,7 @@ func (p *MPVPlayer) Play(url string) error {
 			if err != nil {
 				log.Printf("Error reading MPV log file: %v", err)
 			} else {
-				log.Printf("MPV log file contents (last 500 bytes): \n%s", lastNBytes(string(logBytes), 500))
+				log.Printf("MPV log file contents (last 500 bytes): \n%s", redact.String(lastNBytes(string(logBytes), 500)))
 			}
 			
 			// Update state in thread-safe manner
@@ -298,9 +365,9 @@ func (p *MPVPlayer) Play(url string) error {
 
 			// Auto-restart logic if not manually stopped
 			if p.autoRestart && !p.manualStop && p.currentURL != "" {
-				log.Printf("Auto-restarting MPV with URL: %s", p.currentURL)
+				log.Printf("Auto-restarting MPV with URL: %s", redact.URL(p.currentURL))
 				time.Sleep(1 * time.Second) // Small delay before restart
-				p.Play(p.currentURL)
+				p.PlayWithOptions(p.currentURL, p.currentOpts)
 			}
 		}()
 
@@ -422,7 +489,7 @@ func (p *MPVPlayer) sendCommand(cmd MPVCommand) error {
 		return fmt.Errorf("failed to marshal command: %v", err)
 	}
 	
-	log.Printf("Sending MPV command: %s", string(cmdData))
+	log.Printf("Sending MPV command: %s", redact.String(string(cmdData)))
 	
 	// Check if socket exists
 	if _, err := os.Stat("/tmp/mpvsocket"); err != nil {
@@ -436,7 +503,7 @@ func (p *MPVPlayer) sendCommand(cmd MPVCommand) error {
 		return fmt.Errorf("failed to send command via socket: %v", err)
 	}
 	
-	log.Printf("Command response: %s", string(output))
+	log.Printf("Command response: %s", redact.String(string(output)))
 	
 	// Check if we got a valid response
 	if len(output) > 0 {
@@ -481,7 +548,7 @@ func (p *MPVPlayer) GetMediaTitle() (string, error) {
 		return "", fmt.Errorf("failed to get media title: %v", err)
 	}
 	
-	log.Printf("Media title response: %s", string(output))
+	log.Printf("Media title response: %s", redact.String(string(output)))
 	
 	// Parse the JSON response
 	var response MPVResponse
@@ -513,6 +580,84 @@ func (p *MPVPlayer) GetMediaTitle() (string, error) {
 	return string(titleJSON), nil
 }
 
+// getProperty reads an mpv property over the IPC socket
+func (p *MPVPlayer) getProperty(name string) (interface{}, error) {
+	if !p.isActive {
+		return nil, fmt.Errorf("player is not active")
+	}
+
+	cmdData, err := json.Marshal(MPVCommand{
+		Command: []interface{}{"get_property", name},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal command: %v", err)
+	}
+
+	if _, err := os.Stat("/tmp/mpvsocket"); err != nil {
+		return nil, fmt.Errorf("IPC socket not available: %v", err)
+	}
+
+	output, err := sendToMPVSocket("/tmp/mpvsocket", string(cmdData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %v", name, err)
+	}
+
+	var response MPVResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse %s response: %v", name, err)
+	}
+	if response.Error != "" && response.Error != "success" {
+		return nil, fmt.Errorf("mpv error: %s", response.Error)
+	}
+	return response.Data, nil
+}
+
+// playbackPollInterval is how often WaitForPlayback checks the player
+const playbackPollInterval = 250 * time.Millisecond
+
+// WaitForPlayback waits until mpv has opened url and started playing it.
+// PlayWithOptions returns as soon as mpv accepts the URL, so a stream that
+// cannot be opened is only noticed here: it fails if mpv exits, moves on to
+// another file or does not start playing within timeout.
+func (p *MPVPlayer) WaitForPlayback(url string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if alive, _ := p.IsProcessAlive(); !alive {
+			return fmt.Errorf("mpv exited before playback started")
+		}
+		// path switches to the new URL once mpv starts loading it; time-pos
+		// is only available after the stream has been opened
+		if value, err := p.getProperty("path"); err == nil {
+			if path, _ := value.(string); path == url {
+				if value, err := p.getProperty("time-pos"); err == nil && value != nil {
+					return nil
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("playback did not start within %s", timeout)
+		}
+		time.Sleep(playbackPollInterval)
+	}
+}
+
+// GetPlaybackPosition returns the current position and the duration of the
+// playing file in seconds. Duration is 0 for live streams.
+func (p *MPVPlayer) GetPlaybackPosition() (position, duration float64, err error) {
+	value, err := p.getProperty("time-pos")
+	if err != nil {
+		return 0, 0, err
+	}
+	position, ok := value.(float64)
+	if !ok {
+		return 0, 0, fmt.Errorf("no playback position available")
+	}
+	if value, err := p.getProperty("duration"); err == nil {
+		duration, _ = value.(float64)
+	}
+	return position, duration, nil
+}
+
 func (p *MPVPlayer) IsProcessAlive() (bool, error) {
 	if p.cmd == nil || p.cmd.Process == nil {
 		return false, nil
@@ -0,0 +1,185 @@
+// Package redact hides provider credentials in log output and API
+// responses.
+package redact
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Mask replaces hidden values
+const Mask = "********"
+
+// minSecretLength keeps very short secrets from masking unrelated text
+const minSecretLength = 4
+
+// sensitiveParams are query parameters whose values are always hidden
+var sensitiveParams = map[string]bool{
+	"username": true,
+	"user":     true,
+	"password": true,
+	"pass":     true,
+	"pwd":      true,
+	"token":    true,
+	"api_key":  true,
+	"apikey":   true,
+	"auth":     true,
+}
+
+// credentialPaths are Xtream path prefixes followed by /{username}/{password}/
+var credentialPaths = map[string]bool{
+	"live":      true,
+	"movie":     true,
+	"series":    true,
+	"vod":       true,
+	"timeshift": true,
+}
+
+// streamIDPattern matches the last segment of an Xtream stream path: the
+// stream ID with an optional extension
+var streamIDPattern = regexp.MustCompile(`^[0-9]+(\.[a-zA-Z0-9]+)?$`)
+
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>]+`)
+
+var (
+	secretsMu sync.RWMutex
+	secrets   = map[string]bool{}
+)
+
+// AddSecret registers a value, typically a provider password, that must
+// never appear in redacted output
+func AddSecret(secret string) {
+	if len(secret) < minSecretLength || secret == Mask {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	secrets[secret] = true
+	secrets[url.QueryEscape(secret)] = true
+	secrets[url.PathEscape(secret)] = true
+}
+
+// AddURLSecrets registers the credentials carried by a URL: the user info
+// and the values of sensitive query parameters, such as the username and
+// password of an M3U get.php link. Stream URLs derived from it then stay
+// hidden even where their path puts the credentials in an unknown place.
+func AddURLSecrets(raw string) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return
+	}
+	if u.User != nil {
+		AddSecret(u.User.Username())
+		if password, ok := u.User.Password(); ok {
+			AddSecret(password)
+		}
+	}
+	for key, values := range u.Query() {
+		if !sensitiveParams[strings.ToLower(key)] {
+			continue
+		}
+		for _, value := range values {
+			AddSecret(value)
+		}
+	}
+}
+
+// URL hides the credentials of a stream or API URL: user info, sensitive
+// query parameters and the username/password segments of Xtream paths,
+// including the /{username}/{password}/{id} form of m3u_plus live entries.
+// Values that are not URLs only have registered secrets removed.
+func URL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return scrubSecrets(raw)
+	}
+
+	var b strings.Builder
+	b.WriteString(u.Scheme)
+	b.WriteString("://")
+	if u.User != nil {
+		b.WriteString(Mask)
+		b.WriteString("@")
+	}
+	b.WriteString(u.Host)
+	b.WriteString(redactPath(u.EscapedPath()))
+	if u.RawQuery != "" {
+		b.WriteString("?")
+		b.WriteString(redactQuery(u.RawQuery))
+	}
+	if u.Fragment != "" {
+		b.WriteString("#")
+		b.WriteString(u.EscapedFragment())
+	}
+	return scrubSecrets(b.String())
+}
+
+// String redacts every URL in s and removes registered secrets
+func String(s string) string {
+	return scrubSecrets(urlPattern.ReplaceAllStringFunc(s, URL))
+}
+
+func redactPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if credentialPaths[segment] && i+3 < len(segments) {
+			segments[i+1] = Mask
+			segments[i+2] = Mask
+			return strings.Join(segments, "/")
+		}
+	}
+	// m3u_plus live entries have no type prefix: /{username}/{password}/{id}
+	if len(segments) == 4 && segments[0] == "" && streamIDPattern.MatchString(segments[3]) {
+		segments[1] = Mask
+		segments[2] = Mask
+	}
+	return strings.Join(segments, "/")
+}
+
+func redactQuery(query string) string {
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		key, _, found := strings.Cut(param, "=")
+		if found && sensitiveParams[strings.ToLower(key)] {
+			params[i] = key + "=" + Mask
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func scrubSecrets(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Mask)
+	}
+	return s
+}
+
+type writer struct {
+	w io.Writer
+}
+
+// NewWriter wraps w so that everything written to it is passed through
+// String first. It is meant for log.SetOutput.
+func NewWriter(w io.Writer) io.Writer {
+	return writer{w: w}
+}
+
+func (w writer) Write(p []byte) (int, error) {
+	if _, err := w.w.Write([]byte(String(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Error returns the redacted message of err
+func Error(err error) string {
+	if err == nil {
+		return ""
+	}
+	return String(err.Error())
+}
@@ -0,0 +1,258 @@
+// Package restream relays provider streams to local clients. Every stream
+// has one upstream session shared by all of its viewers: continuous streams
+// (MPEG-TS) are fanned out from a single connection and HLS playlists and
+// segments are fetched once and served from a short-lived cache. Playlist
+// entries are rewritten to opaque tokens so upstream URLs, which usually
+// carry the provider credentials, never reach the clients.
+package restream
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Unlimited lifts the per-account session limit
+const Unlimited = -1
+
+// Session kinds
+const (
+	KindPending = "pending"
+	KindHLS     = "hls"
+	KindTS      = "ts"
+	KindFile    = "file"
+)
+
+const (
+	// idleTimeout closes an HLS session whose clients stopped polling
+	idleTimeout = 30 * time.Second
+	// lingerTime keeps a continuous upstream open after its last viewer
+	// left, so a reconnecting player does not need a new connection
+	lingerTime = 5 * time.Second
+	// fetchTimeout bounds playlist and segment requests
+	fetchTimeout = 20 * time.Second
+)
+
+var (
+	// ErrLimit is returned when opening a session would exceed the
+	// account's connection limit
+	ErrLimit = errors.New("connection limit reached")
+	// ErrNotFound is returned for playlist entries the session does not know
+	ErrNotFound = errors.New("stream resource not found")
+)
+
+// Stream describes an upstream stream
+type Stream struct {
+	// Key identifies the upstream; clients with the same key share it
+	Key string
+	// Name is shown in session listings
+	Name string
+	// Account groups sessions that count against the same connection limit
+	Account int
+	URL     string
+	// Path is the public path of the stream. Playlist entries are
+	// rewritten to paths below it.
+	Path      string
+	UserAgent string
+	Referrer  string
+}
+
+// SessionInfo describes an open upstream session
+type SessionInfo struct {
+	Key     string `json:"key"`
+	Name    string `json:"name"`
+	Account int    `json:"account"`
+	Kind    string `json:"kind"`
+	// Clients is the number of connected viewers of a continuous stream.
+	// HLS clients poll and are not counted.
+	Clients    int       `json:"clients"`
+	StartedAt  time.Time `json:"started_at"`
+	LastActive time.Time `json:"last_active"`
+}
+
+var client = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: fetchTimeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   4,
+	},
+}
+
+// Hub keeps the open upstream sessions
+type Hub struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	seq      int
+}
+
+// NewHub returns an empty hub
+func NewHub() *Hub {
+	return &Hub{sessions: make(map[string]*Session)}
+}
+
+// Get returns the open session of the key, nil if there is none
+func (h *Hub) Get(key string) *Session {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s := h.sessions[key]; s != nil && !s.isClosed() {
+		return s
+	}
+	return nil
+}
+
+// Open returns the session of the stream, opening a new one if needed. A new
+// session is refused with ErrLimit if the account already has maxSessions
+// open sessions.
+func (h *Hub) Open(stream Stream, maxSessions int) (*Session, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s := h.sessions[stream.Key]; s != nil && !s.isClosed() {
+		return s, nil
+	}
+	if err := h.checkLimit(stream.Account, maxSessions); err != nil {
+		return nil, err
+	}
+	s := newSession(h, stream)
+	h.sessions[stream.Key] = s
+	return s, nil
+}
+
+// Sessions lists the open sessions
+func (h *Hub) Sessions() []SessionInfo {
+	h.mu.Lock()
+	sessions := make([]*Session, 0, len(h.sessions))
+	for _, s := range h.sessions {
+		sessions = append(sessions, s)
+	}
+	h.mu.Unlock()
+
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		infos = append(infos, s.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].StartedAt.Before(infos[j].StartedAt) })
+	return infos
+}
+
+// Active returns the number of open sessions of the account
+func (h *Hub) Active(account int) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.active(account)
+}
+
+func (h *Hub) active(account int) int {
+	n := 0
+	for _, s := range h.sessions {
+		if s.stream.Account == account {
+			n++
+		}
+	}
+	return n
+}
+
+func (h *Hub) checkLimit(account, maxSessions int) error {
+	if maxSessions >= 0 && h.active(account) >= maxSessions {
+		return ErrLimit
+	}
+	return nil
+}
+
+func (h *Hub) remove(s *Session) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.sessions[s.stream.Key] == s {
+		delete(h.sessions, s.stream.Key)
+	}
+}
+
+// Proxy relays a file stream (a movie or an episode) to a single client.
+// Range requests are passed through so the client can seek. The request
+// holds its own upstream connection, counted against the account's limit
+// while it runs. Proxy writes the response unless it returns an error.
+func (h *Hub) Proxy(w http.ResponseWriter, r *http.Request, stream Stream, maxSessions int) error {
+	h.mu.Lock()
+	if err := h.checkLimit(stream.Account, maxSessions); err != nil {
+		h.mu.Unlock()
+		return err
+	}
+	h.seq++
+	stream.Key = fmt.Sprintf("%s#%d", stream.Key, h.seq)
+	s := &Session{hub: h, stream: stream, kind: KindFile, started: time.Now(), lastActive: time.Now()}
+	h.sessions[stream.Key] = s
+	h.mu.Unlock()
+	defer h.remove(s)
+
+	req, err := newRequest(r.Context(), stream.URL, stream)
+	if err != nil {
+		return err
+	}
+	for _, header := range []string{"Range", "If-Range"} {
+		if value := r.Header.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+	resp, err := do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	for _, header := range []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified", "ETag"} {
+		if value := resp.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	copyStream(w, resp.Body)
+	return nil
+}
+
+// newRequest builds an upstream GET request with the stream's HTTP settings
+func newRequest(ctx context.Context, target string, stream Stream) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if stream.UserAgent != "" {
+		req.Header.Set("User-Agent", stream.UserAgent)
+	}
+	if stream.Referrer != "" {
+		req.Header.Set("Referer", stream.Referrer)
+	}
+	return req, nil
+}
+
+// do sends an upstream request, following redirects, and fails on error
+// statuses
+func do(req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		// url.Error messages carry the full request URL, credentials included
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, fmt.Errorf("%s: %v", urlErr.Op, urlErr.Err)
+		}
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("upstream returned status code %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// newToken returns a random playlist entry token
+func newToken() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
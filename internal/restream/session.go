@@ -0,0 +1,567 @@
+package restream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// chunkSize is the read size of continuous streams
+	chunkSize = 32 << 10
+	// clientBuffer is how many chunks may queue up for a viewer before it
+	// is dropped as too slow
+	clientBuffer = 512
+	// playlistTTL is how long a fetched playlist is served from cache
+	playlistTTL = time.Second
+	// resourceTTL forgets playlist entries that stopped appearing
+	resourceTTL = 2 * time.Minute
+	// cachedSegments is how many segments a session keeps in memory
+	cachedSegments = 8
+	// maxPlaylistSize and maxSegmentSize bound what is read into memory
+	maxPlaylistSize = 1 << 20
+	maxSegmentSize  = 64 << 20
+	// sampleSize is how much of the first response is inspected
+	sampleSize = 4096
+)
+
+// uriAttribute matches URI attributes of playlist tags (keys, maps, media)
+var uriAttribute = regexp.MustCompile(`URI="([^"]*)"`)
+
+// Session is the shared upstream of one stream
+type Session struct {
+	hub     *Hub
+	stream  Stream
+	started time.Time
+
+	// openMu serializes starting the continuous upstream
+	openMu sync.Mutex
+
+	mu         sync.Mutex
+	kind       string
+	closed     bool
+	lastActive time.Time
+	timer      *time.Timer
+	cast       *broadcast
+	main       *resource
+	resources  map[string]*resource
+	tokens     map[string]string
+	// cached holds the segments with a cached body, oldest first
+	cached []*resource
+}
+
+// broadcast fans a continuous upstream out to the viewers
+type broadcast struct {
+	cancel      context.CancelFunc
+	contentType string
+	clients     map[chan []byte]struct{}
+}
+
+// resource is a playlist or segment of an HLS stream
+type resource struct {
+	url string
+	ext string
+	// seen is when the entry last appeared in a playlist
+	seen time.Time
+
+	// mu is held while fetching, so concurrent requests share one fetch
+	mu          sync.Mutex
+	body        []byte
+	contentType string
+	playlist    bool
+	fetched     time.Time
+}
+
+func newSession(h *Hub, stream Stream) *Session {
+	now := time.Now()
+	s := &Session{
+		hub:        h,
+		stream:     stream,
+		started:    now,
+		kind:       KindPending,
+		lastActive: now,
+		main:       &resource{url: stream.URL},
+		resources:  make(map[string]*resource),
+		tokens:     make(map[string]string),
+	}
+	s.timer = time.AfterFunc(idleTimeout, s.expire)
+	return s
+}
+
+// Serve writes the stream (resource "") or one of its playlist entries.
+// Nothing is written if an error is returned.
+func (s *Session) Serve(w http.ResponseWriter, r *http.Request, resource string) error {
+	if resource != "" {
+		return s.serveResource(w, resource)
+	}
+
+	s.mu.Lock()
+	kind := s.kind
+	s.touch(idleTimeout)
+	s.mu.Unlock()
+	if kind == KindTS {
+		return s.serveContinuous(w, r, nil)
+	}
+
+	res := s.main
+	res.mu.Lock()
+	s.mu.Lock()
+	kind = s.kind
+	s.mu.Unlock()
+	if kind == KindTS {
+		// Another client found the stream to be continuous meanwhile
+		res.mu.Unlock()
+		return s.serveContinuous(w, r, nil)
+	}
+	if res.body != nil && time.Since(res.fetched) < playlistTTL {
+		body, contentType := res.body, res.contentType
+		res.mu.Unlock()
+		writeBody(w, contentType, body)
+		return nil
+	}
+
+	// The upstream is only known to be a playlist after the first bytes;
+	// until then it is fetched as if it were a continuous stream
+	ctx, cancel := context.WithCancel(context.Background())
+	deadline := time.AfterFunc(fetchTimeout, cancel)
+	req, err := newRequest(ctx, res.url, s.stream)
+	if err != nil {
+		res.mu.Unlock()
+		cancel()
+		return err
+	}
+	resp, err := do(req)
+	if err != nil {
+		res.mu.Unlock()
+		cancel()
+		return err
+	}
+	head := make([]byte, sampleSize)
+	n, err := io.ReadFull(resp.Body, head)
+	head = head[:n]
+	if n == 0 && err != nil {
+		res.mu.Unlock()
+		resp.Body.Close()
+		cancel()
+		return fmt.Errorf("stream returned no data: %v", err)
+	}
+
+	if !isPlaylist(resp, head) {
+		res.mu.Unlock()
+		deadline.Stop()
+		s.mu.Lock()
+		s.kind = KindTS
+		s.mu.Unlock()
+		return s.serveContinuous(w, r, &upstream{resp: resp, head: head, cancel: cancel})
+	}
+
+	defer cancel()
+	defer resp.Body.Close()
+	data, err := readLimited(io.MultiReader(bytes.NewReader(head), resp.Body), maxPlaylistSize)
+	if err != nil {
+		res.mu.Unlock()
+		return err
+	}
+	res.body = s.rewrite(resp.Request.URL, data)
+	res.contentType = "application/vnd.apple.mpegurl"
+	res.playlist = true
+	res.fetched = time.Now()
+	body := res.body
+	res.mu.Unlock()
+
+	s.mu.Lock()
+	s.kind = KindHLS
+	s.mu.Unlock()
+	writeBody(w, "application/vnd.apple.mpegurl", body)
+	return nil
+}
+
+// upstream is an opened continuous upstream response
+type upstream struct {
+	resp   *http.Response
+	head   []byte
+	cancel context.CancelFunc
+}
+
+// serveContinuous attaches the client to the running broadcast, starting
+// it from up (or a new upstream request if up is nil) when none runs
+func (s *Session) serveContinuous(w http.ResponseWriter, r *http.Request, up *upstream) error {
+	s.openMu.Lock()
+	s.mu.Lock()
+	b := s.cast
+	s.mu.Unlock()
+
+	var start io.ReadCloser
+	if b != nil && up != nil {
+		// Another client started the broadcast meanwhile
+		up.resp.Body.Close()
+		up.cancel()
+	}
+	if b == nil {
+		if up == nil {
+			ctx, cancel := context.WithCancel(context.Background())
+			req, err := newRequest(ctx, s.stream.URL, s.stream)
+			if err != nil {
+				s.openMu.Unlock()
+				cancel()
+				return err
+			}
+			resp, err := do(req)
+			if err != nil {
+				s.openMu.Unlock()
+				cancel()
+				return err
+			}
+			up = &upstream{resp: resp, cancel: cancel}
+		}
+		b = &broadcast{
+			cancel:      up.cancel,
+			contentType: up.resp.Header.Get("Content-Type"),
+			clients:     make(map[chan []byte]struct{}),
+		}
+		if b.contentType == "" || strings.HasPrefix(b.contentType, "application/octet-stream") {
+			b.contentType = "video/mp2t"
+		}
+		s.mu.Lock()
+		s.cast = b
+		s.mu.Unlock()
+		start = up.resp.Body
+		if len(up.head) > 0 {
+			start = readCloser{io.MultiReader(bytes.NewReader(up.head), up.resp.Body), up.resp.Body}
+		}
+	}
+
+	c := make(chan []byte, clientBuffer)
+	s.mu.Lock()
+	b.clients[c] = struct{}{}
+	s.touch(idleTimeout)
+	s.mu.Unlock()
+	s.openMu.Unlock()
+	defer s.unsubscribe(b, c)
+	// The first viewer subscribes before any data is relayed
+	if start != nil {
+		go s.run(b, start)
+	}
+
+	w.Header().Set("Content-Type", b.contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	for {
+		select {
+		case chunk, ok := <-c:
+			if !ok {
+				return nil
+			}
+			if _, err := w.Write(chunk); err != nil {
+				return nil
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
+
+// run relays the upstream to the viewers until it ends or is cancelled
+func (s *Session) run(b *broadcast, body io.ReadCloser) {
+	defer body.Close()
+	for {
+		buf := make([]byte, chunkSize)
+		n, err := body.Read(buf)
+		if n > 0 {
+			s.mu.Lock()
+			for c := range b.clients {
+				select {
+				case c <- buf[:n]:
+				default:
+					// The viewer fell too far behind
+					close(c)
+					delete(b.clients, c)
+				}
+			}
+			s.mu.Unlock()
+		}
+		if err != nil {
+			break
+		}
+	}
+	b.cancel()
+
+	s.mu.Lock()
+	for c := range b.clients {
+		close(c)
+	}
+	b.clients = nil
+	if s.cast == b {
+		s.cast = nil
+	}
+	s.touch(lingerTime)
+	s.mu.Unlock()
+}
+
+func (s *Session) unsubscribe(b *broadcast, c chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(b.clients, c)
+	if len(b.clients) == 0 {
+		s.touch(lingerTime)
+	}
+}
+
+// serveResource serves a rewritten playlist entry
+func (s *Session) serveResource(w http.ResponseWriter, name string) error {
+	token := strings.TrimSuffix(name, path.Ext(name))
+	s.mu.Lock()
+	res := s.resources[token]
+	s.touch(idleTimeout)
+	s.mu.Unlock()
+	if res == nil {
+		return ErrNotFound
+	}
+
+	res.mu.Lock()
+	if res.body == nil || (res.playlist && time.Since(res.fetched) >= playlistTTL) {
+		if err := s.fetch(res); err != nil {
+			res.mu.Unlock()
+			return err
+		}
+	}
+	body, contentType := res.body, res.contentType
+	res.mu.Unlock()
+	writeBody(w, contentType, body)
+	return nil
+}
+
+// fetch loads a playlist entry; res.mu must be held
+func (s *Session) fetch(res *resource) error {
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	req, err := newRequest(ctx, res.url, s.stream)
+	if err != nil {
+		return err
+	}
+	resp, err := do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := readLimited(resp.Body, maxSegmentSize)
+	if err != nil {
+		return err
+	}
+	res.contentType = resp.Header.Get("Content-Type")
+	res.fetched = time.Now()
+	if isPlaylist(resp, data) {
+		if len(data) > maxPlaylistSize {
+			return fmt.Errorf("playlist is larger than %d bytes", maxPlaylistSize)
+		}
+		res.body = s.rewrite(resp.Request.URL, data)
+		res.contentType = "application/vnd.apple.mpegurl"
+		res.playlist = true
+		return nil
+	}
+	res.body = data
+	// Providers often serve segments without a usable type
+	if res.contentType == "" || strings.HasPrefix(res.contentType, "text/plain") ||
+		strings.HasPrefix(res.contentType, "application/octet-stream") {
+		res.contentType = "application/octet-stream"
+		if res.ext == ".ts" {
+			res.contentType = "video/mp2t"
+		}
+	}
+	s.cacheSegment(res)
+	return nil
+}
+
+// cacheSegment keeps the body of the latest segments only
+func (s *Session) cacheSegment(res *resource) {
+	s.mu.Lock()
+	s.cached = append(s.cached, res)
+	var evict []*resource
+	if len(s.cached) > cachedSegments {
+		evict = append(evict, s.cached[:len(s.cached)-cachedSegments]...)
+		s.cached = append([]*resource(nil), s.cached[len(s.cached)-cachedSegments:]...)
+	}
+	s.mu.Unlock()
+
+	for _, old := range evict {
+		// A locked segment is being fetched again and stays cached
+		if old != res && old.mu.TryLock() {
+			old.body = nil
+			old.mu.Unlock()
+		}
+	}
+}
+
+// rewrite replaces the entries of a playlist with session tokens
+func (s *Session) rewrite(base *url.URL, playlist []byte) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var out bytes.Buffer
+	for _, line := range strings.Split(strings.TrimRight(string(playlist), "\r\n"), "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			line = uriAttribute.ReplaceAllStringFunc(line, func(match string) string {
+				uri := uriAttribute.FindStringSubmatch(match)[1]
+				return `URI="` + s.link(base, uri, now) + `"`
+			})
+		default:
+			line = s.link(base, trimmed, now)
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+
+	for token, res := range s.resources {
+		if now.Sub(res.seen) > resourceTTL {
+			delete(s.resources, token)
+			delete(s.tokens, res.url)
+		}
+	}
+	return out.Bytes()
+}
+
+// link returns the public path of a playlist entry; s.mu must be held
+func (s *Session) link(base *url.URL, uri string, now time.Time) string {
+	target, err := base.Parse(uri)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		return uri
+	}
+	absolute := target.String()
+	token, ok := s.tokens[absolute]
+	if !ok {
+		token = newToken()
+		ext := path.Ext(target.Path)
+		if len(ext) > 6 {
+			ext = ""
+		}
+		s.tokens[absolute] = token
+		s.resources[token] = &resource{url: absolute, ext: ext}
+	}
+	res := s.resources[token]
+	res.seen = now
+	return s.stream.Path + "/" + token + res.ext
+}
+
+// touch postpones expiry; s.mu must be held
+func (s *Session) touch(d time.Duration) {
+	s.lastActive = time.Now()
+	if s.timer != nil && !s.closed {
+		s.timer.Reset(d)
+	}
+}
+
+// expire closes the session unless viewers are still attached
+func (s *Session) expire() {
+	s.mu.Lock()
+	if s.cast != nil && len(s.cast.clients) > 0 {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	if s.cast != nil {
+		s.cast.cancel()
+	}
+	s.mu.Unlock()
+	s.hub.remove(s)
+}
+
+func (s *Session) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Session) info() SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := SessionInfo{
+		Key:        s.stream.Key,
+		Name:       s.stream.Name,
+		Account:    s.stream.Account,
+		Kind:       s.kind,
+		StartedAt:  s.started,
+		LastActive: s.lastActive,
+	}
+	if s.cast != nil {
+		info.Clients = len(s.cast.clients)
+	}
+	if s.kind == KindFile {
+		info.Clients = 1
+	}
+	return info
+}
+
+// isPlaylist reports whether a response is an HLS playlist
+func isPlaylist(resp *http.Response, head []byte) bool {
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+	if strings.Contains(contentType, "mpegurl") {
+		return true
+	}
+	if strings.HasSuffix(strings.ToLower(resp.Request.URL.Path), ".m3u8") {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimLeft(head, "\ufeff \r\n\t"), []byte("#EXTM3U"))
+}
+
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("response is larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+func writeBody(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(body)
+}
+
+// copyStream copies a file stream, flushing as data arrives
+func copyStream(w http.ResponseWriter, body io.Reader) {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readCloser reads the peeked head before the rest of a body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,204 @@
+// Package schedule parses the sync schedules of sources. A schedule is a
+// Go duration ("6h"), "@every 6h", one of the @hourly, @daily, @weekly and
+// @monthly shortcuts, or a five field cron expression ("30 4 * * 1-5").
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MinInterval is the shortest allowed interval between two runs
+const MinInterval = 5 * time.Minute
+
+// Schedule reports when a job runs next
+type Schedule interface {
+	// Next returns the first run time strictly after t
+	Next(t time.Time) time.Time
+}
+
+var shortcuts = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// Parse parses a schedule expression
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, fmt.Errorf("empty schedule")
+	}
+	if cron, ok := shortcuts[expr]; ok {
+		expr = cron
+	}
+
+	if every, ok := strings.CutPrefix(expr, "@every "); ok {
+		return parseInterval(strings.TrimSpace(every))
+	}
+	if !strings.Contains(expr, " ") {
+		return parseInterval(expr)
+	}
+	return parseCron(expr)
+}
+
+type interval time.Duration
+
+func parseInterval(value string) (Schedule, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, err
+	}
+	if d < MinInterval {
+		return nil, fmt.Errorf("interval %v is shorter than %v", d, MinInterval)
+	}
+	return interval(d), nil
+}
+
+func (i interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// cron matches times against five fields. Each field is a bit set of the
+// allowed values.
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	// Like classic cron, a day matches if either the day of month or the
+	// day of week matches when both are restricted
+	domAny, dowAny bool
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+func parseCron(expr string) (Schedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression needs %d fields, got %d", len(cronFields), len(parts))
+	}
+
+	sets := make([]uint64, len(parts))
+	for i, part := range parts {
+		set, err := parseField(part, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+
+	// 7 is another name for Sunday
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return &cron{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}, nil
+}
+
+// parseField parses comma separated values, ranges (1-5), steps (*/15,
+// 0-30/10) and * for one field
+func parseField(value string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(value, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepPart, f.name)
+			}
+			step = n
+		}
+
+		low, high := f.min, f.max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(lowPart); err != nil {
+				return 0, fmt.Errorf("invalid value %q in %s field", lowPart, f.name)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highPart); err != nil {
+					return 0, fmt.Errorf("invalid value %q in %s field", highPart, f.name)
+				}
+			} else if hasStep {
+				high = f.max
+			}
+		}
+		if low < f.min || high > f.max || low > high {
+			return 0, fmt.Errorf("%s field value %q is out of range %d-%d", f.name, item, f.min, f.max)
+		}
+
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// maxSearch bounds the search for the next matching time, so impossible
+// expressions such as "0 0 31 2 *" cannot loop forever
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+func (c *cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *cron) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dowMatch
+	case c.dowAny:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
@@ -0,0 +1,129 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"   ",
+		"1m",
+		"@every 4m",
+		"@every",
+		"soon",
+		"@yearly",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-b * * * *",
+		"1,,2 * * * *",
+	}
+	for _, expr := range tests {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestInterval(t *testing.T) {
+	from := time.Date(2024, 3, 10, 12, 34, 56, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Duration
+	}{
+		{"6h", 6 * time.Hour},
+		{"5m", 5 * time.Minute},
+		{"@every 90m", 90 * time.Minute},
+		{"  @every   2h30m ", 2*time.Hour + 30*time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := s.Next(from); !got.Equal(from.Add(tt.want)) {
+				t.Errorf("Next(%v) = %v, want %v", from, got, from.Add(tt.want))
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2024-03-10 is a Sunday
+	from := time.Date(2024, 3, 10, 12, 34, 56, 0, time.UTC)
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", from, time.Date(2024, 3, 10, 12, 35, 0, 0, time.UTC)},
+		{"30 4 * * *", from, time.Date(2024, 3, 11, 4, 30, 0, 0, time.UTC)},
+		{"40 12 * * *", from, time.Date(2024, 3, 10, 12, 40, 0, 0, time.UTC)},
+		{"*/15 * * * *", from, time.Date(2024, 3, 10, 12, 45, 0, 0, time.UTC)},
+		{"0-30/10 * * * *", from, time.Date(2024, 3, 10, 13, 0, 0, 0, time.UTC)},
+		{"5/20 * * * *", from, time.Date(2024, 3, 10, 12, 45, 0, 0, time.UTC)},
+		{"0 9,18 * * *", from, time.Date(2024, 3, 10, 18, 0, 0, 0, time.UTC)},
+		{"30 4 * * 1-5", from, time.Date(2024, 3, 11, 4, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", from, time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", from, time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", from, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", from, time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		// Day of month or day of week when both are restricted
+		{"0 0 15 * 1", from, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"0 0 11 * 5", from, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		// The start time itself never matches
+		{"34 12 * * *", from, time.Date(2024, 3, 11, 12, 34, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2024, 12, 31, 23, 59, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// Shortcuts
+		{"@hourly", from, time.Date(2024, 3, 10, 13, 0, 0, 0, time.UTC)},
+		{"@daily", from, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"@midnight", from, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", from, time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", from, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := s.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronNextInLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	s, err := Parse("0 3 * * *")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	from := time.Date(2024, 3, 10, 2, 0, 0, 0, loc)
+	want := time.Date(2024, 3, 10, 3, 0, 0, 0, loc)
+	if got := s.Next(from); !got.Equal(want) || got.Location() != loc {
+		t.Errorf("Next(%v) = %v, want %v", from, got, want)
+	}
+}
+
+func TestCronNextImpossible(t *testing.T) {
+	s, err := Parse("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := s.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next = %v, want the zero time", got)
+	}
+}
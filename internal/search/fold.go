@@ -0,0 +1,75 @@
+// Package search normalizes text for channel search. Names are folded to
+// lower case ASCII where possible, so "Şahin", "sahin" and "ŞAHİN" match the
+// same entries regardless of Turkish casing rules or diacritics.
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// foldRunes maps letters with diacritics to their base letters. Turkish
+// letters come first; the rest covers the Latin-1 and Latin Extended-A
+// letters that commonly appear in provider lists.
+var foldRunes = map[rune]string{
+	'ı': "i", 'İ': "i", 'ş': "s", 'Ş': "s", 'ğ': "g", 'Ğ': "g",
+	'ç': "c", 'Ç': "c", 'ö': "o", 'Ö': "o", 'ü': "u", 'Ü': "u",
+
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y",
+	'ñ': "n", 'ń': "n", 'ň': "n",
+	'ć': "c", 'č': "c",
+	'ď': "d", 'đ': "d",
+	'ł': "l", 'ľ': "l", 'ĺ': "l",
+	'ř': "r", 'ŕ': "r",
+	'ś': "s", 'š': "s",
+	'ť': "t", 'ţ': "t", 'ț': "t", 'ș': "s",
+	'ź': "z", 'ż': "z", 'ž': "z",
+	'ß': "ss", 'æ': "ae", 'œ': "oe",
+}
+
+// Fold lower-cases s, removes diacritics and replaces punctuation with
+// single spaces
+func Fold(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space := true
+	for _, r := range s {
+		// Turkish dotted and dotless I fold to the same letter before the
+		// generic lower-casing turns "I" into "i"
+		if folded, ok := foldRunes[r]; ok {
+			b.WriteString(folded)
+			space = false
+			continue
+		}
+		r = unicode.ToLower(r)
+		if folded, ok := foldRunes[r]; ok {
+			b.WriteString(folded)
+			space = false
+			continue
+		}
+		if unicode.Is(unicode.Mn, r) {
+			// Combining marks of decomposed input ("ş")
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			space = false
+			continue
+		}
+		if !space {
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), " ")
+}
+
+// Terms splits a query into folded search terms
+func Terms(query string) []string {
+	return strings.Fields(Fold(query))
+}
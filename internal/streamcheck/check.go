@@ -0,0 +1,234 @@
+// Package streamcheck performs lightweight health checks on live streams.
+// A check fetches the stream URL following redirects; HLS playlists are
+// resolved down to their first media segment, other streams only need to
+// deliver their first bytes. Nothing is decoded, so a check costs one
+// short-lived provider connection at a time.
+package streamcheck
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout bounds a whole check, including playlist lookups
+	DefaultTimeout = 15 * time.Second
+	// maxRedirects matches what players follow before giving up
+	maxRedirects = 10
+	// maxPlaylistSize bounds how much of a playlist is read
+	maxPlaylistSize = 1 << 20
+	// sampleSize is how many bytes a stream or segment must deliver
+	sampleSize = 4096
+	// maxPlaylistDepth bounds master -> media playlist lookups
+	maxPlaylistDepth = 3
+)
+
+// Options are the HTTP settings the player would use for the stream
+type Options struct {
+	UserAgent string
+	Referrer  string
+	// Timeout defaults to DefaultTimeout
+	Timeout time.Duration
+}
+
+// Result is the outcome of a check. Err is nil if the stream delivered data.
+type Result struct {
+	// StatusCode is the status of the last response, 0 if none arrived
+	StatusCode int
+	// Latency is the time until the stream URL answered
+	Latency time.Duration
+	// HLS reports whether the stream is an HLS playlist
+	HLS bool
+	Err error
+}
+
+// OK reports whether the stream delivered data
+func (r Result) OK() bool {
+	return r.Err == nil
+}
+
+var client = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	},
+}
+
+// Check fetches streamURL and reports whether it delivers data
+func Check(ctx context.Context, streamURL string, opts Options) Result {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var result Result
+	started := time.Now()
+	resp, err := fetch(ctx, streamURL, opts)
+	result.Latency = time.Since(started)
+	if resp != nil {
+		result.StatusCode = resp.StatusCode
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer resp.Body.Close()
+
+	head, err := readSample(resp.Body, sampleSize)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if !isPlaylist(resp, head) {
+		if len(head) == 0 {
+			result.Err = errors.New("stream returned no data")
+		}
+		return result
+	}
+
+	result.HLS = true
+	playlist, err := readAll(io.MultiReader(bytes.NewReader(head), resp.Body), maxPlaylistSize)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	status, err := checkPlaylist(ctx, resp.Request.URL, playlist, opts, maxPlaylistDepth)
+	if status != 0 {
+		result.StatusCode = status
+	}
+	result.Err = err
+	return result
+}
+
+// fetch sends a GET request and fails on error statuses. The response is
+// returned even then so the caller can record the status code.
+func fetch(ctx context.Context, target string, opts Options) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if opts.UserAgent != "" {
+		req.Header.Set("User-Agent", opts.UserAgent)
+	}
+	if opts.Referrer != "" {
+		req.Header.Set("Referer", opts.Referrer)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// url.Error messages carry the full request URL, credentials included
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, fmt.Errorf("%s: %v", urlErr.Op, urlErr.Err)
+		}
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return resp, fmt.Errorf("server returned status code %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// checkPlaylist follows a master playlist to its first variant and checks
+// the first segment of the media playlist
+func checkPlaylist(ctx context.Context, base *url.URL, playlist []byte, opts Options, depth int) (int, error) {
+	uri, master := firstURI(playlist)
+	if uri == "" {
+		return 0, errors.New("playlist has no segments")
+	}
+	target, err := base.Parse(uri)
+	if err != nil {
+		return 0, fmt.Errorf("invalid playlist entry: %v", err)
+	}
+
+	resp, err := fetch(ctx, target.String(), opts)
+	if err != nil {
+		if resp != nil {
+			return resp.StatusCode, err
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if !master {
+		sample, err := readSample(resp.Body, sampleSize)
+		if err == nil && len(sample) == 0 {
+			err = errors.New("segment returned no data")
+		}
+		return resp.StatusCode, err
+	}
+	if depth <= 1 {
+		return resp.StatusCode, errors.New("too many nested playlists")
+	}
+	variant, err := readAll(resp.Body, maxPlaylistSize)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	return checkPlaylist(ctx, resp.Request.URL, variant, opts, depth-1)
+}
+
+// firstURI returns the first URI of a playlist and whether it refers to a
+// variant playlist rather than a media segment
+func firstURI(playlist []byte) (string, bool) {
+	master := false
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF"):
+			master = true
+		case strings.HasPrefix(line, "#"):
+		default:
+			return line, master
+		}
+	}
+	return "", master
+}
+
+// isPlaylist reports whether a response is an HLS playlist
+func isPlaylist(resp *http.Response, head []byte) bool {
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+	if strings.Contains(contentType, "mpegurl") {
+		return true
+	}
+	if strings.HasSuffix(strings.ToLower(resp.Request.URL.Path), ".m3u8") {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimLeft(head, "\ufeff \r\n\t"), []byte("#EXTM3U"))
+}
+
+// readSample reads up to n bytes. A stream that ends early is not an error
+// as long as it delivered something.
+func readSample(r io.Reader, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := io.ReadFull(r, buf)
+	if read > 0 || err == io.EOF {
+		err = nil
+	}
+	return buf[:read], err
+}
+
+func readAll(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("playlist is larger than %d bytes", limit)
+	}
+	return data, nil
+}
@@ -1,14 +1,18 @@
 package xtream
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"remote-iptv/internal/redact"
 )
 
 type Client struct {
@@ -16,42 +20,70 @@ type Client struct {
 	Username string
 	Password string
 	client   *http.Client
+
+	// servers holds the provider's alternative base URLs, see NewClientWithServers
+	servers []string
+	mu      sync.Mutex
+
+	// OnServerError is called when a server fails to answer a request
+	OnServerError func(server string, err error)
+	// OnFailover is called after requests have moved to another server
+	OnFailover func(from, to string)
+
+	// ctx cancels in-flight requests, see SetContext
+	ctx context.Context
+}
+
+// SetContext makes all following requests use ctx. Cancelling it aborts
+// the request in flight, including a list that is still being decoded.
+func (c *Client) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
+func (c *Client) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
 }
 
 // Channel represents a channel in the Xtream API
+// Panels disagree on scalar types, so loosely typed fields use FlexInt and
+// FlexString.
 type Channel struct {
-	ID         int    `json:"stream_id"`
-	Name       string `json:"name"`
-	StreamType string `json:"stream_type"`
-	StreamURL  string `json:"stream_url"`
-	StreamIcon string `json:"stream_icon"`
-	CategoryID string `json:"category_id"`
-	Rating     string `json:"rating,omitempty"`
-	URL        string // URL for streaming the channel
-	Extension  string `json:"container_extension,omitempty"`
+	ID                FlexInt    `json:"stream_id"`
+	Num               FlexInt    `json:"num,omitempty"`
+	Name              FlexString `json:"name"`
+	StreamType        string     `json:"stream_type"`
+	StreamURL         string     `json:"stream_url"`
+	StreamIcon        string     `json:"stream_icon"`
+	CategoryID        FlexString `json:"category_id"`
+	Rating            FlexString `json:"rating,omitempty"`
+	URL               string     // URL for streaming the channel
+	Extension         string     `json:"container_extension,omitempty"`
+	EPGChannelID      string     `json:"epg_channel_id,omitempty"`
+	TVArchive         FlexInt    `json:"tv_archive,omitempty"`
+	TVArchiveDuration FlexInt    `json:"tv_archive_duration,omitempty"`
+	// Series lists and some VOD lists carry descriptive metadata
+	Plot  FlexString `json:"plot,omitempty"`
+	Cast  FlexString `json:"cast,omitempty"`
+	Genre FlexString `json:"genre,omitempty"`
 }
 
 type Category struct {
-	ID    json.Number `json:"category_id"`
-	Name  string      `json:"category_name"`
-	Type  string      `json:"category_type"`
+	ID       FlexInt    `json:"category_id"`
+	Name     FlexString `json:"category_name"`
+	Type     string     `json:"category_type"`
+	ParentID FlexInt    `json:"parent_id,omitempty"`
 }
 
-// Helper function to get category ID as int
+// Helper function to get category ID as int. Missing or empty IDs are 0.
 func (c *Category) GetID() (int, error) {
-	// Boş string kontrolü
-	if c.ID.String() == "" {
-		return 0, nil // Boş string durumunda varsayılan olarak 0 döndür
-	}
-	
-	id, err := c.ID.Int64()
-	if err != nil {
-		return 0, err
-	}
-	return int(id), nil
+	return c.ID.Int(), nil
 }
 
 func NewClient(baseURL, username, password string) *Client {
+	redact.AddSecret(password)
 	client := &http.Client{
 		Timeout: 120 * time.Second,
 		Transport: &http.Transport{
@@ -71,226 +103,213 @@ func NewClient(baseURL, username, password string) *Client {
 	}
 }
 
-// makeRequest performs an HTTP request with Tivimate User-Agent
+// makeRequest performs an HTTP request with Tivimate User-Agent. When the
+// server is unreachable the request is repeated on the provider's other
+// servers and the first one that answers becomes the active server.
 func (c *Client) makeRequest(url string) (*http.Response, error) {
 	time.Sleep(1 * time.Second)
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
+	order := c.failoverOrder()
+	path := ""
+	matched := false
+	for _, server := range order {
+		if server != "" && strings.HasPrefix(url, server) {
+			path = strings.TrimPrefix(url, server)
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return c.do(url)
 	}
-
-	req.Header.Set("User-Agent", "Tivimate/4.8.0")
-	req.Header.Set("Accept", "*/*")
-	req.Header.Set("Connection", "keep-alive")
-	return c.client.Do(req)
-}
-
-func (c *Client) GetLiveStreams() ([]Channel, error) {
-	endpoint := fmt.Sprintf("%s/player_api.php", c.BaseURL)
-	params := url.Values{}
-	params.Add("username", c.Username)
-	params.Add("password", c.Password)
-	params.Add("action", "get_live_streams")
-
-	fullURL := endpoint + "?" + params.Encode()
-	log.Printf("Fetching live streams from: %s", fullURL)
 
 	var resp *http.Response
 	var err error
-	for i := 0; i < 3; i++ {
-		resp, err = c.makeRequest(fullURL)
-		if err == nil && resp.StatusCode == http.StatusOK {
-			break
+	for i, server := range order {
+		resp, err = c.do(server + path)
+		if ctxErr := c.context().Err(); ctxErr != nil {
+			// Cancelled requests say nothing about the server's health
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctxErr
 		}
-		if err != nil {
-			log.Printf("Attempt %d: Error fetching live streams: %v", i+1, err)
-		} else {
-			log.Printf("Attempt %d: Got status code %d", i+1, resp.StatusCode)
+		failure := serverFailed(resp, err)
+		if failure == nil {
+			if i > 0 && c.switchServer(order[0], server) {
+				log.Printf("Xtream server %s is unreachable, switched to %s", order[0], server)
+				if c.OnFailover != nil {
+					c.OnFailover(order[0], server)
+				}
+			}
+			return resp, nil
+		}
+		if c.OnServerError != nil {
+			c.OnServerError(server, failure)
+		}
+		if i < len(order)-1 && resp != nil {
 			resp.Body.Close()
 		}
-		time.Sleep(2 * time.Second)
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed after 3 attempts: %v", err)
-	}
-	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
-		return nil, fmt.Errorf("server returned status code %d", resp.StatusCode)
 	}
-	defer resp.Body.Close()
+	return resp, err
+}
 
-	body, err := io.ReadAll(resp.Body)
+func (c *Client) do(url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.context(), "GET", url, nil)
 	if err != nil {
-		log.Printf("Error reading response body: %v", err)
 		return nil, err
 	}
 
-	var channels []Channel
-	if err := json.Unmarshal(body, &channels); err != nil {
-		log.Printf("Error unmarshaling channels: %v", err)
-		return nil, err
-	}
-
-	// Set stream type and URL for all live channels
-	for i := range channels {
-		channels[i].StreamType = "live"
-		//channels[i].URL = c.GetStreamURL(channels[i].ID)
-	}
-
-	log.Printf("Successfully fetched %d live streams", len(channels))
-	return channels, nil
+	req.Header.Set("User-Agent", "Tivimate/4.8.0")
+	req.Header.Set("Accept", "*/*")
+	req.Header.Set("Connection", "keep-alive")
+	return c.client.Do(req)
 }
 
-func (c *Client) GetCategories() ([]Category, error) {
-	endpoint := fmt.Sprintf("%s/player_api.php", c.BaseURL)
-	params := url.Values{}
-	params.Add("username", c.Username)
-	params.Add("password", c.Password)
-	params.Add("action", "get_live_categories")
+// GetLiveStreams returns all live streams. Large catalogues should use
+// StreamLiveStreams instead, which does not hold the list in memory.
+func (c *Client) GetLiveStreams() ([]Channel, error) {
+	return collectChannels(c.StreamLiveStreams)
+}
 
-	resp, err := http.Get(endpoint + "?" + params.Encode())
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+// StreamLiveStreams decodes the live stream list item by item and calls fn
+// for each channel
+func (c *Client) StreamLiveStreams(fn func(Channel) error) (DecodeReport, error) {
+	return c.streamChannels("get_live_streams", "live", "live streams", fn)
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+func (c *Client) GetStreamURL(ch Channel) string {
+	streamURL, _ := c.ResolveStreamPath(StreamPath(ch))
+	return streamURL
+}
 
-	var categories []Category
-	if err := json.Unmarshal(body, &categories); err != nil {
-		return nil, err
+// StreamPath returns the credential free path of a stream, such as
+// "live/123.m3u8". It is what gets stored; ResolveStreamPath turns it into
+// a playable URL when needed.
+func StreamPath(ch Channel) string {
+	if ch.StreamType == "live" {
+		return fmt.Sprintf("%s/%d.m3u8", ch.StreamType, ch.ID)
 	}
-
-	return categories, nil
+	return fmt.Sprintf("%s/%d.%s", ch.StreamType, ch.ID, ch.Extension)
 }
 
-func (c *Client) GetStreamURL(ch Channel) string {
-	if ch.StreamType == "live" {
-		return fmt.Sprintf("%s/%s/%s/%s/%d.m3u8", c.BaseURL, ch.StreamType, c.Username, c.Password, ch.ID)
-	} else {
-		return fmt.Sprintf("%s/%s/%s/%s/%d.%s", c.BaseURL, ch.StreamType, c.Username, c.Password, ch.ID, ch.Extension)
+// ResolveStreamPath builds the full stream URL on the active server for a
+// path returned by StreamPath. It reports false for anything else.
+func (c *Client) ResolveStreamPath(path string) (string, bool) {
+	streamType, rest, ok := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if !ok || rest == "" || strings.Contains(rest, "/") {
+		return "", false
 	}
+	switch streamType {
+	case "live", "movie", "series":
+	default:
+		return "", false
+	}
+	return fmt.Sprintf("%s/%s/%s/%s/%s", strings.TrimSuffix(c.ActiveServer(), "/"), streamType,
+		c.Username, c.Password, rest), true
 }
 
-func (c *Client) GetLiveCategories() ([]Category, error) {
-	endpoint := fmt.Sprintf("%s/player_api.php", c.BaseURL)
+// XMLTVURL returns the address of the provider's full XMLTV guide
+func (c *Client) XMLTVURL() string {
 	params := url.Values{}
 	params.Add("username", c.Username)
 	params.Add("password", c.Password)
-	params.Add("action", "get_live_categories")
-
-	fullURL := endpoint + "?" + params.Encode()
-	log.Printf("Fetching live categories from: %s", fullURL)
-
-	resp, err := c.makeRequest(fullURL)
-	if err != nil {
-		log.Printf("Error fetching live categories: %v", err)
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Error reading response body: %v", err)
-		return nil, err
-	}
-
-	// log.Printf("Live categories response: %s", string(body))
-
-	var categories []Category
-	if err := json.Unmarshal(body, &categories); err != nil {
-		log.Printf("Error unmarshaling categories: %v", err)
-		return nil, err
-	}
+	return fmt.Sprintf("%s/xmltv.php?%s", strings.TrimSuffix(c.ActiveServer(), "/"), params.Encode())
+}
 
-	log.Printf("Successfully fetched %d live categories", len(categories))
-	return categories, nil
+func (c *Client) GetLiveCategories() ([]Category, error) {
+	categories, _, err := c.FetchCategories("live")
+	return categories, err
 }
 
 func (c *Client) GetMovieCategories() ([]Category, error) {
-	endpoint := fmt.Sprintf("%s/player_api.php", c.BaseURL)
-	params := url.Values{}
-	params.Add("username", c.Username)
-	params.Add("password", c.Password)
-	params.Add("action", "get_vod_categories")
+	categories, _, err := c.FetchCategories("movie")
+	return categories, err
+}
 
-	fullURL := endpoint + "?" + params.Encode()
-	log.Printf("Fetching movie categories from: %s", fullURL)
+func (c *Client) GetSeriesCategories() ([]Category, error) {
+	categories, _, err := c.FetchCategories("series")
+	return categories, err
+}
 
-	resp, err := c.makeRequest(fullURL)
-	if err != nil {
-		log.Printf("Error fetching movie categories: %v", err)
-		return nil, err
+// FetchCategories returns the categories of a stream type (live, movie or
+// series) together with a report of the items that could not be decoded
+func (c *Client) FetchCategories(streamType string) ([]Category, DecodeReport, error) {
+	actions := map[string]string{
+		"live":   "get_live_categories",
+		"movie":  "get_vod_categories",
+		"series": "get_series_categories",
 	}
-	defer resp.Body.Close()
+	action, ok := actions[streamType]
+	if !ok {
+		return nil, DecodeReport{}, fmt.Errorf("unknown stream type %q", streamType)
+	}
+	what := streamType + " categories"
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.openList(action, what)
 	if err != nil {
-		log.Printf("Error reading response body: %v", err)
-		return nil, err
+		log.Printf("Error fetching %s: %v", what, err)
+		return nil, DecodeReport{}, err
 	}
-
-	// log.Printf("Movie categories response: %s", string(body))
+	defer body.Close()
 
 	var categories []Category
-	if err := json.Unmarshal(body, &categories); err != nil {
-		log.Printf("Error unmarshaling categories: %v", err)
-		return nil, err
+	report, err := decodeList(body, func(cat Category) error {
+		categories = append(categories, cat)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error decoding %s: %v", what, err)
+		return nil, report, err
+	}
+	if report.Skipped > 0 {
+		log.Printf("Skipped %d malformed %s", report.Skipped, what)
 	}
 
-	log.Printf("Successfully fetched %d movie categories", len(categories))
-	return categories, nil
+	log.Printf("Successfully fetched %d %s", len(categories), what)
+	return categories, report, nil
 }
 
-func (c *Client) GetSeriesCategories() ([]Category, error) {
-	endpoint := fmt.Sprintf("%s/player_api.php", c.BaseURL)
-	params := url.Values{}
-	params.Add("username", c.Username)
-	params.Add("password", c.Password)
-	params.Add("action", "get_series_categories")
-
-	fullURL := endpoint + "?" + params.Encode()
-	log.Printf("Fetching series categories from: %s", fullURL)
-
-	resp, err := c.makeRequest(fullURL)
-	if err != nil {
-		log.Printf("Error fetching series categories: %v", err)
-		return nil, err
-	}
-	defer resp.Body.Close()
+// GetMovieStreams film akışlarını getirir
+func (c *Client) GetMovieStreams() ([]Channel, error) {
+	return collectChannels(c.StreamMovieStreams)
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Error reading response body: %v", err)
-		return nil, err
-	}
+// StreamMovieStreams film listesini öğe öğe çözüp her film için fn'i çağırır
+func (c *Client) StreamMovieStreams(fn func(Channel) error) (DecodeReport, error) {
+	return c.streamChannels("get_vod_streams", "movie", "movie streams", fn)
+}
 
-	// log.Printf("Series categories response: %s", string(body))
+// GetSeriesStreams dizi akışlarını getirir
+func (c *Client) GetSeriesStreams() ([]Channel, error) {
+	return collectChannels(c.StreamSeriesStreams)
+}
 
-	var categories []Category
-	if err := json.Unmarshal(body, &categories); err != nil {
-		log.Printf("Error unmarshaling categories: %v", err)
-		return nil, err
-	}
+// StreamSeriesStreams dizi listesini öğe öğe çözüp her dizi için fn'i çağırır
+func (c *Client) StreamSeriesStreams(fn func(Channel) error) (DecodeReport, error) {
+	return c.streamChannels("get_series", "series", "series streams", fn)
+}
 
-	log.Printf("Successfully fetched %d series categories", len(categories))
-	return categories, nil
+// collectChannels gathers a streamed list into a slice
+func collectChannels(stream func(func(Channel) error) (DecodeReport, error)) ([]Channel, error) {
+	var channels []Channel
+	_, err := stream(func(ch Channel) error {
+		channels = append(channels, ch)
+		return nil
+	})
+	return channels, err
 }
 
-// GetMovieStreams film akışlarını getirir
-func (c *Client) GetMovieStreams() ([]Channel, error) {
-	endpoint := fmt.Sprintf("%s/player_api.php", c.BaseURL)
+// openList requests a player_api.php list action, retrying up to three times
+func (c *Client) openList(action, what string) (io.ReadCloser, error) {
+	endpoint := fmt.Sprintf("%s/player_api.php", c.ActiveServer())
 	params := url.Values{}
 	params.Add("username", c.Username)
 	params.Add("password", c.Password)
-	params.Add("action", "get_vod_streams")
+	params.Add("action", action)
 
 	fullURL := endpoint + "?" + params.Encode()
-	log.Printf("Fetching movie streams from: %s", fullURL)
+	log.Printf("Fetching %s from: %s", what, redact.URL(fullURL))
 
 	var resp *http.Response
 	var err error
@@ -299,8 +318,11 @@ func (c *Client) GetMovieStreams() ([]Channel, error) {
 		if err == nil && resp.StatusCode == http.StatusOK {
 			break
 		}
+		if ctxErr := c.context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		if err != nil {
-			log.Printf("Attempt %d: Error fetching movie streams: %v", i+1, err)
+			log.Printf("Attempt %d: Error fetching %s: %v", i+1, what, err)
 		} else {
 			log.Printf("Attempt %d: Got status code %d", i+1, resp.StatusCode)
 			resp.Body.Close()
@@ -311,71 +333,45 @@ func (c *Client) GetMovieStreams() ([]Channel, error) {
 		return nil, fmt.Errorf("failed after 3 attempts: %v", err)
 	}
 	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
 		return nil, fmt.Errorf("server returned status code %d", resp.StatusCode)
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Error reading movie streams response: %v", err)
-		return nil, err
-	}
-
-	var channels []Channel
-	if err := json.Unmarshal(body, &channels); err != nil {
-		log.Printf("Error unmarshaling movie streams: %v", err)
-		return nil, err
-	}
-
-	// Set stream type for all movie channels
-	for i := range channels {
-		channels[i].StreamType = "movie"
-		//channels[i].URL = c.GetStreamURL(channels[i].ID)
-	}
-
-	log.Printf("Successfully fetched %d movie streams", len(channels))
-	return channels, nil
+	return resp.Body, nil
 }
 
-// GetSeriesStreams dizi akışlarını getirir
-func (c *Client) GetSeriesStreams() ([]Channel, error) {
-	endpoint := fmt.Sprintf("%s/player_api.php", c.BaseURL)
-	params := url.Values{}
-	params.Add("username", c.Username)
-	params.Add("password", c.Password)
-	params.Add("action", "get_series")
-
-	fullURL := endpoint + "?" + params.Encode()
-	log.Printf("Fetching series streams from: %s", fullURL)
-
-	resp, err := c.makeRequest(fullURL)
+// streamChannels fetches a channel list and decodes it one element at a
+// time, so only a single channel is held in memory. Malformed items are
+// skipped and counted in the returned report.
+func (c *Client) streamChannels(action, streamType, what string, fn func(Channel) error) (DecodeReport, error) {
+	body, err := c.openList(action, what)
 	if err != nil {
-		log.Printf("Error fetching series streams: %v", err)
-		return nil, err
+		return DecodeReport{}, err
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	report, err := decodeList(body, func(ch Channel) error {
+		ch.StreamType = streamType
+		return fn(ch)
+	})
 	if err != nil {
-		log.Printf("Error reading series streams response: %v", err)
-		return nil, err
+		log.Printf("Error decoding %s: %v", what, err)
+		return report, err
 	}
-
-	var channels []Channel
-	if err := json.Unmarshal(body, &channels); err != nil {
-		log.Printf("Error unmarshaling series streams: %v", err)
-		return nil, err
+	if report.Skipped > 0 {
+		log.Printf("Skipped %d malformed %s", report.Skipped, what)
 	}
 
-	// Set stream type and URL for all series channels
-	for i := range channels {
-		channels[i].StreamType = "series"
-		// channels[i].URL = c.GetStreamURL(channels[i].ID)
-	}
+	log.Printf("Successfully fetched %d %s", report.Decoded, what)
+	return report, nil
+}
+
+// HasArchive reports whether the provider keeps a catch-up archive for the channel
+func (c *Channel) HasArchive() bool {
+	return c.TVArchive > 0
+}
 
-	log.Printf("Successfully fetched %d series streams", len(channels))
-	return channels, nil
+// ArchiveDays returns how many days of catch-up the provider keeps
+func (c *Channel) ArchiveDays() int {
+	return c.TVArchiveDuration.Int()
 }
 
 // GetCategoryID returns the category ID as an integer
@@ -383,5 +379,5 @@ func (c *Channel) GetCategoryID() (int, error) {
 	if c.CategoryID == "" {
 		return 0, nil
 	}
-	return strconv.Atoi(c.CategoryID)
+	return strconv.Atoi(c.CategoryID.String())
 } 
\ No newline at end of file
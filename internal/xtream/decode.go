@@ -0,0 +1,78 @@
+package xtream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// maxReportedErrors limits how many item errors a DecodeReport keeps
+const maxReportedErrors = 10
+
+// DecodeReport summarises a list response that was decoded item by item.
+// Items that fail to decode are skipped and counted instead of failing the
+// whole list.
+type DecodeReport struct {
+	Decoded int      `json:"decoded"`
+	Skipped int      `json:"skipped"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+func (r *DecodeReport) skip(index int, err error) {
+	r.Skipped++
+	if len(r.Errors) < maxReportedErrors {
+		r.Errors = append(r.Errors, fmt.Sprintf("item %d: %v", index, err))
+	}
+}
+
+// decodeList iterates over a JSON list with json.Decoder tokens and calls fn
+// for every item. Panels sometimes return the list as an object keyed by
+// ID, in which case the object's values are used; null or an empty body is
+// an empty list. Each item is decoded on its own, so one malformed item is
+// skipped and reported without aborting the rest. Errors returned by fn
+// stop the decode.
+func decodeList[T any](r io.Reader, fn func(T) error) (DecodeReport, error) {
+	var report DecodeReport
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err == io.EOF || (err == nil && tok == nil) {
+		return report, nil
+	}
+	if err != nil {
+		return report, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok || (delim != '[' && delim != '{') {
+		return report, fmt.Errorf("expected a JSON list, got %v", tok)
+	}
+
+	for index := 0; dec.More(); index++ {
+		if delim == '{' {
+			// Skip the key of object shaped lists
+			if _, err := dec.Token(); err != nil {
+				return report, err
+			}
+		}
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return report, err
+		}
+
+		var item T
+		if err := json.Unmarshal(raw, &item); err != nil {
+			report.skip(index, err)
+			continue
+		}
+		if err := fn(item); err != nil {
+			return report, err
+		}
+		report.Decoded++
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return report, err
+	}
+	return report, nil
+}
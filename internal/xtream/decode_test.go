@@ -0,0 +1,127 @@
+package xtream
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testItem struct {
+	ID   FlexInt    `json:"id"`
+	Name FlexString `json:"name"`
+}
+
+func TestDecodeList(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		want        []testItem
+		wantSkipped int
+		wantErr     bool
+	}{
+		{
+			name: "array",
+			body: `[{"id":1,"name":"a"},{"id":"2","name":"b"}]`,
+			want: []testItem{{1, "a"}, {2, "b"}},
+		},
+		{
+			name: "object keyed by id",
+			body: `{"10":{"id":10,"name":"a"},"20":{"id":20,"name":"b"}}`,
+			want: []testItem{{10, "a"}, {20, "b"}},
+		},
+		{
+			name: "empty array",
+			body: `[]`,
+		},
+		{
+			name: "empty object",
+			body: `{}`,
+		},
+		{
+			name: "null",
+			body: `null`,
+		},
+		{
+			name: "empty body",
+			body: ``,
+		},
+		{
+			name: "whitespace body",
+			body: " \n",
+		},
+		{
+			name:        "malformed items are skipped",
+			body:        `[{"id":1,"name":"a"},{"id":"x","name":"b"},{"id":3,"name":{}},"text",{"id":4,"name":"d"}]`,
+			want:        []testItem{{1, "a"}, {4, "d"}},
+			wantSkipped: 3,
+		},
+		{
+			name:        "malformed items in object shaped list",
+			body:        `{"1":{"id":1},"2":{"id":[]}}`,
+			want:        []testItem{{1, ""}},
+			wantSkipped: 1,
+		},
+		{
+			name: "null items decode to zero values",
+			body: `[null,{"id":2}]`,
+			want: []testItem{{0, ""}, {2, ""}},
+		},
+		{
+			name:    "not a list",
+			body:    `"error"`,
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			body:    `[{"id":1},{"id":`,
+			want:    []testItem{{1, ""}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []testItem
+			report, err := decodeList(strings.NewReader(tt.body), func(item testItem) error {
+				got = append(got, item)
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeList error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("items = %+v, want %+v", got, tt.want)
+			}
+			if report.Decoded != len(tt.want) || report.Skipped != tt.wantSkipped {
+				t.Errorf("report = %+v, want %d decoded and %d skipped", report, len(tt.want), tt.wantSkipped)
+			}
+			if len(report.Errors) != tt.wantSkipped {
+				t.Errorf("report has %d errors, want %d", len(report.Errors), tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestDecodeListLimitsReportedErrors(t *testing.T) {
+	body := "[" + strings.Repeat(`{"id":"x"},`, maxReportedErrors+5) + `{"id":1}]`
+	report, err := decodeList(strings.NewReader(body), func(testItem) error { return nil })
+	if err != nil {
+		t.Fatalf("decodeList: %v", err)
+	}
+	if report.Skipped != maxReportedErrors+5 || len(report.Errors) != maxReportedErrors || report.Decoded != 1 {
+		t.Errorf("report = %d decoded, %d skipped, %d errors", report.Decoded, report.Skipped, len(report.Errors))
+	}
+}
+
+func TestDecodeListStopsOnCallbackError(t *testing.T) {
+	errStop := errors.New("stop")
+	calls := 0
+	_, err := decodeList(strings.NewReader(`[{"id":1},{"id":2}]`), func(testItem) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Errorf("decodeList returned %v after %d calls, want %v after 1", err, calls, errStop)
+	}
+}
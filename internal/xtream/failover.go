@@ -0,0 +1,194 @@
+package xtream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// probeTimeout bounds a single server health check
+const probeTimeout = 10 * time.Second
+
+// ProbeResult is the outcome of a health check against one server
+type ProbeResult struct {
+	Server  string
+	Latency time.Duration
+	Err     error
+}
+
+// NewClientWithServers creates a client that fails over between several
+// base URLs of the same provider. servers are tried in the given order,
+// starting with the first one.
+func NewClientWithServers(servers []string, username, password string) *Client {
+	var cleaned []string
+	for _, server := range servers {
+		server = strings.TrimSuffix(strings.TrimSpace(server), "/")
+		if server != "" {
+			cleaned = append(cleaned, server)
+		}
+	}
+	if len(cleaned) == 0 {
+		cleaned = []string{""}
+	}
+
+	c := NewClient(cleaned[0], username, password)
+	c.servers = cleaned
+	return c
+}
+
+// Servers returns the configured base URLs in priority order
+func (c *Client) Servers() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.servers) == 0 {
+		return []string{c.BaseURL}
+	}
+	return append([]string(nil), c.servers...)
+}
+
+// ActiveServer returns the base URL currently used for requests and
+// stream URLs
+func (c *Client) ActiveServer() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.BaseURL
+}
+
+// UseServer makes server the active base URL
+func (c *Client) UseServer(server string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.BaseURL = strings.TrimSuffix(server, "/")
+}
+
+// failoverOrder returns the servers to try, starting with the active one
+func (c *Client) failoverOrder() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.servers) == 0 {
+		return []string{c.BaseURL}
+	}
+	order := []string{c.BaseURL}
+	for _, server := range c.servers {
+		if server != c.BaseURL {
+			order = append(order, server)
+		}
+	}
+	return order
+}
+
+// switchServer makes to the active server unless another request has
+// already moved away from from
+func (c *Client) switchServer(from, to string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.BaseURL != from {
+		return false
+	}
+	c.BaseURL = to
+	return true
+}
+
+// serverFailed reports whether a response means the server itself is
+// unusable, as opposed to an error for the individual request
+func serverFailed(resp *http.Response, err error) error {
+	if err != nil {
+		// url.Error messages carry the full request URL, credentials included
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("%s: %v", urlErr.Op, urlErr.Err)
+		}
+		return err
+	}
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("server returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Probe checks that server answers player_api.php with valid account info
+func (c *Client) Probe(server string) ProbeResult {
+	server = strings.TrimSuffix(server, "/")
+	params := url.Values{}
+	params.Add("username", c.Username)
+	params.Add("password", c.Password)
+
+	req, err := http.NewRequest("GET", server+"/player_api.php?"+params.Encode(), nil)
+	if err != nil {
+		return ProbeResult{Server: server, Err: err}
+	}
+	req.Header.Set("User-Agent", "Tivimate/4.8.0")
+
+	client := &http.Client{Timeout: probeTimeout, Transport: c.client.Transport}
+	started := time.Now()
+	resp, err := client.Do(req)
+	if err := serverFailed(resp, err); err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return ProbeResult{Server: server, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ProbeResult{Server: server, Err: fmt.Errorf("server returned status code %d", resp.StatusCode)}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ProbeResult{Server: server, Err: err}
+	}
+	var info AccountInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return ProbeResult{Server: server, Err: fmt.Errorf("invalid account info: %v", err)}
+	}
+	return ProbeResult{Server: server, Latency: time.Since(started)}
+}
+
+// ProbeAll checks every configured server in parallel. Results are
+// returned in priority order.
+func (c *Client) ProbeAll() []ProbeResult {
+	servers := c.Servers()
+	results := make([]ProbeResult, len(servers))
+
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+			results[i] = c.Probe(server)
+		}(i, server)
+	}
+	wg.Wait()
+	return results
+}
+
+// SelectHealthy makes the first healthy server in priority order active
+// and returns it. If no server is healthy the active server is kept and
+// an empty string is returned.
+func (c *Client) SelectHealthy(results []ProbeResult) string {
+	for _, result := range results {
+		if result.Err == nil {
+			c.UseServer(result.Server)
+			return result.Server
+		}
+	}
+	return ""
+}
+
+// RebaseURL moves a stream URL that was generated for one of the
+// configured servers onto the active server
+func (c *Client) RebaseURL(streamURL string) string {
+	active := c.ActiveServer()
+	for _, server := range c.Servers() {
+		if server != "" && server != active && strings.HasPrefix(streamURL, server+"/") {
+			return active + strings.TrimPrefix(streamURL, server)
+		}
+	}
+	return streamURL
+}
@@ -0,0 +1,113 @@
+package xtream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// timeshiftLayout is the start time format Xtream panels expect in
+// timeshift URLs, expressed in the server's own timezone
+const timeshiftLayout = "2006-01-02:15-04"
+
+// UserInfo describes the subscription as reported by player_api.php
+type UserInfo struct {
+	Username             string      `json:"username"`
+	Status               string      `json:"status"`
+	ExpDate              json.Number `json:"exp_date,omitempty"`
+	IsTrial              json.Number `json:"is_trial,omitempty"`
+	ActiveConnections    FlexInt     `json:"active_cons,omitempty"`
+	MaxConnections       FlexInt     `json:"max_connections,omitempty"`
+	AllowedOutputFormats []string    `json:"allowed_output_formats"`
+}
+
+// ServerInfo describes the panel as reported by player_api.php
+type ServerInfo struct {
+	URL            string      `json:"url"`
+	Port           json.Number `json:"port,omitempty"`
+	HTTPSPort      json.Number `json:"https_port,omitempty"`
+	ServerProtocol string      `json:"server_protocol"`
+	Timezone       string      `json:"timezone"`
+	TimeNow        string      `json:"time_now"`
+	TimestampNow   json.Number `json:"timestamp_now,omitempty"`
+}
+
+// AccountInfo is the response of player_api.php without an action
+type AccountInfo struct {
+	UserInfo   UserInfo   `json:"user_info"`
+	ServerInfo ServerInfo `json:"server_info"`
+}
+
+// Location returns the server's timezone. Panels that report an unknown
+// zone are assumed to run on UTC.
+func (s *ServerInfo) Location() *time.Location {
+	if s.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		log.Printf("Unknown provider timezone %q, using UTC", s.Timezone)
+		return time.UTC
+	}
+	return loc
+}
+
+// GetAccountInfo fetches the subscription and server details
+func (c *Client) GetAccountInfo() (*AccountInfo, error) {
+	params := url.Values{}
+	params.Add("username", c.Username)
+	params.Add("password", c.Password)
+	fullURL := fmt.Sprintf("%s/player_api.php?%s", strings.TrimSuffix(c.ActiveServer(), "/"), params.Encode())
+
+	resp, err := c.makeRequest(fullURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var info AccountInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		log.Printf("Error unmarshaling account info: %v", err)
+		return nil, err
+	}
+	return &info, nil
+}
+
+// archiveMinutes rounds the archive duration up to whole minutes
+func archiveMinutes(duration time.Duration) int {
+	minutes := int((duration + time.Minute - 1) / time.Minute)
+	if minutes < 1 {
+		minutes = 1
+	}
+	return minutes
+}
+
+// TimeshiftURL builds the path style catch-up URL
+// {base}/timeshift/{user}/{pass}/{minutes}/{start}/{id}.ts. start is
+// converted to loc, the provider's timezone.
+func (c *Client) TimeshiftURL(streamID int, start time.Time, duration time.Duration, loc *time.Location) string {
+	return fmt.Sprintf("%s/timeshift/%s/%s/%d/%s/%d.ts",
+		strings.TrimSuffix(c.ActiveServer(), "/"), url.PathEscape(c.Username), url.PathEscape(c.Password),
+		archiveMinutes(duration), start.In(loc).Format(timeshiftLayout), streamID)
+}
+
+// TimeshiftPHPURL builds the streaming/timeshift.php variant of
+// TimeshiftURL, which some panels require instead of the path style
+func (c *Client) TimeshiftPHPURL(streamID int, start time.Time, duration time.Duration, loc *time.Location) string {
+	params := url.Values{}
+	params.Add("username", c.Username)
+	params.Add("password", c.Password)
+	params.Add("stream", fmt.Sprint(streamID))
+	params.Add("start", start.In(loc).Format(timeshiftLayout))
+	params.Add("duration", fmt.Sprint(archiveMinutes(duration)))
+	return fmt.Sprintf("%s/streaming/timeshift.php?%s", strings.TrimSuffix(c.ActiveServer(), "/"), params.Encode())
+}
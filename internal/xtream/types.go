@@ -0,0 +1,83 @@
+package xtream
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FlexInt decodes integers that panels send as numbers, numeric strings,
+// empty strings, booleans or null. Empty values decode to 0.
+type FlexInt int
+
+// UnmarshalJSON implements json.Unmarshaler
+func (f *FlexInt) UnmarshalJSON(data []byte) error {
+	value := string(bytes.TrimSpace(data))
+	if strings.HasPrefix(value, `"`) {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		value = strings.TrimSpace(s)
+	}
+
+	switch value {
+	case "", "null", "false":
+		*f = 0
+		return nil
+	case "true":
+		*f = 1
+		return nil
+	}
+
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		*f = FlexInt(i)
+		return nil
+	}
+	if fl, err := strconv.ParseFloat(value, 64); err == nil {
+		*f = FlexInt(fl)
+		return nil
+	}
+	return fmt.Errorf("xtream: cannot use %s as an integer", data)
+}
+
+// Int returns the value as an int
+func (f FlexInt) Int() int {
+	return int(f)
+}
+
+// FlexString decodes text fields that panels send as strings, numbers,
+// booleans or null. null decodes to an empty string.
+type FlexString string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (f *FlexString) UnmarshalJSON(data []byte) error {
+	value := bytes.TrimSpace(data)
+	if len(value) == 0 || string(value) == "null" {
+		*f = ""
+		return nil
+	}
+
+	switch value[0] {
+	case '"':
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			return err
+		}
+		*f = FlexString(s)
+		return nil
+	case '{', '[':
+		return fmt.Errorf("xtream: cannot use %s as a string", value)
+	default:
+		// Numbers and booleans keep their JSON spelling
+		*f = FlexString(value)
+		return nil
+	}
+}
+
+// String returns the value as a plain string
+func (f FlexString) String() string {
+	return string(f)
+}
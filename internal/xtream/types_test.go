@@ -0,0 +1,98 @@
+package xtream
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFlexInt(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    FlexInt
+		wantErr bool
+	}{
+		{input: `42`, want: 42},
+		{input: `-7`, want: -7},
+		{input: `"42"`, want: 42},
+		{input: `" 42 "`, want: 42},
+		{input: `""`, want: 0},
+		{input: `null`, want: 0},
+		{input: `"null"`, want: 0},
+		{input: `true`, want: 1},
+		{input: `false`, want: 0},
+		{input: `"true"`, want: 1},
+		{input: `12.9`, want: 12},
+		{input: `"3.5"`, want: 3},
+		{input: `"abc"`, wantErr: true},
+		{input: `[1]`, wantErr: true},
+		{input: `{}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			f := FlexInt(99)
+			err := json.Unmarshal([]byte(tt.input), &f)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Unmarshal(%s) = %d, want an error", tt.input, f)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal(%s): %v", tt.input, err)
+			}
+			if f != tt.want {
+				t.Errorf("Unmarshal(%s) = %d, want %d", tt.input, f, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlexString(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    FlexString
+		wantErr bool
+	}{
+		{input: `"TRT 1"`, want: "TRT 1"},
+		{input: `""`, want: ""},
+		{input: `null`, want: ""},
+		{input: `"çay"`, want: "çay"},
+		{input: `123`, want: "123"},
+		{input: `4.5`, want: "4.5"},
+		{input: `true`, want: "true"},
+		{input: `{"a":1}`, wantErr: true},
+		{input: `["a"]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			f := FlexString("previous")
+			err := json.Unmarshal([]byte(tt.input), &f)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Unmarshal(%s) = %q, want an error", tt.input, f)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal(%s): %v", tt.input, err)
+			}
+			if f != tt.want {
+				t.Errorf("Unmarshal(%s) = %q, want %q", tt.input, f, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlexFieldsInStruct(t *testing.T) {
+	var ch Channel
+	data := `{"stream_id":"101","num":null,"name":2024,"category_id":5,"tv_archive":"1","tv_archive_duration":""}`
+	if err := json.Unmarshal([]byte(data), &ch); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if ch.ID != 101 || ch.Num != 0 || ch.Name != "2024" || ch.CategoryID != "5" ||
+		ch.TVArchive != 1 || ch.TVArchiveDuration != 0 {
+		t.Errorf("decoded channel = %+v", ch)
+	}
+}
@@ -67,6 +67,7 @@ interface Channel {
   stream_icon?: string;
   rating?: number;
   added?: string;
+  channel_id?: number;  // Favorilerde kanalın ID'si (id favori kaydının ID'sidir)
 }
 
 interface Category {
@@ -82,6 +83,24 @@ interface XtreamSettings {
   password: string;
 }
 
+interface SyncJob {
+  id: string;
+  status: 'running' | 'completed' | 'failed' | 'cancelled';
+  error?: string;
+}
+
+// Senkronizasyon arka planda iş olarak çalışır; iş bitene kadar durumu yoklanır
+const syncPollInterval = 2000;
+
+const waitForSyncJob = async (job: SyncJob): Promise<SyncJob> => {
+  while (job.status === 'running') {
+    await new Promise(resolve => setTimeout(resolve, syncPollInterval));
+    const response = await axios.get<SyncJob>(`/api/sync/jobs/${job.id}`);
+    job = response.data;
+  }
+  return job;
+};
+
 function App() {
   const [mobileOpen, setMobileOpen] = useState(false);
   const [channels, setChannels] = useState<Channel[]>([]);
@@ -353,7 +372,8 @@ function App() {
       const requestData = {
         url: channelData.url,
         name: channelData.name,
-        id: channelData.id || 0,  // ID yoksa 0 gönder
+        // Favorilerde kanal ID'si channel_id alanındadır, kanal listeden çıktıysa 0'dır
+        id: (channelData.channel_id !== undefined ? channelData.channel_id : channelData.id) || 0,  // ID yoksa 0 gönder
         stream_type: streamType
       };
       
@@ -434,7 +454,26 @@ function App() {
   const handleUpdateChannels = async () => {
     try {
       setLoading(true);
-      await axios.post('/api/xtream/update');
+      let job: SyncJob;
+      try {
+        const response = await axios.post<SyncJob>('/api/xtream/update');
+        job = response.data;
+      } catch (error: any) {
+        // Başka bir senkronizasyon sürüyorsa hata değildir, o iş beklenir
+        if (error.response?.status !== 409 || !error.response.data?.job) {
+          throw error;
+        }
+        job = error.response.data.job;
+      }
+      job = await waitForSyncJob(job);
+      if (job.status === 'failed') {
+        setError(`Kanallar güncellenirken bir hata oluştu: ${job.error || 'bilinmeyen hata'}`);
+      } else if (job.status === 'cancelled') {
+        setError('Kanal güncellemesi iptal edildi.');
+      } else {
+        setError(null);
+      }
+
       // Tüm kategorileri yeniden yükle
       await fetchCategories();
       // Tüm kanalları yeniden yükle
@@ -448,7 +487,6 @@ function App() {
           await fetchFavorites();
         }
       }
-      setError(null);
     } catch (error: any) {
       if (error.response?.data?.error === 'xtream_settings_required') {
         setSettingsOpen(true);